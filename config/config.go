@@ -33,6 +33,29 @@ type Config struct {
 	GoogleClientSecret           string `envconfig:"google_client_secret"`
 	GoogleRedirectURL            string `envconfig:"google_redirect_url"`
 	GoogleApplicationCredentials string `envconfig:"google_application_credentials"`
+	// PushTransport selects how push notifications are sent, "fcm" or "fake" for local development and tests
+	PushTransport string `envconfig:"push_transport" default:"fcm"`
+	// FakePushFile is where the fake push transport appends the notifications it delivers, as JSON lines
+	FakePushFile string `envconfig:"fake_push_file"`
+	// RunJobs runs the background jobs inside the api process, disable it when running a separate worker
+	RunJobs bool `envconfig:"run_jobs" default:"true"`
+	// MissedDoseGraceMinutes is how long after it is due an unconfirmed dose is marked as missed,
+	// unless its medication sets its own
+	MissedDoseGraceMinutes int `envconfig:"missed_dose_grace_minutes" default:"120"`
+	// LoginLockoutThreshold is how many wrong passwords in a row lock an account out for LoginLockoutMinutes
+	LoginLockoutThreshold int `envconfig:"login_lockout_threshold" default:"10"`
+	LoginLockoutMinutes   int `envconfig:"login_lockout_minutes" default:"30"`
+	// LoginIPFailureLimit is how many failed logins an IP address can make in an hour, whatever the accounts
+	LoginIPFailureLimit int `envconfig:"login_ip_failure_limit" default:"50"`
+	// SMSProvider selects how text messages are sent, "http" or "console" to drop them outside production
+	SMSProvider string `envconfig:"sms_provider" default:"console"`
+	// SMSProviderURL is where the http provider posts messages to, authenticated with SMSProviderAPIKey
+	SMSProviderURL    string `envconfig:"sms_provider_url"`
+	SMSProviderAPIKey string `envconfig:"sms_provider_api_key"`
+	// SMSFrom is the sender id or number text messages are sent from
+	SMSFrom string `envconfig:"sms_from" default:"Meddle"`
+	// RequireVerifiedPhoneForSMS only lets users turn on SMS reminders once their phone number is verified
+	RequireVerifiedPhoneForSMS bool `envconfig:"require_verified_phone_for_sms" default:"true"`
 }
 
 func Load() (*Config, error) {
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/admin_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db AdminRepository
+
+type AdminRepository interface {
+	GetUsers(filter *models.UserFilter) ([]models.User, error)
+	SetUserDisabled(userID uint, disabledAt *time.Time) error
+	RequirePasswordReset(userID uint) error
+	UpdateUserRole(userID uint, role string) error
+	GetUserCounts(since time.Time) (*models.UserCounts, error)
+	CountDevices() (int64, error)
+	GetPushDeliveryCounts(since time.Time) ([]models.PushDeliveryCount, error)
+	GetJobStats(since time.Time) ([]models.JobStats, error)
+}
+
+type adminRepo struct {
+	DB *gorm.DB
+}
+
+func NewAdminRepo(db *GormDB) AdminRepository {
+	return &adminRepo{db.DB}
+}
+
+// GetUsers returns a page of users matching the filter, newest first
+func (a *adminRepo) GetUsers(filter *models.UserFilter) ([]models.User, error) {
+	query := a.DB.Model(&models.User{})
+	if filter.Search != "" {
+		search := "%" + filter.Search + "%"
+		query = query.Where("name ILIKE ? OR email ILIKE ? OR phone_number ILIKE ?", search, search, search)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	switch filter.Status {
+	case "active":
+		query = query.Where("is_email_active = ? AND disabled_at IS NULL", true)
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	case "unverified":
+		query = query.Where("is_email_active = ?", false)
+	}
+	if filter.After != nil {
+		query = query.Where("id < ?", filter.After.ID)
+	}
+
+	var users []models.User
+	err := query.Order("id DESC").Limit(filter.Limit).Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get users: %v", err)
+	}
+	return users, nil
+}
+
+// SetUserDisabled disables the user at disabledAt, or enables them again when it is nil.
+// Disabling a user also revokes their refresh tokens, so that they are signed out everywhere.
+func (a *adminRepo) SetUserDisabled(userID uint, disabledAt *time.Time) error {
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		err := updateUser(tx, userID, map[string]interface{}{"disabled_at": disabledAt})
+		if err != nil || disabledAt == nil {
+			return err
+		}
+		return revokeRefreshTokens(tx, userID)
+	})
+	if err != nil {
+		return fmt.Errorf("could not update user disabled status: %w", err)
+	}
+	return nil
+}
+
+// RequirePasswordReset blocks logging in with the current password of the user and signs them out everywhere
+func (a *adminRepo) RequirePasswordReset(userID uint) error {
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		err := updateUser(tx, userID, map[string]interface{}{"password_reset_required": true})
+		if err != nil {
+			return err
+		}
+		return revokeRefreshTokens(tx, userID)
+	})
+	if err != nil {
+		return fmt.Errorf("could not require password reset: %w", err)
+	}
+	return nil
+}
+
+func (a *adminRepo) UpdateUserRole(userID uint, role string) error {
+	err := updateUser(a.DB, userID, map[string]interface{}{"role": role})
+	if err != nil {
+		return fmt.Errorf("could not update user role: %w", err)
+	}
+	return nil
+}
+
+// GetUserCounts counts the users, and those who signed up since the given time
+func (a *adminRepo) GetUserCounts(since time.Time) (*models.UserCounts, error) {
+	var counts models.UserCounts
+	err := a.DB.Model(&models.User{}).Select(`COUNT(*) AS total,
+		COUNT(*) FILTER (WHERE NOT is_email_active) AS unverified,
+		COUNT(*) FILTER (WHERE disabled_at IS NOT NULL) AS disabled,
+		COUNT(*) FILTER (WHERE created_at >= ?) AS signed_up`, since.Unix()).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not count users: %v", err)
+	}
+	return &counts, nil
+}
+
+func (a *adminRepo) CountDevices() (int64, error) {
+	var count int64
+	err := a.DB.Model(&models.FCMNotificationToken{}).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not count devices: %v", err)
+	}
+	return count, nil
+}
+
+// GetPushDeliveryCounts counts the push deliveries attempted since the given time by category and status
+func (a *adminRepo) GetPushDeliveryCounts(since time.Time) ([]models.PushDeliveryCount, error) {
+	var counts []models.PushDeliveryCount
+	err := a.DB.Model(&models.PushDelivery{}).
+		Select("category, status, COUNT(*) AS count").
+		Where("created_at >= ?", since.Unix()).
+		Group("category, status").Order("category, status").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not count push deliveries: %v", err)
+	}
+	return counts, nil
+}
+
+// GetJobStats summarizes the runs of every background job started since the given time
+func (a *adminRepo) GetJobStats(since time.Time) ([]models.JobStats, error) {
+	var stats []models.JobStats
+	err := a.DB.Model(&models.JobRun{}).
+		Select(`job_name,
+			COUNT(*) AS runs,
+			COUNT(*) FILTER (WHERE error <> '') AS failures,
+			COALESCE(SUM(processed_count), 0) AS processed,
+			COALESCE(AVG(EXTRACT(EPOCH FROM finished_at - started_at)), 0) AS average_seconds,
+			MAX(started_at) AS last_started_at,
+			COALESCE((ARRAY_AGG(error ORDER BY started_at DESC) FILTER (WHERE error <> ''))[1], '') AS last_error,
+			MAX(started_at) FILTER (WHERE error <> '') AS last_error_at,
+			COUNT(*) FILTER (WHERE finished_at IS NULL) AS unfinished_count`).
+		Where("started_at >= ?", since).
+		Group("job_name").Order("job_name").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get job stats: %v", err)
+	}
+	return stats, nil
+}
+
+// updateUser updates columns of the user, gorm.ErrRecordNotFound is returned when there is no such user
+func updateUser(tx *gorm.DB, userID uint, columns map[string]interface{}) error {
+	result := tx.Model(&models.User{}).Where("id = ?", userID).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// revokeRefreshTokens signs the user out everywhere, revoking their sessions along with their refresh tokens
+func revokeRefreshTokens(tx *gorm.DB, userID uint) error {
+	now := time.Now().Unix()
+	err := tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at = 0", userID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at = 0", userID).
+		Update("revoked_at", now).Error
+}
@@ -2,10 +2,13 @@ package db
 
 import (
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/decagonhq/meddle-api/models"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DB provides access to the different db
@@ -17,21 +20,44 @@ type AuthRepository interface {
 	IsPhoneExist(email string) error
 	FindUserByUsername(username string) (*models.User, error)
 	FindUserByEmail(email string) (*models.User, error)
-	UpdateUser(user *models.User) error
+	FindUserByID(id uint) (*models.User, error)
+	UpdateUser(user *models.User, timezoneChange *models.TimezoneChange) error
 	AddToBlackList(blacklist *models.BlackList) error
 	TokenInBlacklist(token string) bool
-	VerifyEmail(email string, token string) error
+	VerifyEmail(userID uint, email string) error
+	FindUserToVerify(email string) (*models.User, error)
+	SetVerificationSentAt(userID uint, sentAt int64) error
 	IsTokenInBlacklist(token string) error
+	PurgeBlacklist(before int64) (int64, error)
+	ConsumeToken(blacklist *models.BlackList) error
 	UpdatePassword(password string, email string) error
 	DeleteUserByEmail(email string) error
+	CreateRefreshToken(refreshToken *models.RefreshToken) error
+	FindRefreshToken(tokenID string) (*models.RefreshToken, error)
+	RotateRefreshToken(oldTokenID string, newToken *models.RefreshToken) error
+	RevokeRefreshTokenFamily(familyID string) error
+	CreateSession(session *models.Session) error
+	FindSession(id uint) (*models.Session, error)
+	TouchSession(id uint, usedAt int64) error
+	ExtendSession(id uint, expiresAt int64) error
+	GetActiveSessions(userID uint) ([]models.Session, error)
+	RevokeSession(userID, sessionID uint) error
+	RevokeSessions(userID uint) error
 }
 
+// ErrRefreshTokenReused is returned when a refresh token that has already been rotated is presented again
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// ErrTokenUsed is returned by ConsumeToken when the single-use token was consumed before
+var ErrTokenUsed = errors.New("token has already been used")
+
 type authRepo struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	revoked *revocationCache
 }
 
 func NewAuthRepo(db *GormDB) AuthRepository {
-	return &authRepo{db.DB}
+	return &authRepo{DB: db.DB, revoked: newRevocationCache()}
 }
 
 func (a *authRepo) CreateUser(user *models.User) (*models.User, error) {
@@ -52,9 +78,10 @@ func (a *authRepo) FindUserByUsername(username string) (*models.User, error) {
 	return user, nil
 }
 
+// IsEmailExist fails when the email belongs to a user, or a user is changing to it
 func (a *authRepo) IsEmailExist(email string) error {
 	var count int64
-	err := a.DB.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
+	err := a.DB.Model(&models.User{}).Where("email = ? OR pending_email = ?", email, email).Count(&count).Error
 	if err != nil {
 		return errors.Wrap(err, "gorm.count error")
 	}
@@ -85,72 +112,337 @@ func (a *authRepo) FindUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-func (a *authRepo) UpdateUser(user *models.User) error {
+func (a *authRepo) FindUserByID(id uint) (*models.User, error) {
+	var user models.User
+	err := a.DB.Where("id = ?", id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser saves the editable profile fields of the user, along with their medications moved to a new timezone
+// when timezoneChange is set
+func (a *authRepo) UpdateUser(user *models.User, timezoneChange *models.TimezoneChange) error {
+	// phone numbers are unique, so an unset phone number has to stay null
+	var phoneNumber interface{}
+	if user.PhoneNumber != "" {
+		phoneNumber = user.PhoneNumber
+	}
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"name":                           user.Name,
+			"phone_number":                   phoneNumber,
+			"phone_verified_at":              user.PhoneVerifiedAt,
+			"pending_email":                  user.PendingEmail,
+			"verification_sent_at":           user.VerificationSentAt,
+			"timezone":                       user.Timezone,
+			"avatar_url":                     user.AvatarURL,
+			"preference_push_notifications":  user.Preferences.PushNotifications,
+			"preference_email_notifications": user.Preferences.EmailNotifications,
+			"preference_sms_notifications":   user.Preferences.SMSNotifications,
+			"preference_language":            user.Preferences.Language,
+		}).Error
+		if err != nil || timezoneChange == nil {
+			return err
+		}
+		for i := range timezoneChange.Medications {
+			if err := changeMedicationTimezone(tx, &timezoneChange.Medications[i], timezoneChange.From); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not update user: %v", err)
+	}
 	return nil
 }
 
+// AddToBlackList revokes the token of the entry until it expires. Revoking a token twice is not an error.
 func (a *authRepo) AddToBlackList(blacklist *models.BlackList) error {
-	result := a.DB.Create(blacklist)
-	return result.Error
+	blacklist.TokenHash = models.HashToken(blacklist.Token)
+	result := a.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(blacklist)
+	if result.Error != nil {
+		return result.Error
+	}
+	a.revoked.add(blacklist.TokenHash, blacklist.ExpiresAt)
+	return nil
+}
+
+// ConsumeToken marks a single-use token as used. Only the first of concurrent consumers inserts the entry,
+// every other one gets ErrTokenUsed.
+func (a *authRepo) ConsumeToken(blacklist *models.BlackList) error {
+	blacklist.TokenHash = models.HashToken(blacklist.Token)
+	if a.revoked.contains(blacklist.TokenHash) {
+		return ErrTokenUsed
+	}
+	result := a.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(blacklist)
+	if result.Error != nil {
+		return fmt.Errorf("could not consume token: %v", result.Error)
+	}
+	a.revoked.add(blacklist.TokenHash, blacklist.ExpiresAt)
+	if result.RowsAffected == 0 {
+		return ErrTokenUsed
+	}
+	return nil
+}
+
+// isRevoked looks the token up by its hash. Revocations are cached, as they hold until the token expires.
+func (a *authRepo) isRevoked(token string) (bool, error) {
+	tokenHash := models.HashToken(token)
+	if a.revoked.contains(tokenHash) {
+		return true, nil
+	}
+	var blacklist models.BlackList
+	err := a.DB.Select("token_hash", "expires_at").Where("token_hash = ?", tokenHash).Limit(1).Find(&blacklist).Error
+	if err != nil {
+		return false, err
+	}
+	if blacklist.TokenHash == "" {
+		return false, nil
+	}
+	a.revoked.add(tokenHash, blacklist.ExpiresAt)
+	return true, nil
 }
 
+// TokenInBlacklist reports whether the token was revoked, tokens are considered revoked when that can not be checked
 func (a *authRepo) TokenInBlacklist(token string) bool {
-	result := a.DB.Where("token = ?", token).Find(&models.BlackList{})
-	return result.Error != nil
+	revoked, err := a.isRevoked(token)
+	if err != nil {
+		log.Printf("error checking token blacklist: %v", err)
+		return true
+	}
+	return revoked
 }
 
-func (a *authRepo) VerifyEmail(email string, token string) error {
-	err := a.DB.Model(&models.User{}).Where("email = ?", email).Updates(models.User{IsEmailActive: true}).Error
+// PurgeBlacklist deletes the entries of tokens that expired before the given unix time
+func (a *authRepo) PurgeBlacklist(before int64) (int64, error) {
+	// entries from before hashes were stored can not match any token anymore
+	result := a.DB.Unscoped().Where("expires_at < ? OR token_hash IS NULL", before).Delete(&models.BlackList{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not purge blacklist: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// VerifyEmail marks the email of the user verified
+func (a *authRepo) VerifyEmail(userID uint, email string) error {
+	err := a.DB.Model(&models.User{}).Where("id = ? AND email = ?", userID, email).Updates(models.User{IsEmailActive: true}).Error
 	if err != nil {
 		return err
 	}
 
-	err = a.AddToBlackList(&models.BlackList{Token: token})
+	// a verified pending email replaces the user's current email
+	err = a.DB.Model(&models.User{}).Where("id = ? AND pending_email = ?", userID, email).
+		Updates(map[string]interface{}{"email": email, "pending_email": "", "is_email_active": true}).Error
 	return err
 }
 
+// FindUserToVerify finds the user an email verification link was sent to, which is either their email
+// or the new email they are changing to
+func (a *authRepo) FindUserToVerify(email string) (*models.User, error) {
+	var user models.User
+	err := a.DB.Where("email = ? OR pending_email = ?", email, email).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetVerificationSentAt invalidates the verification links sent to the user before sentAt
+func (a *authRepo) SetVerificationSentAt(userID uint, sentAt int64) error {
+	err := a.DB.Model(&models.User{}).Where("id = ?", userID).Update("verification_sent_at", sentAt).Error
+	if err != nil {
+		return fmt.Errorf("could not update verification of user %v: %v", userID, err)
+	}
+	return nil
+}
+
 func (a *authRepo) IsTokenInBlacklist(token string) error {
-	var count int64
-	err := a.DB.Model(&models.BlackList{}).Where("token = ?", token).Count(&count).Error
+	revoked, err := a.isRevoked(token)
 	if err != nil {
-		return errors.Wrap(err, "gorm.count error")
+		return errors.Wrap(err, "gorm.find error")
 	}
-	if count > 0 {
+	if revoked {
 		return fmt.Errorf("token expired, request a new link")
 	}
 	return nil
 }
 
+// UpdatePassword sets the password of the user, which also lifts a password reset required by an admin
 func (a *authRepo) UpdatePassword(password string, email string) error {
-	err := a.DB.Model(&models.User{}).Where("email = ?", email).Updates(models.User{HashedPassword: password}).Error
+	err := a.DB.Model(&models.User{}).Where("email = ?", email).
+		Updates(map[string]interface{}{"hashed_password": password, "password_reset_required": false}).Error
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// DeleteUserByEmail deletes the user along with every row that belongs to them, all or nothing
 func (a *authRepo) DeleteUserByEmail(email string) error {
-	user := &models.User{}
-	err := a.DB.Where("email = ?", email).Find(user).Error
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		user := &models.User{}
+		if err := tx.Where("email = ?", email).First(user).Error; err != nil {
+			return fmt.Errorf("could not find user to delete: %v", err)
+		}
+
+		rows := []struct {
+			name  string
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{"medications", &models.Medication{}, "user_id = ?", []interface{}{user.ID}},
+			{"medication history", &models.MedicationHistory{}, "user_id = ?", []interface{}{user.ID}},
+			{"dose occurrences", &models.DoseOccurrence{}, "user_id = ?", []interface{}{user.ID}},
+			{"devices", &models.FCMNotificationToken{}, "user_id = ?", []interface{}{user.ID}},
+			{"care shares", &models.CareShare{}, "patient_id = ? OR caregiver_id = ? OR caregiver_email = ?", []interface{}{user.ID, user.ID, user.Email}},
+			{"dependents", &models.Dependent{}, "owner_id = ?", []interface{}{user.ID}},
+			{"revoked tokens", &models.BlackList{}, "email = ?", []interface{}{user.Email}},
+			{"refresh tokens", &models.RefreshToken{}, "email = ?", []interface{}{user.Email}},
+			{"security events", &models.SecurityEvent{}, "user_id = ?", []interface{}{user.ID}},
+			{"recovery codes", &models.RecoveryCode{}, "user_id = ?", []interface{}{user.ID}},
+			{"sessions", &models.Session{}, "user_id = ?", []interface{}{user.ID}},
+			{"phone verifications", &models.PhoneVerification{}, "user_id = ?", []interface{}{user.ID}},
+		}
+		for _, row := range rows {
+			if err := tx.Where(row.query, row.args...).Delete(row.model).Error; err != nil {
+				return fmt.Errorf("could not delete user's %s: %v", row.name, err)
+			}
+		}
+
+		if err := tx.Delete(&models.User{}, user.ID).Error; err != nil {
+			return fmt.Errorf("could not delete user: %v", err)
+		}
+		return nil
+	})
+}
+
+func (a *authRepo) CreateRefreshToken(refreshToken *models.RefreshToken) error {
+	err := a.DB.Create(refreshToken).Error
+	if err != nil {
+		return fmt.Errorf("could not create refresh token: %v", err)
+	}
+	return nil
+}
+
+func (a *authRepo) FindRefreshToken(tokenID string) (*models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	err := a.DB.Where("token_id = ?", tokenID).First(&refreshToken).Error
+	if err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+// RotateRefreshToken revokes the old refresh token and stores its replacement in one transaction.
+// Only a token that has not been revoked yet can be rotated, so two concurrent refreshes
+// with the same token cannot both succeed.
+func (a *authRepo) RotateRefreshToken(oldTokenID string, newToken *models.RefreshToken) error {
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("token_id = ? AND revoked_at = 0", oldTokenID).
+			Updates(map[string]interface{}{"revoked_at": time.Now().Unix(), "replaced_by": newToken.TokenID})
+		if result.Error != nil {
+			return fmt.Errorf("could not revoke refresh token: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		if err := tx.Create(newToken).Error; err != nil {
+			return fmt.Errorf("could not create refresh token: %v", err)
+		}
+		return nil
+	})
+}
+
+func (a *authRepo) RevokeRefreshTokenFamily(familyID string) error {
+	err := a.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at = 0", familyID).
+		Update("revoked_at", time.Now().Unix()).Error
+	if err != nil {
+		return fmt.Errorf("could not revoke refresh token family: %v", err)
+	}
+	return nil
+}
+
+func (a *authRepo) CreateSession(session *models.Session) error {
+	err := a.DB.Create(session).Error
+	if err != nil {
+		return fmt.Errorf("could not create session: %v", err)
+	}
+	return nil
+}
+
+func (a *authRepo) FindSession(id uint) (*models.Session, error) {
+	var session models.Session
+	err := a.DB.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchSession records that the session was used to make a request
+func (a *authRepo) TouchSession(id uint, usedAt int64) error {
+	err := a.DB.Model(&models.Session{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt).Error
 	if err != nil {
-		return fmt.Errorf("could not find user to delete: %v", err)
+		return fmt.Errorf("could not touch session: %v", err)
 	}
-	err = a.DB.Delete(&models.Medication{}, "user_id = ?", user.ID).Error
+	return nil
+}
+
+// ExtendSession keeps the session going until its new refresh token expires
+func (a *authRepo) ExtendSession(id uint, expiresAt int64) error {
+	err := a.DB.Model(&models.Session{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_used_at": time.Now().Unix(), "expires_at": expiresAt}).Error
 	if err != nil {
-		return fmt.Errorf("could not delete user's medication: %v", err)
+		return fmt.Errorf("could not extend session: %v", err)
 	}
-	err = a.DB.Delete(&models.MedicationHistory{}, "user_id = ?", user.ID).Error
+	return nil
+}
+
+// GetActiveSessions returns the sessions of the user that are neither revoked nor expired, most recently used first
+func (a *authRepo) GetActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := a.DB.Where("user_id = ? AND revoked_at = 0 AND expires_at > ?", userID, time.Now().Unix()).
+		Order("last_used_at DESC").Find(&sessions).Error
 	if err != nil {
-		return fmt.Errorf("could not delete user's medication history: %v", err)
+		return nil, fmt.Errorf("could not get sessions: %v", err)
 	}
-	err = a.DB.Delete(&models.BlackList{}, "email = ?", user.Email).Error
+	return sessions, nil
+}
+
+// RevokeSession signs the user out of one of their sessions, gorm.ErrRecordNotFound is returned when
+// the user has no such active session
+func (a *authRepo) RevokeSession(userID, sessionID uint) error {
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Session{}).Where("id = ? AND user_id = ? AND revoked_at = 0", sessionID, userID).
+			Update("revoked_at", time.Now().Unix())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.RefreshToken{}).Where("session_id = ? AND revoked_at = 0", sessionID).
+			Update("revoked_at", time.Now().Unix()).Error
+	})
 	if err != nil {
-		return fmt.Errorf("could not delete user's medication: %v", err)
+		return fmt.Errorf("could not revoke session: %w", err)
 	}
+	return nil
+}
 
-	err = a.DB.Delete(&models.User{}, "email = ?", email).Error
+// RevokeSessions signs the user out everywhere
+func (a *authRepo) RevokeSessions(userID uint) error {
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeRefreshTokens(tx, userID)
+	})
 	if err != nil {
-		return fmt.Errorf("could not delete user: %v", err)
+		return fmt.Errorf("could not revoke sessions: %v", err)
 	}
 	return nil
 }
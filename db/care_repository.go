@@ -0,0 +1,160 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/care_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db CareRepository
+
+type CareRepository interface {
+	CreateCareShare(careShare *models.CareShare) (*models.CareShare, error)
+	FindCareShareByCaregiverEmail(patientID uint, email string) (*models.CareShare, error)
+	FindAcceptedCareShare(patientID uint, caregiverID uint) (*models.CareShare, error)
+	GetCareSharesByPatient(patientID uint) ([]models.CareShare, error)
+	GetCareSharesByCaregiver(caregiverID uint) ([]models.CareShare, error)
+	GetPendingCareInvitations(email string) ([]models.CareShare, error)
+	AcceptCareShare(careShareID uint, caregiverID uint, email string) (*models.CareShare, error)
+	DeleteCareShareByPatient(careShareID uint, patientID uint) error
+	DeleteCareShareByCaregiver(patientID uint, caregiverID uint) error
+	GetMissedDoseCaregivers(patientID uint) ([]models.User, error)
+}
+
+type careRepo struct {
+	DB *gorm.DB
+}
+
+func NewCareRepo(db *GormDB) CareRepository {
+	return &careRepo{db.DB}
+}
+
+func (c *careRepo) CreateCareShare(careShare *models.CareShare) (*models.CareShare, error) {
+	err := c.DB.Create(careShare).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not create care share: %v", err)
+	}
+	return careShare, nil
+}
+
+// FindCareShareByCaregiverEmail finds the pending or accepted share of the patient addressed to the email
+func (c *careRepo) FindCareShareByCaregiverEmail(patientID uint, email string) (*models.CareShare, error) {
+	var careShare models.CareShare
+	err := c.DB.Where("patient_id = ? AND caregiver_email = ? AND deleted_at = 0", patientID, email).First(&careShare).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find care share: %w", err)
+	}
+	return &careShare, nil
+}
+
+// FindAcceptedCareShare finds the share through which the caregiver looks after the patient
+func (c *careRepo) FindAcceptedCareShare(patientID uint, caregiverID uint) (*models.CareShare, error) {
+	var careShare models.CareShare
+	err := c.DB.Preload("Patient").
+		Where("patient_id = ? AND caregiver_id = ? AND accepted_at IS NOT NULL AND deleted_at = 0", patientID, caregiverID).
+		First(&careShare).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find care share: %w", err)
+	}
+	return &careShare, nil
+}
+
+// GetCareSharesByPatient returns the caregivers of the patient, pending invitations included
+func (c *careRepo) GetCareSharesByPatient(patientID uint) ([]models.CareShare, error) {
+	var careShares []models.CareShare
+	err := c.DB.Preload("Caregiver").
+		Where("patient_id = ? AND deleted_at = 0", patientID).
+		Order("id ASC").Find(&careShares).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get care shares of patient: %v", err)
+	}
+	return careShares, nil
+}
+
+// GetCareSharesByCaregiver returns the patients the caregiver looks after
+func (c *careRepo) GetCareSharesByCaregiver(caregiverID uint) ([]models.CareShare, error) {
+	var careShares []models.CareShare
+	err := c.DB.Preload("Patient").
+		Where("caregiver_id = ? AND accepted_at IS NOT NULL AND deleted_at = 0", caregiverID).
+		Order("id ASC").Find(&careShares).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get care shares of caregiver: %v", err)
+	}
+	return careShares, nil
+}
+
+// GetPendingCareInvitations returns the invitations addressed to the email that have not been accepted yet
+func (c *careRepo) GetPendingCareInvitations(email string) ([]models.CareShare, error) {
+	var careShares []models.CareShare
+	err := c.DB.Preload("Patient").
+		Where("caregiver_email = ? AND accepted_at IS NULL AND deleted_at = 0", email).
+		Order("id ASC").Find(&careShares).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get pending care invitations: %v", err)
+	}
+	return careShares, nil
+}
+
+// AcceptCareShare ties the pending invitation addressed to the email to the caregiver
+func (c *careRepo) AcceptCareShare(careShareID uint, caregiverID uint, email string) (*models.CareShare, error) {
+	var careShare models.CareShare
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.CareShare{}).
+			Where("id = ? AND caregiver_email = ? AND accepted_at IS NULL AND deleted_at = 0", careShareID, email).
+			Updates(map[string]interface{}{"caregiver_id": caregiverID, "accepted_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Preload("Patient").First(&careShare, careShareID).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not accept care share: %w", err)
+	}
+	return &careShare, nil
+}
+
+// DeleteCareShareByPatient revokes a caregiver, or withdraws a pending invitation, of the patient
+func (c *careRepo) DeleteCareShareByPatient(careShareID uint, patientID uint) error {
+	result := c.DB.Model(&models.CareShare{}).
+		Where("id = ? AND patient_id = ? AND deleted_at = 0", careShareID, patientID).
+		Update("deleted_at", time.Now().Unix())
+	if result.Error != nil {
+		return fmt.Errorf("could not delete care share: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not delete care share: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// DeleteCareShareByCaregiver stops the caregiver looking after the patient
+func (c *careRepo) DeleteCareShareByCaregiver(patientID uint, caregiverID uint) error {
+	result := c.DB.Model(&models.CareShare{}).
+		Where("patient_id = ? AND caregiver_id = ? AND deleted_at = 0", patientID, caregiverID).
+		Update("deleted_at", time.Now().Unix())
+	if result.Error != nil {
+		return fmt.Errorf("could not delete care share: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not delete care share: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// GetMissedDoseCaregivers returns the caregivers of the patient who asked to be told about missed doses
+func (c *careRepo) GetMissedDoseCaregivers(patientID uint) ([]models.User, error) {
+	var caregivers []models.User
+	err := c.DB.Model(&models.User{}).
+		Joins("JOIN care_shares ON care_shares.caregiver_id = users.id").
+		Where("care_shares.patient_id = ? AND care_shares.notify_missed_doses AND care_shares.accepted_at IS NOT NULL AND care_shares.deleted_at = 0", patientID).
+		Find(&caregivers).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get missed dose caregivers: %v", err)
+	}
+	return caregivers, nil
+}
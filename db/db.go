@@ -33,7 +33,7 @@ func (g *GormDB) Init(c *config.Config) {
 
 func getPostgresDB(c *config.Config) *gorm.DB {
 	log.Printf("Connecting to postgres: %+v", c)
-	postgresDSN := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d TimeZone=Africa/Lagos",
+	postgresDSN := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d TimeZone=UTC",
 		c.PostgresHost, c.PostgresUser, c.PostgresPassword, c.PostgresDB, c.PostgresPort)
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
@@ -58,7 +58,7 @@ func getPostgresDB(c *config.Config) *gorm.DB {
 }
 
 func migrate(db *gorm.DB) error {
-	err := db.AutoMigrate(&models.User{}, &models.BlackList{}, &models.Medication{}, &models.FCMNotificationToken{}, &models.MedicationHistory{})
+	err := db.AutoMigrate(&models.User{}, &models.BlackList{}, &models.Medication{}, &models.FCMNotificationToken{}, &models.MedicationHistory{}, &models.RefreshToken{}, &models.DoseOccurrence{}, &models.JobRun{}, &models.PushDelivery{}, &models.CareShare{}, &models.Dependent{}, &models.SecurityEvent{}, &models.RateLimit{}, &models.RecoveryCode{}, &models.Session{}, &models.PhoneVerification{})
 	if err != nil {
 		return fmt.Errorf("migrations error: %v", err)
 	}
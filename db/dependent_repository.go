@@ -0,0 +1,90 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/dependent_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db DependentRepository
+
+type DependentRepository interface {
+	CreateDependent(dependent *models.Dependent) (*models.Dependent, error)
+	GetDependents(ownerID uint) ([]models.Dependent, error)
+	FindDependent(dependentID uint, ownerID uint) (*models.Dependent, error)
+	UpdateDependent(dependent *models.Dependent) error
+	DeleteDependent(dependentID uint, ownerID uint) error
+}
+
+type dependentRepo struct {
+	DB *gorm.DB
+}
+
+func NewDependentRepo(db *GormDB) DependentRepository {
+	return &dependentRepo{db.DB}
+}
+
+func (d *dependentRepo) CreateDependent(dependent *models.Dependent) (*models.Dependent, error) {
+	err := d.DB.Create(dependent).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not create dependent: %v", err)
+	}
+	return dependent, nil
+}
+
+func (d *dependentRepo) GetDependents(ownerID uint) ([]models.Dependent, error) {
+	var dependents []models.Dependent
+	err := d.DB.Where("owner_id = ? AND deleted_at = 0", ownerID).Order("id ASC").Find(&dependents).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get dependents: %v", err)
+	}
+	return dependents, nil
+}
+
+func (d *dependentRepo) FindDependent(dependentID uint, ownerID uint) (*models.Dependent, error) {
+	var dependent models.Dependent
+	err := d.DB.Where("id = ? AND owner_id = ? AND deleted_at = 0", dependentID, ownerID).First(&dependent).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find dependent: %w", err)
+	}
+	return &dependent, nil
+}
+
+func (d *dependentRepo) UpdateDependent(dependent *models.Dependent) error {
+	err := d.DB.Model(dependent).Select("name", "relationship", "date_of_birth").Updates(dependent).Error
+	if err != nil {
+		return fmt.Errorf("could not update dependent: %v", err)
+	}
+	return nil
+}
+
+// DeleteDependent deletes the dependent along with its medications, whose history stays available
+func (d *dependentRepo) DeleteDependent(dependentID uint, ownerID uint) error {
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		deletedAt := time.Now().Unix()
+		result := tx.Model(&models.Dependent{}).
+			Where("id = ? AND owner_id = ? AND deleted_at = 0", dependentID, ownerID).
+			Update("deleted_at", deletedAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Model(&models.Medication{}).
+			Where("dependent_id = ? AND deleted_at = 0", dependentID).
+			Update("deleted_at", deletedAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("recorded_at IS NULL AND medication_id IN (?)",
+			tx.Model(&models.Medication{}).Select("id").Where("dependent_id = ?", dependentID)).
+			Delete(&models.DoseOccurrence{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete dependent: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/job_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db JobRepository
+
+type JobRepository interface {
+	WithJobLock(jobName string, fn func() error) (bool, error)
+	CreateJobRun(run *models.JobRun) error
+	FinishJobRun(run *models.JobRun) error
+}
+
+type jobRepo struct {
+	DB *gorm.DB
+}
+
+func NewJobRepo(db *GormDB) JobRepository {
+	return &jobRepo{db.DB}
+}
+
+// WithJobLock runs fn while holding a Postgres advisory lock named after the job, so that only one
+// replica runs a job at a time. It returns false without running fn when another replica holds the lock.
+// The lock belongs to a transaction kept open while fn runs and is released when it ends.
+func (j *jobRepo) WithJobLock(jobName string, fn func() error) (bool, error) {
+	acquired := false
+	err := j.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", jobName).Scan(&acquired).Error
+		if err != nil {
+			return fmt.Errorf("could not acquire job lock: %v", err)
+		}
+		if !acquired {
+			return nil
+		}
+		return fn()
+	})
+	return acquired, err
+}
+
+func (j *jobRepo) CreateJobRun(run *models.JobRun) error {
+	err := j.DB.Create(run).Error
+	if err != nil {
+		return fmt.Errorf("could not create job run: %v", err)
+	}
+	return nil
+}
+
+func (j *jobRepo) FinishJobRun(run *models.JobRun) error {
+	err := j.DB.Model(run).Updates(map[string]interface{}{
+		"finished_at":     run.FinishedAt,
+		"error":           run.Error,
+		"processed_count": run.ProcessedCount,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not finish job run: %v", err)
+	}
+	return nil
+}
@@ -1,17 +1,34 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"time"
+
 	"github.com/decagonhq/meddle-api/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MedicationHistoryRepository interface {
 	CreateMedicationHistory(medicationHistory *models.MedicationHistory) (*models.MedicationHistory, error)
 	UpdateMedicationHistory(hasMedicationBeenTaken bool, wasMedicationMissed string, medicationHistoryID uint, userID uint) error
-	GetAllMedicationHistoryByUserID(userID uint) ([]models.MedicationHistory, error)
+	GetAllMedicationHistoryByUserID(userID uint, filter *models.MedicationHistoryFilter) ([]models.MedicationHistory, error)
+	FindMedicationHistoryByDoseOccurrence(doseOccurrenceID uint, userID uint) (*models.MedicationHistory, error)
+	SnoozeDoseReminder(doseOccurrenceID uint, userID uint, remindAt time.Time) error
+	GetUnconfirmedMedicationHistories(dueBefore time.Time, afterID uint, limit int) ([]models.MedicationHistory, error)
+	MarkMedicationHistoryMissed(medicationHistoryID uint) (bool, error)
+	UpdateMedicationHistoryEscalation(medicationHistory *models.MedicationHistory) error
+	GetAdherenceByMedication(userID uint, medicationID uint, dependentID *uint, from time.Time, to time.Time) ([]models.MedicationAdherenceCounts, error)
+	GetAdherenceByPeriod(userID uint, medicationID uint, dependentID *uint, period models.AdherencePeriod, timezone string, from time.Time, to time.Time) ([]models.PeriodAdherenceCounts, error)
 }
 
+// adherenceCountColumns count the doses of medication histories by state
+const adherenceCountColumns = "COUNT(*) FILTER (WHERE has_medication_been_taken) AS taken, " +
+	"COUNT(*) FILTER (WHERE was_medication_missed = 'YES' AND NOT has_medication_been_taken) AS missed, " +
+	"COUNT(*) FILTER (WHERE was_medication_missed = 'SKIPPED') AS skipped, " +
+	"COUNT(*) FILTER (WHERE was_medication_missed = '') AS pending"
+
 type medicationHistoryRepo struct {
 	DB *gorm.DB
 }
@@ -28,21 +45,191 @@ func (m *medicationHistoryRepo) CreateMedicationHistory(medicationHistory *model
 	return medicationHistory, nil
 }
 
+// UpdateMedicationHistory confirms a dose. Taking a dose uses its units from the stock of the medication,
+// and undoing it puts them back.
 func (m *medicationHistoryRepo) UpdateMedicationHistory(hasMedicationBeenTaken bool, wasMedicationMissed string, medicationHistoryID uint, userID uint) error {
-	err := m.DB.Model(&models.MedicationHistory{}).Select("has_medication_been_taken", "was_medication_missed").
-		Where("user_id = ? AND id = ?", userID, medicationHistoryID).
-		Updates(models.MedicationHistory{HasMedicationBeenTaken: hasMedicationBeenTaken, WasMedicationMissed: wasMedicationMissed}).Error
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var medicationHistory models.MedicationHistory
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND id = ?", userID, medicationHistoryID).
+			Find(&medicationHistory).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.MedicationHistory{}).Select("has_medication_been_taken", "was_medication_missed").
+			Where("user_id = ? AND id = ?", userID, medicationHistoryID).
+			Updates(models.MedicationHistory{HasMedicationBeenTaken: hasMedicationBeenTaken, WasMedicationMissed: wasMedicationMissed}).Error
+		if err != nil || medicationHistory.ID == 0 || medicationHistory.HasMedicationBeenTaken == hasMedicationBeenTaken {
+			return err
+		}
+
+		stock := gorm.Expr("GREATEST(pill_count - units_per_dose, 0)")
+		if !hasMedicationBeenTaken {
+			stock = gorm.Expr("pill_count + units_per_dose")
+		}
+		// the stock is not an edit of the medication, so its updated_at, which dose scheduling relies on, is kept
+		return tx.Model(&models.Medication{}).
+			Where("id = ? AND pill_count IS NOT NULL", medicationHistory.MedicationID).
+			UpdateColumn("pill_count", stock).Error
+	})
 	if err != nil {
 		return fmt.Errorf("could not update medication history: %v", err)
 	}
 	return nil
 }
 
-func (m *medicationHistoryRepo) GetAllMedicationHistoryByUserID(userID uint) ([]models.MedicationHistory, error) {
+// GetAllMedicationHistoryByUserID returns a page of the medication histories of the user, most recent first by default
+func (m *medicationHistoryRepo) GetAllMedicationHistoryByUserID(userID uint, filter *models.MedicationHistoryFilter) ([]models.MedicationHistory, error) {
+	query := whereDependent(m.DB.Where("user_id = ?", userID), filter.DependentID)
+	if filter.MedicationID != 0 {
+		query = query.Where("medication_id = ?", filter.MedicationID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("medication_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("medication_time < ?", filter.To)
+	}
+	switch filter.Status {
+	case "taken":
+		query = query.Where("has_medication_been_taken = ?", true)
+	case "missed":
+		query = query.Where("was_medication_missed = ? AND has_medication_been_taken = ?", models.MedicationMissed, false)
+	case "skipped":
+		query = query.Where("was_medication_missed = ?", models.MedicationSkipped)
+	case "pending":
+		query = query.Where("was_medication_missed = ''")
+	}
+
+	order, comparison := keysetOrder(filter.Order, models.SortDescending)
+	if filter.After != nil {
+		query = query.Where("(medication_time, id) "+comparison+" (?, ?)", filter.After.MedicationTime, filter.After.ID)
+	}
+
 	var medicationHistories []models.MedicationHistory
-	err := m.DB.Order("medication_time desc").Where("user_id = ?", userID).Find(&medicationHistories).Error
+	err := query.Order("medication_time " + order).Order("id " + order).
+		Limit(filter.Limit).
+		Find(&medicationHistories).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get medication history: %v", err)
 	}
 	return medicationHistories, nil
 }
+
+func (m *medicationHistoryRepo) FindMedicationHistoryByDoseOccurrence(doseOccurrenceID uint, userID uint) (*models.MedicationHistory, error) {
+	var medicationHistory models.MedicationHistory
+	err := m.DB.Where("dose_occurrence_id = ? AND user_id = ?", doseOccurrenceID, userID).First(&medicationHistory).Error
+	if err != nil {
+		return nil, err
+	}
+	return &medicationHistory, nil
+}
+
+// ErrDoseConfirmed is returned by SnoozeDoseReminder when the dose was already taken, skipped or missed
+var ErrDoseConfirmed = errors.New("dose has already been confirmed")
+
+// SnoozeDoseReminder sends the reminder of the dose again at remindAt, as long as the dose is unconfirmed.
+// It returns gorm.ErrRecordNotFound when the user has no such dose, and ErrDoseConfirmed once it was confirmed.
+func (m *medicationHistoryRepo) SnoozeDoseReminder(doseOccurrenceID uint, userID uint, remindAt time.Time) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.DoseOccurrence{}).
+			Where("id = ? AND user_id = ?", doseOccurrenceID, userID).
+			Where("NOT EXISTS (SELECT 1 FROM medication_histories WHERE dose_occurrence_id = dose_occurrences.id AND was_medication_missed <> '')").
+			Updates(map[string]interface{}{"remind_at": remindAt, "notified_at": nil})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		var count int64
+		if err := tx.Model(&models.DoseOccurrence{}).Where("id = ? AND user_id = ?", doseOccurrenceID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return ErrDoseConfirmed
+	})
+	if err != nil {
+		return fmt.Errorf("could not snooze dose reminder: %w", err)
+	}
+	return nil
+}
+
+// GetUnconfirmedMedicationHistories returns up to limit doses due before dueBefore that the user has neither taken nor missed,
+// in the order of their ids after afterID. Most of them stay unconfirmed, so they are paged through by id rather than claimed.
+func (m *medicationHistoryRepo) GetUnconfirmedMedicationHistories(dueBefore time.Time, afterID uint, limit int) ([]models.MedicationHistory, error) {
+	var medicationHistories []models.MedicationHistory
+	err := m.DB.Preload("Dependent").
+		Where("was_medication_missed = '' AND medication_time <= ? AND id > ?", dueBefore, afterID).
+		Order("id").Limit(limit).
+		Find(&medicationHistories).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get unconfirmed medication histories: %v", err)
+	}
+	return medicationHistories, nil
+}
+
+// MarkMedicationHistoryMissed marks the dose as missed unless the user confirmed it in the meantime,
+// it reports whether the dose was marked
+func (m *medicationHistoryRepo) MarkMedicationHistoryMissed(medicationHistoryID uint) (bool, error) {
+	result := m.DB.Model(&models.MedicationHistory{}).
+		Where("id = ? AND was_medication_missed = ''", medicationHistoryID).
+		Updates(map[string]interface{}{"has_medication_been_taken": false, "was_medication_missed": models.MedicationMissed})
+	if result.Error != nil {
+		return false, fmt.Errorf("could not mark medication history missed: %v", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateMedicationHistoryEscalation saves how far the escalation of the dose went
+func (m *medicationHistoryRepo) UpdateMedicationHistoryEscalation(medicationHistory *models.MedicationHistory) error {
+	err := m.DB.Model(&models.MedicationHistory{}).
+		Where("id = ?", medicationHistory.ID).
+		Updates(map[string]interface{}{
+			"nudges_sent":           medicationHistory.NudgesSent,
+			"caregiver_notified_at": medicationHistory.CaregiverNotifiedAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("could not update medication history escalation: %v", err)
+	}
+	return nil
+}
+
+// adherenceQuery selects the medication histories of the user due in [from, to), of a single medication when
+// medicationID is set, and of the dependent dependentID points to, see whereDependent
+func (m *medicationHistoryRepo) adherenceQuery(userID uint, medicationID uint, dependentID *uint, from time.Time, to time.Time) *gorm.DB {
+	query := m.DB.Model(&models.MedicationHistory{}).
+		Where("user_id = ? AND medication_time >= ? AND medication_time < ?", userID, from, to)
+	if medicationID != 0 {
+		query = query.Where("medication_id = ?", medicationID)
+	}
+	return whereDependent(query, dependentID)
+}
+
+// GetAdherenceByMedication counts the doses due in [from, to) by medication
+func (m *medicationHistoryRepo) GetAdherenceByMedication(userID uint, medicationID uint, dependentID *uint, from time.Time, to time.Time) ([]models.MedicationAdherenceCounts, error) {
+	var counts []models.MedicationAdherenceCounts
+	err := m.adherenceQuery(userID, medicationID, dependentID, from, to).
+		Select("medication_id, MAX(medication_name) AS medication_name, " + adherenceCountColumns).
+		Group("medication_id").
+		Order("medication_name").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get adherence by medication: %v", err)
+	}
+	return counts, nil
+}
+
+// GetAdherenceByPeriod counts the doses due in [from, to) by day, week or month of the given timezone
+func (m *medicationHistoryRepo) GetAdherenceByPeriod(userID uint, medicationID uint, dependentID *uint, period models.AdherencePeriod, timezone string, from time.Time, to time.Time) ([]models.PeriodAdherenceCounts, error) {
+	var counts []models.PeriodAdherenceCounts
+	err := m.adherenceQuery(userID, medicationID, dependentID, from, to).
+		Select("date_trunc(?, medication_time AT TIME ZONE ?) AS period_start, "+adherenceCountColumns, string(period), timezone).
+		Group("1").
+		Order("1").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get adherence by %s: %v", period, err)
+	}
+	return counts, nil
+}
@@ -6,20 +6,30 @@ import (
 
 	"github.com/decagonhq/meddle-api/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 //go:generate mockgen -destination=../mocks/medication_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db MedicationRepository
 
 type MedicationRepository interface {
 	CreateMedication(medication *models.Medication) (*models.Medication, error)
-	GetNextMedications(userID uint) ([]models.Medication, error)
+	GetNextMedications(userID uint, dependentID *uint) ([]models.Medication, error)
 	UpdateMedicationDone(medication *models.Medication) error
-	GetAllNextMedicationsToUpdate() ([]models.Medication, error)
+	GetMedicationsToSchedule(until time.Time) ([]models.Medication, error)
+	ScheduleDoseOccurrences(medication *models.Medication, occurrences []models.DoseOccurrence) error
+	RecordDueDoseOccurrences(now time.Time, limit int) ([]models.DoseOccurrence, error)
 	GetMedicationDetail(id uint, userId uint) (*models.Medication, error)
-	GetAllMedications(userID uint) ([]models.Medication, error)
+	GetAllMedications(userID uint, filter *models.MedicationFilter) ([]models.Medication, error)
 	UpdateNextMedicationTime(medication *models.Medication, nextDosageTime time.Time) error
 	UpdateMedication(medication *models.Medication, medicationID uint, userID uint) error
 	FindMedication(medicationName string, userId int) (*[]models.Medication, error)
+	DeleteMedication(medicationID uint, userID uint) error
+	PauseMedication(medication *models.Medication, pausedAt time.Time) error
+	ResumeMedication(medication *models.Medication) error
+	GetMedicationsOutsideTimezone(userID uint, timezone string) ([]models.Medication, error)
+	RefillMedication(medicationID uint, userID uint, quantity int) (*models.Medication, error)
+	GetMedicationsToRemindRefill() ([]models.Medication, error)
+	SetRefillReminded(medicationID uint, remindedAt time.Time) error
 }
 
 type medicationRepo struct {
@@ -38,27 +48,84 @@ func (m *medicationRepo) CreateMedication(medication *models.Medication) (*model
 	return medication, nil
 }
 
-func (m *medicationRepo) GetNextMedications(userID uint) ([]models.Medication, error) {
+// GetNextMedications returns the upcoming doses of the user, of the dependent dependentID points to, see whereDependent
+func (m *medicationRepo) GetNextMedications(userID uint, dependentID *uint) ([]models.Medication, error) {
 	var medications []models.Medication
-	err := m.DB.Where("user_id = ? AND next_dosage_time > ?", userID, time.Now().UTC()).Order("next_dosage_time ASC").Find(&medications).Error
+	query := m.DB.Where("user_id = ? AND next_dosage_time > ? AND deleted_at = 0 AND paused_at IS NULL", userID, time.Now().UTC())
+	err := whereDependent(query, dependentID).Order("next_dosage_time ASC").Find(&medications).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get next medication: %v", err)
 	}
 	return medications, nil
 }
 
-func (m *medicationRepo) GetAllNextMedicationsToUpdate() ([]models.Medication, error) {
+// GetMedicationsToSchedule returns the medications whose dose occurrences have not been generated up to until
+func (m *medicationRepo) GetMedicationsToSchedule(until time.Time) ([]models.Medication, error) {
 	var medications []models.Medication
-
-	err := m.DB. //Where("date_trunc('hour', next_dosage_time) = date_trunc('hour', now())").
-			Where("date_trunc('minute', next_dosage_time) = date_trunc('minute', now())").
-			Where("is_medication_done = false").Find(&medications).Error
+	err := m.DB.Where("is_medication_done = false AND deleted_at = 0 AND paused_at IS NULL").
+		// medications created before dose occurrences existed have never been scheduled
+		Where("COALESCE(doses_scheduled_until, '-infinity') < LEAST(?, medication_stop_date)", until).
+		Find(&medications).Error
 	if err != nil {
-		return nil, fmt.Errorf("could not get next medication: %v", err)
+		return nil, fmt.Errorf("could not get medications to schedule: %v", err)
 	}
 	return medications, nil
 }
 
+// ScheduleDoseOccurrences saves the generated occurrences along with how far the medication has been scheduled.
+// Occurrences that already exist are left untouched, so generating the same dose twice is harmless.
+func (m *medicationRepo) ScheduleDoseOccurrences(medication *models.Medication, occurrences []models.DoseOccurrence) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if len(occurrences) > 0 {
+			err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&occurrences).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Medication{}).Where("id = ?", medication.ID).Updates(map[string]interface{}{
+			"next_dosage_time":         medication.NextDosageTime,
+			"last_scheduled_dose_time": medication.LastScheduledDoseTime,
+			"doses_scheduled_until":    medication.DosesScheduledUntil,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not schedule dose occurrences: %v", err)
+	}
+	return nil
+}
+
+// RecordDueDoseOccurrences adds up to limit due occurrences to the medication history and marks them as recorded
+// in a single transaction. Rows locked by another worker are skipped, so every occurrence is recorded exactly once.
+func (m *medicationRepo) RecordDueDoseOccurrences(now time.Time, limit int) ([]models.DoseOccurrence, error) {
+	var occurrences []models.DoseOccurrence
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Medication").
+			Where("recorded_at IS NULL AND scheduled_at <= ?", now).
+			Order("scheduled_at ASC").Limit(limit).
+			Find(&occurrences).Error
+		if err != nil || len(occurrences) == 0 {
+			return err
+		}
+
+		histories := make([]models.MedicationHistory, 0, len(occurrences))
+		ids := make([]uint, 0, len(occurrences))
+		for _, occurrence := range occurrences {
+			histories = append(histories, *models.NewMedicationHistory(occurrence))
+			ids = append(ids, occurrence.ID)
+		}
+		err = tx.Create(&histories).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.DoseOccurrence{}).Where("id IN ?", ids).Update("recorded_at", now).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not record due dose occurrences: %v", err)
+	}
+	return occurrences, nil
+}
+
 func (m *medicationRepo) UpdateMedicationDone(medication *models.Medication) error {
 	err := m.DB.Model(&medication).Where("user_id = ?", medication.UserID).Update("is_medication_done", true).Error
 	if err != nil {
@@ -77,26 +144,97 @@ func (m *medicationRepo) UpdateNextMedicationTime(medication *models.Medication,
 
 func (m *medicationRepo) GetMedicationDetail(id uint, userId uint) (*models.Medication, error) {
 	var medication models.Medication
-	err := m.DB.Where("id = ? AND user_id = ?", id, userId).First(&medication).Error
+	err := m.DB.Where("id = ? AND user_id = ? AND deleted_at = 0", id, userId).First(&medication).Error
 	if err != nil {
-		return nil, fmt.Errorf("could not get medication: %v", err)
+		return nil, fmt.Errorf("could not get medication: %w", err)
 	}
 	return &medication, nil
 }
 
-func (m *medicationRepo) GetAllMedications(userID uint) ([]models.Medication, error) {
+// GetAllMedications returns a page of the medications of the user, newest first by default
+func (m *medicationRepo) GetAllMedications(userID uint, filter *models.MedicationFilter) ([]models.Medication, error) {
+	query := whereDependent(m.DB.Where("user_id = ? AND deleted_at = 0", userID), filter.DependentID)
+	if filter.Name != "" {
+		query = query.Where("name ILIKE ?", "%"+filter.Name+"%")
+	}
+	switch filter.Status {
+	case "active":
+		query = query.Where("is_medication_done = ? AND paused_at IS NULL", false)
+	case "paused":
+		query = query.Where("paused_at IS NOT NULL")
+	case "done":
+		query = query.Where("is_medication_done = ?", true)
+	}
+
+	// the sort key is made unique with the id, so that pages neither skip nor repeat medications
+	order, comparison := keysetOrder(filter.Order, models.SortDescending)
+	switch filter.Sort {
+	case "name":
+		if filter.After != nil {
+			query = query.Where("(name, id) "+comparison+" (?, ?)", filter.After.Name, filter.After.ID)
+		}
+		query = query.Order("name " + order).Order("id " + order)
+	default:
+		if filter.After != nil {
+			query = query.Where("id "+comparison+" ?", filter.After.ID)
+		}
+		query = query.Order("id " + order)
+	}
+
 	var medications []models.Medication
-	err := m.DB.Where("user_id = ?", userID).Find(&medications).Error
+	err := query.Limit(filter.Limit).Find(&medications).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get medications: %v", err)
 	}
 	return medications, nil
 }
 
+// whereDependent keeps the rows of a dependent, or the user's own rows when dependentID points to 0
+func whereDependent(query *gorm.DB, dependentID *uint) *gorm.DB {
+	switch {
+	case dependentID == nil:
+		return query
+	case *dependentID == 0:
+		return query.Where("dependent_id IS NULL")
+	default:
+		return query.Where("dependent_id = ?", *dependentID)
+	}
+}
+
+// keysetOrder returns the sql sort order and the comparison selecting the rows after a cursor in that order
+func keysetOrder(order string, defaultOrder string) (string, string) {
+	if order == "" {
+		order = defaultOrder
+	}
+	if order == models.SortAscending {
+		return "ASC", ">"
+	}
+	return "DESC", "<"
+}
+
 func (m *medicationRepo) UpdateMedication(medication *models.Medication, medicationID uint, userID uint) error {
-	err := m.DB.Model(&models.Medication{}).
-		Where("user_id = ? AND id = ?", userID, medicationID).
-		Updates(medication).Error
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Medication{}).
+			Where("user_id = ? AND id = ? AND deleted_at = 0", userID, medicationID).
+			Updates(medication).Error
+		if err != nil {
+			return err
+		}
+		// as needed medications have no next dose, and Updates skips zero values
+		err = tx.Model(&models.Medication{}).
+			Where("user_id = ? AND id = ?", userID, medicationID).
+			Updates(map[string]interface{}{
+				"next_dosage_time":         medication.NextDosageTime,
+				"last_scheduled_dose_time": time.Time{},
+				"doses_scheduled_until":    time.Time{},
+			}).Error
+		if err != nil {
+			return err
+		}
+		// upcoming doses are generated again from the new schedule
+		return tx.Where("medication_id = ? AND user_id = ? AND scheduled_at > ? AND recorded_at IS NULL", medicationID, userID, time.Now()).
+			Delete(&models.DoseOccurrence{}).Error
+	})
 	if err != nil {
 		return fmt.Errorf("could not update medication: %v", err)
 	}
@@ -105,9 +243,134 @@ func (m *medicationRepo) UpdateMedication(medication *models.Medication, medicat
 
 func (m *medicationRepo) FindMedication(medicationName string, userId int) (*[]models.Medication, error) {
 	var medications *[]models.Medication
-	err := m.DB.Where("user_id = ? AND name LIKE ?",  userId, "%"+medicationName+"%").Find(&medications).Error
+	err := m.DB.Where("user_id = ? AND deleted_at = 0 AND name LIKE ?", userId, "%"+medicationName+"%").Find(&medications).Error
 	if err != nil {
 		return nil, err
 	}
 	return medications, nil
 }
+
+// DeleteMedication soft deletes the medication along with its upcoming doses, its history is kept.
+// It returns gorm.ErrRecordNotFound when the user has no such medication.
+func (m *medicationRepo) DeleteMedication(medicationID uint, userID uint) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Medication{}).
+			Where("id = ? AND user_id = ? AND deleted_at = 0", medicationID, userID).
+			Update("deleted_at", time.Now().Unix())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("medication_id = ? AND recorded_at IS NULL", medicationID).Delete(&models.DoseOccurrence{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete medication: %w", err)
+	}
+	return nil
+}
+
+// PauseMedication pauses the medication and drops its doses due after pausedAt
+func (m *medicationRepo) PauseMedication(medication *models.Medication, pausedAt time.Time) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Medication{}).Where("id = ?", medication.ID).Update("paused_at", pausedAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("medication_id = ? AND scheduled_at > ? AND recorded_at IS NULL", medication.ID, pausedAt).
+			Delete(&models.DoseOccurrence{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not pause medication: %v", err)
+	}
+	return nil
+}
+
+// ResumeMedication saves the resumed course, its doses are generated again from its next dosage time
+func (m *medicationRepo) ResumeMedication(medication *models.Medication) error {
+	err := m.DB.Model(&models.Medication{}).Where("id = ?", medication.ID).Updates(map[string]interface{}{
+		"paused_at":                nil,
+		"medication_stop_date":     medication.MedicationStopDate,
+		"next_dosage_time":         medication.NextDosageTime,
+		"last_scheduled_dose_time": time.Time{},
+		"doses_scheduled_until":    time.Time{},
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not resume medication: %v", err)
+	}
+	return nil
+}
+
+// GetMedicationsOutsideTimezone returns the medications of the user whose doses are not in the timezone yet
+func (m *medicationRepo) GetMedicationsOutsideTimezone(userID uint, timezone string) ([]models.Medication, error) {
+	var medications []models.Medication
+	err := m.DB.Where("user_id = ? AND deleted_at = 0 AND timezone <> ?", userID, timezone).Find(&medications).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get medications outside timezone: %v", err)
+	}
+	return medications, nil
+}
+
+// changeMedicationTimezone saves the new timezone and next dose of the medication, and drops its doses after from
+// that were not recorded yet, they are generated again from its next dosage time
+func changeMedicationTimezone(tx *gorm.DB, medication *models.Medication, from time.Time) error {
+	err := tx.Model(&models.Medication{}).Where("id = ?", medication.ID).Updates(map[string]interface{}{
+		"timezone":                 medication.Timezone,
+		"next_dosage_time":         medication.NextDosageTime,
+		"last_scheduled_dose_time": time.Time{},
+		"doses_scheduled_until":    time.Time{},
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("medication_id = ? AND scheduled_at > ? AND recorded_at IS NULL", medication.ID, from).
+		Delete(&models.DoseOccurrence{}).Error
+}
+
+// RefillMedication adds quantity to the stock of the medication, which starts tracking its inventory when it did not yet.
+// It returns gorm.ErrRecordNotFound when the user has no such medication.
+func (m *medicationRepo) RefillMedication(medicationID uint, userID uint, quantity int) (*models.Medication, error) {
+	var medication models.Medication
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Medication{}).
+			Where("id = ? AND user_id = ? AND deleted_at = 0", medicationID, userID).
+			UpdateColumns(map[string]interface{}{
+				"pill_count":         gorm.Expr("COALESCE(pill_count, 0) + ?", quantity),
+				"refill_reminded_at": nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("id = ?", medicationID).First(&medication).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not refill medication: %w", err)
+	}
+	return &medication, nil
+}
+
+// GetMedicationsToRemindRefill returns the running medications tracking their inventory whose user
+// has not been reminded to refill since their last refill
+func (m *medicationRepo) GetMedicationsToRemindRefill() ([]models.Medication, error) {
+	var medications []models.Medication
+	err := m.DB.Preload("Dependent").
+		Where("pill_count IS NOT NULL AND refill_reminded_at IS NULL").
+		Where("is_medication_done = false AND deleted_at = 0 AND paused_at IS NULL AND medication_stop_date > ?", time.Now()).
+		Find(&medications).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get medications to remind refill: %v", err)
+	}
+	return medications, nil
+}
+
+func (m *medicationRepo) SetRefillReminded(medicationID uint, remindedAt time.Time) error {
+	err := m.DB.Model(&models.Medication{}).Where("id = ?", medicationID).Update("refill_reminded_at", remindedAt).Error
+	if err != nil {
+		return fmt.Errorf("could not update medication refill reminder: %v", err)
+	}
+	return nil
+}
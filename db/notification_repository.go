@@ -1,19 +1,25 @@
 package db
 
 import (
-	"errors"
 	"fmt"
+	"time"
 
 	"github.com/decagonhq/meddle-api/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 //go:generate mockgen -destination=../mocks/notification_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db NotificationRepository
 
 type NotificationRepository interface {
 	AddNotificationToken(args *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, error)
-	GetAllNextMedicationsToSendNotifications() ([]models.Medication, error)
+	ClaimDueDoseNotifications(now time.Time, limit int) ([]models.DoseOccurrence, error)
+	ReleaseDoseNotifications(occurrenceIDs []uint) error
 	GetSingleUserDeviceTokens(userId int) ([]string, error)
+	GetUserDevices(userID uint) ([]models.FCMNotificationToken, error)
+	DeleteUserDevice(userID uint, deviceID uint) error
+	DeleteDeviceTokens(tokens []string) error
+	CreatePushDeliveries(deliveries []models.PushDelivery) error
 }
 
 type notificationRepo struct {
@@ -24,17 +30,20 @@ func NewNotificationRepo(db *GormDB) NotificationRepository {
 	return &notificationRepo{db.DB}
 }
 
+// AddNotificationToken registers a device, or refreshes it when its token is already known.
+// A token registered again by another user, who signed in on the same device, moves over to that user.
 func (db *notificationRepo) AddNotificationToken(args *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, error) {
-	var fcmToken models.FCMNotificationToken
-
-	err := db.DB.Where("user_id = ?", args.UserID).First(&fcmToken).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
+	fcmToken := models.FCMNotificationToken{
+		UserID:     args.UserID,
+		Token:      args.Token,
+		Platform:   args.Platform,
+		AppVersion: args.AppVersion,
+		LastSeenAt: time.Now(),
 	}
-
-	fcmToken.Token = args.Token
-	fcmToken.UserID = args.UserID
-	err = db.DB.Save(&fcmToken).Error
+	err := db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "app_version", "last_seen_at", "updated_at"}),
+	}).Create(&fcmToken).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not create notification: %v", err)
 	}
@@ -42,15 +51,40 @@ func (db *notificationRepo) AddNotificationToken(args *models.AddNotificationTok
 	return &fcmToken, nil
 }
 
-func (db *notificationRepo) GetAllNextMedicationsToSendNotifications() ([]models.Medication, error) {
-	var medications []models.Medication
+// ClaimDueDoseNotifications marks up to limit due occurrences as notified and returns them for sending.
+// Rows locked by another worker are skipped, so no reminder is claimed twice. Reminders that could not be sent
+// are handed back with ReleaseDoseNotifications.
+func (db *notificationRepo) ClaimDueDoseNotifications(now time.Time, limit int) ([]models.DoseOccurrence, error) {
+	var occurrences []models.DoseOccurrence
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Medication.Dependent").
+			Where("notified_at IS NULL AND COALESCE(remind_at, scheduled_at) <= ?", now).
+			Order("scheduled_at ASC").Limit(limit).
+			Find(&occurrences).Error
+		if err != nil || len(occurrences) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(occurrences))
+		for _, occurrence := range occurrences {
+			ids = append(ids, occurrence.ID)
+		}
+		return tx.Model(&models.DoseOccurrence{}).Where("id IN ?", ids).Update("notified_at", now).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not claim due dose notifications: %v", err)
+	}
+	return occurrences, nil
+}
 
-	err := db.DB.Where("date_trunc('minute', next_dosage_time) = date_trunc('minute', now())").
-		Where("is_medication_done = false").Find(&medications).Error
+// ReleaseDoseNotifications clears the claim of occurrences whose reminder could not be sent, so that a later run sends them again
+func (db *notificationRepo) ReleaseDoseNotifications(occurrenceIDs []uint) error {
+	err := db.DB.Model(&models.DoseOccurrence{}).Where("id IN ?", occurrenceIDs).Update("notified_at", nil).Error
 	if err != nil {
-		return nil, fmt.Errorf("could not get next medication: %v", err)
+		return fmt.Errorf("could not release dose notifications: %v", err)
 	}
-	return medications, nil
+	return nil
 }
 
 func (db *notificationRepo) GetSingleUserDeviceTokens(userId int) ([]string, error) {
@@ -64,3 +98,40 @@ func (db *notificationRepo) GetSingleUserDeviceTokens(userId int) ([]string, err
 
 	return tokens, nil
 }
+
+func (db *notificationRepo) GetUserDevices(userID uint) ([]models.FCMNotificationToken, error) {
+	var devices []models.FCMNotificationToken
+	err := db.DB.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get devices: %v", err)
+	}
+	return devices, nil
+}
+
+// DeleteUserDevice revokes a device of the user, it returns gorm.ErrRecordNotFound when the user has no such device
+func (db *notificationRepo) DeleteUserDevice(userID uint, deviceID uint) error {
+	result := db.DB.Where("user_id = ? AND id = ?", userID, deviceID).Delete(&models.FCMNotificationToken{})
+	if result.Error != nil {
+		return fmt.Errorf("could not delete device: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (db *notificationRepo) DeleteDeviceTokens(tokens []string) error {
+	err := db.DB.Where("token IN ?", tokens).Delete(&models.FCMNotificationToken{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete device tokens: %v", err)
+	}
+	return nil
+}
+
+func (db *notificationRepo) CreatePushDeliveries(deliveries []models.PushDelivery) error {
+	err := db.DB.Create(&deliveries).Error
+	if err != nil {
+		return fmt.Errorf("could not create push deliveries: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockgen -destination=../mocks/phone_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db PhoneRepository
+
+type PhoneRepository interface {
+	CreatePhoneVerification(verification *models.PhoneVerification) error
+	FindPhoneVerification(userID uint) (*models.PhoneVerification, error)
+	UsePhoneVerificationAttempt(id uint, maxAttempts int) error
+	VerifyPhone(verification *models.PhoneVerification) error
+	PurgePhoneVerifications(before int64) (int64, error)
+}
+
+type phoneRepo struct {
+	DB *gorm.DB
+}
+
+func NewPhoneRepo(db *GormDB) PhoneRepository {
+	return &phoneRepo{db.DB}
+}
+
+// CreatePhoneVerification stores the verification of the user, replacing the one they had before
+func (p *phoneRepo) CreatePhoneVerification(verification *models.PhoneVerification) error {
+	err := p.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"phone_number", "code_hash", "attempts", "expires_at", "created_at", "updated_at"}),
+	}).Create(verification).Error
+	if err != nil {
+		return fmt.Errorf("could not create phone verification: %v", err)
+	}
+	return nil
+}
+
+func (p *phoneRepo) FindPhoneVerification(userID uint) (*models.PhoneVerification, error) {
+	var verification models.PhoneVerification
+	err := p.DB.Where("user_id = ?", userID).First(&verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// UsePhoneVerificationAttempt counts a code entered for the verification. It returns gorm.ErrRecordNotFound
+// once maxAttempts were used, so that concurrent requests can not enter more codes than that.
+func (p *phoneRepo) UsePhoneVerificationAttempt(id uint, maxAttempts int) error {
+	result := p.DB.Model(&models.PhoneVerification{}).Where("id = ? AND attempts < ?", id, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("could not use phone verification attempt: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// VerifyPhone marks the phone number of the verification as verified and deletes the verification. It returns
+// gorm.ErrRecordNotFound when the user changed their phone number since the code was sent.
+func (p *phoneRepo) VerifyPhone(verification *models.PhoneVerification) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND phone_number = ?", verification.UserID, verification.PhoneNumber).
+			Update("phone_verified_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("could not verify phone: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("could not verify phone: %w", gorm.ErrRecordNotFound)
+		}
+		return tx.Unscoped().Delete(&models.PhoneVerification{}, verification.ID).Error
+	})
+}
+
+// PurgePhoneVerifications deletes the verifications that expired before the given unix time
+func (p *phoneRepo) PurgePhoneVerifications(before int64) (int64, error) {
+	result := p.DB.Unscoped().Where("expires_at < ?", before).Delete(&models.PhoneVerification{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not purge phone verifications: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// revocationCacheSize bounds the memory used by the cache, revocations past it are only looked up in the database
+const revocationCacheSize = 10000
+
+// revocationCache remembers revoked tokens by hash until they expire. It only ever holds revocations, which hold
+// on every replica, so a token missing from it still has to be looked up in the database.
+type revocationCache struct {
+	mu      sync.Mutex
+	expires map[string]int64
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{expires: map[string]int64{}}
+}
+
+func (r *revocationCache) add(tokenHash string, expiresAt int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.expires) >= revocationCacheSize {
+		r.evictExpired(time.Now().Unix())
+		if len(r.expires) >= revocationCacheSize {
+			return
+		}
+	}
+	r.expires[tokenHash] = expiresAt
+}
+
+func (r *revocationCache) contains(tokenHash string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expiresAt, ok := r.expires[tokenHash]
+	if !ok {
+		return false
+	}
+	if expiresAt < time.Now().Unix() {
+		delete(r.expires, tokenHash)
+		return false
+	}
+	return true
+}
+
+func (r *revocationCache) evictExpired(now int64) {
+	for tokenHash, expiresAt := range r.expires {
+		if expiresAt < now {
+			delete(r.expires, tokenHash)
+		}
+	}
+}
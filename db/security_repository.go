@@ -0,0 +1,213 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/security_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db SecurityRepository
+
+type SecurityRepository interface {
+	HitRateLimit(key string, window time.Duration) (*models.RateLimit, error)
+	CountRateLimitHits(key string, window time.Duration) (int64, error)
+	PurgeRateLimits(before time.Time) (int64, error)
+	RecordFailedLogin(userID uint, at time.Time) (int, error)
+	LockUser(userID uint, until time.Time) error
+	ResetFailedLogins(userID uint) error
+	CreateSecurityEvent(event *models.SecurityEvent) error
+	HasLoggedInFrom(userID uint, userAgent string) (bool, error)
+	GetSecurityEvents(userID uint, limit int) ([]models.SecurityEvent, error)
+	SetTwoFactorSecret(userID uint, secret string) error
+	EnableTwoFactor(userID uint, step int64, recoveryCodeHashes []string) error
+	DisableTwoFactor(userID uint) error
+	UseTwoFactorStep(userID uint, step int64) error
+	UseRecoveryCode(userID uint, codeHash string) error
+}
+
+type securityRepo struct {
+	DB *gorm.DB
+}
+
+func NewSecurityRepo(db *GormDB) SecurityRepository {
+	return &securityRepo{db.DB}
+}
+
+// HitRateLimit counts a hit on the key and returns its counter. Counters are fixed windows,
+// a hit after the window of the key is over starts a new one.
+func (s *securityRepo) HitRateLimit(key string, window time.Duration) (*models.RateLimit, error) {
+	now := time.Now()
+	var rateLimit models.RateLimit
+	err := s.DB.Raw(`INSERT INTO rate_limits (key, hits, window_start) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			hits = CASE WHEN rate_limits.window_start <= ? THEN 1 ELSE rate_limits.hits + 1 END,
+			window_start = CASE WHEN rate_limits.window_start <= ? THEN EXCLUDED.window_start ELSE rate_limits.window_start END
+		RETURNING key, hits, window_start`, key, now, now.Add(-window), now.Add(-window)).
+		Scan(&rateLimit).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not hit rate limit: %v", err)
+	}
+	return &rateLimit, nil
+}
+
+// CountRateLimitHits returns the hits on the key during its current window
+func (s *securityRepo) CountRateLimitHits(key string, window time.Duration) (int64, error) {
+	var hits int64
+	err := s.DB.Model(&models.RateLimit{}).Select("COALESCE(SUM(hits), 0)").
+		Where("key = ? AND window_start > ?", key, time.Now().Add(-window)).
+		Scan(&hits).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not count rate limit hits: %v", err)
+	}
+	return hits, nil
+}
+
+// PurgeRateLimits deletes the counters whose window started before the given time
+func (s *securityRepo) PurgeRateLimits(before time.Time) (int64, error) {
+	result := s.DB.Where("window_start < ?", before).Delete(&models.RateLimit{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not purge rate limits: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RecordFailedLogin counts a wrong password entered for the user and returns how many were entered in a row
+func (s *securityRepo) RecordFailedLogin(userID uint, at time.Time) (int, error) {
+	var count int
+	err := s.DB.Raw(`UPDATE users SET failed_login_count = failed_login_count + 1, last_failed_login_at = ?
+		WHERE id = ? RETURNING failed_login_count`, at, userID).
+		Scan(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not record failed login: %v", err)
+	}
+	return count, nil
+}
+
+func (s *securityRepo) LockUser(userID uint, until time.Time) error {
+	err := s.DB.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("locked_until", until).Error
+	if err != nil {
+		return fmt.Errorf("could not lock user: %v", err)
+	}
+	return nil
+}
+
+// ResetFailedLogins clears the failed logins of the user, and lifts a lockout
+func (s *securityRepo) ResetFailedLogins(userID uint) error {
+	err := s.DB.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"failed_login_count": 0, "last_failed_login_at": nil, "locked_until": nil}).Error
+	if err != nil {
+		return fmt.Errorf("could not reset failed logins: %v", err)
+	}
+	return nil
+}
+
+func (s *securityRepo) CreateSecurityEvent(event *models.SecurityEvent) error {
+	err := s.DB.Create(event).Error
+	if err != nil {
+		return fmt.Errorf("could not create security event: %v", err)
+	}
+	return nil
+}
+
+// HasLoggedInFrom reports whether the user logged in before from a device with the user agent
+func (s *securityRepo) HasLoggedInFrom(userID uint, userAgent string) (bool, error) {
+	var count int64
+	err := s.DB.Model(&models.SecurityEvent{}).
+		Where("user_id = ? AND user_agent = ? AND type IN ?", userID, userAgent,
+			[]string{models.SecurityEventLogin, models.SecurityEventNewDeviceLogin}).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("could not find previous logins: %v", err)
+	}
+	return count > 0, nil
+}
+
+// GetSecurityEvents returns the latest security events of the user
+func (s *securityRepo) GetSecurityEvents(userID uint, limit int) ([]models.SecurityEvent, error) {
+	var events []models.SecurityEvent
+	err := s.DB.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get security events: %v", err)
+	}
+	return events, nil
+}
+
+// SetTwoFactorSecret stores the secret of a two-factor enrollment that still has to be confirmed
+func (s *securityRepo) SetTwoFactorSecret(userID uint, secret string) error {
+	err := s.DB.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"two_factor_secret": secret, "two_factor_enabled_at": nil}).Error
+	if err != nil {
+		return fmt.Errorf("could not set two-factor secret: %v", err)
+	}
+	return nil
+}
+
+// EnableTwoFactor turns on two-factor authentication for the user, replacing their recovery codes
+func (s *securityRepo) EnableTwoFactor(userID uint, step int64, recoveryCodeHashes []string) error {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumns(map[string]interface{}{"two_factor_enabled_at": time.Now(), "two_factor_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, 0, len(recoveryCodeHashes))
+		for _, hash := range recoveryCodeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not enable two-factor authentication: %v", err)
+	}
+	return nil
+}
+
+// DisableTwoFactor turns off two-factor authentication for the user and deletes their recovery codes
+func (s *securityRepo) DisableTwoFactor(userID uint) error {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumns(map[string]interface{}{"two_factor_secret": "", "two_factor_enabled_at": nil, "two_factor_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not disable two-factor authentication: %v", err)
+	}
+	return nil
+}
+
+// UseTwoFactorStep records that the code of the step was used, gorm.ErrRecordNotFound is returned when
+// a code of that step or a later one was already used
+func (s *securityRepo) UseTwoFactorStep(userID uint, step int64) error {
+	result := s.DB.Model(&models.User{}).Where("id = ? AND two_factor_last_step < ?", userID, step).
+		UpdateColumn("two_factor_last_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("could not use two-factor code: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not use two-factor code: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// UseRecoveryCode spends a recovery code of the user, gorm.ErrRecordNotFound is returned when there is
+// no such code left
+func (s *securityRepo) UseRecoveryCode(userID uint, codeHash string) error {
+	result := s.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("could not use recovery code: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not use recovery code: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
@@ -49,6 +49,12 @@ var ErrBadRequest = New("bad request", http.StatusBadRequest)
 // InValidPasswordError
 var ErrInvalidPassword = New("invalid password", http.StatusUnauthorized)
 
+// ErrAccountDisabled is returned to users whose account an admin disabled
+var ErrAccountDisabled = New("account disabled", http.StatusForbidden)
+
+// ErrEmailAlreadyVerified is returned when verifying an email that was verified before
+var ErrEmailAlreadyVerified = New("email already verified", http.StatusConflict)
+
 func GetUniqueContraintError(err error) *Error {
 	fields := strings.Split(err.Error(), "UNIQUE constraint failed: ")
 	return &Error{
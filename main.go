@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/decagonhq/meddle-api/config"
@@ -20,28 +21,60 @@ func main() {
 
 	gormDB := db.GetDB(conf)
 	authRepo := db.NewAuthRepo(gormDB)
+	securityRepo := db.NewSecurityRepo(gormDB)
 	mail := services.NewMailService(conf)
 	notificationRepo := db.NewNotificationRepo(gormDB)
-	pushNotification, errr := services.NewFirebaseCloudMessaging(notificationRepo, conf)
+	pushTransport, err := services.NewPushTransport(conf)
 	if err != nil {
-		log.Fatalf("error retrieving client for push notification\n%v", errr)
+		log.Fatalf("error retrieving client for push notification\n%v", err)
 	}
-	authService := services.NewAuthService(authRepo, conf, mail, pushNotification)
-
+	smsSender, err := services.NewSMSSender(conf)
+	if err != nil {
+		log.Fatalf("error setting up the sms provider\n%v", err)
+	}
+	pushNotification := services.NewPushNotifier(notificationRepo, authRepo, conf, pushTransport, smsSender)
 	medicationHistoryRepo := db.NewMedicationHistoryRepo(gormDB)
 	medicationRepo := db.NewMedicationRepo(gormDB)
-	medicationService := services.NewMedicationService(medicationRepo, medicationHistoryRepo, conf)
+	authService := services.NewAuthService(authRepo, securityRepo, medicationRepo, conf, mail, pushNotification)
+	dependentRepo := db.NewDependentRepo(gormDB)
+	medicationService := services.NewMedicationService(medicationRepo, medicationHistoryRepo, dependentRepo, conf)
+	dependentService := services.NewDependentService(dependentRepo, conf)
 	medicationHistoryService := services.NewMedicationHistoryService(medicationHistoryRepo, conf)
+	inventoryService := services.NewInventoryService(medicationRepo, authRepo, pushNotification, mail, smsSender, conf)
+	careRepo := db.NewCareRepo(gormDB)
+	careService := services.NewCareService(careRepo, mail, conf)
+	adminService := services.NewAdminService(db.NewAdminRepo(gormDB), authRepo, authService, conf)
+	securityService := services.NewSecurityService(securityRepo, conf)
+	sessionService := services.NewSessionService(authRepo, conf)
+	phoneVerificationService := services.NewPhoneVerificationService(db.NewPhoneRepo(gormDB), securityRepo, smsSender, conf)
 
 	s := &server.Server{
 		Config:                   conf,
 		AuthRepository:           authRepo,
+		SecurityRepository:       securityRepo,
 		AuthService:              authService,
 		MedicationService:        medicationService,
 		MedicationHistoryService: medicationHistoryService,
 		PushNotification:         pushNotification,
+		InventoryService:         inventoryService,
+		CareService:              careService,
+		DependentService:         dependentService,
+		AdminService:             adminService,
+		SecurityService:          securityService,
+		SessionService:           sessionService,
+		PhoneVerificationService: phoneVerificationService,
+	}
+
+	jobRunner := services.NewJobRunner(db.NewJobRepo(gormDB))
+	escalationService := services.NewEscalationService(medicationHistoryRepo, authRepo, careRepo, pushNotification, mail, smsSender, conf)
+	jobs := services.Jobs(medicationService, pushNotification, escalationService, inventoryService, securityService, sessionService, phoneVerificationService)
+	// `meddle-api worker` only runs the background jobs, so they can be scaled apart from the api
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		jobRunner.StartBlocking(jobs...)
+		return
+	}
+	if conf.RunJobs {
+		jobRunner.Start(jobs...)
 	}
-	go services.UpdateMedicationCronJob(medicationService)
-	go pushNotification.NotificationsCronJob()
 	s.Start()
 }
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// AdherencePeriod is the length of the periods adherence is broken down into
+type AdherencePeriod string
+
+const (
+	AdherenceByDay   AdherencePeriod = "day"
+	AdherenceByWeek  AdherencePeriod = "week"
+	AdherenceByMonth AdherencePeriod = "month"
+)
+
+// AdherenceRequest is the query of an adherence report, dates are days in the user's timezone
+// and the range defaults to the last 30 days
+type AdherenceRequest struct {
+	From         string          `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To           string          `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Period       AdherencePeriod `form:"period" binding:"omitempty,oneof=day week month"`
+	MedicationID uint            `form:"medication_id"`
+	// DependentID selects the doses of a dependent, the user's own ones are counted without it
+	DependentID *uint  `form:"dependent_id"`
+	Timezone    string `form:"-"`
+}
+
+// AdherenceCounts are the doses of a group of medication histories, by state
+type AdherenceCounts struct {
+	Taken   int `json:"taken"`
+	Missed  int `json:"missed"`
+	Skipped int `json:"skipped"`
+	Pending int `json:"pending"`
+}
+
+// AdherencePercentage is the share of the confirmed doses that were taken, skipped doses were not taken either
+func (a AdherenceCounts) AdherencePercentage() float64 {
+	confirmed := a.Taken + a.Missed + a.Skipped
+	if confirmed == 0 {
+		return 0
+	}
+	return float64(a.Taken) * 100 / float64(confirmed)
+}
+
+// MedicationAdherenceCounts are the dose counts of a medication
+type MedicationAdherenceCounts struct {
+	AdherenceCounts
+	MedicationID   uint
+	MedicationName string
+}
+
+// PeriodAdherenceCounts are the dose counts of a day, week or month starting at PeriodStart
+type PeriodAdherenceCounts struct {
+	AdherenceCounts
+	PeriodStart time.Time
+}
+
+type AdherenceStats struct {
+	AdherenceCounts
+	AdherencePercentage float64 `json:"adherence_percentage"`
+}
+
+func NewAdherenceStats(counts AdherenceCounts) AdherenceStats {
+	return AdherenceStats{AdherenceCounts: counts, AdherencePercentage: counts.AdherencePercentage()}
+}
+
+type MedicationAdherence struct {
+	AdherenceStats
+	MedicationID   uint   `json:"medication_id"`
+	MedicationName string `json:"medication_name"`
+}
+
+type PeriodAdherence struct {
+	AdherenceStats
+	PeriodStart string `json:"period_start"`
+}
+
+type AdherenceResponse struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Period AdherencePeriod `json:"period"`
+	AdherenceStats
+	// CurrentStreak and LongestStreak count consecutive days on which every confirmed dose was taken,
+	// CurrentStreak ending on the last day of the range
+	CurrentStreak int                   `json:"current_streak"`
+	LongestStreak int                   `json:"longest_streak"`
+	Medications   []MedicationAdherence `json:"medications"`
+	Periods       []PeriodAdherence     `json:"periods"`
+}
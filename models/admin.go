@@ -0,0 +1,150 @@
+package models
+
+import "time"
+
+// Roles of a user, support and admin staff can use the admin api
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// HasRole reports whether the user has one of the roles
+func (u *User) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManage reports whether the staff member may act on the account of the user,
+// support staff only look after plain users while admins look after everyone
+func (u *User) CanManage(user *User) bool {
+	if u.Role == RoleAdmin {
+		return true
+	}
+	return u.Role == RoleSupport && user.HasRole(RoleUser, "")
+}
+
+// IsDisabled reports whether an admin disabled the account
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// UserListRequest searches the users of the admin api, newest first
+type UserListRequest struct {
+	PageRequest
+	// Search matches users whose name, email or phone number contains it
+	Search string `form:"search"`
+	Role   string `form:"role" binding:"omitempty,oneof=user support admin"`
+	Status string `form:"status" binding:"omitempty,oneof=active disabled unverified"`
+}
+
+// UserCursor is the position of the last user of a page
+type UserCursor struct {
+	ID uint `json:"id"`
+}
+
+// UserFilter selects a page of users, After being the cursor of the previous page
+type UserFilter struct {
+	Search string
+	Role   string
+	Status string
+	After  *UserCursor
+	Limit  int
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user support admin"`
+}
+
+// AdminUserResponse is a user as support staff see it
+type AdminUserResponse struct {
+	ID                    uint   `json:"id"`
+	CreatedAt             string `json:"created_at"`
+	Name                  string `json:"name"`
+	Email                 string `json:"email"`
+	PendingEmail          string `json:"pending_email"`
+	PhoneNumber           string `json:"phone_number"`
+	IsEmailActive         bool   `json:"is_email_active"`
+	Role                  string `json:"role"`
+	Timezone              string `json:"timezone"`
+	Social                string `json:"social"`
+	DisabledAt            string `json:"disabled_at,omitempty"`
+	PasswordResetRequired bool   `json:"password_reset_required"`
+	FailedLoginCount      int    `json:"failed_login_count"`
+	LockedUntil           string `json:"locked_until,omitempty"`
+}
+
+func (u *User) ToAdminUserResponse() *AdminUserResponse {
+	response := &AdminUserResponse{
+		ID:                    u.ID,
+		CreatedAt:             time.Unix(u.CreatedAt, 0).Format(time.RFC3339),
+		Name:                  u.Name,
+		Email:                 u.Email,
+		PendingEmail:          u.PendingEmail,
+		PhoneNumber:           u.PhoneNumber,
+		IsEmailActive:         u.IsEmailActive,
+		Role:                  u.Role,
+		Timezone:              u.Timezone,
+		Social:                u.Social,
+		PasswordResetRequired: u.PasswordResetRequired,
+		FailedLoginCount:      u.FailedLoginCount,
+	}
+	if u.DisabledAt != nil {
+		response.DisabledAt = u.DisabledAt.Format(time.RFC3339)
+	}
+	if u.LockedUntil != nil {
+		response.LockedUntil = u.LockedUntil.Format(time.RFC3339)
+	}
+	return response
+}
+
+// StatsRequest is the window, in hours up to now, system statistics are computed over
+type StatsRequest struct {
+	Hours int `form:"hours" binding:"omitempty,min=1,max=720"`
+}
+
+// DefaultStatsHours is the window of system statistics when none is requested
+const DefaultStatsHours = 24
+
+type UserCounts struct {
+	Total      int64 `json:"total"`
+	Unverified int64 `json:"unverified"`
+	Disabled   int64 `json:"disabled"`
+	SignedUp   int64 `json:"signed_up"`
+}
+
+// PushDeliveryCount is the number of push deliveries of a category that ended with a status
+type PushDeliveryCount struct {
+	Category PushNotificationCategory `json:"category"`
+	Status   PushDeliveryStatus       `json:"status"`
+	Count    int64                    `json:"count"`
+}
+
+type NotificationStats struct {
+	Devices    int64               `json:"devices"`
+	Deliveries []PushDeliveryCount `json:"deliveries"`
+}
+
+// JobStats summarizes the runs of a background job
+type JobStats struct {
+	JobName         string     `json:"job_name"`
+	Runs            int64      `json:"runs"`
+	Failures        int64      `json:"failures"`
+	Processed       int64      `json:"processed"`
+	AverageSeconds  float64    `json:"average_seconds"`
+	LastStartedAt   *time.Time `json:"last_started_at"`
+	LastError       string     `json:"last_error"`
+	LastErrorAt     *time.Time `json:"last_error_at"`
+	UnfinishedCount int64      `json:"unfinished"`
+}
+
+type SystemStats struct {
+	Since         string            `json:"since"`
+	Users         UserCounts        `json:"users"`
+	Notifications NotificationStats `json:"notifications"`
+	Jobs          []JobStats        `json:"jobs"`
+}
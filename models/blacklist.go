@@ -1,7 +1,22 @@
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// BlackList revokes a token until it expires. Only the hash of the token is stored,
+// and the entry can be purged once the token expired by itself.
 type BlackList struct {
 	Model
-	Token string `json:"token"`
-	Email string `json:"email"`
+	Token     string `json:"-" gorm:"-"`
+	TokenHash string `json:"-" gorm:"uniqueIndex"`
+	Email     string `json:"email" gorm:"index"`
+	ExpiresAt int64  `json:"expires_at" gorm:"index"`
+}
+
+// HashToken returns the hash a revoked token is looked up by
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// Permissions a patient grants a caregiver
+const (
+	// CarePermissionRead lets the caregiver view the medications, next doses and history of the patient
+	CarePermissionRead = "read"
+	// CarePermissionManage also lets the caregiver record doses on behalf of the patient, and create, update,
+	// pause, resume and refill their medications
+	CarePermissionManage = "manage"
+)
+
+const (
+	CareSharePending  = "pending"
+	CareShareAccepted = "accepted"
+)
+
+// CareShare is the access a patient shares with a caregiver. It is an invitation addressed to
+// CaregiverEmail until the caregiver accepts it, from then on it is tied to CaregiverID.
+type CareShare struct {
+	Model
+	PatientID         uint       `json:"patient_id" gorm:"index"`
+	Patient           *User      `json:"-" gorm:"foreignKey:PatientID"`
+	CaregiverEmail    string     `json:"caregiver_email" gorm:"index"`
+	CaregiverID       *uint      `json:"caregiver_id" gorm:"index"`
+	Caregiver         *User      `json:"-" gorm:"foreignKey:CaregiverID"`
+	Permission        string     `json:"permission"`
+	NotifyMissedDoses bool       `json:"notify_missed_doses"`
+	AcceptedAt        *time.Time `json:"accepted_at"`
+}
+
+// CareInviteRequest invites a caregiver by email
+type CareInviteRequest struct {
+	Email             string `json:"email" binding:"required,email"`
+	Permission        string `json:"permission" binding:"required,oneof=read manage"`
+	NotifyMissedDoses bool   `json:"notify_missed_doses"`
+}
+
+type CareShareResponse struct {
+	ID                uint   `json:"id"`
+	PatientID         uint   `json:"patient_id"`
+	PatientName       string `json:"patient_name,omitempty"`
+	CaregiverEmail    string `json:"caregiver_email"`
+	CaregiverName     string `json:"caregiver_name,omitempty"`
+	Permission        string `json:"permission"`
+	NotifyMissedDoses bool   `json:"notify_missed_doses"`
+	Status            string `json:"status"`
+	CreatedAt         string `json:"created_at"`
+	AcceptedAt        string `json:"accepted_at,omitempty"`
+}
+
+// IsAccepted reports whether the caregiver accepted the invitation
+func (c *CareShare) IsAccepted() bool {
+	return c.AcceptedAt != nil && c.CaregiverID != nil
+}
+
+// Allows reports whether the share grants the permission, manage implying read
+func (c *CareShare) Allows(permission string) bool {
+	return c.Permission == CarePermissionManage || c.Permission == permission
+}
+
+func (c *CareShare) CareShareToResponse() *CareShareResponse {
+	response := &CareShareResponse{
+		ID:                c.ID,
+		PatientID:         c.PatientID,
+		CaregiverEmail:    c.CaregiverEmail,
+		Permission:        c.Permission,
+		NotifyMissedDoses: c.NotifyMissedDoses,
+		Status:            CareSharePending,
+		CreatedAt:         time.Unix(c.CreatedAt, 0).Format(time.RFC3339),
+	}
+	if c.Patient != nil {
+		response.PatientName = c.Patient.Name
+	}
+	if c.Caregiver != nil {
+		response.CaregiverName = c.Caregiver.Name
+	}
+	if c.IsAccepted() {
+		response.Status = CareShareAccepted
+		response.AcceptedAt = c.AcceptedAt.Format(time.RFC3339)
+	}
+	return response
+}
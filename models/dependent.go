@@ -0,0 +1,60 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Dependent is a person, such as a child or an elderly relative, whose medications are managed by the
+// account of its owner. Dependents have no credentials of their own, their reminders go to the devices
+// of the owner.
+type Dependent struct {
+	Model
+	OwnerID      uint   `json:"owner_id" gorm:"index"`
+	Name         string `json:"name"`
+	Relationship string `json:"relationship"`
+	// DateOfBirth is a day, formatted as 2006-01-02
+	DateOfBirth string `json:"date_of_birth"`
+}
+
+type DependentRequest struct {
+	Name         string `json:"name" binding:"required,min=2"`
+	Relationship string `json:"relationship" binding:"omitempty,max=50"`
+	DateOfBirth  string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+}
+
+type DependentResponse struct {
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	Relationship string `json:"relationship"`
+	DateOfBirth  string `json:"date_of_birth"`
+	CreatedAt    string `json:"created_at"`
+}
+
+func (d *DependentRequest) ReqToDependentModel(ownerID uint) *Dependent {
+	return &Dependent{
+		OwnerID:      ownerID,
+		Name:         d.Name,
+		Relationship: d.Relationship,
+		DateOfBirth:  d.DateOfBirth,
+	}
+}
+
+func (d *Dependent) DependentToResponse() *DependentResponse {
+	return &DependentResponse{
+		ID:           d.ID,
+		Name:         d.Name,
+		Relationship: d.Relationship,
+		DateOfBirth:  d.DateOfBirth,
+		CreatedAt:    time.Unix(d.CreatedAt, 0).Format(time.RFC3339),
+	}
+}
+
+// ForDependent prefixes a notification text with the name of the dependent it is about,
+// texts about the owner's own medications are left as they are
+func ForDependent(dependent *Dependent, text string) string {
+	if dependent == nil {
+		return text
+	}
+	return fmt.Sprintf("%s: %s", dependent.Name, text)
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// DoseOccurrence is a single scheduled dose of a medication. Occurrences are generated ahead of time
+// so that doses which fall due while the workers are down are still processed once they are back.
+type DoseOccurrence struct {
+	Model
+	MedicationID uint       `json:"medication_id" gorm:"uniqueIndex:idx_dose_occurrences_medication_scheduled_at"`
+	Medication   Medication `json:"-"`
+	UserID       uint       `json:"user_id" gorm:"index"`
+	ScheduledAt  time.Time  `json:"scheduled_at" gorm:"uniqueIndex:idx_dose_occurrences_medication_scheduled_at;index"`
+	Dosage       int        `json:"dosage"`
+	// RecordedAt is set once the occurrence has been added to the medication history
+	RecordedAt *time.Time `json:"recorded_at"`
+	// NotifiedAt is set once the reminder for the occurrence has been sent
+	NotifiedAt *time.Time `json:"notified_at"`
+	// RemindAt overrides ScheduledAt as the time of the reminder once it has been snoozed
+	RemindAt *time.Time `json:"remind_at"`
+}
+
+func NewDoseOccurrence(medication *Medication, scheduledAt time.Time) DoseOccurrence {
+	return DoseOccurrence{
+		MedicationID: medication.ID,
+		UserID:       medication.UserID,
+		ScheduledAt:  scheduledAt,
+		Dosage:       medication.DosageAt(scheduledAt),
+	}
+}
+
+type DoseAction string
+
+const (
+	DoseTaken   DoseAction = "taken"
+	DoseSkipped DoseAction = "skip"
+	DoseSnoozed DoseAction = "snooze"
+)
+
+// DoseActionRequest is sent by the actions of a dose reminder
+type DoseActionRequest struct {
+	ActionToken   string     `json:"action_token" binding:"required"`
+	Action        DoseAction `json:"action" binding:"required,oneof=taken skip snooze"`
+	SnoozeMinutes int        `json:"snooze_minutes" binding:"required_if=Action snooze,omitempty,min=1,max=720"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// DefaultNudgeAfterMinutes is when the user is re-reminded about a dose they have not confirmed,
+// for medications that do not configure an escalation policy
+var DefaultNudgeAfterMinutes = []int{15}
+
+// EscalationPolicy describes what happens while a dose is left unconfirmed.
+// Minutes are counted from the time the dose was due.
+type EscalationPolicy struct {
+	// NudgeAfterMinutes re-reminds the user at each of the given minutes
+	NudgeAfterMinutes []int `json:"nudge_after_minutes,omitempty" binding:"omitempty,dive,min=1"`
+	// CaregiverAfterMinutes emails the caregiver once the dose is that late, 0 never does.
+	// CaregiverEmail is only emailed once it accepted a care invitation of the user.
+	CaregiverAfterMinutes int    `json:"caregiver_after_minutes,omitempty" binding:"omitempty,min=1"`
+	CaregiverEmail        string `json:"caregiver_email,omitempty" binding:"required_with=CaregiverAfterMinutes,omitempty,email"`
+	// MissedAfterMinutes marks the dose as missed once it is that late, 0 uses the configured grace period
+	MissedAfterMinutes int `json:"missed_after_minutes,omitempty" binding:"omitempty,min=1,max=1440"`
+}
+
+// IsZero reports whether no escalation policy has been configured
+func (p EscalationPolicy) IsZero() bool {
+	return len(p.NudgeAfterMinutes) == 0 && p.CaregiverAfterMinutes == 0 && p.CaregiverEmail == "" && p.MissedAfterMinutes == 0
+}
+
+// NudgesDue returns how many nudges of the policy are due once a dose is late by the given duration
+func (p EscalationPolicy) NudgesDue(late time.Duration) int {
+	nudgeAfterMinutes := p.NudgeAfterMinutes
+	if p.IsZero() {
+		nudgeAfterMinutes = DefaultNudgeAfterMinutes
+	}
+	due := 0
+	for _, minutes := range nudgeAfterMinutes {
+		if late >= time.Duration(minutes)*time.Minute {
+			due++
+		}
+	}
+	return due
+}
+
+// IsCaregiverDue reports whether the caregiver should be told about a dose late by the given duration
+func (p EscalationPolicy) IsCaregiverDue(late time.Duration) bool {
+	return p.CaregiverEmail != "" && p.CaregiverAfterMinutes > 0 && late >= time.Duration(p.CaregiverAfterMinutes)*time.Minute
+}
+
+// IsMissed reports whether a dose late by the given duration is missed, gracePeriod applies when
+// the policy does not set its own
+func (p EscalationPolicy) IsMissed(late time.Duration, gracePeriod time.Duration) bool {
+	if p.MissedAfterMinutes > 0 {
+		gracePeriod = time.Duration(p.MissedAfterMinutes) * time.Minute
+	}
+	return late >= gracePeriod
+}
@@ -1,22 +1,51 @@
 package models
 
+import "time"
+
 type PushNotificationCategory string
 
 const (
 	NextMedicationCategory PushNotificationCategory = "NEXT_MEDICATION_CATEGORY"
 	WelcomeCategory        PushNotificationCategory = "WELCOME_CATEGORY"
+	RefillReminderCategory PushNotificationCategory = "REFILL_REMINDER_CATEGORY"
+	MissedDoseCategory     PushNotificationCategory = "MISSED_DOSE_CATEGORY"
 )
 
+// FCMNotificationToken is a device registered to receive push notifications.
+// A user has one per device, and a token only ever belongs to one device.
 type FCMNotificationToken struct {
 	Model
-	UserID   uint   `json:"user_id"`
-	Token    string `json:"token"`
-	IsViewed bool   `json:"is_viewed"`
+	UserID     uint      `json:"user_id" gorm:"index"`
+	Token      string    `json:"token" gorm:"uniqueIndex"`
+	Platform   string    `json:"platform"`
+	AppVersion string    `json:"app_version"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IsViewed   bool      `json:"is_viewed"`
 }
 
 type AddNotificationTokenArgs struct {
-	Token  string `json:"token" binding:"required"`
-	UserID uint   `json:"user_id"`
+	Token      string `json:"token" binding:"required"`
+	Platform   string `json:"platform" binding:"omitempty,oneof=ios android web"`
+	AppVersion string `json:"app_version"`
+	UserID     uint   `json:"user_id"`
+}
+
+type DeviceResponse struct {
+	ID         uint   `json:"id"`
+	Platform   string `json:"platform"`
+	AppVersion string `json:"app_version"`
+	LastSeenAt string `json:"last_seen_at"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func (t *FCMNotificationToken) ToDeviceResponse() *DeviceResponse {
+	return &DeviceResponse{
+		ID:         t.ID,
+		Platform:   t.Platform,
+		AppVersion: t.AppVersion,
+		LastSeenAt: t.LastSeenAt.Format(time.RFC3339),
+		CreatedAt:  time.Unix(t.CreatedAt, 0).UTC().Format(time.RFC3339),
+	}
 }
 
 type PushPayload struct {
@@ -26,3 +55,26 @@ type PushPayload struct {
 	ClickAction string                   `json:"clickAction"`
 	Category    PushNotificationCategory `json:"category"`
 }
+
+type PushDeliveryStatus string
+
+const (
+	PushDelivered PushDeliveryStatus = "delivered"
+	// PushInvalidToken means the device is gone for good, its token is pruned
+	PushInvalidToken PushDeliveryStatus = "invalid_token"
+	// PushUnavailable is a transient failure, the send is retried
+	PushUnavailable PushDeliveryStatus = "unavailable"
+	PushFailed      PushDeliveryStatus = "failed"
+)
+
+// PushDelivery records one attempt to send a push notification to a device, for auditing
+type PushDelivery struct {
+	Model
+	Token     string                   `json:"token" gorm:"index"`
+	Category  PushNotificationCategory `json:"category"`
+	Title     string                   `json:"title"`
+	Attempt   int                      `json:"attempt"`
+	Status    PushDeliveryStatus       `json:"status"`
+	MessageID string                   `json:"message_id"`
+	Error     string                   `json:"error"`
+}
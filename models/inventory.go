@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// DefaultRefillThresholdDays is how many days before running out the user is reminded to refill,
+// for medications that do not set their own threshold
+const DefaultRefillThresholdDays = 7
+
+// RefillRequest records that the user got more of a medication
+type RefillRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+// TracksInventory reports whether the stock of the medication is tracked
+func (m *Medication) TracksInventory() bool {
+	return m.PillCount != nil
+}
+
+// DoseUnits returns how many units of the stock a dose uses
+func (m *Medication) DoseUnits() int {
+	if m.UnitsPerDose < 1 {
+		return 1
+	}
+	return m.UnitsPerDose
+}
+
+// RefillThreshold returns how long before running out the user is reminded to refill
+func (m *Medication) RefillThreshold() time.Duration {
+	days := m.RefillThresholdDays
+	if days < 1 {
+		days = DefaultRefillThresholdDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// JobRun records a single run of a background job
+type JobRun struct {
+	Model
+	JobName string `json:"job_name" gorm:"index"`
+	// Worker identifies the process that ran the job as host:pid
+	Worker         string     `json:"worker"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	Error          string     `json:"error"`
+	ProcessedCount int        `json:"processed_count"`
+}
@@ -20,49 +20,102 @@ type Medication struct {
 	IsMedicationDone       bool      `json:"is_medication_done"`
 	MedicationIcon         string    `json:"medication_icon"`
 	UserID                 uint      `json:"user_id"`
+	// DependentID is set when the medication is taken by a dependent of the user rather than the user
+	DependentID *uint      `json:"dependent_id" gorm:"index"`
+	Dependent   *Dependent `json:"-" gorm:"foreignKey:DependentID"`
+	// PausedAt is set while the course is paused, no dose is due until it is resumed
+	PausedAt *time.Time `json:"paused_at"`
+	// PillCount is the stock of the medication, its inventory is not tracked while it is nil.
+	// Every dose taken uses UnitsPerDose of it.
+	PillCount           *int `json:"pill_count"`
+	UnitsPerDose        int  `json:"units_per_dose" gorm:"default:1"`
+	RefillThresholdDays int  `json:"refill_threshold_days"`
+	// RefillRemindedAt is set once a refill reminder went out, until the next refill
+	RefillRemindedAt *time.Time `json:"-"`
+	// Timezone is the IANA timezone of the owner, dose times are computed in its wall clock
+	Timezone string             `json:"timezone"`
+	Schedule MedicationSchedule `json:"schedule" gorm:"serializer:json"`
+	// EscalationPolicy applies to the doses of the medication that are not confirmed
+	EscalationPolicy EscalationPolicy `json:"escalation_policy" gorm:"serializer:json"`
+	// LastScheduledDoseTime is the latest dose occurrence generated for the medication, and
+	// DosesScheduledUntil the time up to which occurrences have been generated
+	LastScheduledDoseTime time.Time `json:"-"`
+	DosesScheduledUntil   time.Time `json:"-"`
+}
+
+// TimezoneChange holds the medications of a user moved to their new timezone, their doses after From are generated again
+type TimezoneChange struct {
+	Medications []Medication
+	From        time.Time
 }
 
 type UpdateMedicationRequest struct {
-	Name                   string `json:"name"`
-	Dosage                 int    `json:"dosage"`
-	TimeInterval           int    `json:"time_interval"` // min hour daily
-	MedicationStartDate    string `json:"medication_start_date"`
-	Duration               int    `json:"duration"`
-	MedicationPrescribedBy string `json:"medication_prescribed_by"`
-	MedicationStartTime    string `json:"medication_start_time"`
-	PurposeOfMedication    string `json:"purpose_of_medication"`
-	MedicationIcon         string `json:"medication_icon"`
+	Name                   string              `json:"name"`
+	Dosage                 int                 `json:"dosage"`
+	TimeInterval           int                 `json:"time_interval"` // min hour daily
+	MedicationStartDate    string              `json:"medication_start_date"`
+	Duration               int                 `json:"duration"`
+	MedicationPrescribedBy string              `json:"medication_prescribed_by"`
+	MedicationStartTime    string              `json:"medication_start_time"`
+	PurposeOfMedication    string              `json:"purpose_of_medication"`
+	MedicationIcon         string              `json:"medication_icon"`
+	Timezone               string              `json:"-"`
+	Schedule               *MedicationSchedule `json:"schedule"`
+	EscalationPolicy       *EscalationPolicy   `json:"escalation_policy"`
+	PillCount              *int                `json:"pill_count" binding:"omitempty,min=0"`
+	UnitsPerDose           int                 `json:"units_per_dose" binding:"omitempty,min=1"`
+	RefillThresholdDays    int                 `json:"refill_threshold_days" binding:"omitempty,min=1"`
 }
 
 type MedicationRequest struct {
-	Name                   string `json:"name" binding:"required"`
-	Dosage                 int    `json:"dosage" binding:"required"`
-	TimeInterval           int    `json:"time_interval" binding:"required"` // min hour daily
-	MedicationStartDate    string `json:"medication_start_date" binding:"required"`
-	Duration               int    `json:"duration" binding:"required"`
-	MedicationPrescribedBy string `json:"medication_prescribed_by" binding:"required"`
-	MedicationStartTime    string `json:"medication_start_time" binding:"required"`
-	PurposeOfMedication    string `json:"purpose_of_medication" binding:"required"`
-	MedicationIcon         string `json:"medication_icon" binding:"required"`
-	UserID                 uint   `json:"user_id"`
+	Name                   string              `json:"name" binding:"required"`
+	Dosage                 int                 `json:"dosage" binding:"required"`
+	TimeInterval           int                 `json:"time_interval"` // min hour daily, required for interval schedules
+	MedicationStartDate    string              `json:"medication_start_date" binding:"required"`
+	Duration               int                 `json:"duration" binding:"required"`
+	MedicationPrescribedBy string              `json:"medication_prescribed_by" binding:"required"`
+	MedicationStartTime    string              `json:"medication_start_time" binding:"required"`
+	PurposeOfMedication    string              `json:"purpose_of_medication" binding:"required"`
+	MedicationIcon         string              `json:"medication_icon" binding:"required"`
+	UserID                 uint                `json:"user_id"`
+	DependentID            *uint               `json:"dependent_id"`
+	Timezone               string              `json:"-"`
+	Schedule               *MedicationSchedule `json:"schedule"`
+	EscalationPolicy       *EscalationPolicy   `json:"escalation_policy"`
+	PillCount              *int                `json:"pill_count" binding:"omitempty,min=0"`
+	UnitsPerDose           int                 `json:"units_per_dose" binding:"omitempty,min=1"`
+	RefillThresholdDays    int                 `json:"refill_threshold_days" binding:"omitempty,min=1"`
+}
+
+// NextMedicationsRequest selects whose upcoming doses are listed, the user's own ones without a dependent
+type NextMedicationsRequest struct {
+	DependentID *uint `form:"dependent_id"`
 }
 
 type MedicationResponse struct {
-	ID                     uint   `json:"id"`
-	CreatedAt              string `json:"created_at"`
-	UpdatedAt              string `json:"updated_at"`
-	Name                   string `json:"name"`
-	Dosage                 int    `json:"dosage"`
-	TimeInterval           int    `json:"time_interval"` // min hour daily
-	MedicationStartDate    string `json:"medication_start_date"`
-	Duration               int    `json:"duration"`
-	MedicationPrescribedBy string `json:"medication_prescribed_by"`
-	MedicationStopDate     string `json:"medication_stop_date"`
-	MedicationStartTime    string `json:"medication_start_time"`
-	NextDosageTime         string `json:"next_dosage_time"`
-	PurposeOfMedication    string `json:"purpose_of_medication"`
-	MedicationIcon         string `json:"medication_icon"`
-	UserID                 uint   `json:"user_id"`
+	ID                     uint               `json:"id"`
+	CreatedAt              string             `json:"created_at"`
+	UpdatedAt              string             `json:"updated_at"`
+	Name                   string             `json:"name"`
+	Dosage                 int                `json:"dosage"`
+	TimeInterval           int                `json:"time_interval"` // min hour daily
+	MedicationStartDate    string             `json:"medication_start_date"`
+	Duration               int                `json:"duration"`
+	MedicationPrescribedBy string             `json:"medication_prescribed_by"`
+	MedicationStopDate     string             `json:"medication_stop_date"`
+	MedicationStartTime    string             `json:"medication_start_time"`
+	NextDosageTime         string             `json:"next_dosage_time"`
+	PurposeOfMedication    string             `json:"purpose_of_medication"`
+	MedicationIcon         string             `json:"medication_icon"`
+	UserID                 uint               `json:"user_id"`
+	DependentID            *uint              `json:"dependent_id"`
+	Timezone               string             `json:"timezone"`
+	Schedule               MedicationSchedule `json:"schedule"`
+	EscalationPolicy       EscalationPolicy   `json:"escalation_policy"`
+	PausedAt               string             `json:"paused_at,omitempty"`
+	PillCount              *int               `json:"pill_count"`
+	UnitsPerDose           int                `json:"units_per_dose"`
+	RefillThresholdDays    int                `json:"refill_threshold_days"`
 }
 
 type MedicationDetailResponse struct {
@@ -93,25 +146,64 @@ func (m *MedicationRequest) ReqToMedicationModel() *Medication {
 		PurposeOfMedication:    m.PurposeOfMedication,
 		MedicationIcon:         m.MedicationIcon,
 		UserID:                 m.UserID,
+		DependentID:            m.DependentID,
+		Timezone:               m.Timezone,
+		Schedule:               m.scheduleFromRequest(),
+		EscalationPolicy:       m.escalationPolicyFromRequest(),
+		PillCount:              m.PillCount,
+		UnitsPerDose:           m.UnitsPerDose,
+		RefillThresholdDays:    m.RefillThresholdDays,
 	}
 }
 
+func (m *MedicationRequest) scheduleFromRequest() MedicationSchedule {
+	if m.Schedule == nil {
+		return MedicationSchedule{}
+	}
+	return *m.Schedule
+}
+
+func (m *MedicationRequest) escalationPolicyFromRequest() EscalationPolicy {
+	if m.EscalationPolicy == nil {
+		return EscalationPolicy{}
+	}
+	return *m.EscalationPolicy
+}
+
+// Location returns the location dose times of the medication are computed and rendered in
+func (m *Medication) Location() *time.Location {
+	return LoadLocation(m.Timezone)
+}
+
 func (m *Medication) MedicationToResponse() *MedicationResponse {
+	loc := m.Location()
+	var pausedAt string
+	if m.PausedAt != nil {
+		pausedAt = m.PausedAt.In(loc).String()
+	}
 	return &MedicationResponse{
 		ID:                     m.ID,
-		CreatedAt:              time.Unix(m.CreatedAt, 0).String(),
-		UpdatedAt:              time.Unix(m.UpdatedAt, 0).String(),
+		CreatedAt:              time.Unix(m.CreatedAt, 0).In(loc).String(),
+		UpdatedAt:              time.Unix(m.UpdatedAt, 0).In(loc).String(),
 		Name:                   m.Name,
 		Dosage:                 m.Dosage,
 		TimeInterval:           m.TimeInterval,
-		MedicationStartDate:    m.MedicationStartDate.String(),
+		MedicationStartDate:    m.MedicationStartDate.In(loc).String(),
 		Duration:               m.Duration,
 		MedicationPrescribedBy: m.MedicationPrescribedBy,
-		MedicationStopDate:     m.MedicationStopDate.String(),
-		MedicationStartTime:    m.MedicationStartTime.String(),
-		NextDosageTime:         m.NextDosageTime.String(),
+		MedicationStopDate:     m.MedicationStopDate.In(loc).String(),
+		MedicationStartTime:    m.MedicationStartTime.In(loc).String(),
+		NextDosageTime:         m.NextDosageTime.In(loc).String(),
 		PurposeOfMedication:    m.PurposeOfMedication,
 		MedicationIcon:         m.MedicationIcon,
 		UserID:                 m.UserID,
+		DependentID:            m.DependentID,
+		Timezone:               m.Timezone,
+		Schedule:               m.Schedule,
+		EscalationPolicy:       m.EscalationPolicy,
+		PausedAt:               pausedAt,
+		PillCount:              m.PillCount,
+		UnitsPerDose:           m.UnitsPerDose,
+		RefillThresholdDays:    m.RefillThresholdDays,
 	}
 }
@@ -2,25 +2,47 @@ package models
 
 import "time"
 
+// values of MedicationHistory.WasMedicationMissed, it is empty while the dose is unconfirmed.
+// A skipped dose was left out on purpose by the user, rather than forgotten.
+const (
+	MedicationMissed    = "YES"
+	MedicationNotMissed = "NO"
+	MedicationSkipped   = "SKIPPED"
+)
+
 type MedicationHistory struct {
 	Model
-	MedicationName         string    `json:"medication_name"`
-	MedicationID           uint      `json:"medication_id"`
-	MedicationTime         time.Time `json:"medication_time"`
-	MedicationDosage       int       `json:"medication_dosage"`
-	UserID                 uint      `json:"user_id"`
-	HasMedicationBeenTaken bool      `json:"has_medication_been_taken"`
-	WasMedicationMissed    string    `json:"was_medication_missed"`
+	MedicationName   string    `json:"medication_name"`
+	MedicationID     uint      `json:"medication_id"`
+	DoseOccurrenceID uint      `json:"dose_occurrence_id" gorm:"index"`
+	MedicationTime   time.Time `json:"medication_time"`
+	MedicationDosage int       `json:"medication_dosage"`
+	UserID           uint      `json:"user_id"`
+	// DependentID is the dependent of the user the dose was for, if any
+	DependentID            *uint      `json:"dependent_id" gorm:"index"`
+	Dependent              *Dependent `json:"-" gorm:"foreignKey:DependentID"`
+	HasMedicationBeenTaken bool       `json:"has_medication_been_taken"`
+	WasMedicationMissed    string     `json:"was_medication_missed"`
+	Timezone               string     `json:"timezone"`
+	// EscalationPolicy is the policy of the medication when the dose was due
+	EscalationPolicy EscalationPolicy `json:"-" gorm:"serializer:json"`
+	// NudgesSent and CaregiverNotifiedAt track the escalation of the dose while it is unconfirmed
+	NudgesSent          int        `json:"-"`
+	CaregiverNotifiedAt *time.Time `json:"-"`
 }
 
-func NewMedicationHistory(medication Medication) *MedicationHistory {
+func NewMedicationHistory(occurrence DoseOccurrence) *MedicationHistory {
 	return &MedicationHistory{
-		MedicationName:         medication.Name,
-		MedicationID:           medication.ID,
-		MedicationDosage:       medication.Dosage,
-		MedicationTime:         medication.NextDosageTime,
-		UserID:                 medication.UserID,
+		MedicationName:         occurrence.Medication.Name,
+		MedicationID:           occurrence.MedicationID,
+		DoseOccurrenceID:       occurrence.ID,
+		MedicationDosage:       occurrence.Dosage,
+		MedicationTime:         occurrence.ScheduledAt,
+		UserID:                 occurrence.UserID,
+		DependentID:            occurrence.Medication.DependentID,
 		HasMedicationBeenTaken: false,
+		Timezone:               occurrence.Medication.Timezone,
+		EscalationPolicy:       occurrence.Medication.EscalationPolicy,
 	}
 
 }
@@ -31,23 +53,28 @@ type MedicationHistoryResponse struct {
 	UpdatedAt              string `json:"updated_at"`
 	MedicationName         string `json:"medication_name"`
 	MedicationID           uint   `json:"medication_id"`
+	DoseOccurrenceID       uint   `json:"dose_occurrence_id"`
 	MedicationTime         string `json:"medication_time"`
 	MedicationDosage       int    `json:"medication_dosage"`
 	UserID                 uint   `json:"user_id"`
+	DependentID            *uint  `json:"dependent_id"`
 	HasMedicationBeenTaken bool   `json:"has_medication_been_taken"`
 	WasMedicationMissed    string `json:"was_medication_missed"`
 }
 
 func (m *MedicationHistory) MedicationHistoryToResponse() *MedicationHistoryResponse {
+	loc := LoadLocation(m.Timezone)
 	return &MedicationHistoryResponse{
 		ID:                     m.ID,
-		CreatedAt:              time.Unix(m.CreatedAt, 0).String(),
-		UpdatedAt:              time.Unix(m.UpdatedAt, 0).String(),
+		CreatedAt:              time.Unix(m.CreatedAt, 0).In(loc).String(),
+		UpdatedAt:              time.Unix(m.UpdatedAt, 0).In(loc).String(),
 		MedicationName:         m.MedicationName,
 		MedicationID:           m.MedicationID,
-		MedicationTime:         m.MedicationTime.UTC().String(),
+		DoseOccurrenceID:       m.DoseOccurrenceID,
+		MedicationTime:         m.MedicationTime.In(loc).String(),
 		MedicationDosage:       m.MedicationDosage,
 		UserID:                 m.UserID,
+		DependentID:            m.DependentID,
 		HasMedicationBeenTaken: m.HasMedicationBeenTaken,
 		WasMedicationMissed:    m.WasMedicationMissed,
 	}
@@ -1,8 +1,23 @@
 package models
 
+import "time"
+
 type Model struct {
 	ID        uint  `json:"id" gorm:"primaryKey,autoIncrement"`
 	CreatedAt int64 `json:"created_at"`
 	UpdatedAt int64 `json:"updated_at"`
 	DeletedAt int64 `json:"deleted_at"`
 }
+
+// LoadLocation returns the location of an IANA timezone name,
+// falling back to UTC when the name is empty or unknown
+func LoadLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
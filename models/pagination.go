@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// PageRequest are the query parameters of a page of a list endpoint.
+// Cursor is the next_cursor of the previous page, empty for the first page.
+type PageRequest struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// PageLimit returns the number of items of the page, DefaultPageLimit when none is requested
+func (p PageRequest) PageLimit() int {
+	if p.Limit == 0 {
+		return DefaultPageLimit
+	}
+	return p.Limit
+}
+
+// Pagination is returned alongside a page of a list endpoint
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// MedicationCursor is the position of the last medication of a page in the requested sort order
+type MedicationCursor struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// MedicationHistoryCursor is the position of the last medication history of a page
+type MedicationHistoryCursor struct {
+	ID             uint      `json:"id"`
+	MedicationTime time.Time `json:"medication_time"`
+}
+
+// EncodeCursor turns a cursor into the opaque string handed to clients
+func EncodeCursor(cursor interface{}) string {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor reads a cursor produced by EncodeCursor
+func DecodeCursor(s string, cursor interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, cursor)
+}
+
+// MedicationListRequest filters and sorts the medications of a user
+type MedicationListRequest struct {
+	PageRequest
+	// Name matches medications whose name contains it
+	Name string `form:"name"`
+	// DependentID keeps the medications of a dependent, 0 the user's own ones, all are listed without it
+	DependentID *uint  `form:"dependent_id"`
+	Status      string `form:"status" binding:"omitempty,oneof=active paused done"`
+	Sort        string `form:"sort" binding:"omitempty,oneof=created name"`
+	Order       string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// MedicationHistoryListRequest filters the medication histories of a user, most recent first unless
+// order is asc. From and To are days in the user's timezone.
+type MedicationHistoryListRequest struct {
+	PageRequest
+	MedicationID uint `form:"medication_id"`
+	// DependentID keeps the doses of a dependent, 0 the user's own ones, all are listed without it
+	DependentID *uint  `form:"dependent_id"`
+	From        string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To          string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Status      string `form:"status" binding:"omitempty,oneof=taken missed skipped pending"`
+	Order       string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Timezone    string `form:"-"`
+}
+
+// MedicationFilter selects a page of medications, After being the cursor of the previous page
+type MedicationFilter struct {
+	Name        string
+	DependentID *uint
+	Status      string
+	Sort        string
+	Order       string
+	After       *MedicationCursor
+	Limit       int
+}
+
+// MedicationHistoryFilter selects a page of medication histories due in [From, To), zero times leave
+// the range open
+type MedicationHistoryFilter struct {
+	MedicationID uint
+	DependentID  *uint
+	From         time.Time
+	To           time.Time
+	Status       string
+	Order        string
+	After        *MedicationHistoryCursor
+	Limit        int
+}
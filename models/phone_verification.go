@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// PhoneVerification is a code texted to the phone number of a user, only its hash is stored.
+// A user has at most one, requesting a new code replaces it.
+type PhoneVerification struct {
+	Model
+	UserID      uint   `json:"user_id" gorm:"uniqueIndex"`
+	PhoneNumber string `json:"phone_number"`
+	CodeHash    string `json:"-"`
+	// Attempts counts the codes entered, the verification stops working after too many wrong ones
+	Attempts  int   `json:"attempts"`
+	ExpiresAt int64 `json:"expires_at" gorm:"index"`
+}
+
+// IsPhoneVerified reports whether the user proved the current phone number is theirs
+func (u *User) IsPhoneVerified() bool {
+	return u.PhoneVerifiedAt != nil
+}
+
+// CanReceiveSMS reports whether text messages can be sent to the user, requireVerified only allows verified phone numbers
+func (u *User) CanReceiveSMS(requireVerified bool) bool {
+	if !u.Preferences.SMSNotifications || u.PhoneNumber == "" {
+		return false
+	}
+	return u.IsPhoneVerified() || !requireVerified
+}
+
+// PhoneVerificationResponse tells when the code that was texted expires
+type PhoneVerificationResponse struct {
+	PhoneNumber string `json:"phone_number"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+func (v *PhoneVerification) ToResponse() *PhoneVerificationResponse {
+	return &PhoneVerificationResponse{
+		PhoneNumber: v.PhoneNumber,
+		ExpiresAt:   time.Unix(v.ExpiresAt, 0).UTC().Format(time.RFC3339),
+	}
+}
+
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
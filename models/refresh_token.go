@@ -0,0 +1,27 @@
+package models
+
+// RefreshToken records every refresh token issued so that rotations can be
+// tracked per family and reuse of an already rotated token can be detected
+type RefreshToken struct {
+	Model
+	UserID     uint   `json:"user_id"`
+	Email      string `json:"email" gorm:"index"`
+	TokenID    string `json:"token_id" gorm:"uniqueIndex"`
+	FamilyID   string `json:"family_id" gorm:"index"`
+	SessionID  uint   `json:"session_id" gorm:"index"`
+	ExpiresAt  int64  `json:"expires_at"`
+	RevokedAt  int64  `json:"revoked_at"`
+	ReplacedBy string `json:"replaced_by"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// TwoFactorRequired is set instead of the tokens when a two-factor code has to be sent along with ChallengeToken
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+type ScheduleType string
+
+const (
+	// IntervalSchedule takes a dose every TimeInterval hours, restarting at 9:00 every day
+	IntervalSchedule ScheduleType = "interval"
+	// TimesOfDaySchedule takes a dose at fixed wall clock times
+	TimesOfDaySchedule ScheduleType = "times_of_day"
+	// AsNeededSchedule is for PRN medications, which never have a scheduled dose
+	AsNeededSchedule ScheduleType = "as_needed"
+)
+
+// MedicationSchedule describes when the doses of a medication are due.
+// The zero value is an interval schedule, which is how medications created before schedules existed behave.
+type MedicationSchedule struct {
+	Type ScheduleType `json:"type" binding:"omitempty,oneof=interval times_of_day as_needed"`
+	// TimesOfDay holds the times of the daily doses in "15:04" format
+	TimesOfDay []string `json:"times_of_day,omitempty" binding:"omitempty,dive,datetime=15:04"`
+	// Weekdays restricts the doses to the given days of the week, 0 being Sunday
+	Weekdays []time.Weekday `json:"weekdays,omitempty" binding:"omitempty,dive,min=0,max=6"`
+	// EveryNDays only takes doses every n days counting from the medication start date
+	EveryNDays int `json:"every_n_days,omitempty" binding:"omitempty,min=1"`
+	// TaperSteps changes the dosage over the course of the medication
+	TaperSteps []TaperStep `json:"taper_steps,omitempty" binding:"omitempty,dive"`
+}
+
+// TaperStep is a dosage that is taken for a number of days before moving on to the next step
+type TaperStep struct {
+	Days   int `json:"days" binding:"required,min=1"`
+	Dosage int `json:"dosage" binding:"required,min=1"`
+}
+
+// ScheduleType returns the type of the medication's schedule, defaulting to an interval schedule
+func (m *Medication) ScheduleType() ScheduleType {
+	if m.Schedule.Type == "" {
+		return IntervalSchedule
+	}
+	return m.Schedule.Type
+}
+
+// IsAsNeeded reports whether the medication is only taken as needed and never reminded about
+func (m *Medication) IsAsNeeded() bool {
+	return m.ScheduleType() == AsNeededSchedule
+}
+
+// IsDoseDay reports whether doses are due on the calendar day of t in the medication's timezone
+func (m *Medication) IsDoseDay(t time.Time) bool {
+	if m.IsAsNeeded() {
+		return false
+	}
+	t = t.In(m.Location())
+	if len(m.Schedule.Weekdays) > 0 {
+		found := false
+		for _, weekday := range m.Schedule.Weekdays {
+			if weekday == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if m.Schedule.EveryNDays > 1 {
+		return m.daysSinceStart(t)%m.Schedule.EveryNDays == 0
+	}
+	return true
+}
+
+// DoseTimesOn returns the fixed dose times of a times of day schedule on the calendar day of t, in order
+func (m *Medication) DoseTimesOn(t time.Time) []time.Time {
+	loc := m.Location()
+	year, month, day := t.In(loc).Date()
+	var doseTimes []time.Time
+	for _, timeOfDay := range m.Schedule.TimesOfDay {
+		clock, err := time.Parse("15:04", timeOfDay)
+		if err != nil {
+			continue
+		}
+		doseTimes = append(doseTimes, time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, loc))
+	}
+	sort.Slice(doseTimes, func(i, j int) bool { return doseTimes[i].Before(doseTimes[j]) })
+	return doseTimes
+}
+
+// DosageAt returns the dosage due at t, following the taper steps when the medication has any.
+// Once every step has passed the dosage of the last step is kept.
+func (m *Medication) DosageAt(t time.Time) int {
+	if len(m.Schedule.TaperSteps) == 0 {
+		return m.Dosage
+	}
+	days := m.daysSinceStart(t.In(m.Location()))
+	for _, step := range m.Schedule.TaperSteps {
+		if days < step.Days {
+			return step.Dosage
+		}
+		days -= step.Days
+	}
+	return m.Schedule.TaperSteps[len(m.Schedule.TaperSteps)-1].Dosage
+}
+
+// daysSinceStart counts calendar days between the start date and t, which is unaffected by DST changes
+func (m *Medication) daysSinceStart(t time.Time) int {
+	start := m.MedicationStartTime.In(m.Location())
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int(day.Sub(startDay).Hours() / 24)
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Types of security events
+const (
+	SecurityEventLogin           = "login"
+	SecurityEventNewDeviceLogin  = "new_device_login"
+	SecurityEventAccountLocked   = "account_locked"
+	SecurityEventAccountUnlocked = "account_unlocked"
+	SecurityEventTwoFactorOn     = "two_factor_enabled"
+	SecurityEventTwoFactorOff    = "two_factor_disabled"
+	SecurityEventPhoneVerified   = "phone_verified"
+)
+
+// SecurityEvent records something that happened to the security of an account, for the user and support staff to review
+type SecurityEvent struct {
+	Model
+	UserID    uint   `json:"user_id" gorm:"index"`
+	Type      string `json:"type"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+type SecurityEventResponse struct {
+	ID        uint   `json:"id"`
+	Type      string `json:"type"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (e *SecurityEvent) SecurityEventToResponse() *SecurityEventResponse {
+	return &SecurityEventResponse{
+		ID:        e.ID,
+		Type:      e.Type,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		CreatedAt: time.Unix(e.CreatedAt, 0).Format(time.RFC3339),
+	}
+}
+
+// RateLimit counts the hits on a key during a fixed window. It is shared by every replica of the api.
+type RateLimit struct {
+	Key         string    `gorm:"primaryKey"`
+	Hits        int64     `gorm:"not null"`
+	WindowStart time.Time `gorm:"index;not null"`
+}
+
+// IsLocked reports whether the account is locked out after too many wrong passwords
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(now)
+}
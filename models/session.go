@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device. Every token issued for the login carries the ID of its session,
+// so that revoking the session signs the device out.
+type Session struct {
+	Model
+	UserID     uint   `json:"user_id" gorm:"index"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	LastUsedAt int64  `json:"last_used_at"`
+	// ExpiresAt follows the expiry of the latest refresh token of the session
+	ExpiresAt int64 `json:"expires_at"`
+	RevokedAt int64 `json:"revoked_at"`
+}
+
+// IsActive reports whether tokens of the session are still accepted
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == 0 && s.ExpiresAt > now.Unix()
+}
+
+type SessionResponse struct {
+	ID         uint   `json:"id"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	// Current is set on the session the request was made with
+	Current bool `json:"current"`
+}
+
+func (s *Session) SessionToResponse(currentSessionID uint) *SessionResponse {
+	return &SessionResponse{
+		ID:         s.ID,
+		Device:     s.Device,
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		CreatedAt:  time.Unix(s.CreatedAt, 0).Format(time.RFC3339),
+		LastUsedAt: time.Unix(s.LastUsedAt, 0).Format(time.RFC3339),
+		Current:    s.ID == currentSessionID,
+	}
+}
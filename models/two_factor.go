@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// RecoveryCodeCount is how many recovery codes are handed out when two-factor authentication is enabled
+const RecoveryCodeCount = 10
+
+// RecoveryCode lets a user who lost their authenticator log in once, only its hash is stored
+type RecoveryCode struct {
+	Model
+	UserID   uint       `json:"user_id" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"index"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+// HasTwoFactor reports whether the user confirmed two-factor authentication
+func (u *User) HasTwoFactor() bool {
+	return u.TwoFactorEnabledAt != nil
+}
+
+// TwoFactorEnrollResponse is the secret to add to an authenticator app, ProvisioningURI is meant to be shown as a QR code
+type TwoFactorEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// RecoveryCodesResponse holds recovery codes, they are only ever shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorLoginRequest finishes a login with either a code of the authenticator or a recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode   string `json:"recovery_code" binding:"required_without=Code"`
+	ClientInfo     `json:"-"`
+}
+
+// TwoFactorDisableRequest proves it is the user turning off two-factor authentication, with either their password or a recovery code
+type TwoFactorDisableRequest struct {
+	Password     string `json:"password" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Password"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	goval "github.com/go-passwd/validator"
 	"github.com/go-playground/locales/en"
@@ -23,6 +24,70 @@ type User struct {
 	IsEmailActive  bool   `json:"-"`
 	Social         string `json:"-"`
 	AccessToken    string `json:"-"`
+	// PendingEmail holds a new email address until it has been verified
+	PendingEmail string          `json:"-"`
+	Timezone     string          `json:"timezone" gorm:"default:UTC" binding:"omitempty,timezone"`
+	AvatarURL    string          `json:"-"`
+	Preferences  UserPreferences `json:"-" gorm:"embedded;embeddedPrefix:preference_"`
+	// Role grants access to the admin api, it is never bound from requests
+	Role string `json:"-" gorm:"default:user"`
+	// DisabledAt is set while an admin has disabled the account
+	DisabledAt *time.Time `json:"-"`
+	// PasswordResetRequired blocks logging in with the current password until it is reset
+	PasswordResetRequired bool `json:"-"`
+	// FailedLoginCount counts the wrong passwords entered since the last successful login
+	FailedLoginCount  int        `json:"-"`
+	LastFailedLoginAt *time.Time `json:"-"`
+	// LockedUntil is set when too many wrong passwords were entered in a row
+	LockedUntil *time.Time `json:"-"`
+	// TwoFactorSecret is the TOTP secret of the user, it only protects logins once TwoFactorEnabledAt is set
+	TwoFactorSecret    string     `json:"-"`
+	TwoFactorEnabledAt *time.Time `json:"-"`
+	// TwoFactorLastStep is the TOTP step of the last code used, so that no code can be used twice
+	TwoFactorLastStep int64 `json:"-"`
+	// VerificationSentAt is when the last verification link was sent, links sent before it no longer work
+	VerificationSentAt int64 `json:"-"`
+	// PhoneVerifiedAt is set once a code texted to the phone number was entered, changing the number unsets it
+	PhoneVerifiedAt *time.Time `json:"-"`
+}
+
+type UserPreferences struct {
+	PushNotifications  bool   `json:"push_notifications" gorm:"default:true"`
+	EmailNotifications bool   `json:"email_notifications" gorm:"default:true"`
+	SMSNotifications   bool   `json:"sms_notifications" gorm:"default:false"`
+	Language           string `json:"language" gorm:"default:en" validate:"omitempty,bcp47_language_tag"`
+}
+
+// UpdateUserRequest holds the profile fields a user can edit, fields left empty are not changed
+type UpdateUserRequest struct {
+	Name        string                    `json:"name" conform:"trim" validate:"omitempty,min=2"`
+	Email       string                    `json:"email" conform:"trim" validate:"omitempty,email"`
+	PhoneNumber string                    `json:"phone_number" conform:"trim" validate:"omitempty,e164"`
+	Timezone    string                    `json:"timezone" conform:"trim" validate:"omitempty,timezone"`
+	AvatarURL   string                    `json:"avatar_url" conform:"trim" validate:"omitempty,url"`
+	Preferences *UpdatePreferencesRequest `json:"preferences"`
+}
+
+// UpdatePreferencesRequest holds the preferences a user can change, preferences left out are not changed
+type UpdatePreferencesRequest struct {
+	PushNotifications  *bool   `json:"push_notifications"`
+	EmailNotifications *bool   `json:"email_notifications"`
+	SMSNotifications   *bool   `json:"sms_notifications"`
+	Language           *string `json:"language" validate:"omitempty,bcp47_language_tag"`
+}
+
+type ProfileResponse struct {
+	ID            uint            `json:"id"`
+	CreatedAt     string          `json:"created_at"`
+	Name          string          `json:"name"`
+	Email         string          `json:"email"`
+	PendingEmail  string          `json:"pending_email"`
+	IsEmailActive bool            `json:"is_email_active"`
+	PhoneNumber   string          `json:"phone_number"`
+	PhoneVerified bool            `json:"phone_verified"`
+	Timezone      string          `json:"timezone"`
+	AvatarURL     string          `json:"avatar_url"`
+	Preferences   UserPreferences `json:"preferences"`
 }
 
 func ValidateStruct(req interface{}) []error {
@@ -68,9 +133,24 @@ type UserResponse struct {
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	ClientInfo `json:"-"`
 }
+
+// ClientInfo identifies where a login comes from, it is set by the handler
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	// Device is the name the app gives the device, if any
+	Device string
+}
+
+// ResendVerificationRequest asks for a new link to verify the email of an account
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
 type ForgotPassword struct {
 	Email string `json:"email" binding:"required,email"`
 }
@@ -91,7 +171,28 @@ type GoogleAuthResponse struct {
 
 type LoginResponse struct {
 	UserResponse
-	AccessToken string
+	AccessToken  string
+	RefreshToken string
+	// TwoFactorRequired is set instead of the tokens when the password was right but the user has to send
+	// a two-factor code along with ChallengeToken to finish logging in
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+func (u *User) ToProfileResponse() *ProfileResponse {
+	return &ProfileResponse{
+		ID:            u.ID,
+		CreatedAt:     time.Unix(u.CreatedAt, 0).String(),
+		Name:          u.Name,
+		Email:         u.Email,
+		PendingEmail:  u.PendingEmail,
+		IsEmailActive: u.IsEmailActive,
+		PhoneNumber:   u.PhoneNumber,
+		PhoneVerified: u.IsPhoneVerified(),
+		Timezone:      u.Timezone,
+		AvatarURL:     u.AvatarURL,
+		Preferences:   u.Preferences,
+	}
 }
 
 // VerifyPassword verifies the collected password with the user's hashed password
@@ -100,7 +201,7 @@ func (u *User) VerifyPassword(password string) error {
 }
 
 // LoginUserToDto responsible for creating a response object for the handleLogin handler
-func (u *User) LoginUserToDto(token string) *LoginResponse {
+func (u *User) LoginUserToDto(accessToken, refreshToken string) *LoginResponse {
 	return &LoginResponse{
 		UserResponse: UserResponse{
 			ID:          u.ID,
@@ -108,6 +209,7 @@ func (u *User) LoginUserToDto(token string) *LoginResponse {
 			PhoneNumber: u.PhoneNumber,
 			Email:       u.Email,
 		},
-		AccessToken: token,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 	}
 }
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleAdminGetUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userListRequest models.UserListRequest
+		if err := decodeQuery(c, &userListRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		users, pagination, err := s.AdminService.GetUsers(&userListRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.Paginated(c, "users retrieved successfully", http.StatusOK, users, pagination)
+	}
+}
+
+func (s *Server) handleAdminGetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		user, err := s.AdminService.GetUser(uint(userID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "user retrieved successfully", http.StatusOK, user, nil)
+	}
+}
+
+func (s *Server) handleAdminGetSecurityEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		events, err := s.SecurityService.GetSecurityEvents(uint(userID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "security events retrieved successfully", http.StatusOK, events, nil)
+	}
+}
+
+func (s *Server) handleDisableUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, admin, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.AdminService.DisableUser(admin, uint(userID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "user disabled successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleEnableUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.AdminService.EnableUser(uint(userID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "user enabled successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleUpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, admin, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var updateRoleRequest models.UpdateRoleRequest
+		if err := decode(c, &updateRoleRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		if err := s.AdminService.UpdateRole(admin, uint(userID), &updateRoleRequest); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "role updated successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleResendVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.AdminService.ResendVerification(uint(userID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "verification email sent", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleForcePasswordReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, staff, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.AdminService.ForcePasswordReset(staff, uint(userID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "password reset email sent", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleGetSystemStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var statsRequest models.StatsRequest
+		if err := decodeQuery(c, &statsRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		stats, err := s.AdminService.GetStats(&statsRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "stats retrieved successfully", http.StatusOK, stats, nil)
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminGetUsersHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		role          string
+		query         string
+		buildStubs    func(service *mocks.MockAdminService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "support staff case",
+			role:  models.RoleSupport,
+			query: "?search=tobi&status=unverified&limit=10",
+			buildStubs: func(service *mocks.MockAdminService) {
+				request := &models.UserListRequest{
+					PageRequest: models.PageRequest{Limit: 10},
+					Search:      "tobi",
+					Status:      "unverified",
+				}
+				service.EXPECT().GetUsers(request).Times(1).
+					Return([]models.AdminUserResponse{{ID: 4, Name: "Tobi"}}, &models.Pagination{Limit: 10}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"pagination"`)
+			},
+		},
+		{
+			name:  "regular user case",
+			role:  models.RoleUser,
+			query: "",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().GetUsers(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:  "invalid status case",
+			role:  models.RoleAdmin,
+			query: "?status=sleeping",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().GetUsers(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "internal server error case",
+			role:  models.RoleAdmin,
+			query: "",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().GetUsers(gomock.Any()).Times(1).Return(nil, nil, errors.ErrInternalServerError)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAdminService := mocks.NewMockAdminService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AdminService = mockAdminService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			staff := user
+			staff.Role = tc.role
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&staff, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockAdminService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/admin/users"+tc.query, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestDisableUserHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+	disabledAt := time.Now()
+
+	testCases := []struct {
+		name          string
+		role          string
+		disabledAt    *time.Time
+		userID        string
+		buildStubs    func(service *mocks.MockAdminService, admin *models.User)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "success case",
+			role:   models.RoleAdmin,
+			userID: "4",
+			buildStubs: func(service *mocks.MockAdminService, admin *models.User) {
+				service.EXPECT().DisableUser(admin, uint(4)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "support staff case",
+			role:   models.RoleSupport,
+			userID: "4",
+			buildStubs: func(service *mocks.MockAdminService, admin *models.User) {
+				service.EXPECT().DisableUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:       "disabled admin case",
+			role:       models.RoleAdmin,
+			disabledAt: &disabledAt,
+			userID:     "4",
+			buildStubs: func(service *mocks.MockAdminService, admin *models.User) {
+				service.EXPECT().DisableUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "invalid id case",
+			role:   models.RoleAdmin,
+			userID: "four",
+			buildStubs: func(service *mocks.MockAdminService, admin *models.User) {
+				service.EXPECT().DisableUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "user not found case",
+			role:   models.RoleAdmin,
+			userID: "4",
+			buildStubs: func(service *mocks.MockAdminService, admin *models.User) {
+				service.EXPECT().DisableUser(admin, uint(4)).Times(1).
+					Return(errors.New("user not found", http.StatusNotFound))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAdminService := mocks.NewMockAdminService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AdminService = mockAdminService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := user
+			admin.Role = tc.role
+			admin.DisabledAt = tc.disabledAt
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&admin, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockAdminService, &admin)
+
+			recorder := httptest.NewRecorder()
+			url := fmt.Sprintf("/api/v1/admin/users/%s/disable", tc.userID)
+			req, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestUpdateUserRoleHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+	user.Role = models.RoleAdmin
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockAdminService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"role": "support"},
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().UpdateRole(&user, uint(4), &models.UpdateRoleRequest{Role: models.RoleSupport}).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "unknown role case",
+			reqBody: gin.H{"role": "superuser"},
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().UpdateRole(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAdminService := mocks.NewMockAdminService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AdminService = mockAdminService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockAdminService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPut, "/api/v1/admin/users/4/role", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
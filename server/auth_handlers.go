@@ -9,7 +9,6 @@ import (
 
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
@@ -40,6 +39,7 @@ func (s *Server) handleLogin() gin.HandlerFunc {
 			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
 			return
 		}
+		loginRequest.ClientInfo = clientInfo(c)
 		userResponse, err := s.AuthService.LoginUser(&loginRequest)
 		if err != nil {
 			response.JSON(c, "", err.Status, nil, err)
@@ -49,10 +49,32 @@ func (s *Server) handleLogin() gin.HandlerFunc {
 	}
 }
 
+// clientInfo returns where the request comes from, for the security events and sessions of logins.
+// Apps can name the device in the X-Device-Name header.
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent(), Device: c.GetHeader("X-Device-Name")}
+}
+
+func (s *Server) handleRefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var refreshTokenRequest models.RefreshTokenRequest
+		if err := decode(c, &refreshTokenRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		tokens, err := s.AuthService.RefreshToken(refreshTokenRequest.RefreshToken)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "token refreshed successfully", http.StatusOK, tokens, nil)
+	}
+}
+
 func (s *Server) HandleGoogleOauthLogin() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		conf := config.GetGoogleOAuthConfig(s.Config.GoogleClientID, s.Config.GoogleClientSecret, s.Config.GoogleRedirectURL)
-		state, err := jwt.GenerateToken("", s.Config.JWTSecret)
+		state, err := jwt.GeneratePurposeToken(jwt.OAuthStateTokenType, "", s.Config.JWTSecret)
 		if err != nil {
 			response.JSON(c, "", http.StatusInternalServerError, nil, err)
 			return
@@ -67,8 +89,7 @@ func (s *Server) HandleGoogleCallback() gin.HandlerFunc {
 		var state = c.Query("state")
 		var code = c.Query("code")
 
-		_, err := jwt.ValidateToken(state, s.Config.JWTSecret)
-		if err != nil {
+		if err := s.consumeOAuthState(state); err != nil {
 			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid login", http.StatusUnauthorized))
 			return
 		}
@@ -89,6 +110,15 @@ func (s *Server) HandleGoogleCallback() gin.HandlerFunc {
 	}
 }
 
+// consumeOAuthState checks the state an oauth provider sent back was generated by us and was not used before
+func (s *Server) consumeOAuthState(state string) error {
+	claims, err := jwt.ValidatePurposeToken(state, jwt.OAuthStateTokenType, s.Config.JWTSecret)
+	if err != nil {
+		return err
+	}
+	return s.AuthRepository.ConsumeToken(&models.BlackList{Token: state, ExpiresAt: jwt.GetExpiry(claims)})
+}
+
 func GetValuesFromContext(c *gin.Context) (string, *models.User, *errors.Error) {
 	var tokenI, userI interface{}
 	var tokenExists, userExists bool
@@ -111,6 +141,25 @@ func GetValuesFromContext(c *gin.Context) (string, *models.User, *errors.Error)
 	return token, user, nil
 }
 
+// getSessionID returns the session the request was authorized with, or 0 for tokens issued before sessions existed
+func getSessionID(c *gin.Context) uint {
+	return c.GetUint("session_id")
+}
+
+// GetOwnerFromContext returns the user whose medications the request acts on: the patient on the
+// caregiver routes authorized by AuthorizeCare, the signed in user everywhere else
+func GetOwnerFromContext(c *gin.Context) (*models.User, *errors.Error) {
+	if patientI, exists := c.Get("patient"); exists {
+		patient, ok := patientI.(*models.User)
+		if !ok {
+			return nil, errors.New("internal server error", http.StatusInternalServerError)
+		}
+		return patient, nil
+	}
+	_, user, err := GetValuesFromContext(c)
+	return user, err
+}
+
 func (s *Server) handleLogout() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token, user, err := GetValuesFromContext(c)
@@ -118,22 +167,30 @@ func (s *Server) handleLogout() gin.HandlerFunc {
 			response.JSON(c, "", err.Status, nil, err)
 			return
 		}
+		if sessionID := getSessionID(c); sessionID != 0 {
+			if err := s.SessionService.RevokeSession(user, sessionID); err != nil {
+				err.Respond(c)
+				return
+			}
+			response.JSON(c, "logout successful", http.StatusOK, nil, nil)
+			return
+		}
+
+		// tokens issued before sessions existed are revoked through the blacklist
 		claims, errr := jwt.ValidateAndGetClaims(token, s.Config.JWTSecret)
 		if errr != nil {
 			response.JSON(c, "", http.StatusUnauthorized, nil, errr)
 			return
 		}
-		convertClaims, _ := claims["exp"].(int64) //jwt pkg to validate
-		if convertClaims < time.Now().Unix() {
-			accBlacklist := &models.BlackList{
-				Email: user.Email,
-				Token: token,
-			}
-			if err := s.AuthRepository.AddToBlackList(accBlacklist); err != nil {
-				log.Printf("can't add access token to blacklist: %v\n", err)
-				response.JSON(c, "logout failed", http.StatusInternalServerError, nil, errors.New("can't add access token to blacklist", http.StatusInternalServerError))
-				return
-			}
+		accBlacklist := &models.BlackList{
+			Email:     user.Email,
+			Token:     token,
+			ExpiresAt: jwt.GetExpiry(claims),
+		}
+		if err := s.AuthRepository.AddToBlackList(accBlacklist); err != nil {
+			log.Printf("can't add access token to blacklist: %v\n", err)
+			response.JSON(c, "logout failed", http.StatusInternalServerError, nil, errors.New("can't add access token to blacklist", http.StatusInternalServerError))
+			return
 		}
 		response.JSON(c, "logout successful", http.StatusOK, nil, nil)
 
@@ -143,7 +200,7 @@ func (s *Server) handleLogout() gin.HandlerFunc {
 func (s *Server) handleFBLogin() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		conf := config.GetFacebookOAuthConfig(s.Config.FacebookClientID, s.Config.FacebookClientSecret, s.Config.FacebookRedirectURL)
-		state, err := jwt.GenerateToken("", s.Config.JWTSecret)
+		state, err := jwt.GeneratePurposeToken(jwt.OAuthStateTokenType, "", s.Config.JWTSecret)
 		if err != nil {
 			response.JSON(c, "", http.StatusInternalServerError, nil, err)
 			return
@@ -158,8 +215,7 @@ func (s *Server) fbCallbackHandler() gin.HandlerFunc {
 		var state = c.Query("state")
 		var code = c.Query("code")
 
-		_, err := jwt.ValidateToken(state, s.Config.JWTSecret)
-		if err != nil {
+		if err := s.consumeOAuthState(state); err != nil {
 			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid login", http.StatusUnauthorized))
 			return
 		}
@@ -178,13 +234,8 @@ func (s *Server) fbCallbackHandler() gin.HandlerFunc {
 			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid authToken", http.StatusUnauthorized))
 			return
 		}
-		result := struct {
-			AccessToken *string `json:"access_token"`
-		}{
-			AccessToken: authToken,
-		}
 
-		response.JSON(c, "facebook sign in successful", http.StatusOK, result, nil)
+		response.JSON(c, "facebook sign in successful", http.StatusOK, authToken, nil)
 	}
 }
 
@@ -205,36 +256,106 @@ func (s *Server) handleDeleteUserByEmail() gin.HandlerFunc {
 	}
 }
 
-func (s *Server) handleGetUsers() gin.HandlerFunc {
+func (s *Server) handleUpdateUserDetails() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		response.JSON(c, "successful", http.StatusOK, nil, nil)
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var updateUserRequest models.UpdateUserRequest
+		if err := decode(c, &updateUserRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		profile, err := s.AuthService.UpdateUserProfile(user, &updateUserRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		message := "profile updated successfully"
+		if profile.PendingEmail != "" {
+			message = "profile updated successfully, check your new email for verification"
+		}
+		response.JSON(c, message, http.StatusOK, profile, nil)
 	}
 }
 
-func (s *Server) handleUpdateUserDetails() gin.HandlerFunc {
+func (s *Server) handleShowProfile() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		response.JSON(c, "successful", http.StatusOK, nil, nil)
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "profile retrieved successfully", http.StatusOK, user.ToProfileResponse(), nil)
 	}
 }
 
-func (s *Server) handleShowProfile() gin.HandlerFunc {
+func (s *Server) handleGetSecurityEvents() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		events, err := s.SecurityService.GetSecurityEvents(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "security events retrieved successfully", http.StatusOK, events, nil)
+	}
+}
 
-		response.JSON(c, "successful", http.StatusOK, nil, nil)
+func (s *Server) handleUnlockAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.AuthService.UnlockAccount(c.Param("token")); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "account unlocked, login to continue", http.StatusOK, nil, nil)
 	}
 }
 
+// HandleVerifyEmail is opened from the verification email, so it answers with a page instead of json
 func (s *Server) HandleVerifyEmail() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		paramToken := c.Param("token")
-		err := s.AuthService.VerifyEmail(paramToken)
-		if err != nil {
+		err := s.AuthService.VerifyEmail(c.Param("token"))
+		switch {
+		case err == nil:
+			renderVerifyEmailPage(c, http.StatusOK, "Email verified!", "Proceed to the login page")
+		case err == errors.ErrEmailAlreadyVerified:
+			renderVerifyEmailPage(c, http.StatusOK, "Email already verified", "Your email was verified before, proceed to the login page")
+		case err.Status == http.StatusInternalServerError:
+			renderVerifyEmailPage(c, http.StatusInternalServerError, "Something went wrong", "Your email could not be verified, open the link again later")
+		default:
+			renderVerifyEmailPage(c, http.StatusBadRequest, "Link expired",
+				"This link has expired or was replaced by a newer one, request a new verification link from the app")
+		}
+	}
+}
+
+func renderVerifyEmailPage(c *gin.Context, status int, heading, message string) {
+	c.HTML(status, "verifyemail.html", gin.H{
+		"title":   "Verify email",
+		"heading": heading,
+		"message": message,
+	})
+}
+
+// handleRequestVerificationEmail sends a new verification link to an account that is not verified yet
+func (s *Server) handleRequestVerificationEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.ResendVerificationRequest
+		if err := decode(c, &request); err != nil {
 			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		if err := s.AuthService.RequestVerificationEmail(&request); err != nil {
+			err.Respond(c)
+			return
 		}
-		c.HTML(http.StatusOK, "index.html", gin.H{
-			"title": "Main website",
-		})
+		response.JSON(c, "if the email belongs to an account that is not verified, a new verification link was sent", http.StatusOK, nil, nil)
 	}
 }
@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
@@ -280,8 +281,71 @@ func TestLoginHandler(t *testing.T) {
 	}
 }
 
+func TestRefreshTokenHandler(t *testing.T) {
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockAuthService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"refresh_token": "refresh-token"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().RefreshToken("refresh-token").Times(1).
+					Return(&models.TokenResponse{AccessToken: "new-access", RefreshToken: "new-refresh"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "new-refresh")
+			},
+		},
+		{
+			name:    "reused token case",
+			reqBody: gin.H{"refresh_token": "used-token"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().RefreshToken("used-token").Times(1).
+					Return(nil, errors.New("refresh token has already been used", http.StatusUnauthorized))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "refresh token has already been used")
+			},
+		},
+		{
+			name:    "bad request case",
+			reqBody: gin.H{},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().RefreshToken(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockService := mocks.NewMockAuthService(ctrl)
+			testServer.handler.AuthService = mockService
+			tc.buildStubs(mockService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
 func Test_FacebookCallBackHandler(t *testing.T) {
-	testOauthState, err := jwt.GenerateToken("", testServer.handler.Config.JWTSecret)
+	testOauthState, err := jwt.GeneratePurposeToken(jwt.OAuthStateTokenType, "", testServer.handler.Config.JWTSecret)
+	require.NoError(t, err)
+	tokenPair, err := jwt.GenerateTokenPair("email@gmail.com", "", 0, testServer.handler.Config.JWTSecret)
 	require.NoError(t, err)
 
 	// test cases
@@ -290,15 +354,40 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 		state                 string
 		code                  string
 		inputToken            string
-		facebookLoginResponse *string
-		buildStubs            func(service *mocks.MockAuthService, request string, response *string)
+		facebookLoginResponse *models.TokenResponse
+		buildStubs            func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, request string, response *models.TokenResponse)
 		checkResponse         func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name:  "invalid state case",
 			state: "invalidState",
 			code:  "code",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+				service.EXPECT().FacebookSignInUser(token).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:  "access token as state case",
+			state: tokenPair.AccessToken,
+			code:  "code",
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+				service.EXPECT().FacebookSignInUser(token).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:  "reused state case",
+			state: testOauthState,
+			code:  "code",
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).Return(db.ErrTokenUsed)
 				service.EXPECT().FacebookSignInUser(token).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -309,7 +398,12 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 			name:  "invalid token",
 			state: testOauthState,
 			code:  "",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).
+					DoAndReturn(func(blacklist *models.BlackList) error {
+						require.Equal(t, testOauthState, blacklist.Token)
+						return nil
+					})
 				service.EXPECT().FacebookSignInUser(token).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -320,10 +414,12 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockService := mocks.NewMockAuthService(ctrl)
+	mockRepository := mocks.NewMockAuthRepository(ctrl)
 	testServer.handler.AuthService = mockService
+	testServer.handler.AuthRepository = mockRepository
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.buildStubs(mockService, tc.inputToken, tc.facebookLoginResponse)
+			tc.buildStubs(mockService, mockRepository, tc.inputToken, tc.facebookLoginResponse)
 
 			recorder := httptest.NewRecorder()
 			url := fmt.Sprintf("/api/v1/fb/callback?state=%s&code=%s", tc.state, tc.code)
@@ -336,7 +432,9 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 }
 
 func Test_GoogleCallBackHandler(t *testing.T) {
-	testOauthState, err := jwt.GenerateToken("", testServer.handler.Config.JWTSecret)
+	testOauthState, err := jwt.GeneratePurposeToken(jwt.OAuthStateTokenType, "", testServer.handler.Config.JWTSecret)
+	require.NoError(t, err)
+	tokenPair, err := jwt.GenerateTokenPair("email@gmail.com", "", 0, testServer.handler.Config.JWTSecret)
 	require.NoError(t, err)
 
 	// test cases
@@ -345,15 +443,40 @@ func Test_GoogleCallBackHandler(t *testing.T) {
 		state               string
 		code                string
 		inputToken          string
-		googleLoginResponse *string
-		buildStubs          func(service *mocks.MockAuthService, request string, response *string)
+		googleLoginResponse *models.TokenResponse
+		buildStubs          func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, request string, response *models.TokenResponse)
 		checkResponse       func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name:  "invalid state case",
 			state: "invalidState",
 			code:  "code",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+				service.EXPECT().GoogleSignInUser(token).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:  "access token as state case",
+			state: tokenPair.AccessToken,
+			code:  "code",
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+				service.EXPECT().GoogleSignInUser(token).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:  "reused state case",
+			state: testOauthState,
+			code:  "code",
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).Return(db.ErrTokenUsed)
 				service.EXPECT().GoogleSignInUser(token).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -364,7 +487,12 @@ func Test_GoogleCallBackHandler(t *testing.T) {
 			name:  "invalid token",
 			state: testOauthState,
 			code:  "",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockAuthRepository, token string, response *models.TokenResponse) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).
+					DoAndReturn(func(blacklist *models.BlackList) error {
+						require.Equal(t, testOauthState, blacklist.Token)
+						return nil
+					})
 				service.EXPECT().GoogleSignInUser(token).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
@@ -375,10 +503,12 @@ func Test_GoogleCallBackHandler(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockService := mocks.NewMockAuthService(ctrl)
+	mockRepository := mocks.NewMockAuthRepository(ctrl)
 	testServer.handler.AuthService = mockService
+	testServer.handler.AuthRepository = mockRepository
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.buildStubs(mockService, tc.inputToken, tc.googleLoginResponse)
+			tc.buildStubs(mockService, mockRepository, tc.inputToken, tc.googleLoginResponse)
 
 			recorder := httptest.NewRecorder()
 			url := fmt.Sprintf("/api/v1/google/callback?state=%s&code=%s", tc.state, tc.code)
@@ -427,7 +557,8 @@ func Test_Logout(t *testing.T) {
 		IsEmailActive: true,
 	}
 	conf.JWTSecret = "testSecret"
-	token, err := jwt.GenerateToken(user.Email, conf.JWTSecret)
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", 0, conf.JWTSecret)
+	token := tokenPair.AccessToken
 
 	s := &Server{
 		Config:         conf,
@@ -435,7 +566,13 @@ func Test_Logout(t *testing.T) {
 		AuthService:    auth,
 	}
 
-	repo.EXPECT().AddToBlackList(&models.BlackList{Email: user.Email, Token: token}).Return(nil)
+	repo.EXPECT().AddToBlackList(gomock.Any()).
+		DoAndReturn(func(blacklist *models.BlackList) error {
+			require.Equal(t, user.Email, blacklist.Email)
+			require.Equal(t, token, blacklist.Token)
+			require.Greater(t, blacklist.ExpiresAt, time.Now().Unix())
+			return nil
+		})
 	repo.EXPECT().TokenInBlacklist(token).Return(false)
 	repo.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
 
@@ -510,6 +647,66 @@ func Test_DeleteUserByEmail(t *testing.T) {
 	}
 }
 
+func Test_ProfileHandlers(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	user.Timezone = "Africa/Lagos"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AuthService = mockAuthService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	t.Run("show profile", func(t *testing.T) {
+		mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+		mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/api/v1/me", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+		testServer.router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Contains(t, recorder.Body.String(), user.Email)
+		require.Contains(t, recorder.Body.String(), "Africa/Lagos")
+	})
+
+	t.Run("update profile", func(t *testing.T) {
+		request := &models.UpdateUserRequest{Name: "New Name"}
+		mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+		mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+		mockAuthService.EXPECT().UpdateUserProfile(&user, request).Return(&models.ProfileResponse{Name: "New Name"}, nil)
+
+		data, err := json.Marshal(request)
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPut, "/api/v1/me/update", bytes.NewReader(data))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+		testServer.router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Contains(t, recorder.Body.String(), "profile updated successfully")
+	})
+
+	t.Run("update profile validation error", func(t *testing.T) {
+		mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+		mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+		mockAuthService.EXPECT().UpdateUserProfile(&user, gomock.Any()).
+			Return(nil, errors.New("phone_number must be a valid E.164 formatted phone number", http.StatusBadRequest))
+
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPut, "/api/v1/me/update", strings.NewReader(`{"phone_number":"0803"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+		testServer.router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -543,3 +740,106 @@ func RandomOwnerName() string {
 func RandomEmail() string {
 	return fmt.Sprintf("%s@email.com", RandomString(6))
 }
+
+func TestVerifyEmailHandler(t *testing.T) {
+	testCases := []struct {
+		name          string
+		verifyError   *errors.Error
+		expectedCode  int
+		expectedTitle string
+	}{
+		{name: "verified case", expectedCode: http.StatusOK, expectedTitle: "Email verified!"},
+		{name: "already verified case", verifyError: errors.ErrEmailAlreadyVerified, expectedCode: http.StatusOK, expectedTitle: "Email already verified"},
+		{name: "expired link case", verifyError: errors.New("expired link", http.StatusUnauthorized), expectedCode: http.StatusBadRequest, expectedTitle: "Link expired"},
+		{name: "internal server error case", verifyError: errors.ErrInternalServerError, expectedCode: http.StatusInternalServerError, expectedTitle: "Something went wrong"},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+	testServer.handler.AuthService = mockAuthService
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthService.EXPECT().VerifyEmail("token").Times(1).Return(tc.verifyError)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/verifyEmail/token", nil)
+			require.NoError(t, err)
+			testServer.router.ServeHTTP(recorder, req)
+
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			require.Contains(t, recorder.Header().Get("Content-Type"), "text/html")
+			require.Contains(t, recorder.Body.String(), tc.expectedTitle)
+		})
+	}
+}
+
+func TestRequestVerificationEmailHandler(t *testing.T) {
+	email := "toluwase@gmail.com"
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockAuthService, repository *mocks.MockSecurityRepository)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "verification sent case",
+			reqBody: gin.H{"email": email},
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockSecurityRepository) {
+				repository.EXPECT().HitRateLimit("verify-resend:"+email, time.Hour).Times(1).
+					Return(&models.RateLimit{Hits: 1, WindowStart: time.Now()}, nil)
+				service.EXPECT().RequestVerificationEmail(&models.ResendVerificationRequest{Email: email}).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "internal server error case",
+			reqBody: gin.H{"email": email},
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockSecurityRepository) {
+				repository.EXPECT().HitRateLimit("verify-resend:"+email, time.Hour).Times(1).
+					Return(&models.RateLimit{Hits: 2, WindowStart: time.Now()}, nil)
+				service.EXPECT().RequestVerificationEmail(gomock.Any()).Times(1).Return(errors.ErrInternalServerError)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name:    "rate limited case",
+			reqBody: gin.H{"email": email},
+			buildStubs: func(service *mocks.MockAuthService, repository *mocks.MockSecurityRepository) {
+				repository.EXPECT().HitRateLimit("verify-resend:"+email, time.Hour).Times(1).
+					Return(&models.RateLimit{Hits: 4, WindowStart: time.Now()}, nil)
+				service.EXPECT().RequestVerificationEmail(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+	mockSecurityRepository := mocks.NewMockSecurityRepository(ctrl)
+	testServer.handler.AuthService = mockAuthService
+	testServer.handler.SecurityRepository = mockSecurityRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockAuthService, mockSecurityRepository)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/auth/verify/resend", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
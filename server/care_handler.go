@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleInviteCaregiver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var careInviteRequest models.CareInviteRequest
+		if err := decode(c, &careInviteRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		careShare, err := s.CareService.InviteCaregiver(user, &careInviteRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregiver invited successfully", http.StatusCreated, careShare, nil)
+	}
+}
+
+func (s *Server) handleGetCaregivers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		caregivers, err := s.CareService.GetCaregivers(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregivers retrieved successfully", http.StatusOK, caregivers, nil)
+	}
+}
+
+func (s *Server) handleRemoveCaregiver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		careShareID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		err = s.CareService.RemoveCaregiver(uint(careShareID), user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregiver removed successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleGetCareInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		invitations, err := s.CareService.GetCareInvitations(user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "care invitations retrieved successfully", http.StatusOK, invitations, nil)
+	}
+}
+
+func (s *Server) handleAcceptCareInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		careShareID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		careShare, err := s.CareService.AcceptCareInvitation(uint(careShareID), user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "care invitation accepted successfully", http.StatusOK, careShare, nil)
+	}
+}
+
+func (s *Server) handleGetPatients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		patients, err := s.CareService.GetPatients(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "patients retrieved successfully", http.StatusOK, patients, nil)
+	}
+}
+
+func (s *Server) handleLeavePatient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		patientID, errr := strconv.ParseUint(c.Param("patientID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		err = s.CareService.LeavePatient(uint(patientID), user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "patient left successfully", http.StatusOK, nil, nil)
+	}
+}
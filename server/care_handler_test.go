@@ -0,0 +1,271 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInviteCaregiverHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockCareService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"email": "caregiver@example.com", "permission": "read", "notify_missed_doses": true},
+			buildStubs: func(service *mocks.MockCareService) {
+				request := &models.CareInviteRequest{Email: "caregiver@example.com", Permission: models.CarePermissionRead, NotifyMissedDoses: true}
+				service.EXPECT().InviteCaregiver(gomock.Any(), request).Times(1).
+					Return(&models.CareShareResponse{ID: 1, CaregiverEmail: "caregiver@example.com", Status: models.CareSharePending}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid permission case",
+			reqBody: gin.H{"email": "caregiver@example.com", "permission": "owner"},
+			buildStubs: func(service *mocks.MockCareService) {
+				service.EXPECT().InviteCaregiver(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "already invited case",
+			reqBody: gin.H{"email": "caregiver@example.com", "permission": "manage"},
+			buildStubs: func(service *mocks.MockCareService) {
+				service.EXPECT().InviteCaregiver(gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, errors.New("caregiver already invited", http.StatusConflict))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCareService := mocks.NewMockCareService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.CareService = mockCareService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockCareService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/user/caregivers", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestCaregiverScopedRoutes(t *testing.T) {
+
+	// generate a random user acting as the caregiver
+	accToken, caregiver := AuthorizeTestUser(t)
+	patient := &models.User{Model: models.Model{ID: 9}, Name: "Ada", Timezone: "Africa/Lagos"}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		reqBody       interface{}
+		buildStubs    func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "caregiver lists the medications of the patient case",
+			method: http.MethodGet,
+			path:   "/api/v1/user/care/patients/9/medications",
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionRead).Times(1).Return(patient, nil)
+				medication.EXPECT().GetAllMedications(uint(9), gomock.Any()).Times(1).
+					Return([]models.MedicationResponse{{ID: 1, UserID: 9}}, &models.Pagination{Limit: models.DefaultPageLimit}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "history rendered in the timezone of the patient case",
+			method: http.MethodGet,
+			path:   "/api/v1/user/care/patients/9/medication-history",
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionRead).Times(1).Return(patient, nil)
+				history.EXPECT().GetAllMedicationHistoryByUser(uint(9), &models.MedicationHistoryListRequest{Timezone: "Africa/Lagos"}).Times(1).
+					Return([]models.MedicationHistoryResponse{}, &models.Pagination{Limit: models.DefaultPageLimit}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "caregiver records a dose of the patient case",
+			method:  http.MethodPut,
+			path:    "/api/v1/user/care/patients/9/medication-history/4",
+			reqBody: gin.H{"has_medication_been_taken": true},
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionManage).Times(1).Return(patient, nil)
+				history.EXPECT().UpdateMedicationHistory(true, uint(4), uint(9)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "read only caregiver can not record doses case",
+			method:  http.MethodPut,
+			path:    "/api/v1/user/care/patients/9/medication-history/4",
+			reqBody: gin.H{"has_medication_been_taken": true},
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionManage).Times(1).
+					Return(nil, errors.New("you are not allowed to manage this patient", http.StatusForbidden))
+				history.EXPECT().UpdateMedicationHistory(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "caregiver adds a medication of the patient case",
+			method: http.MethodPost,
+			path:   "/api/v1/user/care/patients/9/medications",
+			reqBody: gin.H{
+				"name":                     "paracetamol",
+				"dosage":                   2,
+				"time_interval":            8,
+				"medication_start_date":    "2022-08-01T08:00:00Z",
+				"duration":                 7,
+				"medication_prescribed_by": "Dr Tolu",
+				"medication_start_time":    "2022-08-01T08:00:00Z",
+				"purpose_of_medication":    "malaria treatment",
+				"medication_icon":          "pill",
+			},
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionManage).Times(1).Return(patient, nil)
+				medication.EXPECT().CreateMedication(gomock.Any()).Times(1).
+					DoAndReturn(func(request *models.MedicationRequest) (*models.MedicationResponse, *errors.Error) {
+						require.Equal(t, uint(9), request.UserID)
+						require.Equal(t, "Africa/Lagos", request.Timezone)
+						return &models.MedicationResponse{ID: 1, UserID: 9}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:   "caregiver pauses a medication of the patient case",
+			method: http.MethodPost,
+			path:   "/api/v1/user/care/patients/9/medications/3/pause",
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionManage).Times(1).Return(patient, nil)
+				medication.EXPECT().PauseMedication(uint(3), uint(9)).Times(1).Return(&models.MedicationResponse{ID: 3, UserID: 9}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "read only caregiver can not update medications case",
+			method:  http.MethodPut,
+			path:    "/api/v1/user/care/patients/9/medications/3",
+			reqBody: gin.H{"name": "paracetamol"},
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(9), models.CarePermissionManage).Times(1).
+					Return(nil, errors.New("you are not allowed to manage this patient", http.StatusForbidden))
+				medication.EXPECT().UpdateMedication(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "patient not shared with the caregiver case",
+			method: http.MethodGet,
+			path:   "/api/v1/user/care/patients/10/medications/next",
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(caregiver.ID, uint(10), models.CarePermissionRead).Times(1).
+					Return(nil, errors.New("patient not found", http.StatusNotFound))
+				medication.EXPECT().GetNextMedications(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "invalid patient id case",
+			method: http.MethodGet,
+			path:   "/api/v1/user/care/patients/a/medications",
+			buildStubs: func(care *mocks.MockCareService, medication *mocks.MockMedicationService, history *mocks.MockMedicationHistoryService) {
+				care.EXPECT().AuthorizeCareAccess(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCareService := mocks.NewMockCareService(ctrl)
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	mockMedicationHistoryService := mocks.NewMockMedicationHistoryService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.CareService = mockCareService
+	testServer.handler.MedicationService = mockMedicationService
+	testServer.handler.MedicationHistoryService = mockMedicationHistoryService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(caregiver.Email).Return(&caregiver, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockCareService, mockMedicationService, mockMedicationHistoryService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleCreateDependent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var dependentRequest models.DependentRequest
+		if err := decode(c, &dependentRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		dependent, err := s.DependentService.CreateDependent(user.ID, &dependentRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "dependent created successfully", http.StatusCreated, dependent, nil)
+	}
+}
+
+func (s *Server) handleGetDependents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetOwnerFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		dependents, err := s.DependentService.GetDependents(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "dependents retrieved successfully", http.StatusOK, dependents, nil)
+	}
+}
+
+func (s *Server) handleUpdateDependent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		dependentID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var dependentRequest models.DependentRequest
+		if err := decode(c, &dependentRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		dependent, err := s.DependentService.UpdateDependent(uint(dependentID), user.ID, &dependentRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "dependent updated successfully", http.StatusOK, dependent, nil)
+	}
+}
+
+func (s *Server) handleDeleteDependent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		dependentID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		err = s.DependentService.DeleteDependent(uint(dependentID), user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "dependent deleted successfully", http.StatusOK, nil, nil)
+	}
+}
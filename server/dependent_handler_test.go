@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateDependentHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockDependentService, userID uint)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"name": "Tobi", "relationship": "son", "date_of_birth": "2015-04-02"},
+			buildStubs: func(service *mocks.MockDependentService, userID uint) {
+				request := &models.DependentRequest{Name: "Tobi", Relationship: "son", DateOfBirth: "2015-04-02"}
+				service.EXPECT().CreateDependent(userID, request).Times(1).
+					Return(&models.DependentResponse{ID: 4, Name: "Tobi"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:    "missing name case",
+			reqBody: gin.H{"relationship": "son"},
+			buildStubs: func(service *mocks.MockDependentService, userID uint) {
+				service.EXPECT().CreateDependent(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid date of birth case",
+			reqBody: gin.H{"name": "Tobi", "date_of_birth": "02/04/2015"},
+			buildStubs: func(service *mocks.MockDependentService, userID uint) {
+				service.EXPECT().CreateDependent(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "internal server error case",
+			reqBody: gin.H{"name": "Tobi"},
+			buildStubs: func(service *mocks.MockDependentService, userID uint) {
+				service.EXPECT().CreateDependent(userID, gomock.Any()).Times(1).Return(nil, errors.ErrInternalServerError)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockDependentService := mocks.NewMockDependentService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.DependentService = mockDependentService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockDependentService, user.ID)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/user/dependents", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/decagonhq/meddle-api/models"
@@ -52,3 +53,40 @@ func (s *Server) authorizeNotificationsForDevice() gin.HandlerFunc {
 		response.JSON(c, "device authorized to receive notification successfully", http.StatusCreated, nil, nil)
 	}
 }
+
+func (s *Server) handleGetDevices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		devices, err := s.PushNotification.GetUserDevices(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "devices retrieved successfully", http.StatusOK, devices, nil)
+	}
+}
+
+func (s *Server) handleRevokeDevice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		deviceID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		err = s.PushNotification.RevokeUserDevice(user.ID, uint(deviceID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "device revoked successfully", http.StatusOK, nil, nil)
+	}
+}
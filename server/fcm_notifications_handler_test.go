@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DeviceHandlers(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	devices := []models.DeviceResponse{
+		{ID: 1, Platform: "ios", AppVersion: "1.2.0"},
+		{ID: 2, Platform: "android", AppVersion: "1.1.0"},
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		buildStubs    func(service *mocks.MockPushNotifier)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "list devices success case",
+			method: http.MethodGet,
+			path:   "/api/v1/notifications/devices",
+			buildStubs: func(service *mocks.MockPushNotifier) {
+				service.EXPECT().GetUserDevices(user.ID).Times(1).Return(devices, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "android")
+			},
+		},
+		{
+			name:   "list devices internal server error",
+			method: http.MethodGet,
+			path:   "/api/v1/notifications/devices",
+			buildStubs: func(service *mocks.MockPushNotifier) {
+				service.EXPECT().GetUserDevices(user.ID).Times(1).Return(nil, errors.ErrInternalServerError)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name:   "revoke device success case",
+			method: http.MethodDelete,
+			path:   "/api/v1/notifications/devices/2",
+			buildStubs: func(service *mocks.MockPushNotifier) {
+				service.EXPECT().RevokeUserDevice(user.ID, uint(2)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "revoke unknown device",
+			method: http.MethodDelete,
+			path:   "/api/v1/notifications/devices/3",
+			buildStubs: func(service *mocks.MockPushNotifier) {
+				service.EXPECT().RevokeUserDevice(user.ID, uint(3)).Times(1).Return(errors.New("device not found", http.StatusNotFound))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "revoke device bad request from route param",
+			method: http.MethodDelete,
+			path:   "/api/v1/notifications/devices/a",
+			buildStubs: func(service *mocks.MockPushNotifier) {
+				service.EXPECT().RevokeUserDevice(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockPushNotifier := mocks.NewMockPushNotifier(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.PushNotification = mockPushNotifier
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockPushNotifier)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
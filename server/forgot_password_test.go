@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
 	"github.com/decagonhq/meddle-api/services"
@@ -19,7 +20,8 @@ import (
 func TestResetPassword(t *testing.T) {
 	user := models.User{}
 	email := "toluwasethomas1@gmail.com"
-	token, _ := jwt.GenerateToken(email, testServer.handler.Config.JWTSecret)
+	token, _ := jwt.GeneratePurposeToken(jwt.ResetPasswordTokenType, email, testServer.handler.Config.JWTSecret)
+	verifyToken, _ := jwt.GeneratePurposeToken(jwt.VerifyEmailTokenType, email, testServer.handler.Config.JWTSecret)
 	newReq := &models.ResetPassword{
 		Password:        "12345678",
 		ConfirmPassword: "12345678",
@@ -29,6 +31,7 @@ func TestResetPassword(t *testing.T) {
 	cases := []struct {
 		Name            string
 		Request         *models.ResetPassword
+		Token           string
 		ExpectedCode    int
 		ExpectedMessage string
 		ExpectedError   string
@@ -42,9 +45,30 @@ func TestResetPassword(t *testing.T) {
 			ExpectedMessage: "Reset successful, Login with your new password to continue",
 			ExpectedError:   "",
 			mockDB: func(ctrl *mocks.MockAuthRepository) {
-				ctrl.EXPECT().IsTokenInBlacklist(token).Return(nil).AnyTimes()
-				ctrl.EXPECT().UpdatePassword(gomock.Any(), email).Return(nil).AnyTimes()
-				ctrl.EXPECT().AddToBlackList(gomock.Any()).Return(nil).AnyTimes()
+				ctrl.EXPECT().ConsumeToken(gomock.Any()).Times(1).
+					DoAndReturn(func(blacklist *models.BlackList) error {
+						require.Equal(t, token, blacklist.Token)
+						return nil
+					})
+				ctrl.EXPECT().UpdatePassword(gomock.Any(), email).Return(nil).Times(1)
+			},
+		},
+		{
+			Name:         "Test Reused Link",
+			Request:      newReq,
+			ExpectedCode: http.StatusUnauthorized,
+			mockDB: func(ctrl *mocks.MockAuthRepository) {
+				ctrl.EXPECT().ConsumeToken(gomock.Any()).Return(db.ErrTokenUsed).Times(1)
+				ctrl.EXPECT().UpdatePassword(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			Name:         "Test Verify Email Link",
+			Request:      newReq,
+			Token:        verifyToken,
+			ExpectedCode: http.StatusUnauthorized,
+			mockDB: func(ctrl *mocks.MockAuthRepository) {
+				ctrl.EXPECT().ConsumeToken(gomock.Any()).Times(0)
 			},
 		},
 		{
@@ -70,7 +94,7 @@ func TestResetPassword(t *testing.T) {
 	mockAuthRepo := mocks.NewMockAuthRepository(ctrl)
 	mail := mocks.NewMockMailer(ctrl)
 	pushNotifier := mocks.NewMockPushNotifier(ctrl)
-	authService := services.NewAuthService(mockAuthRepo, testServer.handler.Config, mail, pushNotifier)
+	authService := services.NewAuthService(mockAuthRepo, mocks.NewMockSecurityRepository(ctrl), mocks.NewMockMedicationRepository(ctrl), testServer.handler.Config, mail, pushNotifier)
 	testServer.handler.AuthService = authService
 	testServer.handler.AuthRepository = mockAuthRepo
 
@@ -79,7 +103,11 @@ func TestResetPassword(t *testing.T) {
 			c.mockDB(mockAuthRepo)
 			data, err := json.Marshal(c.Request)
 			require.NoError(t, err)
-			req, _ := http.NewRequest(http.MethodPost, "/api/v1/password/reset/"+token, bytes.NewReader(data))
+			linkToken := c.Token
+			if linkToken == "" {
+				linkToken = token
+			}
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/password/reset/"+linkToken, bytes.NewReader(data))
 			require.NoError(t, err)
 			recorder := httptest.NewRecorder()
 			testServer.router.ServeHTTP(recorder, req)
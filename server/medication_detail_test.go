@@ -39,7 +39,8 @@ func Test_MedicationDetail(t *testing.T) {
 		UserID:                 1,
 	}
 	conf.JWTSecret = "testSecret"
-	token, err := jwt.GenerateToken(user.Email, conf.JWTSecret)
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", 0, conf.JWTSecret)
+	token := tokenPair.AccessToken
 
 	s := &Server{
 		Config:            conf,
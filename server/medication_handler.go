@@ -13,7 +13,7 @@ import (
 func (s *Server) handleCreateMedication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var medicationRequest models.MedicationRequest
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
@@ -24,6 +24,7 @@ func (s *Server) handleCreateMedication() gin.HandlerFunc {
 			return
 		}
 		medicationRequest.UserID = userId
+		medicationRequest.Timezone = user.Timezone
 		createdMedication, err := s.MedicationService.CreateMedication(&medicationRequest)
 		if err != nil {
 			err.Respond(c)
@@ -35,7 +36,7 @@ func (s *Server) handleCreateMedication() gin.HandlerFunc {
 
 func (s *Server) handleGetMedDetail() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
@@ -48,7 +49,7 @@ func (s *Server) handleGetMedDetail() gin.HandlerFunc {
 		}
 		medication, err := s.MedicationService.GetMedicationDetail(uint(userId), user.ID)
 		if err != nil {
-			response.JSON(c, "", http.StatusInternalServerError, nil, errors.New("internal server error", http.StatusInternalServerError))
+			err.Respond(c)
 			return
 		}
 		response.JSON(c, "retrieved medications successfully", http.StatusOK, gin.H{"medication": medication}, nil)
@@ -57,29 +58,40 @@ func (s *Server) handleGetMedDetail() gin.HandlerFunc {
 
 func (s *Server) handleGetAllMedications() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		medications, err := s.MedicationService.GetAllMedications(user.ID)
+		var medicationListRequest models.MedicationListRequest
+		if err := decodeQuery(c, &medicationListRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		medications, pagination, err := s.MedicationService.GetAllMedications(user.ID, &medicationListRequest)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medications retrieved successfully", http.StatusOK, medications, nil)
+		response.Paginated(c, "medications retrieved successfully", http.StatusOK, medications, pagination)
 	}
 }
 
 func (s *Server) handleGetNextMedication() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
 
-		medication, err := s.MedicationService.GetNextMedications(user.ID)
+		var nextRequest models.NextMedicationsRequest
+		if err := decodeQuery(c, &nextRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+
+		medication, err := s.MedicationService.GetNextMedications(user.ID, nextRequest.DependentID)
 		if err != nil {
 			err.Respond(c)
 			return
@@ -90,7 +102,7 @@ func (s *Server) handleGetNextMedication() gin.HandlerFunc {
 
 func (s *Server) handleUpdateMedication() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
@@ -105,6 +117,7 @@ func (s *Server) handleUpdateMedication() gin.HandlerFunc {
 			response.JSON(c, "", http.StatusBadRequest, nil, err)
 			return
 		}
+		updateMedicationRequest.Timezone = user.Timezone
 		err = s.MedicationService.UpdateMedication(&updateMedicationRequest, uint(medicationID), user.ID)
 		if err != nil {
 			err.Respond(c)
@@ -133,3 +146,91 @@ func (s *Server) handleFindMedication() gin.HandlerFunc {
 	}
 }
 
+func (s *Server) handleDeleteMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		err = s.MedicationService.DeleteMedication(uint(medicationID), user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication deleted successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handlePauseMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetOwnerFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		medication, err := s.MedicationService.PauseMedication(uint(medicationID), user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication paused successfully", http.StatusOK, gin.H{"medication": medication}, nil)
+	}
+}
+
+func (s *Server) handleResumeMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetOwnerFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		medication, err := s.MedicationService.ResumeMedication(uint(medicationID), user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication resumed successfully", http.StatusOK, gin.H{"medication": medication}, nil)
+	}
+}
+
+func (s *Server) handleRefillMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetOwnerFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var refillRequest models.RefillRequest
+		if err := decode(c, &refillRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		medication, err := s.InventoryService.RefillMedication(uint(medicationID), user.ID, &refillRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication refilled successfully", http.StatusOK, gin.H{"medication": medication}, nil)
+	}
+}
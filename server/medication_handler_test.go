@@ -242,6 +242,7 @@ func TestGetAllMedicationHandler(t *testing.T) {
 	// test cases
 	testCases := []struct {
 		name               string
+		query              string
 		medicationResponse []models.MedicationResponse
 		buildStubs         func(service *mocks.MockMedicationService, userID uint, response []models.MedicationResponse)
 		checkCodeResponse  func(t *testing.T, recorder *httptest.ResponseRecorder)
@@ -283,7 +284,7 @@ func TestGetAllMedicationHandler(t *testing.T) {
 				},
 			},
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetAllMedications(request).Times(1).Return(response, nil)
+				service.EXPECT().GetAllMedications(request, gomock.Any()).Times(1).Return(response, &models.Pagination{Limit: models.DefaultPageLimit}, nil)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -293,12 +294,40 @@ func TestGetAllMedicationHandler(t *testing.T) {
 			name:               "internal server error",
 			medicationResponse: nil,
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetAllMedications(request).Times(1).Return(nil, errors.ErrInternalServerError)
+				service.EXPECT().GetAllMedications(request, gomock.Any()).Times(1).Return(nil, nil, errors.ErrInternalServerError)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name:  "filtered page case",
+			query: "?name=para&status=active&sort=name&order=asc&limit=10&cursor=abc",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint, response []models.MedicationResponse) {
+				request := &models.MedicationListRequest{
+					PageRequest: models.PageRequest{Cursor: "abc", Limit: 10},
+					Name:        "para",
+					Status:      "active",
+					Sort:        "name",
+					Order:       "asc",
+				}
+				service.EXPECT().GetAllMedications(userID, request).Times(1).Return(response, &models.Pagination{Limit: 10}, nil)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"pagination":{"limit":10,"has_more":false}`)
+			},
+		},
+		{
+			name:  "limit too large case",
+			query: "?limit=1000",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint, response []models.MedicationResponse) {
+				service.EXPECT().GetAllMedications(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
 	}
 
 	ctrl := gomock.NewController(t)
@@ -317,7 +346,7 @@ func TestGetAllMedicationHandler(t *testing.T) {
 
 			recorder := httptest.NewRecorder()
 
-			req, err := http.NewRequest(http.MethodGet, "/api/v1/user/medications", nil)
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/user/medications"+tc.query, nil)
 			require.NoError(t, err)
 
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
@@ -377,7 +406,7 @@ func TestGetNextMedicationHandler(t *testing.T) {
 				},
 			},
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetNextMedications(request).Times(1).Return(response, nil)
+				service.EXPECT().GetNextMedications(request, gomock.Nil()).Times(1).Return(response, nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -387,7 +416,7 @@ func TestGetNextMedicationHandler(t *testing.T) {
 			name:               "internal server error",
 			medicationResponse: nil,
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetNextMedications(request).Times(1).Return(nil, errors.ErrInternalServerError)
+				service.EXPECT().GetNextMedications(request, gomock.Nil()).Times(1).Return(nil, errors.ErrInternalServerError)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -557,3 +586,197 @@ func Test_UpdateMedicationHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestDeletePauseResumeMedicationHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+	medicationResponse := &models.MedicationResponse{ID: 2, Name: "paracetamol", UserID: user.ID}
+
+	testCases := []struct {
+		name              string
+		method            string
+		path              string
+		buildStubs        func(service *mocks.MockMedicationService, userID uint)
+		checkCodeResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "delete success case",
+			method: http.MethodDelete,
+			path:   "/api/v1/user/medications/2",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().DeleteMedication(uint(2), userID).Times(1).Return(nil)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "delete not found case",
+			method: http.MethodDelete,
+			path:   "/api/v1/user/medications/2",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().DeleteMedication(uint(2), userID).Times(1).Return(errors.New("medication not found", http.StatusNotFound))
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "delete bad route param case",
+			method: http.MethodDelete,
+			path:   "/api/v1/user/medications/a",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().DeleteMedication(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "pause success case",
+			method: http.MethodPost,
+			path:   "/api/v1/user/medications/2/pause",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().PauseMedication(uint(2), userID).Times(1).Return(medicationResponse, nil)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "pause paused medication case",
+			method: http.MethodPost,
+			path:   "/api/v1/user/medications/2/pause",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().PauseMedication(uint(2), userID).Times(1).Return(nil, errors.New("medication is already paused", http.StatusConflict))
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name:   "resume success case",
+			method: http.MethodPost,
+			path:   "/api/v1/user/medications/2/resume",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().ResumeMedication(uint(2), userID).Times(1).Return(medicationResponse, nil)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "resume internal server error case",
+			method: http.MethodPost,
+			path:   "/api/v1/user/medications/2/resume",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().ResumeMedication(uint(2), userID).Times(1).Return(nil, errors.ErrInternalServerError)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.MedicationService = mockMedicationService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockMedicationService, user.ID)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkCodeResponse(t, recorder)
+		})
+	}
+}
+
+func TestRefillMedicationHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+	stock := 30
+
+	testCases := []struct {
+		name              string
+		reqBody           interface{}
+		buildStubs        func(service *mocks.MockInventoryService, userID uint)
+		checkCodeResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"quantity": 30},
+			buildStubs: func(service *mocks.MockInventoryService, userID uint) {
+				service.EXPECT().RefillMedication(uint(2), userID, &models.RefillRequest{Quantity: 30}).Times(1).
+					Return(&models.MedicationResponse{ID: 2, PillCount: &stock}, nil)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid quantity case",
+			reqBody: gin.H{"quantity": 0},
+			buildStubs: func(service *mocks.MockInventoryService, userID uint) {
+				service.EXPECT().RefillMedication(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "medication not found case",
+			reqBody: gin.H{"quantity": 30},
+			buildStubs: func(service *mocks.MockInventoryService, userID uint) {
+				service.EXPECT().RefillMedication(uint(2), userID, gomock.Any()).Times(1).
+					Return(nil, errors.New("medication not found", http.StatusNotFound))
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockInventoryService := mocks.NewMockInventoryService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.InventoryService = mockInventoryService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockInventoryService, user.ID)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/user/medications/2/refill", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkCodeResponse(t, recorder)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/decagonhq/meddle-api/models"
 	"github.com/decagonhq/meddle-api/server/response"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -9,7 +10,7 @@ import (
 
 func (s *Server) handleUpdateMedicationHistory() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
@@ -37,16 +38,62 @@ func (s *Server) handleUpdateMedicationHistory() gin.HandlerFunc {
 
 func (s *Server) handleGetAllMedicationHistoryByUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, user, err := GetValuesFromContext(c)
+		user, err := GetOwnerFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		medicationHistories, err := s.MedicationHistoryService.GetAllMedicationHistoryByUser(user.ID)
+		var medicationHistoryListRequest models.MedicationHistoryListRequest
+		if err := decodeQuery(c, &medicationHistoryListRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		medicationHistoryListRequest.Timezone = user.Timezone
+		medicationHistories, pagination, err := s.MedicationHistoryService.GetAllMedicationHistoryByUser(user.ID, &medicationHistoryListRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.Paginated(c, "medication history retrieved successfully", http.StatusOK, medicationHistories, pagination)
+	}
+}
+
+// handleDoseAction handles the actions of a dose reminder. It is authenticated by the action token
+// sent with the reminder, so that actions work without opening the app.
+func (s *Server) handleDoseAction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var doseActionRequest models.DoseActionRequest
+		if err := decode(c, &doseActionRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		err := s.MedicationHistoryService.HandleDoseAction(&doseActionRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "dose action applied successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleGetAdherence() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetOwnerFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var adherenceRequest models.AdherenceRequest
+		if err := decodeQuery(c, &adherenceRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		adherenceRequest.Timezone = user.Timezone
+		adherence, err := s.MedicationHistoryService.GetAdherence(user.ID, &adherenceRequest)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medication history retrieved successfully", http.StatusOK, medicationHistories, nil)
+		response.JSON(c, "adherence retrieved successfully", http.StatusOK, adherence, nil)
 	}
 }
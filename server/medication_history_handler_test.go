@@ -156,7 +156,7 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 				},
 			},
 			buildStubs: func(service *mocks.MockMedicationHistoryService, request uint, response []models.MedicationHistoryResponse) {
-				service.EXPECT().GetAllMedicationHistoryByUser(request).Times(1).Return(response, nil)
+				service.EXPECT().GetAllMedicationHistoryByUser(request, gomock.Any()).Times(1).Return(response, &models.Pagination{Limit: models.DefaultPageLimit}, nil)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -166,7 +166,7 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 			name:               "internal server error",
 			medicationResponse: nil,
 			buildStubs: func(service *mocks.MockMedicationHistoryService, request uint, response []models.MedicationHistoryResponse) {
-				service.EXPECT().GetAllMedicationHistoryByUser(request).Times(1).Return(nil, errors.ErrInternalServerError)
+				service.EXPECT().GetAllMedicationHistoryByUser(request, gomock.Any()).Times(1).Return(nil, nil, errors.ErrInternalServerError)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -200,3 +200,164 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func Test_DoseActionHandler(t *testing.T) {
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockMedicationHistoryService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "dose taken case",
+			reqBody: gin.H{"action_token": "token", "action": "taken"},
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().HandleDoseAction(&models.DoseActionRequest{ActionToken: "token", Action: models.DoseTaken}).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "dose snoozed case",
+			reqBody: gin.H{"action_token": "token", "action": "snooze", "snooze_minutes": 15},
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().HandleDoseAction(&models.DoseActionRequest{ActionToken: "token", Action: models.DoseSnoozed, SnoozeMinutes: 15}).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "snooze without minutes case",
+			reqBody: gin.H{"action_token": "token", "action": "snooze"},
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().HandleDoseAction(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "unknown action case",
+			reqBody: gin.H{"action_token": "token", "action": "later"},
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().HandleDoseAction(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid action token case",
+			reqBody: gin.H{"action_token": "token", "action": "skip"},
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().HandleDoseAction(gomock.Any()).Times(1).Return(errors.New("invalid action token", http.StatusUnauthorized))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMedicationHistoryService := mocks.NewMockMedicationHistoryService(ctrl)
+	testServer.handler.MedicationHistoryService = mockMedicationHistoryService
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockMedicationHistoryService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/notifications/actions", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetAdherenceHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name              string
+		query             string
+		buildStubs        func(service *mocks.MockMedicationHistoryService, userID uint)
+		checkCodeResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "success case",
+			query: "?from=2022-08-01&to=2022-08-31&period=week&medication_id=3",
+			buildStubs: func(service *mocks.MockMedicationHistoryService, userID uint) {
+				request := &models.AdherenceRequest{From: "2022-08-01", To: "2022-08-31", Period: models.AdherenceByWeek, MedicationID: 3, Timezone: user.Timezone}
+				service.EXPECT().GetAdherence(userID, request).Times(1).Return(&models.AdherenceResponse{}, nil)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "invalid period case",
+			query: "?period=year",
+			buildStubs: func(service *mocks.MockMedicationHistoryService, userID uint) {
+				service.EXPECT().GetAdherence(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "invalid date case",
+			query: "?from=01-08-2022",
+			buildStubs: func(service *mocks.MockMedicationHistoryService, userID uint) {
+				service.EXPECT().GetAdherence(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "internal server error",
+			buildStubs: func(service *mocks.MockMedicationHistoryService, userID uint) {
+				service.EXPECT().GetAdherence(userID, gomock.Any()).Times(1).Return(nil, errors.ErrInternalServerError)
+			},
+			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMedicationHistoryService := mocks.NewMockMedicationHistoryService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.MedicationHistoryService = mockMedicationHistoryService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockMedicationHistoryService, user.ID)
+
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/user/adherence"+tc.query, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkCodeResponse(t, recorder)
+		})
+	}
+}
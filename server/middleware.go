@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
@@ -29,7 +30,17 @@ func (s *Server) Authorize() gin.HandlerFunc {
 			return
 		}
 
-		if s.AuthRepository.TokenInBlacklist(accessToken) {
+		if tokenType, _ := accessClaims[jwt.TokenTypeClaim].(string); tokenType == jwt.RefreshTokenType {
+			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("refresh tokens can not be used for authorization", http.StatusUnauthorized))
+			return
+		} else if tokenType != jwt.AccessTokenType {
+			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("only access tokens can be used for authorization", http.StatusUnauthorized))
+			return
+		}
+
+		// tokens issued before sessions existed can only be revoked through the blacklist
+		sessionID := jwt.GetSessionID(accessClaims)
+		if sessionID == 0 && s.AuthRepository.TokenInBlacklist(accessToken) {
 			respondAndAbort(c, "expired token", http.StatusUnauthorized, nil, errs.New("expired token", http.StatusUnauthorized))
 			return
 		}
@@ -60,6 +71,19 @@ func (s *Server) Authorize() gin.HandlerFunc {
 			return
 		}
 
+		if user.IsDisabled() {
+			respondAndAbort(c, "", http.StatusForbidden, nil, errs.ErrAccountDisabled)
+			return
+		}
+
+		if sessionID != 0 {
+			if err := s.checkSession(sessionID, user); err != nil {
+				respondAndAbort(c, "", err.Status, nil, err)
+				return
+			}
+			c.Set("session_id", sessionID)
+		}
+
 		c.Set("access_token", accessToken)
 		c.Set("user", user)
 
@@ -67,20 +91,88 @@ func (s *Server) Authorize() gin.HandlerFunc {
 	}
 }
 
-func limitRateForPasswordReset(store ratelimit.Store) gin.HandlerFunc {
-	store = ratelimit.InMemoryStore(&ratelimit.InMemoryOptions{
-		Rate:  time.Hour * 24,
-		Limit: 3,
-	})
+// sessionTouchInterval keeps Authorize from writing the last use of a session on every request
+const sessionTouchInterval = time.Minute
+
+// checkSession makes sure the session of a token belongs to the user and was not revoked, and records its use
+func (s *Server) checkSession(sessionID uint, user *models.User) *errs.Error {
+	session, err := s.AuthRepository.FindSession(sessionID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error finding session %v: %v", sessionID, err)
+		return errs.ErrInternalServerError
+	}
+	now := time.Now()
+	if session == nil || session.UserID != user.ID || !session.IsActive(now) {
+		return errs.New("session expired, log in again", http.StatusUnauthorized)
+	}
+	if now.Unix()-session.LastUsedAt >= int64(sessionTouchInterval.Seconds()) {
+		if err := s.AuthRepository.TouchSession(sessionID, now.Unix()); err != nil {
+			log.Printf("error touching session %v: %v", sessionID, err)
+		}
+	}
+	return nil
+}
+
+// AuthorizeRole lets only users with one of the roles through. It runs after Authorize.
+func (s *Server) AuthorizeRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		if !user.HasRole(roles...) {
+			respondAndAbort(c, "", http.StatusForbidden, nil, errs.New("you are not allowed to access this resource", http.StatusForbidden))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AuthorizeCare lets a caregiver act on the medications of the patient in the path, provided the patient
+// shared them with at least the given permission. It runs after Authorize, and the handlers it guards
+// pick the patient up with GetOwnerFromContext.
+func (s *Server) AuthorizeCare(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		patientID, parseErr := strconv.ParseUint(c.Param("patientID"), 10, 32)
+		if parseErr != nil {
+			respondAndAbort(c, "invalid ID", http.StatusBadRequest, nil, errs.New("invalid patient id", http.StatusBadRequest))
+			return
+		}
+		patient, err := s.CareService.AuthorizeCareAccess(user.ID, uint(patientID), permission)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		c.Set("patient", patient)
+
+		c.Next()
+	}
+}
+
+// limitRatePerEmail limits the requests for the email in the body, route namespaces the keys in the shared store
+func limitRatePerEmail(store ratelimit.Store, route string) gin.HandlerFunc {
 	mw := ratelimit.RateLimiter(store, &ratelimit.Options{
 		ErrorHandler:   errs.ErrorHandler,
-		KeyFunc:        keyFunc,
+		KeyFunc:        emailKeyFunc(route),
 		BeforeResponse: nil,
 	})
 	return mw
 }
 
-func keyFunc(c *gin.Context) string {
+func emailKeyFunc(route string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		return route + ":" + emailFromBody(c)
+	}
+}
+
+func emailFromBody(c *gin.Context) string {
 	//TODO Handle when email isn't sent successfully in any of the three tries
 	//b1, err := c.Request.GetBody()
 	buf, err := ioutil.ReadAll(c.Request.Body)
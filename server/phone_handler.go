@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleSendPhoneVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		verification, err := s.PhoneVerificationService.SendPhoneVerification(user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "verification code sent", http.StatusOK, verification, nil)
+	}
+}
+
+func (s *Server) handleVerifyPhone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var verifyRequest models.VerifyPhoneRequest
+		if err := decode(c, &verifyRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		if err := s.PhoneVerificationService.VerifyPhone(user, &verifyRequest); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "phone number verified", http.StatusOK, nil, nil)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
+	"github.com/gin-gonic/gin"
+)
+
+// postgresStore is a ratelimit.Store keeping its counters in the database, so that every replica of the api
+// shares them. Each key can be hit limit times in a fixed window of rate.
+type postgresStore struct {
+	server *Server
+	rate   time.Duration
+	limit  uint
+}
+
+// sharedRateLimitStore returns a ratelimit.Store shared by every replica of the api
+func (s *Server) sharedRateLimitStore(rate time.Duration, limit uint) ratelimit.Store {
+	return &postgresStore{server: s, rate: rate, limit: limit}
+}
+
+func (p *postgresStore) Limit(key string, c *gin.Context) ratelimit.Info {
+	rateLimit, err := p.server.SecurityRepository.HitRateLimit(key, p.rate)
+	if err != nil {
+		// requests are let through when the counters are not available
+		log.Printf("error hitting rate limit %s: %v", key, err)
+		return ratelimit.Info{ResetTime: time.Now().Add(p.rate), RemainingHits: p.limit}
+	}
+	info := ratelimit.Info{ResetTime: rateLimit.WindowStart.Add(p.rate)}
+	if rateLimit.Hits > int64(p.limit) {
+		info.RateLimited = true
+		return info
+	}
+	info.RemainingHits = p.limit - uint(rateLimit.Hits)
+	return info
+}
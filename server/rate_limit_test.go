@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresRateLimitStore(t *testing.T) {
+	windowStart := time.Now().Add(-time.Minute)
+
+	testCases := []struct {
+		name          string
+		hits          int64
+		dbError       error
+		rateLimited   bool
+		remainingHits uint
+	}{
+		{name: "first hit case", hits: 1, remainingHits: 2},
+		{name: "last allowed hit case", hits: 3, remainingHits: 0},
+		{name: "limited case", hits: 4, rateLimited: true},
+		{name: "store unavailable case", dbError: errors.New("connection refused"), remainingHits: 3},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSecurityRepository := mocks.NewMockSecurityRepository(ctrl)
+	testServer.handler.SecurityRepository = mockSecurityRepository
+	store := testServer.handler.sharedRateLimitStore(time.Hour, 3)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var rateLimit *models.RateLimit
+			if tc.dbError == nil {
+				rateLimit = &models.RateLimit{Key: "key", Hits: tc.hits, WindowStart: windowStart}
+			}
+			mockSecurityRepository.EXPECT().HitRateLimit("key", time.Hour).Times(1).Return(rateLimit, tc.dbError)
+
+			info := store.Limit("key", nil)
+			require.Equal(t, tc.rateLimited, info.RateLimited)
+			require.Equal(t, tc.remainingHits, info.RemainingHits)
+			if tc.dbError == nil {
+				require.Equal(t, windowStart.Add(time.Hour), info.ResetTime)
+			}
+		})
+	}
+}
@@ -5,22 +5,32 @@ import (
 	"strings"
 
 	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
 	"github.com/gin-gonic/gin"
 )
 
 func JSON(c *gin.Context, message string, status int, data interface{}, err error) {
+	c.JSON(status, envelope(message, status, data, err))
+}
+
+// Paginated responds with a page of a list endpoint, the pagination tells clients how to get the next page
+func Paginated(c *gin.Context, message string, status int, data interface{}, pagination *models.Pagination) {
+	responsedata := envelope(message, status, data, nil)
+	responsedata["pagination"] = pagination
+	c.JSON(status, responsedata)
+}
+
+func envelope(message string, status int, data interface{}, err error) gin.H {
 	errMessage := ""
 	if err != nil {
 		errMessage = err.Error()
 	}
-	responsedata := gin.H{
+	return gin.H{
 		"message": message,
 		"data":    data,
 		"errors":  errMessage,
 		"status":  http.StatusText(status),
 	}
-
-	c.JSON(status, responsedata)
 }
 
 func HandleErrors(c *gin.Context, err error) {
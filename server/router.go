@@ -2,24 +2,27 @@ package server
 
 import (
 	"fmt"
-	rateLimit "github.com/JGLTechnologies/gin-rate-limit"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
 
+	"github.com/decagonhq/meddle-api/models"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func (s *Server) defineRoutes(router *gin.Engine) {
-	store := rateLimit.InMemoryStore(&rateLimit.InMemoryOptions{})
-	limitRate := limitRateForPasswordReset(store)
+	limitRate := limitRatePerEmail(s.sharedRateLimitStore(time.Hour*24, 3), "password-forgot")
+	limitVerificationRate := limitRatePerEmail(s.sharedRateLimitStore(time.Hour, 3), "verify-resend")
 
 	apirouter := router.Group("/api/v1")
 	apirouter.POST("/auth/signup", s.HandleSignup())
 	apirouter.POST("/auth/login", s.handleLogin())
+	apirouter.POST("/auth/login/2fa", s.handleTwoFactorLogin())
+	apirouter.POST("/auth/refresh", s.handleRefreshToken())
+	apirouter.GET("/auth/unlock/:token", s.handleUnlockAccount())
 
 	apirouter.GET("/fb/auth", s.handleFBLogin())
 	apirouter.GET("fb/callback", s.fbCallbackHandler())
@@ -28,49 +31,107 @@ func (s *Server) defineRoutes(router *gin.Engine) {
 	apirouter.GET("/google/callback", s.HandleGoogleCallback())
 
 	apirouter.GET("/verifyEmail/:token", s.HandleVerifyEmail())
+	apirouter.POST("/auth/verify/resend", limitVerificationRate, s.handleRequestVerificationEmail())
 	apirouter.POST("/password/forgot", limitRate, s.SendEmailForPasswordReset())
 	apirouter.POST("/password/reset/:token", s.ResetPassword())
+	apirouter.POST("/notifications/actions", s.handleDoseAction())
 
 	authorized := apirouter.Group("/")
 	authorized.Use(s.Authorize())
 	authorized.GET("/logout", s.handleLogout())
-	authorized.GET("/users", s.handleGetUsers())
 	authorized.DELETE("/users", s.handleDeleteUserByEmail())
 	authorized.PUT("/me/update", s.handleUpdateUserDetails())
 	authorized.GET("/me", s.handleShowProfile())
+	authorized.GET("/me/security-events", s.handleGetSecurityEvents())
+	authorized.POST("/me/2fa", s.handleEnrollTwoFactor())
+	authorized.POST("/me/2fa/confirm", s.handleConfirmTwoFactor())
+	authorized.POST("/me/2fa/disable", s.handleDisableTwoFactor())
+	authorized.POST("/me/phone/verification", s.handleSendPhoneVerification())
+	authorized.POST("/me/phone/verification/confirm", s.handleVerifyPhone())
+	authorized.GET("/me/sessions", s.handleGetSessions())
+	authorized.DELETE("/me/sessions", s.handleRevokeAllSessions())
+	authorized.DELETE("/me/sessions/:id", s.handleRevokeSession())
 
 	authorized.POST("/user/medications", s.handleCreateMedication())
 	authorized.GET("/user/medications/:id", s.handleGetMedDetail())
 	authorized.GET("/user/medications", s.handleGetAllMedications())
 	authorized.PUT("/user/medications/:medicationID", s.handleUpdateMedication())
+	authorized.DELETE("/user/medications/:id", s.handleDeleteMedication())
+	authorized.POST("/user/medications/:id/pause", s.handlePauseMedication())
+	authorized.POST("/user/medications/:id/resume", s.handleResumeMedication())
+	authorized.POST("/user/medications/:id/refill", s.handleRefillMedication())
 	authorized.GET("/user/medications/next", s.handleGetNextMedication())
 	authorized.GET("/user/medications/search", s.handleFindMedication())
 
 	authorized.PUT("/user/medication-history/:id", s.handleUpdateMedicationHistory())
 	authorized.GET("/user/medication-history", s.handleGetAllMedicationHistoryByUser())
+	authorized.GET("/user/adherence", s.handleGetAdherence())
+
+	authorized.POST("/user/dependents", s.handleCreateDependent())
+	authorized.GET("/user/dependents", s.handleGetDependents())
+	authorized.PUT("/user/dependents/:id", s.handleUpdateDependent())
+	authorized.DELETE("/user/dependents/:id", s.handleDeleteDependent())
+
+	authorized.POST("/user/caregivers", s.handleInviteCaregiver())
+	authorized.GET("/user/caregivers", s.handleGetCaregivers())
+	authorized.DELETE("/user/caregivers/:id", s.handleRemoveCaregiver())
+	authorized.GET("/user/care/invitations", s.handleGetCareInvitations())
+	authorized.POST("/user/care/invitations/:id/accept", s.handleAcceptCareInvitation())
+	authorized.GET("/user/care/patients", s.handleGetPatients())
+	authorized.DELETE("/user/care/patients/:patientID", s.handleLeavePatient())
+
+	// caregivers reach the medications of their patients through the same handlers, scoped to the patient
+	patient := authorized.Group("/user/care/patients/:patientID")
+	patient.GET("/medications", s.AuthorizeCare(models.CarePermissionRead), s.handleGetAllMedications())
+	patient.GET("/medications/:id", s.AuthorizeCare(models.CarePermissionRead), s.handleGetMedDetail())
+	patient.GET("/medications/next", s.AuthorizeCare(models.CarePermissionRead), s.handleGetNextMedication())
+	patient.GET("/medication-history", s.AuthorizeCare(models.CarePermissionRead), s.handleGetAllMedicationHistoryByUser())
+	patient.GET("/adherence", s.AuthorizeCare(models.CarePermissionRead), s.handleGetAdherence())
+	patient.GET("/dependents", s.AuthorizeCare(models.CarePermissionRead), s.handleGetDependents())
+	patient.PUT("/medication-history/:id", s.AuthorizeCare(models.CarePermissionManage), s.handleUpdateMedicationHistory())
+	patient.POST("/medications", s.AuthorizeCare(models.CarePermissionManage), s.handleCreateMedication())
+	patient.PUT("/medications/:medicationID", s.AuthorizeCare(models.CarePermissionManage), s.handleUpdateMedication())
+	patient.POST("/medications/:id/pause", s.AuthorizeCare(models.CarePermissionManage), s.handlePauseMedication())
+	patient.POST("/medications/:id/resume", s.AuthorizeCare(models.CarePermissionManage), s.handleResumeMedication())
+	patient.POST("/medications/:id/refill", s.AuthorizeCare(models.CarePermissionManage), s.handleRefillMedication())
+
 	authorized.POST("/notifications/add-token", s.authorizeNotificationsForDevice())
+	authorized.GET("/notifications/devices", s.handleGetDevices())
+	authorized.DELETE("/notifications/devices/:id", s.handleRevokeDevice())
+
+	// support staff look after users, only admins change who can sign in and who has which role
+	admin := authorized.Group("/admin")
+	admin.Use(s.AuthorizeRole(models.RoleAdmin, models.RoleSupport))
+	admin.GET("/users", s.handleAdminGetUsers())
+	admin.GET("/users/:id", s.handleAdminGetUser())
+	admin.GET("/users/:id/security-events", s.handleAdminGetSecurityEvents())
+	admin.POST("/users/:id/disable", s.AuthorizeRole(models.RoleAdmin), s.handleDisableUser())
+	admin.POST("/users/:id/enable", s.AuthorizeRole(models.RoleAdmin), s.handleEnableUser())
+	admin.PUT("/users/:id/role", s.AuthorizeRole(models.RoleAdmin), s.handleUpdateUserRole())
+	admin.POST("/users/:id/resend-verification", s.handleResendVerification())
+	admin.POST("/users/:id/force-password-reset", s.handleForcePasswordReset())
+	admin.GET("/stats", s.handleGetSystemStats())
 
 }
 
 func (s *Server) setupRouter() *gin.Engine {
 	ginMode := os.Getenv("GIN_MODE")
+	templates := "server/templates"
+	if s.Config.Env == "test" || ginMode == "test" {
+		_, b, _, _ := runtime.Caller(0)
+		templates = filepath.Dir(b) + "/templates"
+	}
 	if ginMode == "test" {
 		r := gin.New()
+		// the verify email page is rendered from a template, so the test router needs them too
+		r.LoadHTMLGlob(templates + "/*.html")
 		s.defineRoutes(r)
 		return r
 	}
 
 	r := gin.New()
-	staticFiles := "server/templates/static"
-	htmlFiles := "server/templates/*.html"
-	if s.Config.Env == "test" {
-		_, b, _, _ := runtime.Caller(0)
-		basepath := filepath.Dir(b)
-		staticFiles = basepath + "/templates/static"
-		htmlFiles = basepath + "/templates/*.html"
-	}
-	r.StaticFS("static", http.Dir(staticFiles))
-	r.LoadHTMLGlob(htmlFiles)
+	r.StaticFS("static", http.Dir(templates+"/static"))
+	r.LoadHTMLGlob(templates + "/*.html")
 
 	// LoggerWithFormatter middleware will write the logs to gin.DefaultWriter
 	// By default gin.DefaultWriter = os.Stdout
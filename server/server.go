@@ -18,10 +18,18 @@ import (
 type Server struct {
 	Config                   *config.Config
 	AuthRepository           db.AuthRepository
+	SecurityRepository       db.SecurityRepository
 	AuthService              services.AuthService
 	MedicationService        services.MedicationService
 	MedicationHistoryService services.MedicationHistoryService
 	PushNotification         services.PushNotifier
+	InventoryService         services.InventoryService
+	CareService              services.CareService
+	DependentService         services.DependentService
+	AdminService             services.AdminService
+	SecurityService          services.SecurityService
+	SessionService           services.SessionService
+	PhoneVerificationService services.PhoneVerificationService
 }
 
 func (s *Server) Start() {
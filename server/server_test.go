@@ -44,7 +44,8 @@ func TestMain(m *testing.M) {
 func AuthorizeTestUser(t *testing.T) (string, models.User) {
 	user, _ := randomUser(t)
 	user.IsEmailActive = true
-	accToken, err := jwt.GenerateToken(user.Email, testServer.handler.Config.JWTSecret)
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", 0, testServer.handler.Config.JWTSecret)
+	accToken := tokenPair.AccessToken
 
 	require.NoError(t, err)
 	return accToken, user
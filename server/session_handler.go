@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleGetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		sessions, err := s.SessionService.GetSessions(user, getSessionID(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "sessions retrieved successfully", http.StatusOK, sessions, nil)
+	}
+}
+
+func (s *Server) handleRevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		sessionID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.SessionService.RevokeSession(user, uint(sessionID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "session revoked successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleRevokeAllSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		if err := s.SessionService.RevokeAllSessions(user); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "logged out everywhere", http.StatusOK, nil, nil)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionAuthorization(t *testing.T) {
+	_, user := AuthorizeTestUser(t)
+	user.ID = 1
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", 7, testServer.handler.Config.JWTSecret)
+	require.NoError(t, err)
+
+	active := models.Session{Model: models.Model{ID: 7}, UserID: user.ID,
+		LastUsedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	stale := active
+	stale.LastUsedAt = time.Now().Add(-time.Hour).Unix()
+	revoked := active
+	revoked.RevokedAt = time.Now().Unix()
+	otherUser := active
+	otherUser.UserID = 2
+
+	testCases := []struct {
+		name         string
+		buildStubs   func(repository *mocks.MockAuthRepository, service *mocks.MockSessionService)
+		expectedCode int
+	}{
+		{
+			name: "active session case",
+			buildStubs: func(repository *mocks.MockAuthRepository, service *mocks.MockSessionService) {
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(&active, nil)
+				repository.EXPECT().TouchSession(gomock.Any(), gomock.Any()).Times(0)
+				service.EXPECT().GetSessions(&user, uint(7)).Times(1).Return([]models.SessionResponse{{ID: 7, Current: true}}, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "session used a while ago case",
+			buildStubs: func(repository *mocks.MockAuthRepository, service *mocks.MockSessionService) {
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(&stale, nil)
+				repository.EXPECT().TouchSession(uint(7), gomock.Any()).Times(1).Return(nil)
+				service.EXPECT().GetSessions(&user, uint(7)).Times(1).Return(nil, nil)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "revoked session case",
+			buildStubs: func(repository *mocks.MockAuthRepository, service *mocks.MockSessionService) {
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(&revoked, nil)
+				service.EXPECT().GetSessions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name: "session of another user case",
+			buildStubs: func(repository *mocks.MockAuthRepository, service *mocks.MockSessionService) {
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(&otherUser, nil)
+				service.EXPECT().GetSessions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSessionService := mocks.NewMockSessionService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.SessionService = mockSessionService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			// session tokens are not looked up in the blacklist
+			mockAuthRepository.EXPECT().TokenInBlacklist(gomock.Any()).Times(0)
+			tc.buildStubs(mockAuthRepository, mockSessionService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/me/sessions", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tokenPair.AccessToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+		})
+	}
+}
+
+func TestRevokeSessionHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		sessionID     string
+		buildStubs    func(service *mocks.MockSessionService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "success case",
+			sessionID: "4",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().RevokeSession(&user, uint(4)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:      "invalid id case",
+			sessionID: "four",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().RevokeSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:      "session not found case",
+			sessionID: "4",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().RevokeSession(&user, uint(4)).Times(1).Return(errors.New("session not found", http.StatusNotFound))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSessionService := mocks.NewMockSessionService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.SessionService = mockSessionService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockSessionService)
+
+			recorder := httptest.NewRecorder()
+			url := fmt.Sprintf("/api/v1/me/sessions/%s", tc.sessionID)
+			req, err := http.NewRequest(http.MethodDelete, url, nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleTwoFactorLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var twoFactorLoginRequest models.TwoFactorLoginRequest
+		if err := decode(c, &twoFactorLoginRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		twoFactorLoginRequest.ClientInfo = clientInfo(c)
+		userResponse, err := s.AuthService.LoginWithTwoFactor(&twoFactorLoginRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "login successful", http.StatusOK, userResponse, nil)
+	}
+}
+
+func (s *Server) handleEnrollTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		enrollment, err := s.AuthService.EnrollTwoFactor(user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "add the secret to your authenticator app and confirm a code", http.StatusOK, enrollment, nil)
+	}
+}
+
+func (s *Server) handleConfirmTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var confirmRequest models.TwoFactorConfirmRequest
+		if err := decode(c, &confirmRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		recoveryCodes, err := s.AuthService.ConfirmTwoFactor(user, &confirmRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "two-factor authentication enabled", http.StatusOK, recoveryCodes, nil)
+	}
+}
+
+func (s *Server) handleDisableTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var disableRequest models.TwoFactorDisableRequest
+		if err := decode(c, &disableRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		if err := s.AuthService.DisableTwoFactor(user, &disableRequest); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "two-factor authentication disabled", http.StatusOK, nil, nil)
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorLoginHandler(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockAuthService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"challenge_token": "challenge", "code": "123456"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().LoginWithTwoFactor(gomock.Any()).Times(1).
+					DoAndReturn(func(request *models.TwoFactorLoginRequest) (*models.LoginResponse, *errors.Error) {
+						require.Equal(t, "challenge", request.ChallengeToken)
+						require.Equal(t, "123456", request.Code)
+						require.NotEmpty(t, request.IP)
+						return &models.LoginResponse{AccessToken: "access"}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"AccessToken":"access"`)
+			},
+		},
+		{
+			name:    "no code case",
+			reqBody: gin.H{"challenge_token": "challenge"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().LoginWithTwoFactor(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid code case",
+			reqBody: gin.H{"challenge_token": "challenge", "code": "000000"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().LoginWithTwoFactor(gomock.Any()).Times(1).
+					Return(nil, errors.New("invalid two-factor code", http.StatusUnauthorized))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+	testServer.handler.AuthService = mockAuthService
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockAuthService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/auth/login/2fa", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+			req.RemoteAddr = "10.0.0.1:1234"
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestConfirmTwoFactorHandler(t *testing.T) {
+
+	// generate a random user
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockAuthService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"code": "123456"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().ConfirmTwoFactor(&user, &models.TwoFactorConfirmRequest{Code: "123456"}).Times(1).
+					Return(&models.RecoveryCodesResponse{RecoveryCodes: []string{"abcde-fghjk"}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "abcde-fghjk")
+			},
+		},
+		{
+			name:    "invalid code format case",
+			reqBody: gin.H{"code": "12345a"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().ConfirmTwoFactor(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "already enabled case",
+			reqBody: gin.H{"code": "123456"},
+			buildStubs: func(service *mocks.MockAuthService) {
+				service.EXPECT().ConfirmTwoFactor(gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, errors.New("two-factor authentication is already enabled", http.StatusConflict))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AuthService = mockAuthService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+
+			tc.buildStubs(mockAuthService)
+
+			jsonFile, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/me/2fa/confirm", strings.NewReader(string(jsonFile)))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestChallengeTokenCanNotAuthorize(t *testing.T) {
+	_, user := AuthorizeTestUser(t)
+	challenge, err := jwt.GenerateTwoFactorChallengeToken(user.ID, testServer.handler.Config.JWTSecret)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", challenge))
+
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
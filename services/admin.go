@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/admin_mock.go -package=mocks github.com/decagonhq/meddle-api/services AdminService
+
+// AdminService lets support staff look after the users and the health of the system
+type AdminService interface {
+	GetUsers(request *models.UserListRequest) ([]models.AdminUserResponse, *models.Pagination, *apiError.Error)
+	GetUser(userID uint) (*models.AdminUserResponse, *apiError.Error)
+	DisableUser(admin *models.User, userID uint) *apiError.Error
+	EnableUser(userID uint) *apiError.Error
+	ResendVerification(userID uint) *apiError.Error
+	ForcePasswordReset(staff *models.User, userID uint) *apiError.Error
+	UpdateRole(admin *models.User, userID uint, request *models.UpdateRoleRequest) *apiError.Error
+	GetStats(request *models.StatsRequest) (*models.SystemStats, *apiError.Error)
+}
+
+var errUserNotFound = apiError.New("user not found", http.StatusNotFound)
+
+type adminService struct {
+	Config      *config.Config
+	adminRepo   db.AdminRepository
+	authRepo    db.AuthRepository
+	authService AuthService
+}
+
+// NewAdminService instantiates an AdminService
+func NewAdminService(adminRepo db.AdminRepository, authRepo db.AuthRepository, authService AuthService, conf *config.Config) AdminService {
+	return &adminService{
+		Config:      conf,
+		adminRepo:   adminRepo,
+		authRepo:    authRepo,
+		authService: authService,
+	}
+}
+
+// GetUsers returns a page of the users matching the request, newest first
+func (a *adminService) GetUsers(request *models.UserListRequest) ([]models.AdminUserResponse, *models.Pagination, *apiError.Error) {
+	filter := &models.UserFilter{
+		Search: request.Search,
+		Role:   request.Role,
+		Status: request.Status,
+		// one more user than requested tells whether there is a next page
+		Limit: request.PageLimit() + 1,
+	}
+	if request.Cursor != "" {
+		filter.After = &models.UserCursor{}
+		if err := models.DecodeCursor(request.Cursor, filter.After); err != nil {
+			return nil, nil, apiError.New("invalid cursor", http.StatusBadRequest)
+		}
+	}
+
+	users, err := a.adminRepo.GetUsers(filter)
+	if err != nil {
+		log.Printf("error getting users: %v", err)
+		return nil, nil, apiError.ErrInternalServerError
+	}
+
+	pagination := &models.Pagination{Limit: request.PageLimit()}
+	if len(users) > pagination.Limit {
+		users = users[:pagination.Limit]
+		pagination.HasMore = true
+		pagination.NextCursor = models.EncodeCursor(models.UserCursor{ID: users[len(users)-1].ID})
+	}
+
+	userResponses := make([]models.AdminUserResponse, 0, len(users))
+	for i := range users {
+		userResponses = append(userResponses, *users[i].ToAdminUserResponse())
+	}
+	return userResponses, pagination, nil
+}
+
+func (a *adminService) GetUser(userID uint) (*models.AdminUserResponse, *apiError.Error) {
+	user, err := a.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.ToAdminUserResponse(), nil
+}
+
+// DisableUser stops the user from signing in and signs them out everywhere
+func (a *adminService) DisableUser(admin *models.User, userID uint) *apiError.Error {
+	if admin.ID == userID {
+		return apiError.New("you can not disable your own account", http.StatusBadRequest)
+	}
+	disabledAt := time.Now()
+	return a.setUserDisabled(userID, &disabledAt)
+}
+
+func (a *adminService) EnableUser(userID uint) *apiError.Error {
+	return a.setUserDisabled(userID, nil)
+}
+
+func (a *adminService) setUserDisabled(userID uint, disabledAt *time.Time) *apiError.Error {
+	err := a.adminRepo.SetUserDisabled(userID, disabledAt)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUserNotFound
+		}
+		log.Printf("error updating disabled status of user %v: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// ResendVerification emails the user a new link to verify their email
+func (a *adminService) ResendVerification(userID uint) *apiError.Error {
+	user, err := a.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.IsEmailActive {
+		return apiError.ErrEmailAlreadyVerified
+	}
+	return a.authService.ResendVerificationEmail(user)
+}
+
+// ForcePasswordReset signs the user out everywhere and emails them a link to reset their password,
+// they can not sign in with their current password anymore. Support staff can only force plain users to.
+func (a *adminService) ForcePasswordReset(staff *models.User, userID uint) *apiError.Error {
+	user, err := a.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if !staff.CanManage(user) {
+		return apiError.New("you can not force staff to reset their password", http.StatusForbidden)
+	}
+	if err := a.adminRepo.RequirePasswordReset(user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUserNotFound
+		}
+		log.Printf("error requiring password reset of user %v: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	return a.authService.SendEmailForPasswordReset(&models.ForgotPassword{Email: user.Email})
+}
+
+// UpdateRole changes the role of a user, admins can not change their own role so that there is always one left
+func (a *adminService) UpdateRole(admin *models.User, userID uint, request *models.UpdateRoleRequest) *apiError.Error {
+	if admin.ID == userID {
+		return apiError.New("you can not change your own role", http.StatusBadRequest)
+	}
+	err := a.adminRepo.UpdateUserRole(userID, request.Role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUserNotFound
+		}
+		log.Printf("error updating role of user %v: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetStats summarizes the users, push notifications and background jobs over the requested window
+func (a *adminService) GetStats(request *models.StatsRequest) (*models.SystemStats, *apiError.Error) {
+	hours := request.Hours
+	if hours == 0 {
+		hours = models.DefaultStatsHours
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	userCounts, err := a.adminRepo.GetUserCounts(since)
+	if err != nil {
+		log.Printf("error counting users: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	devices, err := a.adminRepo.CountDevices()
+	if err != nil {
+		log.Printf("error counting devices: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	deliveries, err := a.adminRepo.GetPushDeliveryCounts(since)
+	if err != nil {
+		log.Printf("error counting push deliveries: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	jobs, err := a.adminRepo.GetJobStats(since)
+	if err != nil {
+		log.Printf("error getting job stats: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	if deliveries == nil {
+		deliveries = []models.PushDeliveryCount{}
+	}
+	if jobs == nil {
+		jobs = []models.JobStats{}
+	}
+	return &models.SystemStats{
+		Since: since.Format(time.RFC3339),
+		Users: *userCounts,
+		Notifications: models.NotificationStats{
+			Devices:    devices,
+			Deliveries: deliveries,
+		},
+		Jobs: jobs,
+	}, nil
+}
+
+func (a *adminService) findUser(userID uint) (*models.User, *apiError.Error) {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errUserNotFound
+		}
+		log.Printf("error finding user %v: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return user, nil
+}
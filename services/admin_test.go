@@ -0,0 +1,247 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type adminMocks struct {
+	adminRepo   *mocks.MockAdminRepository
+	authRepo    *mocks.MockAuthRepository
+	authService *mocks.MockAuthService
+}
+
+func newTestAdminService(ctrl *gomock.Controller) (AdminService, *adminMocks) {
+	m := &adminMocks{
+		adminRepo:   mocks.NewMockAdminRepository(ctrl),
+		authRepo:    mocks.NewMockAuthRepository(ctrl),
+		authService: mocks.NewMockAuthService(ctrl),
+	}
+	return NewAdminService(m.adminRepo, m.authRepo, m.authService, testConfig), m
+}
+
+func Test_AdminGetUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, m := newTestAdminService(ctrl)
+
+	request := &models.UserListRequest{
+		PageRequest: models.PageRequest{Limit: 2, Cursor: models.EncodeCursor(models.UserCursor{ID: 10})},
+		Search:      "tobi",
+	}
+	m.adminRepo.EXPECT().GetUsers(gomock.Any()).Times(1).
+		DoAndReturn(func(filter *models.UserFilter) ([]models.User, error) {
+			require.Equal(t, "tobi", filter.Search)
+			require.Equal(t, uint(10), filter.After.ID)
+			require.Equal(t, 3, filter.Limit)
+			return []models.User{{Model: models.Model{ID: 9}}, {Model: models.Model{ID: 8}}, {Model: models.Model{ID: 7}}}, nil
+		})
+
+	users, pagination, err := service.GetUsers(request)
+	require.Nil(t, err)
+	require.Len(t, users, 2)
+	require.True(t, pagination.HasMore)
+	require.Equal(t, models.EncodeCursor(models.UserCursor{ID: 8}), pagination.NextCursor)
+
+	_, _, err = service.GetUsers(&models.UserListRequest{PageRequest: models.PageRequest{Cursor: "%%"}})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+}
+
+func Test_DisableUser(t *testing.T) {
+	admin := &models.User{Model: models.Model{ID: 1}, Role: models.RoleAdmin}
+
+	testCases := []struct {
+		name        string
+		userID      uint
+		buildStubs  func(repository *mocks.MockAdminRepository)
+		expectedErr *apiError.Error
+	}{
+		{
+			name:   "user disabled case",
+			userID: 4,
+			buildStubs: func(repository *mocks.MockAdminRepository) {
+				repository.EXPECT().SetUserDisabled(uint(4), gomock.Not(gomock.Nil())).Times(1).Return(nil)
+			},
+		},
+		{
+			name:   "own account case",
+			userID: 1,
+			buildStubs: func(repository *mocks.MockAdminRepository) {
+				repository.EXPECT().SetUserDisabled(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedErr: apiError.New("you can not disable your own account", http.StatusBadRequest),
+		},
+		{
+			name:   "user not found case",
+			userID: 4,
+			buildStubs: func(repository *mocks.MockAdminRepository) {
+				repository.EXPECT().SetUserDisabled(uint(4), gomock.Any()).Times(1).
+					Return(fmt.Errorf("could not update user disabled status: %w", gorm.ErrRecordNotFound))
+			},
+			expectedErr: errUserNotFound,
+		},
+		{
+			name:   "internal server error case",
+			userID: 4,
+			buildStubs: func(repository *mocks.MockAdminRepository) {
+				repository.EXPECT().SetUserDisabled(uint(4), gomock.Any()).Times(1).Return(gorm.ErrInvalidDB)
+			},
+			expectedErr: apiError.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service, m := newTestAdminService(ctrl)
+			tc.buildStubs(m.adminRepo)
+
+			err := service.DisableUser(admin, tc.userID)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_ResendVerification(t *testing.T) {
+	unverified := &models.User{Model: models.Model{ID: 4}, Email: "tobi@gmail.com"}
+	verified := &models.User{Model: models.Model{ID: 4}, Email: "tobi@gmail.com", IsEmailActive: true}
+
+	testCases := []struct {
+		name        string
+		buildStubs  func(m *adminMocks)
+		expectedErr *apiError.Error
+	}{
+		{
+			name: "verification sent case",
+			buildStubs: func(m *adminMocks) {
+				m.authRepo.EXPECT().FindUserByID(uint(4)).Times(1).Return(unverified, nil)
+				m.authService.EXPECT().ResendVerificationEmail(unverified).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "already verified case",
+			buildStubs: func(m *adminMocks) {
+				m.authRepo.EXPECT().FindUserByID(uint(4)).Times(1).Return(verified, nil)
+				m.authService.EXPECT().ResendVerificationEmail(gomock.Any()).Times(0)
+			},
+			expectedErr: apiError.New("email already verified", http.StatusConflict),
+		},
+		{
+			name: "user not found case",
+			buildStubs: func(m *adminMocks) {
+				m.authRepo.EXPECT().FindUserByID(uint(4)).Times(1).Return(nil, gorm.ErrRecordNotFound)
+			},
+			expectedErr: errUserNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service, m := newTestAdminService(ctrl)
+			tc.buildStubs(m)
+
+			err := service.ResendVerification(4)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_ForcePasswordReset(t *testing.T) {
+	admin := &models.User{Model: models.Model{ID: 1}, Role: models.RoleAdmin}
+	support := &models.User{Model: models.Model{ID: 2}, Role: models.RoleSupport}
+
+	testCases := []struct {
+		name           string
+		staff          *models.User
+		role           string
+		expectedStatus int
+	}{
+		{name: "support resets user case", staff: support, role: models.RoleUser},
+		{name: "admin resets admin case", staff: admin, role: models.RoleAdmin},
+		{name: "support resets support case", staff: support, role: models.RoleSupport, expectedStatus: http.StatusForbidden},
+		{name: "support resets admin case", staff: support, role: models.RoleAdmin, expectedStatus: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service, m := newTestAdminService(ctrl)
+
+			user := &models.User{Model: models.Model{ID: 4}, Email: "tobi@gmail.com", IsEmailActive: true, Role: tc.role}
+			m.authRepo.EXPECT().FindUserByID(uint(4)).Times(1).Return(user, nil)
+			if tc.expectedStatus == 0 {
+				gomock.InOrder(
+					m.adminRepo.EXPECT().RequirePasswordReset(uint(4)).Times(1).Return(nil),
+					m.authService.EXPECT().SendEmailForPasswordReset(&models.ForgotPassword{Email: user.Email}).Times(1).Return(nil),
+				)
+			} else {
+				m.adminRepo.EXPECT().RequirePasswordReset(gomock.Any()).Times(0)
+				m.authService.EXPECT().SendEmailForPasswordReset(gomock.Any()).Times(0)
+			}
+
+			err := service.ForcePasswordReset(tc.staff, 4)
+			if tc.expectedStatus == 0 {
+				require.Nil(t, err)
+				return
+			}
+			require.Equal(t, tc.expectedStatus, err.Status)
+		})
+	}
+}
+
+func Test_UpdateRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, m := newTestAdminService(ctrl)
+
+	admin := &models.User{Model: models.Model{ID: 1}, Role: models.RoleAdmin}
+	request := &models.UpdateRoleRequest{Role: models.RoleUser}
+
+	err := service.UpdateRole(admin, 1, request)
+	require.Equal(t, http.StatusBadRequest, err.Status)
+
+	m.adminRepo.EXPECT().UpdateUserRole(uint(4), models.RoleUser).Times(1).Return(nil)
+	err = service.UpdateRole(admin, 4, request)
+	require.Nil(t, err)
+}
+
+func Test_GetStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, m := newTestAdminService(ctrl)
+
+	checkSince := func(since time.Time) {
+		require.WithinDuration(t, time.Now().Add(-24*time.Hour), since, time.Minute)
+	}
+	m.adminRepo.EXPECT().GetUserCounts(gomock.Any()).Times(1).
+		DoAndReturn(func(since time.Time) (*models.UserCounts, error) {
+			checkSince(since)
+			return &models.UserCounts{Total: 10, SignedUp: 2}, nil
+		})
+	m.adminRepo.EXPECT().CountDevices().Times(1).Return(int64(7), nil)
+	m.adminRepo.EXPECT().GetPushDeliveryCounts(gomock.Any()).Times(1).
+		DoAndReturn(func(since time.Time) ([]models.PushDeliveryCount, error) {
+			checkSince(since)
+			return []models.PushDeliveryCount{{Category: models.NextMedicationCategory, Status: models.PushDelivered, Count: 5}}, nil
+		})
+	m.adminRepo.EXPECT().GetJobStats(gomock.Any()).Times(1).Return(nil, nil)
+
+	stats, err := service.GetStats(&models.StatsRequest{})
+	require.Nil(t, err)
+	require.Equal(t, int64(10), stats.Users.Total)
+	require.Equal(t, int64(7), stats.Notifications.Devices)
+	require.Len(t, stats.Notifications.Deliveries, 1)
+	require.NotNil(t, stats.Jobs)
+}
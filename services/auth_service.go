@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
@@ -15,7 +16,7 @@ import (
 	"github.com/decagonhq/meddle-api/models"
 	"github.com/decagonhq/meddle-api/services/jwt"
 	_ "github.com/gin-gonic/gin"
-	_ "github.com/golang-jwt/jwt"
+	jwtgo "github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -26,27 +27,40 @@ import (
 type AuthService interface {
 	LoginUser(request *models.LoginRequest) (*models.LoginResponse, *apiError.Error)
 	SignupUser(request *models.User) (*models.User, *apiError.Error)
-	FacebookSignInUser(token string) (*string, *apiError.Error)
-	VerifyEmail(token string) error
+	FacebookSignInUser(token string) (*models.TokenResponse, *apiError.Error)
+	VerifyEmail(token string) *apiError.Error
 	SendEmailForPasswordReset(user *models.ForgotPassword) *apiError.Error
 	ResetPassword(user *models.ResetPassword, token string) *apiError.Error
-	GoogleSignInUser(token string) (*string, *apiError.Error)
+	GoogleSignInUser(token string) (*models.TokenResponse, *apiError.Error)
 	DeleteUserByEmail(userEmail string) *apiError.Error
+	RefreshToken(refreshToken string) (*models.TokenResponse, *apiError.Error)
+	ResendVerificationEmail(user *models.User) *apiError.Error
+	RequestVerificationEmail(request *models.ResendVerificationRequest) *apiError.Error
+	UnlockAccount(token string) *apiError.Error
+	EnrollTwoFactor(user *models.User) (*models.TwoFactorEnrollResponse, *apiError.Error)
+	ConfirmTwoFactor(user *models.User, request *models.TwoFactorConfirmRequest) (*models.RecoveryCodesResponse, *apiError.Error)
+	DisableTwoFactor(user *models.User, request *models.TwoFactorDisableRequest) *apiError.Error
+	LoginWithTwoFactor(request *models.TwoFactorLoginRequest) (*models.LoginResponse, *apiError.Error)
+	UpdateUserProfile(user *models.User, request *models.UpdateUserRequest) (*models.ProfileResponse, *apiError.Error)
 }
 
 // authService struct
 type authService struct {
 	Config           *config.Config
 	authRepo         db.AuthRepository
+	securityRepo     db.SecurityRepository
+	medicationRepo   db.MedicationRepository
 	mail             Mailer
 	pushNotification PushNotifier
 }
 
 // NewAuthService instantiate an authService
-func NewAuthService(authRepo db.AuthRepository, conf *config.Config, mailer Mailer, pushNotifier PushNotifier) AuthService {
+func NewAuthService(authRepo db.AuthRepository, securityRepo db.SecurityRepository, medicationRepo db.MedicationRepository, conf *config.Config, mailer Mailer, pushNotifier PushNotifier) AuthService {
 	return &authService{
 		Config:           conf,
 		authRepo:         authRepo,
+		securityRepo:     securityRepo,
+		medicationRepo:   medicationRepo,
 		mail:             mailer,
 		pushNotification: pushNotifier,
 	}
@@ -71,11 +85,8 @@ func (a *authService) SignupUser(user *models.User) (*models.User, *apiError.Err
 		return nil, apiError.New("internal server error", http.StatusInternalServerError)
 	}
 
-	token, err := jwt.GenerateToken(user.Email, a.Config.JWTSecret)
-	if err != nil {
-		return nil, apiError.New("internal server error", http.StatusInternalServerError)
-	}
-	if err := a.sendVerifyEmail(token, user.Email); err != nil {
+	user.VerificationSentAt = time.Now().Unix()
+	if err := a.sendVerifyEmail(user.Email); err != nil {
 		return nil, err
 	}
 
@@ -91,14 +102,53 @@ func (a *authService) SignupUser(user *models.User) (*models.User, *apiError.Err
 	return user, nil
 }
 
-func (a *authService) sendVerifyEmail(token, email string) *apiError.Error {
+// ResendVerificationEmail sends the user a new link to verify their email, or the new email they are
+// changing to. The links sent before stop working.
+func (a *authService) ResendVerificationEmail(user *models.User) *apiError.Error {
+	email := user.Email
+	if user.IsEmailActive {
+		if user.PendingEmail == "" {
+			return apiError.ErrEmailAlreadyVerified
+		}
+		email = user.PendingEmail
+	}
+	if err := a.authRepo.SetVerificationSentAt(user.ID, time.Now().Unix()); err != nil {
+		log.Printf("error resending verification email: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	return a.sendVerifyEmail(email)
+}
+
+// RequestVerificationEmail resends the verification link of the account with the email. Whether there is
+// such an account, and whether it is verified already, is not revealed.
+func (a *authService) RequestVerificationEmail(request *models.ResendVerificationRequest) *apiError.Error {
+	user, err := a.authRepo.FindUserByEmail(request.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		log.Printf("error finding user to resend verification: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	if err := a.ResendVerificationEmail(user); err != nil && err != apiError.ErrEmailAlreadyVerified {
+		return err
+	}
+	return nil
+}
+
+func (a *authService) sendVerifyEmail(email string) *apiError.Error {
+	token, err := jwt.GeneratePurposeToken(jwt.VerifyEmailTokenType, email, a.Config.JWTSecret)
+	if err != nil {
+		log.Printf("error generating verification token: %v", err)
+		return apiError.ErrInternalServerError
+	}
 	link := fmt.Sprintf("%s/verifyEmail/%s", a.Config.BaseUrl, token)
 	value := map[string]interface{}{}
 	value["link"] = link
 	subject := "Verify your email"
 	body := "Please Click the link below to verify your email"
 	templateName := "emailverification"
-	err := a.mail.SendMail(email, subject, body, templateName, value)
+	err = a.mail.SendMail(email, subject, body, templateName, value)
 	if err != nil {
 		log.Printf("Error: %v", err.Error())
 		return apiError.New("Internal server error", http.StatusInternalServerError)
@@ -112,9 +162,14 @@ func GenerateHashPassword(password string) (string, error) {
 }
 
 func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.LoginResponse, *apiError.Error) {
+	if err := a.checkLoginIP(loginRequest.IP); err != nil {
+		return nil, err
+	}
+
 	foundUser, err := a.authRepo.FindUserByEmail(loginRequest.Email)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			a.recordFailedLoginIP(loginRequest.IP)
 			return nil, apiError.New("invalid email", http.StatusUnprocessableEntity)
 		} else {
 			log.Printf("error from database: %v", err)
@@ -123,33 +178,117 @@ func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.Logi
 	}
 
 	if foundUser.IsEmailActive == false {
-		return nil, apiError.New("email not verified", http.StatusUnauthorized)
+		return nil, apiError.New("email not verified, request a new verification link if it did not arrive", http.StatusUnauthorized)
+	}
+
+	if foundUser.IsDisabled() {
+		return nil, apiError.ErrAccountDisabled
+	}
+
+	// passwords are not even checked while the account is locked
+	if err := checkLoginAccount(foundUser, time.Now()); err != nil {
+		return nil, err
 	}
 
 	if err := foundUser.VerifyPassword(loginRequest.Password); err != nil {
+		a.recordFailedLogin(foundUser, loginRequest.ClientInfo)
 		return nil, apiError.ErrInvalidPassword
 	}
 
-	accessToken, err := jwt.GenerateToken(foundUser.Email, a.Config.JWTSecret)
+	if err := checkSignIn(foundUser, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if foundUser.HasTwoFactor() {
+		// the password was right, but the login is only recorded and the failed logins are only cleared once the second factor is,
+		// so that wrong codes keep counting towards the lockout across logins
+		challenge, err := a.twoFactorChallenge(foundUser)
+		if err != nil {
+			log.Printf("error generating token %s", err)
+			return nil, apiError.ErrInternalServerError
+		}
+		response := foundUser.LoginUserToDto("", "")
+		response.TwoFactorRequired = true
+		response.ChallengeToken = challenge
+		return response, nil
+	}
+
+	tokenPair, err := a.issueTokens(foundUser, loginRequest.ClientInfo)
 	if err != nil {
 		log.Printf("error generating token %s", err)
 		return nil, apiError.ErrInternalServerError
 	}
+	a.recordLogin(foundUser, loginRequest.ClientInfo)
 
-	return foundUser.LoginUserToDto(accessToken), nil
+	return foundUser.LoginUserToDto(tokenPair.AccessToken, tokenPair.RefreshToken), nil
 }
 
-func (a *authService) VerifyEmail(token string) error {
-	claims, err := jwt.ValidateAndGetClaims(token, a.Config.JWTSecret)
+var (
+	errInvalidLink = apiError.New("invalid link", http.StatusUnauthorized)
+	errExpiredLink = apiError.New("expired link", http.StatusUnauthorized)
+)
+
+// VerifyEmail verifies the email a verification link was sent to. Links that were replaced by a newer one
+// do not work anymore, verified emails are reported with apiError.ErrEmailAlreadyVerified.
+func (a *authService) VerifyEmail(token string) *apiError.Error {
+	claims, err := jwt.ValidatePurposeToken(token, jwt.VerifyEmailTokenType, a.Config.JWTSecret)
 	if err != nil {
-		return apiError.New("invalid link", http.StatusUnauthorized)
+		return errInvalidLink
 	}
 	email := claims["email"].(string)
-	err = a.authRepo.VerifyEmail(email, token)
-	return err
+	user, err := a.authRepo.FindUserToVerify(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidLink
+		}
+		log.Printf("error finding user to verify: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	if user.Email == email && user.IsEmailActive {
+		return apiError.ErrEmailAlreadyVerified
+	}
+	if jwt.GetIssuedAt(claims) < user.VerificationSentAt {
+		return errExpiredLink
+	}
+
+	if err := a.useLinkToken(token, claims); err != nil {
+		return err
+	}
+	if err := a.authRepo.VerifyEmail(user.ID, email); err != nil {
+		log.Printf("error verifying email of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// consumeLinkToken returns the email of a link token generated for the purpose, and uses it up so that the
+// link only works once
+func (a *authService) consumeLinkToken(token, purpose string) (string, *apiError.Error) {
+	claims, err := jwt.ValidatePurposeToken(token, purpose, a.Config.JWTSecret)
+	if err != nil {
+		return "", errInvalidLink
+	}
+	if err := a.useLinkToken(token, claims); err != nil {
+		return "", err
+	}
+	return claims["email"].(string), nil
+}
+
+// useLinkToken marks the validated link token as used, it fails for tokens that were used before
+func (a *authService) useLinkToken(token string, claims jwtgo.MapClaims) *apiError.Error {
+	email := claims["email"].(string)
+	err := a.authRepo.ConsumeToken(&models.BlackList{Email: email, Token: token, ExpiresAt: jwt.GetExpiry(claims)})
+	if err != nil {
+		if errors.Is(err, db.ErrTokenUsed) {
+			return errExpiredLink
+		}
+		log.Printf("error consuming link token: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
 }
 
-func (a *authService) GoogleSignInUser(token string) (*string, *apiError.Error) {
+func (a *authService) GoogleSignInUser(token string) (*models.TokenResponse, *apiError.Error) {
 
 	googleUserDetails, googleUserDetailsError := GetUserInfoFromGoogle(token)
 
@@ -160,9 +299,12 @@ func (a *authService) GoogleSignInUser(token string) (*string, *apiError.Error)
 	authToken, authTokenError := a.GetGoogleSignInToken(googleUserDetails)
 
 	if authTokenError != nil {
+		if err, ok := authTokenError.(*apiError.Error); ok {
+			return nil, err
+		}
 		return nil, apiError.New(fmt.Sprintf("unable sign in user: %v", authTokenError), http.StatusUnauthorized)
 	}
-	return &authToken, nil
+	return authToken, nil
 }
 
 // GetUserInfoFromGoogle will return information of user which is fetched from Google
@@ -194,7 +336,7 @@ func GetUserInfoFromGoogle(token string) (*models.GoogleUser, error) {
 	return googleUserDetails, nil
 }
 
-func (a *authService) FacebookSignInUser(token string) (*string, *apiError.Error) {
+func (a *authService) FacebookSignInUser(token string) (*models.TokenResponse, *apiError.Error) {
 	// rename function
 	fbUserDetails, fbUserDetailsError := GetUserInfoFromFacebook(token)
 
@@ -204,9 +346,12 @@ func (a *authService) FacebookSignInUser(token string) (*string, *apiError.Error
 
 	authToken, authTokenError := a.GetFacebookSignInToken(fbUserDetails)
 	if authTokenError != nil {
+		if err, ok := authTokenError.(*apiError.Error); ok {
+			return nil, err
+		}
 		return nil, apiError.New(fmt.Sprintf("unable sign in user: %v", authTokenError), http.StatusUnauthorized)
 	}
-	return &authToken, nil
+	return authToken, nil
 }
 
 // GetUserInfoFromFacebook will return information of user which is fetched from facebook
@@ -233,24 +378,24 @@ func GetUserInfoFromFacebook(token string) (*models.FacebookUser, error) {
 }
 
 // GetGoogleSignInToken Used for Signing In the Users
-func (a *authService) GetGoogleSignInToken(googleUserDetails *models.GoogleUser) (string, error) {
+func (a *authService) GetGoogleSignInToken(googleUserDetails *models.GoogleUser) (*models.TokenResponse, error) {
 	var result *models.User
 
 	if googleUserDetails == nil {
-		return "", fmt.Errorf("error: google user details can't be empty")
+		return nil, fmt.Errorf("error: google user details can't be empty")
 	}
 
 	if googleUserDetails.Email == "" {
-		return "", fmt.Errorf("error: email can't be empty")
+		return nil, fmt.Errorf("error: email can't be empty")
 	}
 
 	if googleUserDetails.Name == "" {
-		return "", fmt.Errorf("error: name can't be empty")
+		return nil, fmt.Errorf("error: name can't be empty")
 	}
 
 	result, err := a.authRepo.FindUserByEmail(googleUserDetails.Email)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return "", fmt.Errorf("error finding user: %+v", err)
+		return nil, fmt.Errorf("error finding user: %+v", err)
 	}
 
 	if result == nil {
@@ -260,38 +405,52 @@ func (a *authService) GetGoogleSignInToken(googleUserDetails *models.GoogleUser)
 		result.IsEmailActive = true
 		_, err = a.authRepo.CreateUser(result)
 		if err != nil {
-			return "", fmt.Errorf("error occurred creating user: %+v", err)
+			return nil, fmt.Errorf("error occurred creating user: %+v", err)
 		}
 	}
 
-	tokenString, err := jwt.GenerateToken(googleUserDetails.Email, a.Config.JWTSecret)
+	if err := checkSignIn(result, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if result.HasTwoFactor() {
+		challenge, err := a.twoFactorChallenge(result)
+		if err != nil {
+			return nil, err
+		}
+		return &models.TokenResponse{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
 
-	if tokenString == "" {
-		return "", fmt.Errorf("unable to generate Auth token: %+v", err)
+	tokenPair, err := a.issueTokens(result, models.ClientInfo{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate Auth token: %+v", err)
 	}
 
-	return tokenString, nil
+	return &models.TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+	}, nil
 }
 
 // GetFacebookSignInToken Used for Signing In the Users
-func (a *authService) GetFacebookSignInToken(facebookUserDetails *models.FacebookUser) (string, error) {
+func (a *authService) GetFacebookSignInToken(facebookUserDetails *models.FacebookUser) (*models.TokenResponse, error) {
 	var result *models.User
 
 	if facebookUserDetails == nil {
-		return "", fmt.Errorf("error: facebook user details can't be empty")
+		return nil, fmt.Errorf("error: facebook user details can't be empty")
 	}
 
 	if facebookUserDetails.Email == "" {
-		return "", fmt.Errorf("error: email can't be empty")
+		return nil, fmt.Errorf("error: email can't be empty")
 	}
 
 	if facebookUserDetails.Name == "" {
-		return "", fmt.Errorf("error: name can't be empty")
+		return nil, fmt.Errorf("error: name can't be empty")
 	}
 
 	result, err := a.authRepo.FindUserByEmail(facebookUserDetails.Email)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return "", fmt.Errorf("error finding user: %+v", err)
+		return nil, fmt.Errorf("error finding user: %+v", err)
 	}
 
 	if result == nil {
@@ -301,17 +460,31 @@ func (a *authService) GetFacebookSignInToken(facebookUserDetails *models.Faceboo
 		result.IsEmailActive = true
 		_, err = a.authRepo.CreateUser(result)
 		if err != nil {
-			return "", fmt.Errorf("error occurred creating user: %+v", err)
+			return nil, fmt.Errorf("error occurred creating user: %+v", err)
 		}
 	}
 
-	tokenString, err := jwt.GenerateToken(result.Email, a.Config.JWTSecret)
+	if err := checkSignIn(result, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if result.HasTwoFactor() {
+		challenge, err := a.twoFactorChallenge(result)
+		if err != nil {
+			return nil, err
+		}
+		return &models.TokenResponse{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
 
-	if tokenString == "" {
-		return "", fmt.Errorf("unable to generate Auth token: %+v", err)
+	tokenPair, err := a.issueTokens(result, models.ClientInfo{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate Auth token: %+v", err)
 	}
 
-	return tokenString, nil
+	return &models.TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+	}, nil
 }
 
 func (a *authService) DeleteUserByEmail(userEmail string) *apiError.Error {
@@ -3,10 +3,13 @@ package services
 import (
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
@@ -14,19 +17,22 @@ import (
 )
 
 var mockRepository *mocks.MockAuthRepository
+var mockSecurityRepository *mocks.MockSecurityRepository
+var mockMailer *mocks.MockMailer
 var testAuthService AuthService
 
 func setup(t *testing.T) func() {
 	ctrl := gomock.NewController(t)
 	ctrl.Finish()
 	mockRepository = mocks.NewMockAuthRepository(ctrl)
-	mailService := mocks.NewMockMailer(ctrl)
+	mockSecurityRepository = mocks.NewMockSecurityRepository(ctrl)
+	mockMailer = mocks.NewMockMailer(ctrl)
 	pushNotification := mocks.NewMockPushNotifier(ctrl)
-	testAuthService = NewAuthService(mockRepository, testConfig, mailService, pushNotification)
-
 	mockMedicationRepository = mocks.NewMockMedicationRepository(ctrl)
+	testAuthService = NewAuthService(mockRepository, mockSecurityRepository, mockMedicationRepository, testConfig, mockMailer, pushNotification)
+
 	mockMedicationHistoryRepository = mocks.NewMockMedicationHistoryRepository(ctrl)
-	testMedicationService = NewMedicationService(mockMedicationRepository, mockMedicationHistoryRepository, testConfig)
+	testMedicationService = NewMedicationService(mockMedicationRepository, mockMedicationHistoryRepository, mocks.NewMockDependentRepository(ctrl), testConfig)
 
 	testMedicationHistoryService = NewMedicationHistoryService(mockMedicationHistoryRepository, testConfig)
 	return func() {
@@ -60,6 +66,13 @@ func Test_AuthLoginService(t *testing.T) {
 	inactiveUser := user
 	inactiveUser.IsEmailActive = false
 
+	disabledAt := time.Now()
+	disabledUser := user
+	disabledUser.DisabledAt = &disabledAt
+
+	resetUser := user
+	resetUser.PasswordResetRequired = true
+
 	testCases := []struct {
 		name          string
 		input         models.LoginRequest
@@ -117,7 +130,29 @@ func Test_AuthLoginService(t *testing.T) {
 			dbOutput:      &inactiveUser,
 			dbError:       nil,
 			loginResponse: nil,
-			loginError:    errors.New("email not verified", http.StatusUnauthorized),
+			loginError:    errors.New("email not verified, request a new verification link if it did not arrive", http.StatusUnauthorized),
+		},
+		{
+			name: "disabled user case",
+			input: models.LoginRequest{
+				Email:    disabledUser.Email,
+				Password: "password",
+			},
+			dbOutput:      &disabledUser,
+			dbError:       nil,
+			loginResponse: nil,
+			loginError:    errors.ErrAccountDisabled,
+		},
+		{
+			name: "password reset required case",
+			input: models.LoginRequest{
+				Email:    resetUser.Email,
+				Password: "password",
+			},
+			dbOutput:      &resetUser,
+			dbError:       nil,
+			loginResponse: nil,
+			loginError:    errors.New("password reset required, check your email for a reset link", http.StatusForbidden),
 		},
 		{
 			name: "internal server error case",
@@ -137,11 +172,24 @@ func Test_AuthLoginService(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 
 			mockRepository.EXPECT().FindUserByEmail(tc.input.Email).Times(1).Return(tc.dbOutput, tc.dbError)
+			if tc.name == "login successful case" {
+				mockRepository.EXPECT().CreateSession(gomock.Any()).Times(1).Return(nil)
+				mockRepository.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
+				mockSecurityRepository.EXPECT().HasLoggedInFrom(user.ID, "").Times(1).Return(true, nil)
+				mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).Return(nil)
+			}
+			if tc.name == "invalid password case" {
+				mockSecurityRepository.EXPECT().RecordFailedLogin(user.ID, gomock.Any()).Times(1).Return(1, nil)
+			}
 
 			loginResponse, err := testAuthService.LoginUser(&tc.input)
 			if tc.name != "login successful case" {
 				require.Equal(t, tc.loginResponse, loginResponse)
 				require.Equal(t, tc.loginError, err)
+			} else {
+				require.Nil(t, err)
+				require.NotEmpty(t, loginResponse.AccessToken)
+				require.NotEmpty(t, loginResponse.RefreshToken)
 			}
 		})
 	}
@@ -187,3 +235,193 @@ func Test_DeleteUserByEmail(t *testing.T) {
 		})
 	}
 }
+
+func Test_VerifyEmail(t *testing.T) {
+	email := "sample@email.com"
+	verifyToken, err := jwt.GeneratePurposeToken(jwt.VerifyEmailTokenType, email, testConfig.JWTSecret)
+	require.NoError(t, err)
+	resetToken, err := jwt.GeneratePurposeToken(jwt.ResetPasswordTokenType, email, testConfig.JWTSecret)
+	require.NoError(t, err)
+	tokenPair, err := jwt.GenerateTokenPair(email, "", 0, testConfig.JWTSecret)
+	require.NoError(t, err)
+	unverified := &models.User{Model: models.Model{ID: 4}, Email: email, VerificationSentAt: time.Now().Add(-time.Minute).Unix()}
+	verified := &models.User{Model: models.Model{ID: 4}, Email: email, IsEmailActive: true}
+	resent := &models.User{Model: models.Model{ID: 4}, Email: email, VerificationSentAt: time.Now().Add(time.Minute).Unix()}
+	changingEmail := &models.User{Model: models.Model{ID: 4}, Email: "old@email.com", IsEmailActive: true, PendingEmail: email}
+
+	testCases := []struct {
+		name        string
+		token       string
+		buildStubs  func(repository *mocks.MockAuthRepository)
+		expectedErr *errors.Error
+	}{
+		{
+			name:  "email verified case",
+			token: verifyToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindUserToVerify(email).Times(1).Return(unverified, nil)
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).
+					DoAndReturn(func(blacklist *models.BlackList) error {
+						require.Equal(t, verifyToken, blacklist.Token)
+						require.Equal(t, email, blacklist.Email)
+						return nil
+					})
+				repository.EXPECT().VerifyEmail(uint(4), email).Times(1).Return(nil)
+			},
+		},
+		{
+			name:  "pending email verified case",
+			token: verifyToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindUserToVerify(email).Times(1).Return(changingEmail, nil)
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).Return(nil)
+				repository.EXPECT().VerifyEmail(uint(4), email).Times(1).Return(nil)
+			},
+		},
+		{
+			name:  "already verified case",
+			token: verifyToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindUserToVerify(email).Times(1).Return(verified, nil)
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+			},
+			expectedErr: errors.ErrEmailAlreadyVerified,
+		},
+		{
+			name:  "link replaced by a newer one case",
+			token: verifyToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindUserToVerify(email).Times(1).Return(resent, nil)
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+			},
+			expectedErr: errors.New("expired link", http.StatusUnauthorized),
+		},
+		{
+			name:  "unknown email case",
+			token: verifyToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindUserToVerify(email).Times(1).Return(nil, gorm.ErrRecordNotFound)
+			},
+			expectedErr: errors.New("invalid link", http.StatusUnauthorized),
+		},
+		{
+			name:  "link used before case",
+			token: verifyToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindUserToVerify(email).Times(1).Return(unverified, nil)
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(1).Return(db.ErrTokenUsed)
+				repository.EXPECT().VerifyEmail(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedErr: errors.New("expired link", http.StatusUnauthorized),
+		},
+		{
+			name:  "password reset link case",
+			token: resetToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+			},
+			expectedErr: errors.New("invalid link", http.StatusUnauthorized),
+		},
+		{
+			name:  "access token case",
+			token: tokenPair.AccessToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().ConsumeToken(gomock.Any()).Times(0)
+			},
+			expectedErr: errors.New("invalid link", http.StatusUnauthorized),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs(mockRepository)
+
+			err := testAuthService.VerifyEmail(tc.token)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_RequestVerificationEmail(t *testing.T) {
+	request := &models.ResendVerificationRequest{Email: "sample@email.com"}
+	unverified := &models.User{Model: models.Model{ID: 4}, Email: request.Email}
+	verified := &models.User{Model: models.Model{ID: 4}, Email: request.Email, IsEmailActive: true}
+	changingEmail := &models.User{Model: models.Model{ID: 4}, Email: request.Email, IsEmailActive: true, PendingEmail: "new@email.com"}
+
+	testCases := []struct {
+		name        string
+		buildStubs  func(repository *mocks.MockAuthRepository, mailer *mocks.MockMailer)
+		expectedErr *errors.Error
+	}{
+		{
+			name: "verification sent case",
+			buildStubs: func(repository *mocks.MockAuthRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().FindUserByEmail(request.Email).Times(1).Return(unverified, nil)
+				repository.EXPECT().SetVerificationSentAt(uint(4), gomock.Any()).Times(1).
+					DoAndReturn(func(userID uint, sentAt int64) error {
+						require.InDelta(t, time.Now().Unix(), sentAt, 5)
+						return nil
+					})
+				mailer.EXPECT().SendMail(request.Email, gomock.Any(), gomock.Any(), "emailverification", gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "pending email case",
+			buildStubs: func(repository *mocks.MockAuthRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().FindUserByEmail(request.Email).Times(1).Return(changingEmail, nil)
+				repository.EXPECT().SetVerificationSentAt(uint(4), gomock.Any()).Times(1).Return(nil)
+				mailer.EXPECT().SendMail("new@email.com", gomock.Any(), gomock.Any(), "emailverification", gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "already verified case",
+			buildStubs: func(repository *mocks.MockAuthRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().FindUserByEmail(request.Email).Times(1).Return(verified, nil)
+				repository.EXPECT().SetVerificationSentAt(gomock.Any(), gomock.Any()).Times(0)
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name: "unknown email case",
+			buildStubs: func(repository *mocks.MockAuthRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().FindUserByEmail(request.Email).Times(1).Return(nil, gorm.ErrRecordNotFound)
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name: "internal server error case",
+			buildStubs: func(repository *mocks.MockAuthRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().FindUserByEmail(request.Email).Times(1).Return(nil, gorm.ErrInvalidDB)
+			},
+			expectedErr: errors.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs(mockRepository, mockMailer)
+
+			err := testAuthService.RequestVerificationEmail(request)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_RequestVerificationEmailDoesNotRevealAccounts(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	verified := &models.User{Model: models.Model{ID: 4}, Email: "verified@email.com", IsEmailActive: true}
+	mockRepository.EXPECT().FindUserByEmail("unknown@email.com").Times(1).Return(nil, gorm.ErrRecordNotFound)
+	mockRepository.EXPECT().FindUserByEmail(verified.Email).Times(1).Return(verified, nil)
+	mockMailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	unknownErr := testAuthService.RequestVerificationEmail(&models.ResendVerificationRequest{Email: "unknown@email.com"})
+	verifiedErr := testAuthService.RequestVerificationEmail(&models.ResendVerificationRequest{Email: verified.Email})
+	require.Nil(t, unknownErr)
+	require.Equal(t, unknownErr, verifiedErr)
+}
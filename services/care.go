@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/care_mock.go -package=mocks github.com/decagonhq/meddle-api/services CareService
+
+// CareService lets patients share their medications with caregivers
+type CareService interface {
+	InviteCaregiver(patient *models.User, request *models.CareInviteRequest) (*models.CareShareResponse, *apiError.Error)
+	GetCaregivers(patientID uint) ([]models.CareShareResponse, *apiError.Error)
+	RemoveCaregiver(careShareID uint, patientID uint) *apiError.Error
+	GetCareInvitations(caregiver *models.User) ([]models.CareShareResponse, *apiError.Error)
+	AcceptCareInvitation(careShareID uint, caregiver *models.User) (*models.CareShareResponse, *apiError.Error)
+	GetPatients(caregiverID uint) ([]models.CareShareResponse, *apiError.Error)
+	LeavePatient(patientID uint, caregiverID uint) *apiError.Error
+	AuthorizeCareAccess(caregiverID uint, patientID uint, permission string) (*models.User, *apiError.Error)
+}
+
+var errCareShareNotFound = apiError.New("caregiver not found", http.StatusNotFound)
+
+type careService struct {
+	Config   *config.Config
+	careRepo db.CareRepository
+	mail     Mailer
+}
+
+// NewCareService instantiates a CareService
+func NewCareService(careRepo db.CareRepository, mail Mailer, conf *config.Config) CareService {
+	return &careService{
+		Config:   conf,
+		careRepo: careRepo,
+		mail:     mail,
+	}
+}
+
+// InviteCaregiver invites the owner of the email to look after the patient. The invitation is emailed,
+// and the caregiver accepts it once signed in with that email.
+func (c *careService) InviteCaregiver(patient *models.User, request *models.CareInviteRequest) (*models.CareShareResponse, *apiError.Error) {
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	if strings.EqualFold(email, patient.Email) {
+		return nil, apiError.New("you can not be your own caregiver", http.StatusBadRequest)
+	}
+	_, err := c.careRepo.FindCareShareByCaregiverEmail(patient.ID, email)
+	if err == nil {
+		return nil, apiError.New("caregiver already invited", http.StatusConflict)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error finding care share: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	careShare, err := c.careRepo.CreateCareShare(&models.CareShare{
+		PatientID:         patient.ID,
+		CaregiverEmail:    email,
+		Permission:        request.Permission,
+		NotifyMissedDoses: request.NotifyMissedDoses,
+	})
+	if err != nil {
+		log.Printf("error creating care share: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	subject := fmt.Sprintf("%s invited you to be their caregiver", patient.Name)
+	body := fmt.Sprintf("%s would like you to help manage their medications. Sign in to Meddle with this email to accept the invitation.", patient.Name)
+	value := map[string]interface{}{
+		"name":       patient.Name,
+		"permission": careShare.Permission,
+	}
+	if err := c.mail.SendMail(email, subject, body, "careinvitation", value); err != nil {
+		// the invitation is still listed for the caregiver when they sign in
+		log.Printf("error sending care invitation: %v\n", err)
+	}
+	return careShare.CareShareToResponse(), nil
+}
+
+// GetCaregivers returns the caregivers of the patient and the invitations still pending
+func (c *careService) GetCaregivers(patientID uint) ([]models.CareShareResponse, *apiError.Error) {
+	careShares, err := c.careRepo.GetCareSharesByPatient(patientID)
+	if err != nil {
+		log.Printf("error getting caregivers of user %v: %v", patientID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return careSharesToResponse(careShares), nil
+}
+
+// RemoveCaregiver revokes the access of a caregiver, or withdraws an invitation
+func (c *careService) RemoveCaregiver(careShareID uint, patientID uint) *apiError.Error {
+	err := c.careRepo.DeleteCareShareByPatient(careShareID, patientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errCareShareNotFound
+		}
+		log.Printf("error removing caregiver %v: %v", careShareID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetCareInvitations returns the invitations addressed to the caregiver that have not been accepted yet
+func (c *careService) GetCareInvitations(caregiver *models.User) ([]models.CareShareResponse, *apiError.Error) {
+	careShares, err := c.careRepo.GetPendingCareInvitations(strings.ToLower(caregiver.Email))
+	if err != nil {
+		log.Printf("error getting care invitations of user %v: %v", caregiver.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return careSharesToResponse(careShares), nil
+}
+
+// AcceptCareInvitation accepts an invitation addressed to the caregiver
+func (c *careService) AcceptCareInvitation(careShareID uint, caregiver *models.User) (*models.CareShareResponse, *apiError.Error) {
+	careShare, err := c.careRepo.AcceptCareShare(careShareID, caregiver.ID, strings.ToLower(caregiver.Email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("invitation not found", http.StatusNotFound)
+		}
+		log.Printf("error accepting care invitation %v: %v", careShareID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return careShare.CareShareToResponse(), nil
+}
+
+// GetPatients returns the patients the caregiver looks after
+func (c *careService) GetPatients(caregiverID uint) ([]models.CareShareResponse, *apiError.Error) {
+	careShares, err := c.careRepo.GetCareSharesByCaregiver(caregiverID)
+	if err != nil {
+		log.Printf("error getting patients of user %v: %v", caregiverID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return careSharesToResponse(careShares), nil
+}
+
+// LeavePatient stops the caregiver looking after the patient
+func (c *careService) LeavePatient(patientID uint, caregiverID uint) *apiError.Error {
+	err := c.careRepo.DeleteCareShareByCaregiver(patientID, caregiverID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("patient not found", http.StatusNotFound)
+		}
+		log.Printf("error leaving patient %v: %v", patientID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// AuthorizeCareAccess returns the patient when they shared their medications with the caregiver
+// with the given permission
+func (c *careService) AuthorizeCareAccess(caregiverID uint, patientID uint, permission string) (*models.User, *apiError.Error) {
+	careShare, err := c.careRepo.FindAcceptedCareShare(patientID, caregiverID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// patients who did not share with the caregiver are not told apart from unknown ones
+			return nil, apiError.New("patient not found", http.StatusNotFound)
+		}
+		log.Printf("error finding care share of patient %v: %v", patientID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if careShare.Patient == nil {
+		return nil, apiError.New("patient not found", http.StatusNotFound)
+	}
+	if !careShare.Allows(permission) {
+		return nil, apiError.New("you are not allowed to manage this patient", http.StatusForbidden)
+	}
+	return careShare.Patient, nil
+}
+
+func careSharesToResponse(careShares []models.CareShare) []models.CareShareResponse {
+	responses := make([]models.CareShareResponse, 0, len(careShares))
+	for i := range careShares {
+		responses = append(responses, *careShares[i].CareShareToResponse())
+	}
+	return responses
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_InviteCaregiver(t *testing.T) {
+	patient := &models.User{Model: models.Model{ID: 1}, Name: "Ada", Email: "ada@example.com"}
+	notFound := fmt.Errorf("could not find care share: %w", gorm.ErrRecordNotFound)
+
+	testCases := []struct {
+		name        string
+		request     *models.CareInviteRequest
+		buildStubs  func(careRepo *mocks.MockCareRepository, mailer *mocks.MockMailer)
+		expectedErr *apiError.Error
+	}{
+		{
+			name:    "caregiver invited case",
+			request: &models.CareInviteRequest{Email: "Caregiver@Example.com", Permission: models.CarePermissionRead, NotifyMissedDoses: true},
+			buildStubs: func(careRepo *mocks.MockCareRepository, mailer *mocks.MockMailer) {
+				careRepo.EXPECT().FindCareShareByCaregiverEmail(uint(1), "caregiver@example.com").Times(1).Return(nil, notFound)
+				careRepo.EXPECT().CreateCareShare(gomock.Any()).Times(1).
+					DoAndReturn(func(careShare *models.CareShare) (*models.CareShare, error) {
+						require.Equal(t, uint(1), careShare.PatientID)
+						require.True(t, careShare.NotifyMissedDoses)
+						careShare.ID = 3
+						return careShare, nil
+					})
+				mailer.EXPECT().SendMail("caregiver@example.com", gomock.Any(), gomock.Any(), "careinvitation", gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name:    "invitation kept when the email fails case",
+			request: &models.CareInviteRequest{Email: "caregiver@example.com", Permission: models.CarePermissionManage},
+			buildStubs: func(careRepo *mocks.MockCareRepository, mailer *mocks.MockMailer) {
+				careRepo.EXPECT().FindCareShareByCaregiverEmail(uint(1), "caregiver@example.com").Times(1).Return(nil, notFound)
+				careRepo.EXPECT().CreateCareShare(gomock.Any()).Times(1).
+					DoAndReturn(func(careShare *models.CareShare) (*models.CareShare, error) {
+						return careShare, nil
+					})
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("mailgun is down"))
+			},
+		},
+		{
+			name:    "own email case",
+			request: &models.CareInviteRequest{Email: "ADA@example.com", Permission: models.CarePermissionRead},
+			buildStubs: func(careRepo *mocks.MockCareRepository, mailer *mocks.MockMailer) {
+			},
+			expectedErr: apiError.New("you can not be your own caregiver", http.StatusBadRequest),
+		},
+		{
+			name:    "caregiver already invited case",
+			request: &models.CareInviteRequest{Email: "caregiver@example.com", Permission: models.CarePermissionRead},
+			buildStubs: func(careRepo *mocks.MockCareRepository, mailer *mocks.MockMailer) {
+				careRepo.EXPECT().FindCareShareByCaregiverEmail(uint(1), "caregiver@example.com").Times(1).Return(&models.CareShare{}, nil)
+			},
+			expectedErr: apiError.New("caregiver already invited", http.StatusConflict),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			careRepo := mocks.NewMockCareRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			careService := NewCareService(careRepo, mailer, testConfig)
+			tc.buildStubs(careRepo, mailer)
+
+			careShare, err := careService.InviteCaregiver(patient, tc.request)
+			require.Equal(t, tc.expectedErr, err)
+			if err == nil {
+				require.Equal(t, models.CareSharePending, careShare.Status)
+			}
+		})
+	}
+}
+
+func Test_AuthorizeCareAccess(t *testing.T) {
+	acceptedAt := time.Now()
+	caregiverID := uint(2)
+	patient := &models.User{Model: models.Model{ID: 1}, Name: "Ada"}
+	careShare := func(permission string) *models.CareShare {
+		return &models.CareShare{
+			PatientID:   1,
+			Patient:     patient,
+			CaregiverID: &caregiverID,
+			Permission:  permission,
+			AcceptedAt:  &acceptedAt,
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		permission  string
+		dbOutput    *models.CareShare
+		dbError     error
+		expectedErr *apiError.Error
+	}{
+		{
+			name:       "read caregiver reads case",
+			permission: models.CarePermissionRead,
+			dbOutput:   careShare(models.CarePermissionRead),
+		},
+		{
+			name:       "manage caregiver reads case",
+			permission: models.CarePermissionRead,
+			dbOutput:   careShare(models.CarePermissionManage),
+		},
+		{
+			name:       "manage caregiver manages case",
+			permission: models.CarePermissionManage,
+			dbOutput:   careShare(models.CarePermissionManage),
+		},
+		{
+			name:        "read caregiver manages case",
+			permission:  models.CarePermissionManage,
+			dbOutput:    careShare(models.CarePermissionRead),
+			expectedErr: apiError.New("you are not allowed to manage this patient", http.StatusForbidden),
+		},
+		{
+			name:        "patient not shared case",
+			permission:  models.CarePermissionRead,
+			dbError:     fmt.Errorf("could not find care share: %w", gorm.ErrRecordNotFound),
+			expectedErr: apiError.New("patient not found", http.StatusNotFound),
+		},
+		{
+			name:        "internal server error case",
+			permission:  models.CarePermissionRead,
+			dbError:     gorm.ErrInvalidDB,
+			expectedErr: apiError.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			careRepo := mocks.NewMockCareRepository(ctrl)
+			careService := NewCareService(careRepo, mocks.NewMockMailer(ctrl), testConfig)
+			careRepo.EXPECT().FindAcceptedCareShare(uint(1), caregiverID).Times(1).Return(tc.dbOutput, tc.dbError)
+
+			authorizedPatient, err := careService.AuthorizeCareAccess(caregiverID, 1, tc.permission)
+			require.Equal(t, tc.expectedErr, err)
+			if err == nil {
+				require.Equal(t, patient, authorizedPatient)
+			}
+		})
+	}
+}
+
+func Test_AcceptCareInvitation(t *testing.T) {
+	caregiver := &models.User{Model: models.Model{ID: 2}, Email: "Caregiver@example.com"}
+	acceptedAt := time.Now()
+
+	t.Run("invitation accepted case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		careRepo := mocks.NewMockCareRepository(ctrl)
+		careService := NewCareService(careRepo, mocks.NewMockMailer(ctrl), testConfig)
+		careRepo.EXPECT().AcceptCareShare(uint(3), uint(2), "caregiver@example.com").Times(1).
+			Return(&models.CareShare{Model: models.Model{ID: 3}, CaregiverID: &caregiver.ID, AcceptedAt: &acceptedAt}, nil)
+
+		careShare, err := careService.AcceptCareInvitation(3, caregiver)
+		require.Nil(t, err)
+		require.Equal(t, models.CareShareAccepted, careShare.Status)
+	})
+
+	t.Run("invitation addressed to someone else case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		careRepo := mocks.NewMockCareRepository(ctrl)
+		careService := NewCareService(careRepo, mocks.NewMockMailer(ctrl), testConfig)
+		careRepo.EXPECT().AcceptCareShare(uint(3), uint(2), "caregiver@example.com").Times(1).
+			Return(nil, fmt.Errorf("could not accept care share: %w", gorm.ErrRecordNotFound))
+
+		_, err := careService.AcceptCareInvitation(3, caregiver)
+		require.Equal(t, apiError.New("invitation not found", http.StatusNotFound), err)
+	})
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/dependent_mock.go -package=mocks github.com/decagonhq/meddle-api/services DependentService
+
+// DependentService manages the dependents whose medications an account looks after
+type DependentService interface {
+	CreateDependent(ownerID uint, request *models.DependentRequest) (*models.DependentResponse, *apiError.Error)
+	GetDependents(ownerID uint) ([]models.DependentResponse, *apiError.Error)
+	UpdateDependent(dependentID uint, ownerID uint, request *models.DependentRequest) (*models.DependentResponse, *apiError.Error)
+	DeleteDependent(dependentID uint, ownerID uint) *apiError.Error
+}
+
+var errDependentNotFound = apiError.New("dependent not found", http.StatusNotFound)
+
+type dependentService struct {
+	Config        *config.Config
+	dependentRepo db.DependentRepository
+}
+
+// NewDependentService instantiates a DependentService
+func NewDependentService(dependentRepo db.DependentRepository, conf *config.Config) DependentService {
+	return &dependentService{
+		Config:        conf,
+		dependentRepo: dependentRepo,
+	}
+}
+
+func (d *dependentService) CreateDependent(ownerID uint, request *models.DependentRequest) (*models.DependentResponse, *apiError.Error) {
+	dependent, err := d.dependentRepo.CreateDependent(request.ReqToDependentModel(ownerID))
+	if err != nil {
+		log.Printf("error creating dependent: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return dependent.DependentToResponse(), nil
+}
+
+func (d *dependentService) GetDependents(ownerID uint) ([]models.DependentResponse, *apiError.Error) {
+	dependents, err := d.dependentRepo.GetDependents(ownerID)
+	if err != nil {
+		log.Printf("error getting dependents of user %v: %v", ownerID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	responses := make([]models.DependentResponse, 0, len(dependents))
+	for i := range dependents {
+		responses = append(responses, *dependents[i].DependentToResponse())
+	}
+	return responses, nil
+}
+
+func (d *dependentService) UpdateDependent(dependentID uint, ownerID uint, request *models.DependentRequest) (*models.DependentResponse, *apiError.Error) {
+	dependent, err := d.dependentRepo.FindDependent(dependentID, ownerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errDependentNotFound
+		}
+		log.Printf("error finding dependent %v: %v", dependentID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	dependent.Name = request.Name
+	dependent.Relationship = request.Relationship
+	dependent.DateOfBirth = request.DateOfBirth
+	if err := d.dependentRepo.UpdateDependent(dependent); err != nil {
+		log.Printf("error updating dependent %v: %v", dependentID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return dependent.DependentToResponse(), nil
+}
+
+// DeleteDependent deletes the dependent and its medications
+func (d *dependentService) DeleteDependent(dependentID uint, ownerID uint) *apiError.Error {
+	err := d.dependentRepo.DeleteDependent(dependentID, ownerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errDependentNotFound
+		}
+		log.Printf("error deleting dependent %v: %v", dependentID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
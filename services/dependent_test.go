@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_UpdateDependent(t *testing.T) {
+	request := &models.DependentRequest{Name: "Tobi", Relationship: "son", DateOfBirth: "2015-04-02"}
+
+	testCases := []struct {
+		name        string
+		buildStubs  func(repository *mocks.MockDependentRepository)
+		expectedErr *apiError.Error
+	}{
+		{
+			name: "dependent updated case",
+			buildStubs: func(repository *mocks.MockDependentRepository) {
+				repository.EXPECT().FindDependent(uint(4), uint(1)).Times(1).
+					Return(&models.Dependent{Model: models.Model{ID: 4}, OwnerID: 1, Name: "Tobii"}, nil)
+				repository.EXPECT().UpdateDependent(gomock.Any()).Times(1).
+					DoAndReturn(func(dependent *models.Dependent) error {
+						require.Equal(t, "Tobi", dependent.Name)
+						require.Equal(t, "son", dependent.Relationship)
+						require.Equal(t, "2015-04-02", dependent.DateOfBirth)
+						return nil
+					})
+			},
+		},
+		{
+			name: "dependent of another user case",
+			buildStubs: func(repository *mocks.MockDependentRepository) {
+				repository.EXPECT().FindDependent(uint(4), uint(1)).Times(1).
+					Return(nil, fmt.Errorf("could not find dependent: %w", gorm.ErrRecordNotFound))
+				repository.EXPECT().UpdateDependent(gomock.Any()).Times(0)
+			},
+			expectedErr: errDependentNotFound,
+		},
+		{
+			name: "internal server error case",
+			buildStubs: func(repository *mocks.MockDependentRepository) {
+				repository.EXPECT().FindDependent(uint(4), uint(1)).Times(1).
+					Return(&models.Dependent{Model: models.Model{ID: 4}, OwnerID: 1}, nil)
+				repository.EXPECT().UpdateDependent(gomock.Any()).Times(1).Return(gorm.ErrInvalidDB)
+			},
+			expectedErr: apiError.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockDependentRepository(ctrl)
+			service := NewDependentService(repository, testConfig)
+			tc.buildStubs(repository)
+
+			dependent, err := service.UpdateDependent(4, 1, request)
+			require.Equal(t, tc.expectedErr, err)
+			if err == nil {
+				require.Equal(t, "Tobi", dependent.Name)
+			}
+		})
+	}
+}
+
+func Test_DeleteDependent(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dbError     error
+		expectedErr *apiError.Error
+	}{
+		{
+			name: "dependent deleted case",
+		},
+		{
+			name:        "dependent not found case",
+			dbError:     fmt.Errorf("could not delete dependent: %w", gorm.ErrRecordNotFound),
+			expectedErr: errDependentNotFound,
+		},
+		{
+			name:        "internal server error case",
+			dbError:     gorm.ErrInvalidDB,
+			expectedErr: apiError.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockDependentRepository(ctrl)
+			service := NewDependentService(repository, testConfig)
+			repository.EXPECT().DeleteDependent(uint(4), uint(1)).Times(1).Return(tc.dbError)
+
+			require.Equal(t, tc.expectedErr, service.DeleteDependent(4, 1))
+		})
+	}
+}
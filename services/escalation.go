@@ -0,0 +1,271 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"gorm.io/gorm"
+)
+
+// unconfirmedDoseBatchSize is the number of unconfirmed doses loaded at a time
+const unconfirmedDoseBatchSize = 100
+
+type EscalationService interface {
+	EscalateUnconfirmedDoses() (int, error)
+}
+
+type escalationService struct {
+	Config                *config.Config
+	medicationHistoryRepo db.MedicationHistoryRepository
+	authRepo              db.AuthRepository
+	careRepo              db.CareRepository
+	pushNotifier          PushNotifier
+	mail                  Mailer
+	sms                   SMSSender
+}
+
+// NewEscalationService instantiates an EscalationService
+func NewEscalationService(medicationHistoryRepo db.MedicationHistoryRepository, authRepo db.AuthRepository, careRepo db.CareRepository, pushNotifier PushNotifier, mail Mailer, sms SMSSender, conf *config.Config) EscalationService {
+	return &escalationService{
+		Config:                conf,
+		medicationHistoryRepo: medicationHistoryRepo,
+		authRepo:              authRepo,
+		careRepo:              careRepo,
+		pushNotifier:          pushNotifier,
+		mail:                  mail,
+		sms:                   sms,
+	}
+}
+
+// EscalateUnconfirmedDoses cron job
+// follows up on the due doses the user has not confirmed yet, according to the escalation policy of their medication:
+// the user is nudged again and the caregiver is emailed as the dose gets later, and once the grace period is over
+// the dose is marked as missed, which the caregivers who asked for it are told about. It returns the number of doses marked as missed.
+func (e *escalationService) EscalateUnconfirmedDoses() (int, error) {
+	now := time.Now()
+	missed := 0
+	var afterID uint
+	for {
+		medicationHistories, err := e.medicationHistoryRepo.GetUnconfirmedMedicationHistories(now, afterID, unconfirmedDoseBatchSize)
+		if err != nil {
+			return missed, err
+		}
+		for i := range medicationHistories {
+			marked, err := e.escalateDose(&medicationHistories[i], now)
+			if err != nil {
+				return missed, err
+			}
+			if marked {
+				missed++
+			}
+		}
+		if len(medicationHistories) < unconfirmedDoseBatchSize {
+			return missed, nil
+		}
+		afterID = medicationHistories[len(medicationHistories)-1].ID
+	}
+}
+
+// escalateDose takes the next steps of the escalation policy that fell due for the dose, it reports whether the dose was marked as missed
+func (e *escalationService) escalateDose(medicationHistory *models.MedicationHistory, now time.Time) (bool, error) {
+	gracePeriod := time.Duration(e.Config.MissedDoseGraceMinutes) * time.Minute
+	policy := medicationHistory.EscalationPolicy
+	late := now.Sub(medicationHistory.MedicationTime)
+
+	if policy.IsMissed(late, gracePeriod) {
+		marked, err := e.medicationHistoryRepo.MarkMedicationHistoryMissed(medicationHistory.ID)
+		if err != nil {
+			return false, err
+		}
+		if marked {
+			e.notifyCaregiversOfMissedDose(medicationHistory)
+		}
+		return marked, nil
+	}
+
+	escalated := false
+	if nudgesDue := policy.NudgesDue(late); nudgesDue > medicationHistory.NudgesSent {
+		// nudges that fell due while the job was not running are not sent one after the other
+		e.sendDoseNudge(medicationHistory)
+		medicationHistory.NudgesSent = nudgesDue
+		escalated = true
+	}
+	if policy.IsCaregiverDue(late) && medicationHistory.CaregiverNotifiedAt == nil {
+		e.notifyCaregiver(medicationHistory)
+		notifiedAt := now
+		medicationHistory.CaregiverNotifiedAt = &notifiedAt
+		escalated = true
+	}
+	if escalated {
+		if err := e.medicationHistoryRepo.UpdateMedicationHistoryEscalation(medicationHistory); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// sendDoseNudge asks the user again whether they took the dose, on their devices and by text as far as they turned on push and sms notifications
+func (e *escalationService) sendDoseNudge(medicationHistory *models.MedicationHistory) {
+	dosageTime := medicationHistory.MedicationTime.In(models.LoadLocation(medicationHistory.Timezone)).Format(time.Kitchen)
+	title := models.ForDependent(medicationHistory.Dependent, fmt.Sprintf("Reminder: %s", medicationHistory.MedicationName))
+	body := fmt.Sprintf("Did you take your %s due at %v?", medicationHistory.MedicationName, dosageTime)
+	if medicationHistory.Dependent != nil {
+		body = fmt.Sprintf("Did %s take their %s due at %v?", medicationHistory.Dependent.Name, medicationHistory.MedicationName, dosageTime)
+	}
+
+	user, err := e.authRepo.FindUserByID(medicationHistory.UserID)
+	if err != nil {
+		log.Printf("error finding user %v: %v\n", medicationHistory.UserID, err)
+		return
+	}
+	if user.Preferences.PushNotifications {
+		e.pushDoseNudge(medicationHistory, title, body)
+	}
+	if user.CanReceiveSMS(e.Config.RequireVerifiedPhoneForSMS) {
+		if err := e.sms.SendSMS(user.PhoneNumber, title+". "+body); err != nil {
+			log.Printf("error sending dose nudge sms: %v\n", err)
+		}
+	}
+}
+
+func (e *escalationService) pushDoseNudge(medicationHistory *models.MedicationHistory, title, body string) {
+	deviceTokens, err := e.pushNotifier.GetSingleUserDeviceTokens(int(medicationHistory.UserID))
+	if err != nil {
+		log.Printf("error retrieving device notification tokens: %v\n", err)
+		return
+	}
+	if len(deviceTokens) == 0 {
+		return
+	}
+
+	data := map[string]string{
+		"medication_id":      fmt.Sprintf("%v", medicationHistory.MedicationID),
+		"dose_occurrence_id": fmt.Sprintf("%v", medicationHistory.DoseOccurrenceID),
+	}
+	if medicationHistory.DoseOccurrenceID != 0 {
+		actionToken, err := jwt.GenerateDoseActionToken(medicationHistory.UserID, medicationHistory.DoseOccurrenceID, e.Config.JWTSecret)
+		if err != nil {
+			log.Printf("error generating dose action token: %v\n", err)
+			return
+		}
+		data["action_token"] = actionToken
+	}
+
+	_, sendErr := e.pushNotifier.SendPushNotification(deviceTokens, &models.PushPayload{
+		Body:     body,
+		Title:    title,
+		Data:     data,
+		Category: models.NextMedicationCategory,
+	})
+	if sendErr != nil {
+		log.Println("error sending dose nudge", sendErr)
+	}
+}
+
+// notifyCaregiver emails the caregiver of the escalation policy that the dose is still unconfirmed. Patient details are
+// only sent to a caregiver who accepted a care invitation of the user, never to an address merely typed into the policy.
+func (e *escalationService) notifyCaregiver(medicationHistory *models.MedicationHistory) {
+	careShare, err := e.careRepo.FindCareShareByCaregiverEmail(medicationHistory.UserID, medicationHistory.EscalationPolicy.CaregiverEmail)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error finding care share of user %v: %v\n", medicationHistory.UserID, err)
+		return
+	}
+	if careShare == nil || !careShare.IsAccepted() {
+		log.Printf("caregiver alert of user %v not sent, the caregiver has not accepted a care invitation\n", medicationHistory.UserID)
+		return
+	}
+
+	user, err := e.authRepo.FindUserByID(medicationHistory.UserID)
+	if err != nil {
+		log.Printf("error finding user %v: %v\n", medicationHistory.UserID, err)
+		return
+	}
+
+	name := patientName(user, medicationHistory)
+	dosageTime := medicationHistory.MedicationTime.In(models.LoadLocation(medicationHistory.Timezone)).Format(time.Kitchen)
+	subject := fmt.Sprintf("%s has not confirmed a dose of %s", name, medicationHistory.MedicationName)
+	body := fmt.Sprintf("%s was due to take %s at %v and has not confirmed it yet.", name, medicationHistory.MedicationName, dosageTime)
+	value := map[string]interface{}{
+		"name":            name,
+		"medication_name": medicationHistory.MedicationName,
+		"dosage_time":     dosageTime,
+	}
+	err = e.mail.SendMail(careShare.CaregiverEmail, subject, body, "caregiveralert", value)
+	if err != nil {
+		log.Printf("error sending caregiver alert: %v\n", err)
+	}
+}
+
+// notifyCaregiversOfMissedDose tells the caregivers of the user who asked for it that a dose was missed
+func (e *escalationService) notifyCaregiversOfMissedDose(medicationHistory *models.MedicationHistory) {
+	caregivers, err := e.careRepo.GetMissedDoseCaregivers(medicationHistory.UserID)
+	if err != nil {
+		log.Printf("error getting caregivers of user %v: %v\n", medicationHistory.UserID, err)
+		return
+	}
+	if len(caregivers) == 0 {
+		return
+	}
+	user, err := e.authRepo.FindUserByID(medicationHistory.UserID)
+	if err != nil {
+		log.Printf("error finding user %v: %v\n", medicationHistory.UserID, err)
+		return
+	}
+
+	name := patientName(user, medicationHistory)
+	dosageTime := medicationHistory.MedicationTime.In(models.LoadLocation(medicationHistory.Timezone)).Format(time.Kitchen)
+	title := fmt.Sprintf("%s missed a dose of %s", name, medicationHistory.MedicationName)
+	body := fmt.Sprintf("%s was due to take %s at %v and did not confirm it.", name, medicationHistory.MedicationName, dosageTime)
+	for _, caregiver := range caregivers {
+		if caregiver.Preferences.PushNotifications {
+			deviceTokens, tokensErr := e.pushNotifier.GetSingleUserDeviceTokens(int(caregiver.ID))
+			if tokensErr != nil {
+				log.Printf("error retrieving device notification tokens: %v\n", tokensErr)
+			} else if len(deviceTokens) > 0 {
+				_, sendErr := e.pushNotifier.SendPushNotification(deviceTokens, &models.PushPayload{
+					Title: title,
+					Body:  body,
+					Data: map[string]string{
+						"patient_id":    fmt.Sprintf("%v", medicationHistory.UserID),
+						"medication_id": fmt.Sprintf("%v", medicationHistory.MedicationID),
+					},
+					Category: models.MissedDoseCategory,
+				})
+				if sendErr != nil {
+					log.Println("error sending missed dose alert", sendErr)
+				}
+			}
+		}
+		if caregiver.Preferences.EmailNotifications {
+			value := map[string]interface{}{
+				"name":            caregiver.Name,
+				"patient_name":    name,
+				"medication_name": medicationHistory.MedicationName,
+				"dosage_time":     dosageTime,
+			}
+			err = e.mail.SendMail(caregiver.Email, title, body, "misseddose", value)
+			if err != nil {
+				log.Printf("error sending missed dose alert: %v\n", err)
+			}
+		}
+		if caregiver.CanReceiveSMS(e.Config.RequireVerifiedPhoneForSMS) {
+			if err := e.sms.SendSMS(caregiver.PhoneNumber, title+". "+body); err != nil {
+				log.Printf("error sending missed dose alert sms: %v\n", err)
+			}
+		}
+	}
+}
+
+// patientName is the name of who the dose was for, the user or one of their dependents
+func patientName(user *models.User, medicationHistory *models.MedicationHistory) string {
+	if medicationHistory.Dependent != nil {
+		return medicationHistory.Dependent.Name
+	}
+	return user.Name
+}
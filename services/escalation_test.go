@@ -0,0 +1,314 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_EscalateUnconfirmedDoses(t *testing.T) {
+	caregiverPolicy := models.EscalationPolicy{
+		NudgeAfterMinutes:     []int{15},
+		CaregiverAfterMinutes: 60,
+		CaregiverEmail:        "caregiver@example.com",
+	}
+	dueAgo := func(minutes int) time.Time {
+		return time.Now().Add(-time.Duration(minutes) * time.Minute)
+	}
+
+	testCases := []struct {
+		name              string
+		medicationHistory models.MedicationHistory
+		dbError           error
+		expectedMissed    int
+		buildStubs        func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer)
+		expectedErr       bool
+	}{
+		{
+			name: "dose past the grace period is marked missed case",
+			medicationHistory: models.MedicationHistory{
+				Model:          models.Model{ID: 1},
+				MedicationTime: dueAgo(testConfig.MissedDoseGraceMinutes + 1),
+			},
+			expectedMissed: 1,
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				historyRepo.EXPECT().MarkMedicationHistoryMissed(uint(1)).Times(1).Return(true, nil)
+				careRepo.EXPECT().GetMissedDoseCaregivers(uint(0)).Times(1).Return(nil, nil)
+			},
+		},
+		{
+			name: "dose past the policy missed window is marked missed case",
+			medicationHistory: models.MedicationHistory{
+				Model:            models.Model{ID: 1},
+				MedicationTime:   dueAgo(31),
+				EscalationPolicy: models.EscalationPolicy{MissedAfterMinutes: 30},
+			},
+			expectedMissed: 1,
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				historyRepo.EXPECT().MarkMedicationHistoryMissed(uint(1)).Times(1).Return(true, nil)
+				careRepo.EXPECT().GetMissedDoseCaregivers(uint(0)).Times(1).Return(nil, nil)
+			},
+		},
+		{
+			name: "caregivers told about the missed dose case",
+			medicationHistory: models.MedicationHistory{
+				Model:          models.Model{ID: 1},
+				UserID:         2,
+				MedicationName: "Paracetamol",
+				MedicationTime: dueAgo(testConfig.MissedDoseGraceMinutes + 1),
+			},
+			expectedMissed: 1,
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				historyRepo.EXPECT().MarkMedicationHistoryMissed(uint(1)).Times(1).Return(true, nil)
+				careRepo.EXPECT().GetMissedDoseCaregivers(uint(2)).Times(1).Return([]models.User{
+					{
+						Model:       models.Model{ID: 5},
+						Email:       "caregiver@example.com",
+						Preferences: models.UserPreferences{PushNotifications: true, EmailNotifications: true},
+					},
+				}, nil)
+				authRepo.EXPECT().FindUserByID(uint(2)).Times(1).Return(&models.User{Name: "Ada"}, nil)
+				pushNotifier.EXPECT().GetSingleUserDeviceTokens(5).Times(1).Return([]string{"token"}, nil)
+				pushNotifier.EXPECT().SendPushNotification([]string{"token"}, gomock.Any()).Times(1).
+					DoAndReturn(func(tokens []string, payload *models.PushPayload) ([]models.PushDelivery, *apiError.Error) {
+						require.Equal(t, models.MissedDoseCategory, payload.Category)
+						require.Equal(t, "2", payload.Data["patient_id"])
+						return nil, nil
+					})
+				mailer.EXPECT().SendMail("caregiver@example.com", gomock.Any(), gomock.Any(), "misseddose", gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "dose confirmed before it is marked missed case",
+			medicationHistory: models.MedicationHistory{
+				Model:          models.Model{ID: 1},
+				MedicationTime: dueAgo(testConfig.MissedDoseGraceMinutes + 1),
+			},
+			expectedMissed: 0,
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				historyRepo.EXPECT().MarkMedicationHistoryMissed(uint(1)).Times(1).Return(false, nil)
+			},
+		},
+		{
+			name: "user nudged with the default policy case",
+			medicationHistory: models.MedicationHistory{
+				Model:            models.Model{ID: 1},
+				UserID:           2,
+				DoseOccurrenceID: 3,
+				MedicationName:   "Paracetamol",
+				MedicationTime:   dueAgo(20),
+			},
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				pushNotifier.EXPECT().GetSingleUserDeviceTokens(2).Times(1).Return([]string{"token"}, nil)
+				pushNotifier.EXPECT().SendPushNotification([]string{"token"}, gomock.Any()).Times(1).
+					DoAndReturn(func(tokens []string, payload *models.PushPayload) ([]models.PushDelivery, *apiError.Error) {
+						require.Equal(t, "3", payload.Data["dose_occurrence_id"])
+						require.NotEmpty(t, payload.Data["action_token"])
+						return nil, nil
+					})
+				authRepo.EXPECT().FindUserByID(uint(2)).Times(1).
+					Return(&models.User{Name: "Ada", Preferences: models.UserPreferences{PushNotifications: true}}, nil)
+				historyRepo.EXPECT().UpdateMedicationHistoryEscalation(gomock.Any()).Times(1).
+					DoAndReturn(func(medicationHistory *models.MedicationHistory) error {
+						require.Equal(t, 1, medicationHistory.NudgesSent)
+						require.Nil(t, medicationHistory.CaregiverNotifiedAt)
+						return nil
+					})
+			},
+		},
+		{
+			name: "user who turned push notifications off is not pushed the nudge case",
+			medicationHistory: models.MedicationHistory{
+				Model:            models.Model{ID: 1},
+				UserID:           2,
+				DoseOccurrenceID: 3,
+				MedicationName:   "Paracetamol",
+				MedicationTime:   dueAgo(20),
+			},
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				authRepo.EXPECT().FindUserByID(uint(2)).Times(1).Return(&models.User{Name: "Ada"}, nil)
+				pushNotifier.EXPECT().GetSingleUserDeviceTokens(gomock.Any()).Times(0)
+				pushNotifier.EXPECT().SendPushNotification(gomock.Any(), gomock.Any()).Times(0)
+				historyRepo.EXPECT().UpdateMedicationHistoryEscalation(gomock.Any()).Times(1).
+					DoAndReturn(func(medicationHistory *models.MedicationHistory) error {
+						require.Equal(t, 1, medicationHistory.NudgesSent)
+						return nil
+					})
+			},
+		},
+		{
+			name: "user already nudged case",
+			medicationHistory: models.MedicationHistory{
+				Model:          models.Model{ID: 1},
+				MedicationTime: dueAgo(20),
+				NudgesSent:     1,
+			},
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+			},
+		},
+		{
+			name: "caregiver notified case",
+			medicationHistory: models.MedicationHistory{
+				Model:            models.Model{ID: 1},
+				UserID:           2,
+				MedicationName:   "Paracetamol",
+				MedicationTime:   dueAgo(61),
+				NudgesSent:       1,
+				EscalationPolicy: caregiverPolicy,
+			},
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				acceptedAt, caregiverID := time.Now(), uint(5)
+				careRepo.EXPECT().FindCareShareByCaregiverEmail(uint(2), "caregiver@example.com").Times(1).
+					Return(&models.CareShare{CaregiverEmail: "caregiver@example.com", CaregiverID: &caregiverID, AcceptedAt: &acceptedAt}, nil)
+				authRepo.EXPECT().FindUserByID(uint(2)).Times(1).Return(&models.User{Name: "Ada"}, nil)
+				mailer.EXPECT().SendMail("caregiver@example.com", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				historyRepo.EXPECT().UpdateMedicationHistoryEscalation(gomock.Any()).Times(1).
+					DoAndReturn(func(medicationHistory *models.MedicationHistory) error {
+						require.NotNil(t, medicationHistory.CaregiverNotifiedAt)
+						return nil
+					})
+			},
+		},
+		{
+			name: "caregiver who has not accepted an invitation is not emailed case",
+			medicationHistory: models.MedicationHistory{
+				Model:            models.Model{ID: 1},
+				UserID:           2,
+				MedicationName:   "Paracetamol",
+				MedicationTime:   dueAgo(61),
+				NudgesSent:       1,
+				EscalationPolicy: caregiverPolicy,
+			},
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				careRepo.EXPECT().FindCareShareByCaregiverEmail(uint(2), "caregiver@example.com").Times(1).
+					Return(&models.CareShare{CaregiverEmail: "caregiver@example.com"}, nil)
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				historyRepo.EXPECT().UpdateMedicationHistoryEscalation(gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "address that was never invited is not emailed case",
+			medicationHistory: models.MedicationHistory{
+				Model:            models.Model{ID: 1},
+				UserID:           2,
+				MedicationName:   "Paracetamol",
+				MedicationTime:   dueAgo(61),
+				NudgesSent:       1,
+				EscalationPolicy: caregiverPolicy,
+			},
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+				careRepo.EXPECT().FindCareShareByCaregiverEmail(uint(2), "caregiver@example.com").Times(1).
+					Return(nil, fmt.Errorf("could not find care share: %w", gorm.ErrRecordNotFound))
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				historyRepo.EXPECT().UpdateMedicationHistoryEscalation(gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "error getting unconfirmed doses case",
+			buildStubs: func(historyRepo *mocks.MockMedicationHistoryRepository, authRepo *mocks.MockAuthRepository, careRepo *mocks.MockCareRepository, pushNotifier *mocks.MockPushNotifier, mailer *mocks.MockMailer) {
+			},
+			dbError:     gorm.ErrInvalidDB,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			historyRepo := mocks.NewMockMedicationHistoryRepository(ctrl)
+			authRepo := mocks.NewMockAuthRepository(ctrl)
+			careRepo := mocks.NewMockCareRepository(ctrl)
+			pushNotifier := mocks.NewMockPushNotifier(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			escalationService := NewEscalationService(historyRepo, authRepo, careRepo, pushNotifier, mailer, mocks.NewMockSMSSender(ctrl), testConfig)
+
+			if tc.dbError != nil {
+				historyRepo.EXPECT().GetUnconfirmedMedicationHistories(gomock.Any(), uint(0), unconfirmedDoseBatchSize).Times(1).Return(nil, tc.dbError)
+			} else {
+				historyRepo.EXPECT().GetUnconfirmedMedicationHistories(gomock.Any(), uint(0), unconfirmedDoseBatchSize).Times(1).
+					Return([]models.MedicationHistory{tc.medicationHistory}, nil)
+			}
+			tc.buildStubs(historyRepo, authRepo, careRepo, pushNotifier, mailer)
+
+			missed, err := escalationService.EscalateUnconfirmedDoses()
+			require.Equal(t, tc.expectedErr, err != nil)
+			require.Equal(t, tc.expectedMissed, missed)
+		})
+	}
+}
+
+func Test_EscalateUnconfirmedDosesInBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	historyRepo := mocks.NewMockMedicationHistoryRepository(ctrl)
+	escalationService := NewEscalationService(historyRepo, mocks.NewMockAuthRepository(ctrl), mocks.NewMockCareRepository(ctrl),
+		mocks.NewMockPushNotifier(ctrl), mocks.NewMockMailer(ctrl), mocks.NewMockSMSSender(ctrl), testConfig)
+
+	// a full batch of doses that were nudged already, then the last one that is missed
+	batch := make([]models.MedicationHistory, unconfirmedDoseBatchSize)
+	for i := range batch {
+		batch[i] = models.MedicationHistory{Model: models.Model{ID: uint(i + 1)}, MedicationTime: time.Now().Add(-20 * time.Minute), NudgesSent: 1}
+	}
+	lastID := uint(unconfirmedDoseBatchSize + 1)
+	gomock.InOrder(
+		historyRepo.EXPECT().GetUnconfirmedMedicationHistories(gomock.Any(), uint(0), unconfirmedDoseBatchSize).Times(1).Return(batch, nil),
+		historyRepo.EXPECT().GetUnconfirmedMedicationHistories(gomock.Any(), uint(unconfirmedDoseBatchSize), unconfirmedDoseBatchSize).Times(1).
+			Return([]models.MedicationHistory{{Model: models.Model{ID: lastID}, MedicationTime: time.Now().Add(-3 * time.Hour)}}, nil),
+	)
+	historyRepo.EXPECT().MarkMedicationHistoryMissed(lastID).Times(1).Return(false, nil)
+
+	missed, err := escalationService.EscalateUnconfirmedDoses()
+	require.NoError(t, err)
+	require.Equal(t, 0, missed)
+}
+
+func Test_DoseEscalationBySMS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	historyRepo := mocks.NewMockMedicationHistoryRepository(ctrl)
+	authRepo := mocks.NewMockAuthRepository(ctrl)
+	careRepo := mocks.NewMockCareRepository(ctrl)
+	pushNotifier := mocks.NewMockPushNotifier(ctrl)
+	smsSender := mocks.NewMockSMSSender(ctrl)
+	escalationService := NewEscalationService(historyRepo, authRepo, careRepo, pushNotifier, mocks.NewMockMailer(ctrl), smsSender, testConfig)
+
+	verifiedAt := time.Now()
+	user := &models.User{Model: models.Model{ID: 2}, Name: "Ada", PhoneNumber: "+2348163608141", PhoneVerifiedAt: &verifiedAt,
+		Preferences: models.UserPreferences{SMSNotifications: true}}
+	caregiver := models.User{Model: models.Model{ID: 5}, PhoneNumber: "+2348163608142", PhoneVerifiedAt: &verifiedAt,
+		Preferences: models.UserPreferences{SMSNotifications: true}}
+	nudged := models.MedicationHistory{Model: models.Model{ID: 1}, UserID: 2, MedicationName: "Paracetamol", MedicationTime: time.Now().Add(-20 * time.Minute)}
+	missed := models.MedicationHistory{Model: models.Model{ID: 2}, UserID: 2, MedicationName: "Paracetamol",
+		MedicationTime: time.Now().Add(-time.Duration(testConfig.MissedDoseGraceMinutes+1) * time.Minute)}
+
+	historyRepo.EXPECT().GetUnconfirmedMedicationHistories(gomock.Any(), uint(0), unconfirmedDoseBatchSize).Times(1).
+		Return([]models.MedicationHistory{nudged, missed}, nil)
+	// the user only turned on sms notifications
+	pushNotifier.EXPECT().GetSingleUserDeviceTokens(2).Times(0)
+	authRepo.EXPECT().FindUserByID(uint(2)).Times(2).Return(user, nil)
+	smsSender.EXPECT().SendSMS(user.PhoneNumber, gomock.Any()).Times(1).
+		DoAndReturn(func(phoneNumber, message string) error {
+			require.Contains(t, message, "Did you take your Paracetamol")
+			return nil
+		})
+	historyRepo.EXPECT().UpdateMedicationHistoryEscalation(gomock.Any()).Times(1).Return(nil)
+	historyRepo.EXPECT().MarkMedicationHistoryMissed(uint(2)).Times(1).Return(true, nil)
+	careRepo.EXPECT().GetMissedDoseCaregivers(uint(2)).Times(1).Return([]models.User{caregiver}, nil)
+	smsSender.EXPECT().SendSMS(caregiver.PhoneNumber, gomock.Any()).Times(1).
+		DoAndReturn(func(phoneNumber, message string) error {
+			require.Contains(t, message, "Ada missed a dose of Paracetamol")
+			return nil
+		})
+
+	missedDoses, err := escalationService.EscalateUnconfirmedDoses()
+	require.NoError(t, err)
+	require.Equal(t, 1, missedDoses)
+}
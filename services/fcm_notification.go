@@ -1,176 +1,254 @@
 package services
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"sync"
 	"time"
 
-	firebase "firebase.google.com/go"
-	"firebase.google.com/go/messaging"
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
-	"github.com/decagonhq/meddle-api/errors"
+	apiError "github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
-	"github.com/go-co-op/gocron"
-	"google.golang.org/api/option"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"gorm.io/gorm"
 )
 
 //go:generate mockgen -destination=../mocks/auth_mock.go -package=mocks github.com/decagonhq/meddle-api/services PushNotification
 
 type PushNotifier interface {
-	AuthorizeNotification(request *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, *errors.Error)
-	CheckIfThereIsNextMedication()
-	SendPushNotification(registrationTokens []string, payload *models.PushPayload) (*messaging.Message, *errors.Error)
-	NotificationsCronJob()
-	GetSingleUserDeviceTokens(userId int) ([]string, *errors.Error)
+	AuthorizeNotification(request *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, *apiError.Error)
+	CheckIfThereIsNextMedication() (int, error)
+	SendPushNotification(registrationTokens []string, payload *models.PushPayload) ([]models.PushDelivery, *apiError.Error)
+	GetSingleUserDeviceTokens(userId int) ([]string, *apiError.Error)
+	GetUserDevices(userID uint) ([]models.DeviceResponse, *apiError.Error)
+	RevokeUserDevice(userID uint, deviceID uint) *apiError.Error
 }
 
 type notificationService struct {
 	Conf             *config.Config
 	notificationRepo db.NotificationRepository
-	Client           *messaging.Client
+	authRepo         db.AuthRepository
+	transport        PushTransport
+	sms              SMSSender
 }
 
-// NewFirebaseCloudMessaging instantiates an FCM service
-func NewFirebaseCloudMessaging(notificationRepo db.NotificationRepository, conf *config.Config) (PushNotifier, error) {
-	firebaseApp, err := firebase.NewApp(context.Background(), nil, option.WithCredentialsFile(conf.GoogleApplicationCredentials))
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-
-	var fcm notificationService
-
-	fcm.Client, err = firebaseApp.Messaging(context.Background())
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-
+// NewPushNotifier instantiates a notification service sending through the given transport,
+// dose reminders are also texted to the users who asked for it
+func NewPushNotifier(notificationRepo db.NotificationRepository, authRepo db.AuthRepository, conf *config.Config, transport PushTransport, sms SMSSender) PushNotifier {
 	return &notificationService{
 		notificationRepo: notificationRepo,
+		authRepo:         authRepo,
 		Conf:             conf,
-		Client:           fcm.Client,
-	}, nil
+		transport:        transport,
+		sms:              sms,
+	}
 }
 
-func (fcm *notificationService) AuthorizeNotification(request *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, *errors.Error) {
+func (fcm *notificationService) AuthorizeNotification(request *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, *apiError.Error) {
 	token, err := fcm.notificationRepo.AddNotificationToken(request)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		return nil, apiError.ErrInternalServerError
 	}
 	return token, nil
 }
 
-func (fcm *notificationService) GetSingleUserDeviceTokens(userid int) ([]string, *errors.Error) {
+func (fcm *notificationService) GetSingleUserDeviceTokens(userid int) ([]string, *apiError.Error) {
 	tokens, err := fcm.notificationRepo.GetSingleUserDeviceTokens(userid)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		return nil, apiError.ErrInternalServerError
 	}
 	return tokens, nil
 }
 
-// CheckIfThereIsNextMedication cron job
-// check all currently due medication in db
-func (fcm *notificationService) CheckIfThereIsNextMedication() {
-	medicationNotifications, err := fcm.notificationRepo.GetAllNextMedicationsToSendNotifications()
+func (fcm *notificationService) GetUserDevices(userID uint) ([]models.DeviceResponse, *apiError.Error) {
+	devices, err := fcm.notificationRepo.GetUserDevices(userID)
 	if err != nil {
-		log.Println("could not get medications from db", err)
-		return
+		return nil, apiError.ErrInternalServerError
 	}
 
-	//check db for all the time of notifications
-	for _, medicationNotification := range medicationNotifications {
-		go func(m models.Medication) {
-			userId := m.UserID
-			deviceTokens, err := fcm.notificationRepo.GetSingleUserDeviceTokens(int(userId))
-			if err != nil {
-				log.Printf("error retrieving device notification tokens: %v\n", err)
-				return
-			}
+	deviceResponses := make([]models.DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		deviceResponses = append(deviceResponses, *device.ToDeviceResponse())
+	}
+	return deviceResponses, nil
+}
 
-			if len(deviceTokens) == 0 {
-				log.Printf("empty token list: %v\n", err)
-				return
-			}
-			nextDosageTime := m.NextDosageTime.Add(time.Hour).Format(time.Kitchen)
-			notification, err := fcm.SendPushNotification(deviceTokens, &models.PushPayload{
-				Body:  fmt.Sprintf("%s is due by %v", m.Name, nextDosageTime),
-				Title: fmt.Sprintf("Time to take %s", m.Name),
-				Data: map[string]string{
-					"medication_id": fmt.Sprintf("%v", m.ID),
-				},
-				Category: models.NextMedicationCategory,
-				// ClickAction: "/user/medication/id?=" + strconv.Itoa(int((m.ID)),
-			})
-			if err != nil {
-				log.Println("error sending notification", err)
-				return
-			}
+func (fcm *notificationService) RevokeUserDevice(userID uint, deviceID uint) *apiError.Error {
+	err := fcm.notificationRepo.DeleteUserDevice(userID, deviceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("device not found", http.StatusNotFound)
+		}
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// doseReminderWorkers is how many dose reminders are sent at the same time
+const doseReminderWorkers = 10
 
-			log.Println("logging notifications", notification)
-		}(medicationNotification)
+// CheckIfThereIsNextMedication cron job
+// sends a reminder for every due dose occurrence that has not been notified yet,
+// including the ones that fell due while the job was not running.
+// Reminders that reached the user nowhere are released once the run is over, so that the next run tries them again.
+// It returns the number of reminders sent, and fails when any of them could not be sent.
+func (fcm *notificationService) CheckIfThereIsNextMedication() (int, error) {
+	sent, failed := 0, 0
+	var unsent []uint
+	for {
+		occurrences, err := fcm.notificationRepo.ClaimDueDoseNotifications(time.Now(), doseOccurrenceBatchSize)
+		if err != nil {
+			fcm.releaseDoseReminders(unsent)
+			return sent, fmt.Errorf("could not get medications from db: %v", err)
+		}
+
+		batchSent, batchFailed, batchUnsent := fcm.sendDoseReminders(occurrences)
+		sent += batchSent
+		failed += batchFailed
+		unsent = append(unsent, batchUnsent...)
+
+		if len(occurrences) < doseOccurrenceBatchSize {
+			break
+		}
+	}
+	// released only now, otherwise the run would claim them again straight away
+	fcm.releaseDoseReminders(unsent)
+	if failed > 0 {
+		return sent, fmt.Errorf("%d dose reminders could not be sent", failed)
 	}
+	return sent, nil
 }
 
-func (fcm *notificationService) SendPushNotification(registrationTokens []string, payload *models.PushPayload) (*messaging.Message, *errors.Error) {
-	message := &messaging.Message{
-		APNS: &messaging.APNSConfig{
-			Headers: map[string]string{
-				"apns-priority": "10",
-			},
-			Payload: &messaging.APNSPayload{
-				Aps: &messaging.Aps{
-					Category: string(payload.Category),
-					Alert: &messaging.ApsAlert{
-						Title: payload.Title,
-						Body:  payload.Body,
-					},
-					Sound:            "default",
-					ContentAvailable: true,
-				},
-			},
-			FCMOptions: nil,
-		},
-		Data: payload.Data,
-		Notification: &messaging.Notification{
-			Title:    payload.Title,
-			Body:     payload.Body,
-			ImageURL: "https://imgur.com/a/hmt6Mx2",
-		},
+func (fcm *notificationService) releaseDoseReminders(occurrenceIDs []uint) {
+	if len(occurrenceIDs) == 0 {
+		return
+	}
+	if err := fcm.notificationRepo.ReleaseDoseNotifications(occurrenceIDs); err != nil {
+		log.Printf("error releasing %d unsent dose reminders: %v\n", len(occurrenceIDs), err)
+	}
+}
 
-		Token: registrationTokens[0],
+// sendDoseReminders sends the reminders of the occurrences, doseReminderWorkers at a time, and returns
+// once all of them are done with how many were sent, how many failed and the occurrences whose reminder reached the user nowhere
+func (fcm *notificationService) sendDoseReminders(occurrences []models.DoseOccurrence) (int, int, []uint) {
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		sent, failed int
+		unsent       []uint
+		queue        = make(chan models.DoseOccurrence)
+	)
+	for w := 0; w < doseReminderWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for occurrence := range queue {
+				ok, err := fcm.sendDoseReminder(occurrence)
+				if err != nil {
+					log.Printf("error sending reminder of dose occurrence %v: %v\n", occurrence.ID, err)
+				}
+				mu.Lock()
+				if err != nil {
+					failed++
+					// a reminder that got through one way is not sent again
+					if !ok {
+						unsent = append(unsent, occurrence.ID)
+					}
+				} else if ok {
+					sent++
+				}
+				mu.Unlock()
+			}
+		}()
 	}
-	for _, t := range registrationTokens {
-		log.Printf("tokens: %v", t)
+	for _, occurrence := range occurrences {
+		queue <- occurrence
 	}
-	res, err := fcm.Client.Send(context.Background(), message)
+	close(queue)
+	wg.Wait()
+	return sent, failed, unsent
+}
+
+// sendDoseReminder pushes the reminder of the occurrence to the devices of its user, and texts it to them when they turned on sms notifications.
+// It returns false without an error when the user turned both off or has nowhere to be reminded.
+func (fcm *notificationService) sendDoseReminder(occurrence models.DoseOccurrence) (bool, error) {
+	user, err := fcm.authRepo.FindUserByID(occurrence.UserID)
 	if err != nil {
-		log.Printf("error sending message: %v\n", err)
-		return nil, errors.ErrInternalServerError
+		return false, fmt.Errorf("error finding user %v: %v", occurrence.UserID, err)
 	}
 
-	log.Printf("result from message 2: %v\n", res)
-	// d, err := fcm.Client.SendMulticast(context.Background(), notification)
-	// if err != nil {
-	// 	return &messaging.MulticastMessage{}, errors.ErrInternalServerError
-	// }
-
-	// log.Printf("failure: %v, success: %v", d.FailureCount, d.SuccessCount)
-	// for _, v := range d.Responses {
-	// 	log.Printf("res: %+v", v)
-	// }
-	return message, nil
+	pushed, err := fcm.pushDoseReminder(user, occurrence)
+	if !user.CanReceiveSMS(fcm.Conf.RequireVerifiedPhoneForSMS) {
+		return pushed, err
+	}
+	// the text is sent even when the push failed, the failure is still reported
+	m := occurrence.Medication
+	title := models.ForDependent(m.Dependent, fmt.Sprintf("Time to take %s", m.Name))
+	body := fmt.Sprintf("%s is due by %v", m.Name, occurrence.ScheduledAt.In(m.Location()).Format(time.Kitchen))
+	if smsErr := fcm.sms.SendSMS(user.PhoneNumber, title+". "+body); smsErr != nil {
+		return pushed, fmt.Errorf("error sending dose reminder sms: %v", smsErr)
+	}
+	return true, err
 }
 
-func (fcm *notificationService) NotificationsCronJob() {
-	// _, presentMinute, presentSecond := time.Now().UTC().Clock()
-	// waitTime := time.Duration(60-presentMinute)*time.Minute + time.Duration(60-presentSecond)*time.Second
-	scheduler := gocron.NewScheduler(time.UTC)
-	// time.Sleep(waitTime)
-	scheduler.Every(1).Minute().Do(func() {
-		fcm.CheckIfThereIsNextMedication()
+// pushDoseReminder pushes the reminder of the occurrence to the devices of the user,
+// it returns false without an error when the user turned push notifications off or has no device to remind
+func (fcm *notificationService) pushDoseReminder(user *models.User, occurrence models.DoseOccurrence) (bool, error) {
+	m := occurrence.Medication
+	if !user.Preferences.PushNotifications {
+		return false, nil
+	}
+
+	deviceTokens, err := fcm.notificationRepo.GetSingleUserDeviceTokens(int(occurrence.UserID))
+	if err != nil {
+		return false, fmt.Errorf("error retrieving device notification tokens: %v", err)
+	}
+	if len(deviceTokens) == 0 {
+		return false, nil
+	}
+
+	actionToken, err := jwt.GenerateDoseActionToken(occurrence.UserID, occurrence.ID, fcm.Conf.JWTSecret)
+	if err != nil {
+		return false, fmt.Errorf("error generating dose action token: %v", err)
+	}
+	dosageTime := occurrence.ScheduledAt.In(m.Location()).Format(time.Kitchen)
+	_, sendErr := fcm.SendPushNotification(deviceTokens, &models.PushPayload{
+		Body:  fmt.Sprintf("%s is due by %v", m.Name, dosageTime),
+		Title: models.ForDependent(m.Dependent, fmt.Sprintf("Time to take %s", m.Name)),
+		Data: map[string]string{
+			"medication_id":      fmt.Sprintf("%v", occurrence.MedicationID),
+			"dose_occurrence_id": fmt.Sprintf("%v", occurrence.ID),
+			"action_token":       actionToken,
+		},
+		Category: models.NextMedicationCategory,
+		// ClickAction: "/user/medication/id?=" + strconv.Itoa(int((m.ID)),
 	})
-	scheduler.StartBlocking()
+	if sendErr != nil {
+		return false, sendErr
+	}
+	return true, nil
+}
+
+// SendPushNotification sends the payload to every given device, see deliverPushNotification.
+// It fails when the notification could not be delivered to any of the devices.
+func (fcm *notificationService) SendPushNotification(registrationTokens []string, payload *models.PushPayload) ([]models.PushDelivery, *apiError.Error) {
+	if len(registrationTokens) == 0 {
+		return nil, apiError.New("no device to send the notification to", http.StatusBadRequest)
+	}
+
+	deliveries := fcm.deliverPushNotification(registrationTokens, payload)
+	delivered := 0
+	for _, delivery := range deliveries {
+		if delivery.Status == models.PushDelivered {
+			delivered++
+		}
+	}
+	log.Printf("notification sent to %d of %d devices", delivered, len(registrationTokens))
+	if delivered == 0 {
+		return deliveries, apiError.New("notification could not be delivered", http.StatusBadGateway)
+	}
+	return deliveries, nil
 }
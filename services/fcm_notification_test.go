@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_RevokeUserDevice(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dbError     error
+		expectedErr *errors.Error
+	}{
+		{
+			name: "revoke device successful case",
+		},
+		{
+			name:        "device not found case",
+			dbError:     gorm.ErrRecordNotFound,
+			expectedErr: errors.New("device not found", http.StatusNotFound),
+		},
+		{
+			name:        "internal server error case",
+			dbError:     fmt.Errorf("could not delete device: %v", gorm.ErrInvalidDB),
+			expectedErr: errors.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			notificationRepo := mocks.NewMockNotificationRepository(ctrl)
+			pushNotifier := &notificationService{Conf: testConfig, notificationRepo: notificationRepo}
+
+			notificationRepo.EXPECT().DeleteUserDevice(uint(1), uint(2)).Times(1).Return(tc.dbError)
+
+			err := pushNotifier.RevokeUserDevice(1, 2)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_CheckIfThereIsNextMedication(t *testing.T) {
+	pushRetryBackoff = 0
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	notificationRepo := mocks.NewMockNotificationRepository(ctrl)
+	authRepo := mocks.NewMockAuthRepository(ctrl)
+	smsSender := mocks.NewMockSMSSender(ctrl)
+	transport := NewFakeTransport("")
+	pushNotifier := &notificationService{Conf: testConfig, notificationRepo: notificationRepo, authRepo: authRepo, transport: transport, sms: smsSender}
+
+	occurrence := func(id, userID uint) models.DoseOccurrence {
+		return models.DoseOccurrence{Model: models.Model{ID: id}, MedicationID: 3, UserID: userID,
+			ScheduledAt: time.Now(), Medication: models.Medication{Name: "paracetamol"}}
+	}
+	notificationRepo.EXPECT().ClaimDueDoseNotifications(gomock.Any(), doseOccurrenceBatchSize).Times(1).
+		Return([]models.DoseOccurrence{occurrence(1, 1), occurrence(2, 2), occurrence(3, 3), occurrence(4, 4)}, nil)
+	for id := uint(1); id <= 2; id++ {
+		authRepo.EXPECT().FindUserByID(id).Times(1).
+			Return(&models.User{Model: models.Model{ID: id}, Preferences: models.UserPreferences{PushNotifications: true}}, nil)
+	}
+	// the third user has no device, but gets their reminders by text
+	verifiedAt := time.Now()
+	authRepo.EXPECT().FindUserByID(uint(3)).Times(1).Return(&models.User{Model: models.Model{ID: 3}, PhoneNumber: "+2348163608141", PhoneVerifiedAt: &verifiedAt,
+		Preferences: models.UserPreferences{PushNotifications: true, SMSNotifications: true}}, nil)
+	smsSender.EXPECT().SendSMS("+2348163608141", gomock.Any()).Times(1).
+		DoAndReturn(func(phoneNumber, message string) error {
+			require.Contains(t, message, "Time to take paracetamol")
+			return nil
+		})
+	// the fourth user turned push notifications off
+	authRepo.EXPECT().FindUserByID(uint(4)).Times(1).Return(&models.User{Model: models.Model{ID: 4}}, nil)
+	notificationRepo.EXPECT().GetSingleUserDeviceTokens(4).Times(0)
+	notificationRepo.EXPECT().GetSingleUserDeviceTokens(1).Times(1).Return([]string{"phone"}, nil)
+	notificationRepo.EXPECT().GetSingleUserDeviceTokens(2).Times(1).Return([]string{"invalid-old-phone"}, nil)
+	notificationRepo.EXPECT().GetSingleUserDeviceTokens(3).Times(1).Return([]string{}, nil)
+	notificationRepo.EXPECT().CreatePushDeliveries(gomock.Any()).Times(2).Return(nil)
+	notificationRepo.EXPECT().DeleteDeviceTokens([]string{"invalid-old-phone"}).Times(1).Return(nil)
+	// the reminder of the second user reached them nowhere, so the next run sends it again
+	notificationRepo.EXPECT().ReleaseDoseNotifications([]uint{2}).Times(1).Return(nil)
+
+	sent, err := pushNotifier.CheckIfThereIsNextMedication()
+	require.EqualError(t, err, "1 dose reminders could not be sent")
+	require.Equal(t, 2, sent)
+	require.Len(t, transport.Sent(), 1)
+}
@@ -14,7 +14,7 @@ func (a *authService) SendEmailForPasswordReset(user *models.ForgotPassword) *ap
 	if err != nil {
 		return apiError.New("email does not exist", http.StatusBadRequest)
 	}
-	token, err := jwt.GenerateToken(foundUser.Email, a.Config.JWTSecret)
+	token, err := jwt.GeneratePurposeToken(jwt.ResetPasswordTokenType, foundUser.Email, a.Config.JWTSecret)
 	if err != nil {
 		return apiError.New("", http.StatusInternalServerError)
 	}
@@ -46,24 +46,12 @@ func (a *authService) ResetPassword(reset *models.ResetPassword, token string) *
 	if err != nil {
 		return apiError.New("", http.StatusInternalServerError)
 	}
-	err = a.authRepo.IsTokenInBlacklist(token)
-	if err != nil {
-		return apiError.New("expired link", http.StatusUnauthorized)
-	}
-	claims, err := jwt.ValidateAndGetClaims(token, a.Config.JWTSecret)
-	if err != nil {
-		return apiError.New("invalid link", http.StatusUnauthorized)
-	}
-	email := claims["email"].(string)
-	errr := a.authRepo.UpdatePassword(user.HashedPassword, email)
+	email, errr := a.consumeLinkToken(token, jwt.ResetPasswordTokenType)
 	if errr != nil {
-		return apiError.New("", http.StatusInternalServerError)
-	}
-	accBlacklist := &models.BlackList{
-		Email: email,
-		Token: token,
+		return errr
 	}
-	if err := a.authRepo.AddToBlackList(accBlacklist); err != nil {
+	err = a.authRepo.UpdatePassword(user.HashedPassword, email)
+	if err != nil {
 		return apiError.New("", http.StatusInternalServerError)
 	}
 	return nil
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/inventory_mock.go -package=mocks github.com/decagonhq/meddle-api/services InventoryService
+
+type InventoryService interface {
+	RefillMedication(medicationID uint, userID uint, request *models.RefillRequest) (*models.MedicationResponse, *apiError.Error)
+	SendRefillReminders() (int, error)
+}
+
+type inventoryService struct {
+	Config         *config.Config
+	medicationRepo db.MedicationRepository
+	authRepo       db.AuthRepository
+	pushNotifier   PushNotifier
+	mail           Mailer
+	sms            SMSSender
+}
+
+// NewInventoryService instantiates an InventoryService
+func NewInventoryService(medicationRepo db.MedicationRepository, authRepo db.AuthRepository, pushNotifier PushNotifier, mail Mailer, sms SMSSender, conf *config.Config) InventoryService {
+	return &inventoryService{
+		Config:         conf,
+		medicationRepo: medicationRepo,
+		authRepo:       authRepo,
+		pushNotifier:   pushNotifier,
+		mail:           mail,
+		sms:            sms,
+	}
+}
+
+// RefillMedication adds the refilled quantity to the stock of the medication
+func (i *inventoryService) RefillMedication(medicationID uint, userID uint, request *models.RefillRequest) (*models.MedicationResponse, *apiError.Error) {
+	medication, err := i.medicationRepo.RefillMedication(medicationID, userID, request.Quantity)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errMedicationNotFound
+		}
+		log.Printf("error refilling medication %v: %v", medicationID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return medication.MedicationToResponse(), nil
+}
+
+// SendRefillReminders cron job
+// reminds users to refill the medications that will run out within their refill threshold,
+// once per refill. It returns the number of reminders sent.
+func (i *inventoryService) SendRefillReminders() (int, error) {
+	medications, err := i.medicationRepo.GetMedicationsToRemindRefill()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	reminded := 0
+	for j := range medications {
+		medication := &medications[j]
+		runOutAt, runsOut := ProjectedRunOutTime(medication, now, now.Add(medication.RefillThreshold()))
+		if !runsOut {
+			continue
+		}
+		i.sendRefillReminder(medication, runOutAt)
+		err = i.medicationRepo.SetRefillReminded(medication.ID, now)
+		if err != nil {
+			return reminded, err
+		}
+		reminded++
+	}
+	return reminded, nil
+}
+
+// ProjectedRunOutTime returns the first dose due up to until that the stock of the medication does not cover.
+// The second return value is false when the stock lasts until then, or when its inventory is not tracked.
+func ProjectedRunOutTime(medication *models.Medication, now time.Time, until time.Time) (time.Time, bool) {
+	if !medication.TracksInventory() {
+		return time.Time{}, false
+	}
+	stock := *medication.PillCount
+	if stock < medication.DoseUnits() {
+		return now, true
+	}
+
+	dosageTime, ok := medication.NextDosageTime, !medication.NextDosageTime.IsZero()
+	for ok && dosageTime.Before(now) {
+		dosageTime, ok = NextDosageTime(medication, dosageTime)
+	}
+	for ok && !dosageTime.After(until) {
+		if stock < medication.DoseUnits() {
+			return dosageTime, true
+		}
+		stock -= medication.DoseUnits()
+		dosageTime, ok = NextDosageTime(medication, dosageTime)
+	}
+	return time.Time{}, false
+}
+
+func (i *inventoryService) sendRefillReminder(medication *models.Medication, runOutAt time.Time) {
+	user, err := i.authRepo.FindUserByID(medication.UserID)
+	if err != nil {
+		log.Printf("error finding user %v: %v\n", medication.UserID, err)
+		return
+	}
+
+	runOutDate := runOutAt.In(medication.Location()).Format("Monday, January 2")
+	title := models.ForDependent(medication.Dependent, fmt.Sprintf("Time to refill %s", medication.Name))
+	body := fmt.Sprintf("You have %d left of %s, which will run out by %s.", *medication.PillCount, medication.Name, runOutDate)
+
+	if user.Preferences.PushNotifications {
+		deviceTokens, tokensErr := i.pushNotifier.GetSingleUserDeviceTokens(int(medication.UserID))
+		if tokensErr != nil {
+			log.Printf("error retrieving device notification tokens: %v\n", tokensErr)
+		} else if len(deviceTokens) > 0 {
+			_, sendErr := i.pushNotifier.SendPushNotification(deviceTokens, &models.PushPayload{
+				Title: title,
+				Body:  body,
+				Data: map[string]string{
+					"medication_id": fmt.Sprintf("%v", medication.ID),
+				},
+				Category: models.RefillReminderCategory,
+			})
+			if sendErr != nil {
+				log.Println("error sending refill reminder", sendErr)
+			}
+		}
+	}
+
+	if user.Preferences.EmailNotifications {
+		value := map[string]interface{}{
+			"name":            user.Name,
+			"medication_name": medication.Name,
+			"pill_count":      *medication.PillCount,
+			"run_out_date":    runOutDate,
+		}
+		err = i.mail.SendMail(user.Email, title, body, "refillreminder", value)
+		if err != nil {
+			log.Printf("error sending refill reminder email: %v\n", err)
+		}
+	}
+
+	if user.CanReceiveSMS(i.Config.RequireVerifiedPhoneForSMS) {
+		if err := i.sms.SendSMS(user.PhoneNumber, title+". "+body); err != nil {
+			log.Printf("error sending refill reminder sms: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_ProjectedRunOutTime(t *testing.T) {
+	now := time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+	pillCount := func(n int) *int {
+		return &n
+	}
+	// two doses a day, at 8:00 and 20:00
+	newMedication := func(stock *int, unitsPerDose int) *models.Medication {
+		return &models.Medication{
+			MedicationStartTime: now.AddDate(0, 0, -1),
+			MedicationStopDate:  now.AddDate(0, 1, 0),
+			NextDosageTime:      time.Date(2022, 8, 1, 20, 0, 0, 0, time.UTC),
+			Schedule:            models.MedicationSchedule{Type: models.TimesOfDaySchedule, TimesOfDay: []string{"08:00", "20:00"}},
+			PillCount:           stock,
+			UnitsPerDose:        unitsPerDose,
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		medication       *models.Medication
+		expectedRunsOut  bool
+		expectedRunOutAt time.Time
+	}{
+		{
+			name:       "inventory not tracked case",
+			medication: newMedication(nil, 1),
+		},
+		{
+			name:       "stock lasting past the threshold case",
+			medication: newMedication(pillCount(20), 1),
+		},
+		{
+			name:             "stock running out within the threshold case",
+			medication:       newMedication(pillCount(5), 1),
+			expectedRunsOut:  true,
+			expectedRunOutAt: time.Date(2022, 8, 4, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:             "several units per dose case",
+			medication:       newMedication(pillCount(5), 2),
+			expectedRunsOut:  true,
+			expectedRunOutAt: time.Date(2022, 8, 2, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			name:             "out of stock case",
+			medication:       newMedication(pillCount(0), 1),
+			expectedRunsOut:  true,
+			expectedRunOutAt: now,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			runOutAt, runsOut := ProjectedRunOutTime(tc.medication, now, now.AddDate(0, 0, 7))
+			require.Equal(t, tc.expectedRunsOut, runsOut)
+			require.True(t, tc.expectedRunOutAt.Equal(runOutAt), "got %v", runOutAt)
+		})
+	}
+}
+
+func Test_SendRefillReminders(t *testing.T) {
+	stock := 1
+	phoneVerifiedAt := time.Now()
+	user := &models.User{
+		Name:            "Ada",
+		Email:           "ada@example.com",
+		PhoneNumber:     "+2348163608141",
+		PhoneVerifiedAt: &phoneVerifiedAt,
+		Preferences:     models.UserPreferences{PushNotifications: true, EmailNotifications: true, SMSNotifications: true},
+	}
+	runningOut := models.Medication{
+		Model:               models.Model{ID: 2},
+		UserID:              1,
+		Name:                "Paracetamol",
+		TimeInterval:        8,
+		MedicationStartTime: time.Now().Add(-time.Hour),
+		MedicationStopDate:  time.Now().AddDate(0, 1, 0),
+		NextDosageTime:      time.Now().Add(time.Hour),
+		PillCount:           &stock,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	medicationRepo := mocks.NewMockMedicationRepository(ctrl)
+	authRepo := mocks.NewMockAuthRepository(ctrl)
+	pushNotifier := mocks.NewMockPushNotifier(ctrl)
+	mailer := mocks.NewMockMailer(ctrl)
+	smsSender := mocks.NewMockSMSSender(ctrl)
+	service := NewInventoryService(medicationRepo, authRepo, pushNotifier, mailer, smsSender, testConfig)
+
+	untracked := runningOut
+	untracked.ID = 3
+	untracked.PillCount = nil
+	medicationRepo.EXPECT().GetMedicationsToRemindRefill().Times(1).Return([]models.Medication{runningOut, untracked}, nil)
+	authRepo.EXPECT().FindUserByID(uint(1)).Times(1).Return(user, nil)
+	pushNotifier.EXPECT().GetSingleUserDeviceTokens(1).Times(1).Return([]string{"token"}, nil)
+	pushNotifier.EXPECT().SendPushNotification([]string{"token"}, gomock.Any()).Times(1).Return(nil, nil)
+	mailer.EXPECT().SendMail(user.Email, gomock.Any(), gomock.Any(), "refillreminder", gomock.Any()).Times(1).Return(nil)
+	smsSender.EXPECT().SendSMS(user.PhoneNumber, gomock.Any()).Times(1).Return(nil)
+	medicationRepo.EXPECT().SetRefillReminded(uint(2), gomock.Any()).Times(1).Return(nil)
+
+	reminded, err := service.SendRefillReminders()
+	require.NoError(t, err)
+	require.Equal(t, 1, reminded)
+}
+
+func Test_RefillMedication(t *testing.T) {
+	stock := 30
+	testCases := []struct {
+		name        string
+		dbOutput    *models.Medication
+		dbError     error
+		expectedErr *errors.Error
+	}{
+		{
+			name:     "refill successful case",
+			dbOutput: &models.Medication{Model: models.Model{ID: 2}, PillCount: &stock},
+		},
+		{
+			name:        "medication not found case",
+			dbError:     fmt.Errorf("could not refill medication: %w", gorm.ErrRecordNotFound),
+			expectedErr: errMedicationNotFound,
+		},
+		{
+			name:        "internal server error case",
+			dbError:     gorm.ErrInvalidDB,
+			expectedErr: errors.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			medicationRepo := mocks.NewMockMedicationRepository(ctrl)
+			service := NewInventoryService(medicationRepo, mocks.NewMockAuthRepository(ctrl), mocks.NewMockPushNotifier(ctrl), mocks.NewMockMailer(ctrl), mocks.NewMockSMSSender(ctrl), testConfig)
+
+			medicationRepo.EXPECT().RefillMedication(uint(2), uint(1), 30).Times(1).Return(tc.dbOutput, tc.dbError)
+			medication, err := service.RefillMedication(2, 1, &models.RefillRequest{Quantity: 30})
+			require.Equal(t, tc.expectedErr, err)
+			if err == nil {
+				require.Equal(t, 30, *medication.PillCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/go-co-op/gocron"
+)
+
+// Job is a background task run periodically by the JobRunner.
+// Run returns the number of items it processed.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func() (int, error)
+}
+
+// Jobs returns the background jobs of the application
+func Jobs(medicationService MedicationService, pushNotifier PushNotifier, escalationService EscalationService, inventoryService InventoryService, securityService SecurityService, sessionService SessionService, phoneVerificationService PhoneVerificationService) []Job {
+	return []Job{
+		{Name: "record_due_doses", Interval: time.Minute, Run: medicationService.CronUpdateMedicationForNextTime},
+		{Name: "send_dose_reminders", Interval: time.Minute, Run: pushNotifier.CheckIfThereIsNextMedication},
+		{Name: "escalate_unconfirmed_doses", Interval: time.Minute, Run: escalationService.EscalateUnconfirmedDoses},
+		{Name: "send_refill_reminders", Interval: time.Hour, Run: inventoryService.SendRefillReminders},
+		{Name: "purge_rate_limits", Interval: time.Hour, Run: securityService.PurgeRateLimits},
+		{Name: "purge_revoked_tokens", Interval: time.Hour, Run: sessionService.PurgeRevokedTokens},
+		{Name: "purge_phone_verifications", Interval: time.Hour, Run: phoneVerificationService.PurgeExpiredVerifications},
+	}
+}
+
+type JobRunner interface {
+	RunJob(job Job) error
+	Start(jobs ...Job)
+	StartBlocking(jobs ...Job)
+}
+
+type jobRunner struct {
+	jobRepo db.JobRepository
+	worker  string
+}
+
+// NewJobRunner instantiates a JobRunner. Every process may run the jobs, a job lock makes sure
+// that a given job only runs on one of them at a time.
+func NewJobRunner(jobRepo db.JobRepository) JobRunner {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &jobRunner{
+		jobRepo: jobRepo,
+		worker:  fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}
+}
+
+// RunJob runs the job once if no other process is running it, and records the run
+func (r *jobRunner) RunJob(job Job) error {
+	_, err := r.jobRepo.WithJobLock(job.Name, func() error {
+		run := &models.JobRun{
+			JobName:   job.Name,
+			Worker:    r.worker,
+			StartedAt: time.Now(),
+		}
+		err := r.jobRepo.CreateJobRun(run)
+		if err != nil {
+			return err
+		}
+
+		processed, jobErr := job.Run()
+		finishedAt := time.Now()
+		run.FinishedAt = &finishedAt
+		run.ProcessedCount = processed
+		if jobErr != nil {
+			run.Error = jobErr.Error()
+		}
+		err = r.jobRepo.FinishJobRun(run)
+		if err != nil {
+			return err
+		}
+		return jobErr
+	})
+	return err
+}
+
+// Start runs the jobs in the background
+func (r *jobRunner) Start(jobs ...Job) {
+	r.scheduler(jobs).StartAsync()
+}
+
+// StartBlocking runs the jobs and blocks the current goroutine
+func (r *jobRunner) StartBlocking(jobs ...Job) {
+	r.scheduler(jobs).StartBlocking()
+}
+
+func (r *jobRunner) scheduler(jobs []Job) *gocron.Scheduler {
+	s := gocron.NewScheduler(time.UTC)
+	// a run that takes longer than its interval is not started again before it is done
+	s.SingletonModeAll()
+	for _, job := range jobs {
+		job := job
+		_, err := s.Every(job.Interval).Do(func() {
+			err := r.RunJob(job)
+			if err != nil {
+				log.Printf("%s job error: %v", job.Name, err)
+			}
+		})
+		if err != nil {
+			log.Printf("could not schedule %s job: %v", job.Name, err)
+		}
+	}
+	return s
+}
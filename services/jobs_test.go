@@ -0,0 +1,85 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RunJob(t *testing.T) {
+	jobError := fmt.Errorf("could not record due doses")
+
+	testCases := []struct {
+		name         string
+		lockAcquired bool
+		processed    int
+		jobError     error
+		expectedErr  error
+	}{
+		{
+			name:         "job run successful case",
+			lockAcquired: true,
+			processed:    3,
+		},
+		{
+			name:         "job run error case",
+			lockAcquired: true,
+			processed:    1,
+			jobError:     jobError,
+			expectedErr:  jobError,
+		},
+		{
+			name:         "job running elsewhere case",
+			lockAcquired: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			jobRepo := mocks.NewMockJobRepository(ctrl)
+			runner := NewJobRunner(jobRepo)
+
+			ran := false
+			job := Job{
+				Name:     "test_job",
+				Interval: time.Minute,
+				Run: func() (int, error) {
+					ran = true
+					return tc.processed, tc.jobError
+				},
+			}
+
+			jobRepo.EXPECT().WithJobLock(job.Name, gomock.Any()).Times(1).
+				DoAndReturn(func(jobName string, fn func() error) (bool, error) {
+					if !tc.lockAcquired {
+						return false, nil
+					}
+					return true, fn()
+				})
+			if tc.lockAcquired {
+				jobRepo.EXPECT().CreateJobRun(gomock.Any()).Times(1).Return(nil)
+				jobRepo.EXPECT().FinishJobRun(gomock.Any()).Times(1).
+					DoAndReturn(func(run *models.JobRun) error {
+						require.Equal(t, job.Name, run.JobName)
+						require.Equal(t, tc.processed, run.ProcessedCount)
+						require.NotNil(t, run.FinishedAt)
+						if tc.jobError != nil {
+							require.Equal(t, tc.jobError.Error(), run.Error)
+						}
+						return nil
+					})
+			}
+
+			err := runner.RunJob(job)
+			require.Equal(t, tc.expectedErr, err)
+			require.Equal(t, tc.lockAcquired, ran)
+		})
+	}
+}
@@ -1,8 +1,8 @@
 package jwt
 
 import (
+	"crypto/rand"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -10,8 +10,56 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-const AccessTokenValidity = time.Hour * 24
-const RefreshTokenValidity = time.Hour * 24
+const AccessTokenValidity = time.Minute * 15
+const RefreshTokenValidity = time.Hour * 24 * 30
+
+// TokenTypeClaim is the claim that tells access tokens apart from refresh tokens
+const TokenTypeClaim = "token_type"
+
+// SessionIDClaim is the claim holding the session access and refresh tokens were issued for
+const SessionIDClaim = "sid"
+
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+	// DoseActionTokenType tokens only allow acting on a single dose from its reminder
+	DoseActionTokenType = "dose_action"
+	// TwoFactorChallengeTokenType tokens are handed out after the password of a user with two-factor
+	// authentication, they only allow sending the second factor
+	TwoFactorChallengeTokenType = "two_factor_challenge"
+)
+
+// purpose token types, each of them only works for the link or callback it was generated for
+const (
+	VerifyEmailTokenType   = "verify_email"
+	ResetPasswordTokenType = "reset_password"
+	UnlockAccountTokenType = "unlock_account"
+	OAuthStateTokenType    = "oauth_state"
+)
+
+// PurposeTokenValidity is how long the tokens of every purpose can be used
+var PurposeTokenValidity = map[string]time.Duration{
+	VerifyEmailTokenType:   time.Hour * 24,
+	ResetPasswordTokenType: time.Minute * 30,
+	UnlockAccountTokenType: time.Hour,
+	OAuthStateTokenType:    time.Minute * 10,
+}
+
+// DoseActionTokenValidity is how long the actions of a reminder keep working
+const DoseActionTokenValidity = time.Hour * 24
+
+// TwoFactorChallengeTokenValidity is how long a user has to send their two-factor code after their password
+const TwoFactorChallengeTokenValidity = time.Minute * 5
+
+// TokenPair holds a freshly minted access token and the refresh token issued alongside it
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshTokenID   string
+	FamilyID         string
+	SessionID        uint
+	RefreshExpiresAt int64
+}
 
 // verifyAccessToken verifies a token
 func verifyToken(tokenString string, secret string) (*jwt.Token, error) {
@@ -34,7 +82,6 @@ func isAccessTokenEmpty(token string) bool {
 func ValidateToken(token string, secret string) (*jwt.Token, error) {
 	tk, err := verifyToken(token, secret)
 	if err != nil {
-		log.Println(err)                                 // TODO: remove
 		return nil, fmt.Errorf("invalid token: %v", err) // TODO: probably need to errors.NEw
 	}
 	if !tk.Valid {
@@ -66,14 +113,187 @@ func ValidateAndGetClaims(tokenString string, secret string) (jwt.MapClaims, err
 	return claims, nil
 }
 
-// GenerateToken generates only an access token
-func GenerateToken(email string, secret string) (string, error) {
+// GeneratePurposeToken generates the token of an emailed link or an oauth state. The jti makes every token
+// distinct, so that each of them can be consumed on its own.
+func GeneratePurposeToken(purpose, email string, secret string) (string, error) {
+	validity, ok := PurposeTokenValidity[purpose]
+	if !ok {
+		return "", fmt.Errorf("unknown token purpose %q", purpose)
+	}
+	tokenID, err := GenerateTokenID()
+	if err != nil {
+		return "", err
+	}
+	return signClaims(jwt.MapClaims{
+		"email":        email,
+		"jti":          tokenID,
+		TokenTypeClaim: purpose,
+		"iat":          time.Now().Unix(),
+		"exp":          time.Now().Add(validity).Unix(),
+	}, secret)
+}
+
+// ValidatePurposeToken returns the claims of a token generated for the purpose, tokens of any other purpose are rejected
+func ValidatePurposeToken(token, purpose string, secret string) (jwt.MapClaims, error) {
+	claims, err := ValidateAndGetClaims(token, secret)
+	if err != nil {
+		return nil, err
+	}
+	if tokenType, _ := claims[TokenTypeClaim].(string); tokenType != purpose {
+		return nil, fmt.Errorf("not a %s token", purpose)
+	}
+	if _, ok := claims["email"].(string); !ok {
+		return nil, fmt.Errorf("%s token has no email", purpose)
+	}
+	return claims, nil
+}
+
+// GenerateTokenPair generates a short-lived access token and a refresh token for the session.
+// An empty familyID starts a new refresh token family, which happens on every fresh login;
+// rotations pass the family of the refresh token being replaced.
+func GenerateTokenPair(email, familyID string, sessionID uint, secret string) (*TokenPair, error) {
+	var err error
+	if familyID == "" {
+		familyID, err = GenerateTokenID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	refreshTokenID, err := GenerateTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := signClaims(jwt.MapClaims{
+		"email":        email,
+		SessionIDClaim: sessionID,
+		TokenTypeClaim: AccessTokenType,
+		"exp":          time.Now().Add(AccessTokenValidity).Unix(),
+	}, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiresAt := time.Now().Add(RefreshTokenValidity).Unix()
+	refreshToken, err := signClaims(jwt.MapClaims{
+		"email":        email,
+		"jti":          refreshTokenID,
+		"family":       familyID,
+		SessionIDClaim: sessionID,
+		TokenTypeClaim: RefreshTokenType,
+		"exp":          refreshExpiresAt,
+	}, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshTokenID:   refreshTokenID,
+		FamilyID:         familyID,
+		SessionID:        sessionID,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// GenerateDoseActionToken generates the token sent along a dose reminder,
+// which lets the notification actions act on that dose without an access token
+func GenerateDoseActionToken(userID, doseOccurrenceID uint, secret string) (string, error) {
+	return signClaims(jwt.MapClaims{
+		"user_id":            userID,
+		"dose_occurrence_id": doseOccurrenceID,
+		TokenTypeClaim:       DoseActionTokenType,
+		"exp":                time.Now().Add(DoseActionTokenValidity).Unix(),
+	}, secret)
+}
+
+// ValidateDoseActionToken returns the user and dose occurrence a dose action token was generated for
+func ValidateDoseActionToken(token string, secret string) (uint, uint, error) {
+	claims, err := ValidateAndGetClaims(token, secret)
+	if err != nil {
+		return 0, 0, err
+	}
+	if tokenType, _ := claims[TokenTypeClaim].(string); tokenType != DoseActionTokenType {
+		return 0, 0, fmt.Errorf("not a dose action token")
+	}
+	// numeric claims are decoded as float64
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("dose action token has no user")
+	}
+	doseOccurrenceID, ok := claims["dose_occurrence_id"].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("dose action token has no dose")
+	}
+	return uint(userID), uint(doseOccurrenceID), nil
+}
+
+// GenerateTwoFactorChallengeToken generates the token that lets the user finish logging in with their second factor
+func GenerateTwoFactorChallengeToken(userID uint, secret string) (string, error) {
+	tokenID, err := GenerateTokenID()
+	if err != nil {
+		return "", err
+	}
+	return signClaims(jwt.MapClaims{
+		"user_id":      userID,
+		"jti":          tokenID,
+		TokenTypeClaim: TwoFactorChallengeTokenType,
+		"exp":          time.Now().Add(TwoFactorChallengeTokenValidity).Unix(),
+	}, secret)
+}
+
+// ValidateTwoFactorChallengeToken returns the user a two-factor challenge token was generated for
+func ValidateTwoFactorChallengeToken(token string, secret string) (uint, error) {
+	claims, err := ValidateAndGetClaims(token, secret)
+	if err != nil {
+		return 0, err
+	}
+	if tokenType, _ := claims[TokenTypeClaim].(string); tokenType != TwoFactorChallengeTokenType {
+		return 0, fmt.Errorf("not a two-factor challenge token")
+	}
+	// numeric claims are decoded as float64
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("two-factor challenge token has no user")
+	}
+	return uint(userID), nil
+}
+
+// GetExpiry returns the unix time the token of the claims expires at
+func GetExpiry(claims jwt.MapClaims) int64 {
+	// numeric claims are decoded as float64
+	exp, _ := claims["exp"].(float64)
+	return int64(exp)
+}
+
+// GetIssuedAt returns the unix time the token of the claims was generated at, older tokens have none
+func GetIssuedAt(claims jwt.MapClaims) int64 {
+	// numeric claims are decoded as float64
+	iat, _ := claims["iat"].(float64)
+	return int64(iat)
+}
+
+// GetSessionID returns the session the token was issued for, tokens issued before sessions existed have none
+func GetSessionID(claims jwt.MapClaims) uint {
+	// numeric claims are decoded as float64
+	sessionID, _ := claims[SessionIDClaim].(float64)
+	return uint(sessionID)
+}
+
+// GenerateTokenID returns a random hex string suitable for jti and family claims
+func GenerateTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+func signClaims(claims jwt.MapClaims, secret string) (string, error) {
 	if secret == "" {
 		return "", errors.New("", http.StatusInternalServerError)
 	}
-	// Generate claims
-	claims := GenerateClaims(email)
-
 	// Create a new token object, specifying signing method and the claims
 	// you would like it to contain.
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -85,11 +305,3 @@ func GenerateToken(email string, secret string) (string, error) {
 	}
 	return tokenString, nil
 }
-
-func GenerateClaims(email string) jwt.MapClaims {
-	accessClaims := jwt.MapClaims{
-		"email": email,
-		"exp":   time.Now().Add(AccessTokenValidity).Unix(),
-	}
-	return accessClaims
-}
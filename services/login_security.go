@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+)
+
+const (
+	// loginDelayAfter is how many wrong passwords in a row are forgiven before every further attempt is delayed
+	loginDelayAfter = 3
+	maxLoginDelay   = time.Minute
+	loginIPWindow   = time.Hour
+)
+
+// loginDelay is how long after its last wrong password an account has to wait before trying again.
+// The delay doubles with every wrong password past loginDelayAfter, up to maxLoginDelay.
+func loginDelay(failedLogins int) time.Duration {
+	if failedLogins < loginDelayAfter {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(failedLogins-loginDelayAfter))) * time.Second
+	if delay > maxLoginDelay || delay <= 0 {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// checkLoginAccount refuses logins to an account that is locked out, or that has to wait after its last wrong password
+func checkLoginAccount(user *models.User, now time.Time) *apiError.Error {
+	if user.IsLocked(now) {
+		return apiError.New("account locked after too many failed login attempts, check your email to unlock it", http.StatusLocked)
+	}
+	if user.LastFailedLoginAt == nil {
+		return nil
+	}
+	wait := user.LastFailedLoginAt.Add(loginDelay(user.FailedLoginCount)).Sub(now)
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		return apiError.New(fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds), http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// checkSignIn refuses tokens to an account that is disabled, locked out or has to reset its password.
+// Every way of signing in calls it once the user proved who they are.
+func checkSignIn(user *models.User, now time.Time) *apiError.Error {
+	if user.IsDisabled() {
+		return apiError.ErrAccountDisabled
+	}
+	if err := checkLoginAccount(user, now); err != nil {
+		return err
+	}
+	if user.PasswordResetRequired {
+		return apiError.New("password reset required, check your email for a reset link", http.StatusForbidden)
+	}
+	return nil
+}
+
+func loginIPKey(ip string) string {
+	return "login-failures:" + ip
+}
+
+// checkLoginIP refuses logins from an IP address that failed too many of them recently, whatever the accounts
+func (a *authService) checkLoginIP(ip string) *apiError.Error {
+	if ip == "" {
+		return nil
+	}
+	failures, err := a.securityRepo.CountRateLimitHits(loginIPKey(ip), loginIPWindow)
+	if err != nil {
+		// logins stay available when the counters are not
+		log.Printf("error counting failed logins of %s: %v", ip, err)
+		return nil
+	}
+	if failures >= int64(a.Config.LoginIPFailureLimit) {
+		return apiError.New("too many failed login attempts, try again later", http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+func (a *authService) recordFailedLoginIP(ip string) {
+	if ip == "" {
+		return
+	}
+	if _, err := a.securityRepo.HitRateLimit(loginIPKey(ip), loginIPWindow); err != nil {
+		log.Printf("error recording failed login of %s: %v", ip, err)
+	}
+}
+
+// recordFailedLogin counts a wrong password against the account and the IP address it came from,
+// and locks the account out once too many were entered in a row
+func (a *authService) recordFailedLogin(user *models.User, client models.ClientInfo) {
+	a.recordFailedLoginIP(client.IP)
+
+	now := time.Now()
+	failedLogins, err := a.securityRepo.RecordFailedLogin(user.ID, now)
+	if err != nil {
+		log.Printf("error recording failed login of user %v: %v", user.ID, err)
+		return
+	}
+	if failedLogins < a.Config.LoginLockoutThreshold {
+		return
+	}
+
+	lockedUntil := now.Add(time.Duration(a.Config.LoginLockoutMinutes) * time.Minute)
+	if err := a.securityRepo.LockUser(user.ID, lockedUntil); err != nil {
+		log.Printf("error locking user %v: %v", user.ID, err)
+		return
+	}
+	a.recordSecurityEvent(user, models.SecurityEventAccountLocked, client)
+	if err := a.sendUnlockEmail(user); err != nil {
+		// the lockout still ends by itself
+		log.Printf("error sending unlock email to user %v: %v", user.ID, err)
+	}
+}
+
+// clearFailedLogins forgets the wrong passwords entered before the right one
+func (a *authService) clearFailedLogins(user *models.User) {
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		if err := a.securityRepo.ResetFailedLogins(user.ID); err != nil {
+			log.Printf("error resetting failed logins of user %v: %v", user.ID, err)
+		}
+	}
+}
+
+// recordLogin clears the failed logins of the user and records the login, telling the user when it comes from a new device
+func (a *authService) recordLogin(user *models.User, client models.ClientInfo) {
+	a.clearFailedLogins(user)
+
+	eventType := models.SecurityEventLogin
+	knownDevice, err := a.securityRepo.HasLoggedInFrom(user.ID, client.UserAgent)
+	if err != nil {
+		log.Printf("error finding previous logins of user %v: %v", user.ID, err)
+		knownDevice = true
+	}
+	if !knownDevice {
+		eventType = models.SecurityEventNewDeviceLogin
+	}
+	a.recordSecurityEvent(user, eventType, client)
+
+	if !knownDevice {
+		subject := "New sign in to your Meddle account"
+		body := fmt.Sprintf("Your account was signed in to from a new device (%s, %s). If it was not you, reset your password.", client.UserAgent, client.IP)
+		value := map[string]interface{}{
+			"name":       user.Name,
+			"user_agent": client.UserAgent,
+			"ip":         client.IP,
+		}
+		if err := a.mail.SendMail(user.Email, subject, body, "newdevicelogin", value); err != nil {
+			log.Printf("error sending new device email to user %v: %v", user.ID, err)
+		}
+	}
+}
+
+func (a *authService) recordSecurityEvent(user *models.User, eventType string, client models.ClientInfo) {
+	event := &models.SecurityEvent{
+		UserID:    user.ID,
+		Type:      eventType,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+	if err := a.securityRepo.CreateSecurityEvent(event); err != nil {
+		log.Printf("error recording %s event of user %v: %v", eventType, user.ID, err)
+	}
+}
+
+func (a *authService) sendUnlockEmail(user *models.User) error {
+	token, err := jwt.GeneratePurposeToken(jwt.UnlockAccountTokenType, user.Email, a.Config.JWTSecret)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/auth/unlock/%s", a.Config.BaseUrl, token)
+	value := map[string]interface{}{
+		"link":    link,
+		"minutes": a.Config.LoginLockoutMinutes,
+	}
+	subject := "Your Meddle account has been locked"
+	body := fmt.Sprintf("Too many wrong passwords were entered for your account, so it is locked for %d minutes. Click the link below to unlock it now.", a.Config.LoginLockoutMinutes)
+	return a.mail.SendMail(user.Email, subject, body, "accountunlock", value)
+}
+
+// UnlockAccount lifts the lockout of the account the unlock link was sent to. Every link can only be used once.
+func (a *authService) UnlockAccount(token string) *apiError.Error {
+	email, errr := a.consumeLinkToken(token, jwt.UnlockAccountTokenType)
+	if errr != nil {
+		return errr
+	}
+	user, err := a.authRepo.FindUserByEmail(email)
+	if err != nil {
+		return apiError.New("invalid link", http.StatusUnauthorized)
+	}
+
+	if err := a.securityRepo.ResetFailedLogins(user.ID); err != nil {
+		log.Printf("error unlocking user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	a.recordSecurityEvent(user, models.SecurityEventAccountUnlocked, models.ClientInfo{})
+	return nil
+}
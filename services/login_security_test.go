@@ -0,0 +1,234 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_LoginDelay(t *testing.T) {
+	testCases := []struct {
+		failedLogins int
+		delay        time.Duration
+	}{
+		{failedLogins: 0, delay: 0},
+		{failedLogins: 2, delay: 0},
+		{failedLogins: 3, delay: time.Second},
+		{failedLogins: 5, delay: 4 * time.Second},
+		{failedLogins: 9, delay: maxLoginDelay},
+		{failedLogins: 100, delay: maxLoginDelay},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.delay, loginDelay(tc.failedLogins), "after %d failed logins", tc.failedLogins)
+	}
+}
+
+func Test_CheckLoginAccount(t *testing.T) {
+	now := time.Now()
+	lastFailure := now.Add(-2 * time.Second)
+	lockedUntil := now.Add(10 * time.Minute)
+	lockExpired := now.Add(-time.Minute)
+
+	testCases := []struct {
+		name           string
+		user           models.User
+		expectedStatus int
+	}{
+		{name: "no failed login case", user: models.User{}},
+		{name: "forgiven failed logins case", user: models.User{FailedLoginCount: 2, LastFailedLoginAt: &lastFailure}},
+		{name: "delay over case", user: models.User{FailedLoginCount: 4, LastFailedLoginAt: &lastFailure}},
+		{
+			name:           "delayed case",
+			user:           models.User{FailedLoginCount: 5, LastFailedLoginAt: &lastFailure},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:           "locked case",
+			user:           models.User{FailedLoginCount: 10, LastFailedLoginAt: &lastFailure, LockedUntil: &lockedUntil},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name: "lockout over case",
+			user: models.User{FailedLoginCount: 10, LastFailedLoginAt: &lockExpired, LockedUntil: &lockExpired},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkLoginAccount(&tc.user, now)
+			if tc.expectedStatus == 0 {
+				require.Nil(t, err)
+				return
+			}
+			require.Equal(t, tc.expectedStatus, err.Status)
+		})
+	}
+}
+
+func newLoginTestUser(t *testing.T) *models.User {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	return &models.User{
+		Model:          models.Model{ID: 1},
+		Name:           "name",
+		Email:          "email@gmail.com",
+		HashedPassword: string(hashedPassword),
+		IsEmailActive:  true,
+	}
+}
+
+func Test_LoginLockout(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := newLoginTestUser(t)
+	request := &models.LoginRequest{Email: user.Email, Password: "wrongpassword",
+		ClientInfo: models.ClientInfo{IP: "10.0.0.1", UserAgent: "meddle-ios/2.0"}}
+
+	mockSecurityRepository.EXPECT().CountRateLimitHits("login-failures:10.0.0.1", time.Hour).Times(1).Return(int64(3), nil)
+	mockRepository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+	mockSecurityRepository.EXPECT().HitRateLimit("login-failures:10.0.0.1", time.Hour).Times(1).Return(&models.RateLimit{}, nil)
+	mockSecurityRepository.EXPECT().RecordFailedLogin(user.ID, gomock.Any()).Times(1).Return(testConfig.LoginLockoutThreshold, nil)
+	mockSecurityRepository.EXPECT().LockUser(user.ID, gomock.Any()).Times(1).
+		DoAndReturn(func(userID uint, until time.Time) error {
+			lockout := time.Duration(testConfig.LoginLockoutMinutes) * time.Minute
+			require.WithinDuration(t, time.Now().Add(lockout), until, time.Minute)
+			return nil
+		})
+	mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).
+		DoAndReturn(func(event *models.SecurityEvent) error {
+			require.Equal(t, models.SecurityEventAccountLocked, event.Type)
+			require.Equal(t, "10.0.0.1", event.IP)
+			return nil
+		})
+	mockMailer.EXPECT().SendMail(user.Email, gomock.Any(), gomock.Any(), "accountunlock", gomock.Any()).Times(1).Return(nil)
+
+	_, err := testAuthService.LoginUser(request)
+	require.Equal(t, errors.ErrInvalidPassword, err)
+}
+
+func Test_LoginFromBlockedIP(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	request := &models.LoginRequest{Email: "email@gmail.com", Password: "password", ClientInfo: models.ClientInfo{IP: "10.0.0.1"}}
+	mockSecurityRepository.EXPECT().CountRateLimitHits("login-failures:10.0.0.1", time.Hour).Times(1).
+		Return(int64(testConfig.LoginIPFailureLimit), nil)
+	mockRepository.EXPECT().FindUserByEmail(gomock.Any()).Times(0)
+
+	_, err := testAuthService.LoginUser(request)
+	require.Equal(t, http.StatusTooManyRequests, err.Status)
+}
+
+func Test_LoginFromNewDevice(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := newLoginTestUser(t)
+	user.FailedLoginCount = 2
+	request := &models.LoginRequest{Email: user.Email, Password: "password", ClientInfo: models.ClientInfo{UserAgent: "meddle-android/2.0"}}
+
+	mockRepository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+	mockRepository.EXPECT().CreateSession(gomock.Any()).Times(1).
+		DoAndReturn(func(session *models.Session) error {
+			require.Equal(t, user.ID, session.UserID)
+			require.Equal(t, "meddle-android/2.0", session.UserAgent)
+			session.ID = 3
+			return nil
+		})
+	mockRepository.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).
+		DoAndReturn(func(refreshToken *models.RefreshToken) error {
+			require.Equal(t, uint(3), refreshToken.SessionID)
+			return nil
+		})
+	mockSecurityRepository.EXPECT().ResetFailedLogins(user.ID).Times(1).Return(nil)
+	mockSecurityRepository.EXPECT().HasLoggedInFrom(user.ID, "meddle-android/2.0").Times(1).Return(false, nil)
+	mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).
+		DoAndReturn(func(event *models.SecurityEvent) error {
+			require.Equal(t, models.SecurityEventNewDeviceLogin, event.Type)
+			return nil
+		})
+	mockMailer.EXPECT().SendMail(user.Email, gomock.Any(), gomock.Any(), "newdevicelogin", gomock.Any()).Times(1).Return(nil)
+
+	response, err := testAuthService.LoginUser(request)
+	require.Nil(t, err)
+	require.NotEmpty(t, response.AccessToken)
+}
+
+func Test_UnlockAccount(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := newLoginTestUser(t)
+	token, err := jwt.GeneratePurposeToken(jwt.UnlockAccountTokenType, user.Email, testConfig.JWTSecret)
+	require.NoError(t, err)
+	resetToken, err := jwt.GeneratePurposeToken(jwt.ResetPasswordTokenType, user.Email, testConfig.JWTSecret)
+	require.NoError(t, err)
+
+	mockRepository.EXPECT().ConsumeToken(gomock.Any()).Times(1).
+		DoAndReturn(func(blacklist *models.BlackList) error {
+			require.Equal(t, token, blacklist.Token)
+			validity := jwt.PurposeTokenValidity[jwt.UnlockAccountTokenType]
+			require.WithinDuration(t, time.Now().Add(validity), time.Unix(blacklist.ExpiresAt, 0), time.Minute)
+			return nil
+		})
+	mockRepository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+	mockSecurityRepository.EXPECT().ResetFailedLogins(user.ID).Times(1).Return(nil)
+	mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).Return(nil)
+	require.Nil(t, testAuthService.UnlockAccount(token))
+
+	mockRepository.EXPECT().ConsumeToken(gomock.Any()).Times(1).Return(db.ErrTokenUsed)
+	require.Equal(t, http.StatusUnauthorized, testAuthService.UnlockAccount(token).Status)
+
+	// links of other purposes do not unlock accounts
+	require.Equal(t, http.StatusUnauthorized, testAuthService.UnlockAccount(resetToken).Status)
+}
+
+func Test_SocialSignInGates(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	service := testAuthService.(*authService)
+	lockedUntil := time.Now().Add(10 * time.Minute)
+	testCases := []struct {
+		name           string
+		user           models.User
+		expectedStatus int
+	}{
+		{
+			name:           "locked account case",
+			user:           models.User{Email: "email@gmail.com", FailedLoginCount: 10, LockedUntil: &lockedUntil},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:           "password reset required case",
+			user:           models.User{Email: "email@gmail.com", PasswordResetRequired: true},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "disabled account case",
+			user:           models.User{Email: "email@gmail.com", DisabledAt: &lockedUntil},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			user := tc.user
+			mockRepository.EXPECT().FindUserByEmail(user.Email).Times(2).Return(&user, nil)
+			mockRepository.EXPECT().CreateSession(gomock.Any()).Times(0)
+
+			_, err := service.GetGoogleSignInToken(&models.GoogleUser{Email: user.Email, Name: "name"})
+			require.Equal(t, tc.expectedStatus, err.(*errors.Error).Status)
+
+			_, err = service.GetFacebookSignInToken(&models.FacebookUser{Email: user.Email, Name: "name"})
+			require.Equal(t, tc.expectedStatus, err.(*errors.Error).Status)
+		})
+	}
+}
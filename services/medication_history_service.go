@@ -1,20 +1,34 @@
 package services
 
 import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
-	"github.com/decagonhq/meddle-api/errors"
+	apiError "github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
-	"log"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"gorm.io/gorm"
 )
 
 //go:generate mockgen -destination=../mocks/medication_history_mock.go -package=mocks github.com/decagonhq/meddle-api/services MedicationHistoryService
 
 type MedicationHistoryService interface {
-	UpdateMedicationHistory(hasMedicationBeenTaken bool, medicationHistoryID uint, userID uint) *errors.Error
-	GetAllMedicationHistoryByUser(userID uint) ([]models.MedicationHistoryResponse, *errors.Error)
+	UpdateMedicationHistory(hasMedicationBeenTaken bool, medicationHistoryID uint, userID uint) *apiError.Error
+	GetAllMedicationHistoryByUser(userID uint, request *models.MedicationHistoryListRequest) ([]models.MedicationHistoryResponse, *models.Pagination, *apiError.Error)
+	HandleDoseAction(request *models.DoseActionRequest) *apiError.Error
+	GetAdherence(userID uint, request *models.AdherenceRequest) (*models.AdherenceResponse, *apiError.Error)
 }
 
+const (
+	// defaultAdherenceDays is the number of days an adherence report covers when no range is given
+	defaultAdherenceDays = 30
+	dateLayout           = "2006-01-02"
+)
+
 // medicationHistoryService struct
 type medicationHistoryService struct {
 	Config                *config.Config
@@ -29,32 +43,230 @@ func NewMedicationHistoryService(medicationHistoryRepo db.MedicationHistoryRepos
 	}
 }
 
-func (m *medicationHistoryService) UpdateMedicationHistory(hasMedicationBeenTaken bool, medicationHistoryID uint, userID uint) *errors.Error {
+func (m *medicationHistoryService) UpdateMedicationHistory(hasMedicationBeenTaken bool, medicationHistoryID uint, userID uint) *apiError.Error {
 	var wasMedicationMissed string
 	if hasMedicationBeenTaken == true {
-		wasMedicationMissed = "NO"
+		wasMedicationMissed = models.MedicationNotMissed
 	} else {
-		wasMedicationMissed = "YES"
+		wasMedicationMissed = models.MedicationMissed
 	}
+	return m.confirmDose(hasMedicationBeenTaken, wasMedicationMissed, medicationHistoryID, userID)
+}
+
+func (m *medicationHistoryService) confirmDose(hasMedicationBeenTaken bool, wasMedicationMissed string, medicationHistoryID uint, userID uint) *apiError.Error {
 	err := m.medicationHistoryRepo.UpdateMedicationHistory(hasMedicationBeenTaken, wasMedicationMissed, medicationHistoryID, userID)
 	if err != nil {
 		log.Printf("error updating medication history: %v", err)
-		return errors.ErrInternalServerError
+		return apiError.ErrInternalServerError
 	}
 	return nil
 }
 
-func (m *medicationHistoryService) GetAllMedicationHistoryByUser(userID uint) ([]models.MedicationHistoryResponse, *errors.Error) {
-	var medicationHistoryResponses []models.MedicationHistoryResponse
+// GetAllMedicationHistoryByUser returns a page of the medication histories of the user matching the request
+func (m *medicationHistoryService) GetAllMedicationHistoryByUser(userID uint, request *models.MedicationHistoryListRequest) ([]models.MedicationHistoryResponse, *models.Pagination, *apiError.Error) {
+	loc := models.LoadLocation(request.Timezone)
+	filter := &models.MedicationHistoryFilter{
+		MedicationID: request.MedicationID,
+		DependentID:  request.DependentID,
+		Status:       request.Status,
+		Order:        request.Order,
+		// one more medication history than requested tells whether there is a next page
+		Limit: request.PageLimit() + 1,
+	}
+	if request.From != "" {
+		from, err := parseDay(request.From, loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		filter.From = from
+	}
+	if request.To != "" {
+		to, err := parseDay(request.To, loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the range includes the whole last day
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	if request.Cursor != "" {
+		filter.After = &models.MedicationHistoryCursor{}
+		if err := models.DecodeCursor(request.Cursor, filter.After); err != nil {
+			return nil, nil, apiError.New("invalid cursor", http.StatusBadRequest)
+		}
+	}
 
-	medicationHistories, err := m.medicationHistoryRepo.GetAllMedicationHistoryByUserID(userID)
+	medicationHistories, err := m.medicationHistoryRepo.GetAllMedicationHistoryByUserID(userID, filter)
 	if err != nil {
 		log.Printf("error getting all medication history of user %v : %v", userID, err)
-		return nil, errors.ErrInternalServerError
+		return nil, nil, apiError.ErrInternalServerError
+	}
+
+	pagination := &models.Pagination{Limit: request.PageLimit()}
+	if len(medicationHistories) > pagination.Limit {
+		medicationHistories = medicationHistories[:pagination.Limit]
+		last := medicationHistories[len(medicationHistories)-1]
+		pagination.HasMore = true
+		pagination.NextCursor = models.EncodeCursor(models.MedicationHistoryCursor{ID: last.ID, MedicationTime: last.MedicationTime})
 	}
 
+	medicationHistoryResponses := make([]models.MedicationHistoryResponse, 0, len(medicationHistories))
 	for _, medicationHistory := range medicationHistories {
 		medicationHistoryResponses = append(medicationHistoryResponses, *medicationHistory.MedicationHistoryToResponse())
 	}
-	return medicationHistoryResponses, nil
+	return medicationHistoryResponses, pagination, nil
+}
+
+// HandleDoseAction applies the action picked on a dose reminder. Taking or skipping the dose updates its
+// medication history, snoozing it sends the reminder again after the requested number of minutes.
+func (m *medicationHistoryService) HandleDoseAction(request *models.DoseActionRequest) *apiError.Error {
+	userID, doseOccurrenceID, err := jwt.ValidateDoseActionToken(request.ActionToken, m.Config.JWTSecret)
+	if err != nil {
+		return apiError.New("invalid action token", http.StatusUnauthorized)
+	}
+
+	if request.Action == models.DoseSnoozed {
+		remindAt := time.Now().Add(time.Duration(request.SnoozeMinutes) * time.Minute)
+		err = m.medicationHistoryRepo.SnoozeDoseReminder(doseOccurrenceID, userID, remindAt)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apiError.New("dose not found", http.StatusNotFound)
+			}
+			if errors.Is(err, db.ErrDoseConfirmed) {
+				return apiError.New("dose has already been confirmed", http.StatusConflict)
+			}
+			log.Printf("error snoozing dose %v: %v", doseOccurrenceID, err)
+			return apiError.ErrInternalServerError
+		}
+		return nil
+	}
+
+	medicationHistory, err := m.medicationHistoryRepo.FindMedicationHistoryByDoseOccurrence(doseOccurrenceID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the reminder can be sent a moment before the dose is recorded
+			return apiError.New("dose has not been recorded yet, try again shortly", http.StatusConflict)
+		}
+		log.Printf("error finding medication history of dose %v: %v", doseOccurrenceID, err)
+		return apiError.ErrInternalServerError
+	}
+	if request.Action == models.DoseSkipped {
+		// skipping is recorded apart from missing, so that the dose is not followed up or reported as forgotten
+		return m.confirmDose(false, models.MedicationSkipped, medicationHistory.ID, userID)
+	}
+	return m.UpdateMedicationHistory(true, medicationHistory.ID, userID)
+}
+
+// GetAdherence summarizes how well the user kept up with their doses over a range of days,
+// overall, by medication and by day, week or month
+func (m *medicationHistoryService) GetAdherence(userID uint, request *models.AdherenceRequest) (*models.AdherenceResponse, *apiError.Error) {
+	loc := models.LoadLocation(request.Timezone)
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var dateErr *apiError.Error
+	if request.To != "" {
+		to, dateErr = parseDay(request.To, loc)
+		if dateErr != nil {
+			return nil, dateErr
+		}
+	}
+	from := to.AddDate(0, 0, 1-defaultAdherenceDays)
+	if request.From != "" {
+		from, dateErr = parseDay(request.From, loc)
+		if dateErr != nil {
+			return nil, dateErr
+		}
+	}
+	if from.After(to) {
+		return nil, apiError.New("from must not be after to", http.StatusBadRequest)
+	}
+	period := request.Period
+	if period == "" {
+		period = models.AdherenceByDay
+	}
+	// the range includes the whole last day
+	end := to.AddDate(0, 0, 1)
+	// a single medication is counted whoever takes it
+	dependentID := ownOrDependent(request.DependentID)
+	if request.MedicationID != 0 && request.DependentID == nil {
+		dependentID = nil
+	}
+
+	medicationCounts, err := m.medicationHistoryRepo.GetAdherenceByMedication(userID, request.MedicationID, dependentID, from, end)
+	if err != nil {
+		log.Printf("error getting adherence of user %v: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	dailyCounts, err := m.medicationHistoryRepo.GetAdherenceByPeriod(userID, request.MedicationID, dependentID, models.AdherenceByDay, loc.String(), from, end)
+	if err != nil {
+		log.Printf("error getting daily adherence of user %v: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	periodCounts := dailyCounts
+	if period != models.AdherenceByDay {
+		periodCounts, err = m.medicationHistoryRepo.GetAdherenceByPeriod(userID, request.MedicationID, dependentID, period, loc.String(), from, end)
+		if err != nil {
+			log.Printf("error getting adherence by %s of user %v: %v", period, userID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+	}
+
+	var total models.AdherenceCounts
+	medications := make([]models.MedicationAdherence, 0, len(medicationCounts))
+	for _, counts := range medicationCounts {
+		total.Taken += counts.Taken
+		total.Missed += counts.Missed
+		total.Skipped += counts.Skipped
+		total.Pending += counts.Pending
+		medications = append(medications, models.MedicationAdherence{
+			AdherenceStats: models.NewAdherenceStats(counts.AdherenceCounts),
+			MedicationID:   counts.MedicationID,
+			MedicationName: counts.MedicationName,
+		})
+	}
+	periods := make([]models.PeriodAdherence, 0, len(periodCounts))
+	for _, counts := range periodCounts {
+		periods = append(periods, models.PeriodAdherence{
+			AdherenceStats: models.NewAdherenceStats(counts.AdherenceCounts),
+			PeriodStart:    counts.PeriodStart.Format(dateLayout),
+		})
+	}
+	currentStreak, longestStreak := adherenceStreaks(dailyCounts)
+
+	return &models.AdherenceResponse{
+		From:           from.Format(dateLayout),
+		To:             to.Format(dateLayout),
+		Period:         period,
+		AdherenceStats: models.NewAdherenceStats(total),
+		CurrentStreak:  currentStreak,
+		LongestStreak:  longestStreak,
+		Medications:    medications,
+		Periods:        periods,
+	}, nil
+}
+
+// parseDay returns the start of a day of the given location
+func parseDay(value string, loc *time.Location) (time.Time, *apiError.Error) {
+	day, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, apiError.New("wrong date format", http.StatusBadRequest)
+	}
+	return day, nil
+}
+
+// adherenceStreaks returns the current and longest runs of days on which doses were taken and none was missed.
+// Days without doses, or with pending doses only, do not break a streak.
+func adherenceStreaks(dailyCounts []models.PeriodAdherenceCounts) (int, int) {
+	current, longest := 0, 0
+	for _, day := range dailyCounts {
+		switch {
+		case day.Missed > 0 || day.Skipped > 0:
+			current = 0
+		case day.Taken > 0:
+			current++
+			if current > longest {
+				longest = current
+			}
+		}
+	}
+	return current, longest
 }
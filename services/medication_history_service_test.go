@@ -1,13 +1,19 @@
 package services
 
 import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
-	"testing"
-	"time"
 )
 
 var testMedicationHistoryService MedicationHistoryService
@@ -134,7 +140,7 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 			},
 			getAllMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationHistoryRepository, dbInput uint, dbOutput []models.MedicationHistory, dbError error) {
-				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput, gomock.Any()).Times(1).Return(dbOutput, dbError)
 			},
 		},
 		{
@@ -145,7 +151,7 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 			getAllMedResponse: nil,
 			getAllMedError:    errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationHistoryRepository, dbInput uint, dbOutput []models.MedicationHistory, dbError error) {
-				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput, gomock.Any()).Times(1).Return(dbOutput, dbError)
 			},
 		},
 	}
@@ -154,11 +160,278 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationHistoryRepository, tc.dbInput, tc.dbOutput, tc.dbError)
-			medicationResponse, err := testMedicationHistoryService.GetAllMedicationHistoryByUser(1)
+			medicationResponse, pagination, err := testMedicationHistoryService.GetAllMedicationHistoryByUser(1, &models.MedicationHistoryListRequest{})
 
 			require.Equal(t, tc.getAllMedResponse, medicationResponse)
 			require.Equal(t, tc.getAllMedError, err)
+			if err == nil {
+				require.Equal(t, &models.Pagination{Limit: models.DefaultPageLimit}, pagination)
+			}
+		})
+	}
+
+}
+
+func Test_GetAllMedicationHistoryByUserPagination(t *testing.T) {
+	medicationTime, _ := time.Parse(time.RFC3339, "2022-08-02T08:00:00Z")
+	page := []models.MedicationHistory{
+		{Model: models.Model{ID: 9}, MedicationTime: medicationTime.Add(time.Hour)},
+		{Model: models.Model{ID: 8}, MedicationTime: medicationTime},
+		{Model: models.Model{ID: 7}, MedicationTime: medicationTime.Add(-time.Hour)},
+	}
+	cursor := models.EncodeCursor(models.MedicationHistoryCursor{ID: 10, MedicationTime: medicationTime.Add(2 * time.Hour)})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repository := mocks.NewMockMedicationHistoryRepository(ctrl)
+	service := NewMedicationHistoryService(repository, testConfig)
+
+	repository.EXPECT().GetAllMedicationHistoryByUserID(uint(1), gomock.Any()).Times(1).
+		DoAndReturn(func(userID uint, filter *models.MedicationHistoryFilter) ([]models.MedicationHistory, error) {
+			require.Equal(t, 3, filter.Limit)
+			require.Equal(t, uint(10), filter.After.ID)
+			require.Equal(t, uint(4), filter.MedicationID)
+			require.Equal(t, "missed", filter.Status)
+			require.Equal(t, "2022-08-01T00:00:00Z", filter.From.Format(time.RFC3339))
+			require.Equal(t, "2022-08-03T00:00:00Z", filter.To.Format(time.RFC3339))
+			return page, nil
 		})
+
+	request := &models.MedicationHistoryListRequest{
+		PageRequest:  models.PageRequest{Cursor: cursor, Limit: 2},
+		MedicationID: 4,
+		From:         "2022-08-01",
+		To:           "2022-08-02",
+		Status:       "missed",
 	}
+	medicationHistories, pagination, err := service.GetAllMedicationHistoryByUser(1, request)
+	require.Nil(t, err)
+	require.Len(t, medicationHistories, 2)
+	require.True(t, pagination.HasMore)
+
+	var next models.MedicationHistoryCursor
+	require.NoError(t, models.DecodeCursor(pagination.NextCursor, &next))
+	require.Equal(t, uint(8), next.ID)
+	require.True(t, medicationTime.Equal(next.MedicationTime))
+
+	_, _, err = service.GetAllMedicationHistoryByUser(1, &models.MedicationHistoryListRequest{PageRequest: models.PageRequest{Cursor: "not a cursor"}})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+}
 
+func Test_HandleDoseAction(t *testing.T) {
+	actionToken, err := jwt.GenerateDoseActionToken(1, 7, testConfig.JWTSecret)
+	require.NoError(t, err)
+	tokenPair, err := jwt.GenerateTokenPair("email@gmail.com", "", 0, testConfig.JWTSecret)
+	accessToken := tokenPair.AccessToken
+	require.NoError(t, err)
+	medicationHistory := &models.MedicationHistory{Model: models.Model{ID: 5}, DoseOccurrenceID: 7, UserID: 1}
+
+	testCases := []struct {
+		name        string
+		request     models.DoseActionRequest
+		buildStubs  func(repository *mocks.MockMedicationHistoryRepository)
+		expectedErr *errors.Error
+	}{
+		{
+			name:    "dose taken case",
+			request: models.DoseActionRequest{ActionToken: actionToken, Action: models.DoseTaken},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().FindMedicationHistoryByDoseOccurrence(uint(7), uint(1)).Times(1).Return(medicationHistory, nil)
+				repository.EXPECT().UpdateMedicationHistory(true, "NO", uint(5), uint(1)).Times(1).Return(nil)
+			},
+		},
+		{
+			name:    "dose skipped case",
+			request: models.DoseActionRequest{ActionToken: actionToken, Action: models.DoseSkipped},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().FindMedicationHistoryByDoseOccurrence(uint(7), uint(1)).Times(1).Return(medicationHistory, nil)
+				repository.EXPECT().UpdateMedicationHistory(false, models.MedicationSkipped, uint(5), uint(1)).Times(1).Return(nil)
+			},
+		},
+		{
+			name:    "dose not recorded yet case",
+			request: models.DoseActionRequest{ActionToken: actionToken, Action: models.DoseTaken},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().FindMedicationHistoryByDoseOccurrence(uint(7), uint(1)).Times(1).Return(nil, gorm.ErrRecordNotFound)
+			},
+			expectedErr: errors.New("dose has not been recorded yet, try again shortly", http.StatusConflict),
+		},
+		{
+			name:    "dose snoozed case",
+			request: models.DoseActionRequest{ActionToken: actionToken, Action: models.DoseSnoozed, SnoozeMinutes: 10},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().SnoozeDoseReminder(uint(7), uint(1), gomock.Any()).Times(1).
+					DoAndReturn(func(doseOccurrenceID uint, userID uint, remindAt time.Time) error {
+						require.WithinDuration(t, time.Now().Add(10*time.Minute), remindAt, time.Minute)
+						return nil
+					})
+			},
+		},
+		{
+			name:    "snoozing unknown dose case",
+			request: models.DoseActionRequest{ActionToken: actionToken, Action: models.DoseSnoozed, SnoozeMinutes: 10},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().SnoozeDoseReminder(uint(7), uint(1), gomock.Any()).Times(1).Return(gorm.ErrRecordNotFound)
+			},
+			expectedErr: errors.New("dose not found", http.StatusNotFound),
+		},
+		{
+			name:    "snoozing confirmed dose case",
+			request: models.DoseActionRequest{ActionToken: actionToken, Action: models.DoseSnoozed, SnoozeMinutes: 10},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().SnoozeDoseReminder(uint(7), uint(1), gomock.Any()).Times(1).
+					Return(fmt.Errorf("could not snooze dose reminder: %w", db.ErrDoseConfirmed))
+			},
+			expectedErr: errors.New("dose has already been confirmed", http.StatusConflict),
+		},
+		{
+			name:        "access token used as action token case",
+			request:     models.DoseActionRequest{ActionToken: accessToken, Action: models.DoseTaken},
+			buildStubs:  func(repository *mocks.MockMedicationHistoryRepository) {},
+			expectedErr: errors.New("invalid action token", http.StatusUnauthorized),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockMedicationHistoryRepository(ctrl)
+			service := NewMedicationHistoryService(repository, testConfig)
+			tc.buildStubs(repository)
+
+			err := service.HandleDoseAction(&tc.request)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_GetAdherence(t *testing.T) {
+	from, _ := time.Parse("2006-01-02", "2022-08-01")
+	to, _ := time.Parse("2006-01-02", "2022-08-04")
+	day := func(n int) time.Time {
+		return from.AddDate(0, 0, n)
+	}
+	dailyCounts := []models.PeriodAdherenceCounts{
+		{PeriodStart: day(0), AdherenceCounts: models.AdherenceCounts{Taken: 2}},
+		{PeriodStart: day(1), AdherenceCounts: models.AdherenceCounts{Taken: 1, Missed: 1}},
+		{PeriodStart: day(2), AdherenceCounts: models.AdherenceCounts{Taken: 2}},
+		{PeriodStart: day(3), AdherenceCounts: models.AdherenceCounts{Taken: 1, Pending: 1}},
+	}
+	medicationCounts := []models.MedicationAdherenceCounts{
+		{MedicationID: 1, MedicationName: "Amoxicillin", AdherenceCounts: models.AdherenceCounts{Taken: 2, Missed: 1}},
+		{MedicationID: 2, MedicationName: "Paracetamol", AdherenceCounts: models.AdherenceCounts{Taken: 4, Pending: 1}},
+	}
+	own, dependent := uint(0), uint(5)
+
+	testCases := []struct {
+		name        string
+		request     *models.AdherenceRequest
+		buildStubs  func(repository *mocks.MockMedicationHistoryRepository)
+		checkResult func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error)
+	}{
+		{
+			name:    "daily adherence case",
+			request: &models.AdherenceRequest{From: "2022-08-01", To: "2022-08-04"},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().GetAdherenceByMedication(uint(1), uint(0), &own, from, to.AddDate(0, 0, 1)).Times(1).Return(medicationCounts, nil)
+				repository.EXPECT().GetAdherenceByPeriod(uint(1), uint(0), &own, models.AdherenceByDay, "UTC", from, to.AddDate(0, 0, 1)).Times(1).Return(dailyCounts, nil)
+			},
+			checkResult: func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error) {
+				require.Nil(t, err)
+				require.Equal(t, models.AdherenceCounts{Taken: 6, Missed: 1, Pending: 1}, adherence.AdherenceCounts)
+				require.InDelta(t, 85.71, adherence.AdherencePercentage, 0.01)
+				require.Equal(t, 2, adherence.CurrentStreak)
+				require.Equal(t, 2, adherence.LongestStreak)
+				require.Len(t, adherence.Medications, 2)
+				require.Len(t, adherence.Periods, 4)
+				require.Equal(t, "2022-08-02", adherence.Periods[1].PeriodStart)
+				require.Equal(t, float64(50), adherence.Periods[1].AdherencePercentage)
+			},
+		},
+		{
+			name:    "weekly adherence of a medication case",
+			request: &models.AdherenceRequest{From: "2022-08-01", To: "2022-08-04", Period: models.AdherenceByWeek, MedicationID: 2},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().GetAdherenceByMedication(uint(1), uint(2), gomock.Nil(), from, to.AddDate(0, 0, 1)).Times(1).Return(medicationCounts[1:], nil)
+				repository.EXPECT().GetAdherenceByPeriod(uint(1), uint(2), gomock.Nil(), models.AdherenceByDay, "UTC", from, to.AddDate(0, 0, 1)).Times(1).Return(nil, nil)
+				repository.EXPECT().GetAdherenceByPeriod(uint(1), uint(2), gomock.Nil(), models.AdherenceByWeek, "UTC", from, to.AddDate(0, 0, 1)).Times(1).
+					Return([]models.PeriodAdherenceCounts{{PeriodStart: from, AdherenceCounts: medicationCounts[1].AdherenceCounts}}, nil)
+			},
+			checkResult: func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error) {
+				require.Nil(t, err)
+				require.Equal(t, models.AdherenceByWeek, adherence.Period)
+				require.Equal(t, float64(100), adherence.AdherencePercentage)
+				require.Len(t, adherence.Periods, 1)
+			},
+		},
+		{
+			name:    "dependent adherence case",
+			request: &models.AdherenceRequest{From: "2022-08-01", To: "2022-08-04", DependentID: &dependent},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().GetAdherenceByMedication(uint(1), uint(0), &dependent, from, to.AddDate(0, 0, 1)).Times(1).
+					Return(medicationCounts[:1], nil)
+				repository.EXPECT().GetAdherenceByPeriod(uint(1), uint(0), &dependent, models.AdherenceByDay, "UTC", from, to.AddDate(0, 0, 1)).Times(1).
+					Return([]models.PeriodAdherenceCounts{{PeriodStart: day(1), AdherenceCounts: medicationCounts[0].AdherenceCounts}}, nil)
+			},
+			checkResult: func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error) {
+				require.Nil(t, err)
+				require.Equal(t, models.AdherenceCounts{Taken: 2, Missed: 1}, adherence.AdherenceCounts)
+				require.Len(t, adherence.Medications, 1)
+				require.Equal(t, "Amoxicillin", adherence.Medications[0].MedicationName)
+			},
+		},
+		{
+			name:    "skipped doses count as not taken case",
+			request: &models.AdherenceRequest{From: "2022-08-01", To: "2022-08-02"},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				end := day(2)
+				repository.EXPECT().GetAdherenceByMedication(uint(1), uint(0), &own, from, end).Times(1).
+					Return([]models.MedicationAdherenceCounts{{MedicationID: 1, AdherenceCounts: models.AdherenceCounts{Taken: 3, Skipped: 1}}}, nil)
+				repository.EXPECT().GetAdherenceByPeriod(uint(1), uint(0), &own, models.AdherenceByDay, "UTC", from, end).Times(1).
+					Return([]models.PeriodAdherenceCounts{
+						{PeriodStart: day(0), AdherenceCounts: models.AdherenceCounts{Taken: 2}},
+						{PeriodStart: day(1), AdherenceCounts: models.AdherenceCounts{Taken: 1, Skipped: 1}},
+					}, nil)
+			},
+			checkResult: func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error) {
+				require.Nil(t, err)
+				require.Equal(t, models.AdherenceCounts{Taken: 3, Skipped: 1}, adherence.AdherenceCounts)
+				require.Equal(t, float64(75), adherence.AdherencePercentage)
+				require.Equal(t, 0, adherence.CurrentStreak)
+				require.Equal(t, 1, adherence.LongestStreak)
+			},
+		},
+		{
+			name:       "from after to case",
+			request:    &models.AdherenceRequest{From: "2022-08-05", To: "2022-08-04"},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {},
+			checkResult: func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error) {
+				require.Equal(t, http.StatusBadRequest, err.Status)
+			},
+		},
+		{
+			name:    "internal server error case",
+			request: &models.AdherenceRequest{From: "2022-08-01", To: "2022-08-04"},
+			buildStubs: func(repository *mocks.MockMedicationHistoryRepository) {
+				repository.EXPECT().GetAdherenceByMedication(uint(1), uint(0), &own, from, to.AddDate(0, 0, 1)).Times(1).Return(nil, gorm.ErrInvalidDB)
+			},
+			checkResult: func(t *testing.T, adherence *models.AdherenceResponse, err *errors.Error) {
+				require.Equal(t, errors.ErrInternalServerError, err)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockMedicationHistoryRepository(ctrl)
+			service := NewMedicationHistoryService(repository, testConfig)
+			tc.buildStubs(repository)
+
+			adherence, err := service.GetAdherence(1, tc.request)
+			tc.checkResult(t, adherence, err)
+		})
+	}
 }
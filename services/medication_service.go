@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,21 +9,33 @@ import (
 
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
-	"github.com/decagonhq/meddle-api/errors"
+	apiError "github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
-	"github.com/go-co-op/gocron"
+	"gorm.io/gorm"
 )
 
+const (
+	// DoseSchedulingHorizon is how far ahead dose occurrences are generated
+	DoseSchedulingHorizon = 48 * time.Hour
+	// doseOccurrenceBatchSize is the number of due occurrences processed per transaction
+	doseOccurrenceBatchSize = 100
+)
+
+var errMedicationNotFound = apiError.New("medication not found", http.StatusNotFound)
+
 //go:generate mockgen -destination=../mocks/medication_mock.go -package=mocks github.com/decagonhq/meddle-api/services MedicationService
 
 type MedicationService interface {
-	CreateMedication(request *models.MedicationRequest) (*models.MedicationResponse, *errors.Error)
-	GetNextMedications(userID uint) ([]models.MedicationResponse, *errors.Error)
-	GetMedicationDetail(id uint, userId uint) (*models.MedicationResponse, *errors.Error)
-	GetAllMedications(userID uint) ([]models.MedicationResponse, *errors.Error)
-	CronUpdateMedicationForNextTime() error
-	UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint) *errors.Error
+	CreateMedication(request *models.MedicationRequest) (*models.MedicationResponse, *apiError.Error)
+	GetNextMedications(userID uint, dependentID *uint) ([]models.MedicationResponse, *apiError.Error)
+	GetMedicationDetail(id uint, userId uint) (*models.MedicationResponse, *apiError.Error)
+	GetAllMedications(userID uint, request *models.MedicationListRequest) ([]models.MedicationResponse, *models.Pagination, *apiError.Error)
+	CronUpdateMedicationForNextTime() (int, error)
+	UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint) *apiError.Error
 	FindMedication(medicationName string, userId int) (*[]models.Medication, error)
+	DeleteMedication(medicationID uint, userID uint) *apiError.Error
+	PauseMedication(medicationID uint, userID uint) (*models.MedicationResponse, *apiError.Error)
+	ResumeMedication(medicationID uint, userID uint) (*models.MedicationResponse, *apiError.Error)
 }
 
 // medicationService struct
@@ -30,80 +43,225 @@ type medicationService struct {
 	Config                *config.Config
 	medicationRepo        db.MedicationRepository
 	medicationHistoryRepo db.MedicationHistoryRepository
+	dependentRepo         db.DependentRepository
 }
 
 // NewMedicationService instantiate an authService
-func NewMedicationService(medicationRepo db.MedicationRepository, medicationHistoryRepo db.MedicationHistoryRepository, conf *config.Config) MedicationService {
+func NewMedicationService(medicationRepo db.MedicationRepository, medicationHistoryRepo db.MedicationHistoryRepository, dependentRepo db.DependentRepository, conf *config.Config) MedicationService {
 	return &medicationService{
 		Config:                conf,
 		medicationRepo:        medicationRepo,
 		medicationHistoryRepo: medicationHistoryRepo,
+		dependentRepo:         dependentRepo,
 	}
 }
 
-func (m *medicationService) CreateMedication(request *models.MedicationRequest) (*models.MedicationResponse, *errors.Error) {
+func (m *medicationService) CreateMedication(request *models.MedicationRequest) (*models.MedicationResponse, *apiError.Error) {
 	startDate, err := time.Parse(time.RFC3339, request.MedicationStartDate)
 	if err != nil {
-		return nil, errors.New("wrong date format", http.StatusBadRequest)
+		return nil, apiError.New("wrong date format", http.StatusBadRequest)
 	}
 	startTime, err := time.Parse(time.RFC3339, request.MedicationStartTime)
 	if err != nil {
-		return nil, errors.New("wrong time format", http.StatusBadRequest)
+		return nil, apiError.New("wrong time format", http.StatusBadRequest)
 	}
+	if err := validateSchedule(request.TimeInterval, request.Schedule); err != nil {
+		return nil, err
+	}
+	if err := validateEscalationPolicy(request.EscalationPolicy, m.Config.MissedDoseGraceMinutes); err != nil {
+		return nil, err
+	}
+	if request.DependentID != nil {
+		_, err := m.dependentRepo.FindDependent(*request.DependentID, request.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errDependentNotFound
+			}
+			log.Printf("error finding dependent %v: %v", *request.DependentID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+	}
+	loc := models.LoadLocation(request.Timezone)
+	startDate, startTime = startDate.In(loc), startTime.In(loc)
 
 	medication := request.ReqToMedicationModel()
 	medication.CreatedAt = time.Now().Unix()
 	medication.UpdatedAt = time.Now().Unix()
 	medication.MedicationStartDate = startDate
 	medication.MedicationStartTime = startTime
-	var nextTime time.Time
-	if medication.MedicationStartTime.Unix() > time.Now().Unix() {
-		nextTime = medication.MedicationStartTime
-	} else {
-		nextTime = medication.MedicationStartTime.Add(time.Hour * time.Duration(medication.TimeInterval))
-	}
-
 	medication.MedicationStopDate = medication.MedicationStartTime.AddDate(0, 0, medication.Duration)
-	medication.NextDosageTime = GetNextDosageTime(nextTime, medication.MedicationStartTime)
+	medication.NextDosageTime, _ = FirstDosageTime(medication, time.Now())
 
 	response, err := m.medicationRepo.CreateMedication(medication)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		return nil, apiError.ErrInternalServerError
 	}
 	return response.MedicationToResponse(), nil
 }
 
-func (m *medicationService) GetMedicationDetail(id uint, userId uint) (*models.MedicationResponse, *errors.Error) {
+func (m *medicationService) GetMedicationDetail(id uint, userId uint) (*models.MedicationResponse, *apiError.Error) {
 	medic, err := m.medicationRepo.GetMedicationDetail(id, userId)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errMedicationNotFound
+		}
+		return nil, apiError.ErrInternalServerError
 	}
 	return medic.MedicationToResponse(), nil
 }
 
-func (m *medicationService) GetAllMedications(userID uint) ([]models.MedicationResponse, *errors.Error) {
-	var medicationResponses []models.MedicationResponse
+// DeleteMedication deletes the medication, its history stays available
+func (m *medicationService) DeleteMedication(medicationID uint, userID uint) *apiError.Error {
+	err := m.medicationRepo.DeleteMedication(medicationID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errMedicationNotFound
+		}
+		log.Printf("error deleting medication %v: %v", medicationID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// PauseMedication pauses the course of the medication, no dose is due until it is resumed
+func (m *medicationService) PauseMedication(medicationID uint, userID uint) (*models.MedicationResponse, *apiError.Error) {
+	medication, err := m.medicationRepo.GetMedicationDetail(medicationID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errMedicationNotFound
+		}
+		return nil, apiError.ErrInternalServerError
+	}
+	if medication.PausedAt != nil {
+		return nil, apiError.New("medication is already paused", http.StatusConflict)
+	}
+	if medication.IsMedicationDone {
+		return nil, apiError.New("medication is already done", http.StatusConflict)
+	}
+
+	pausedAt := time.Now()
+	err = m.medicationRepo.PauseMedication(medication, pausedAt)
+	if err != nil {
+		log.Printf("error pausing medication %v: %v", medicationID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	medication.PausedAt = &pausedAt
+	return medication.MedicationToResponse(), nil
+}
+
+// ResumeMedication resumes a paused course from now. The course is extended by the time it was paused,
+// and its next dose is the first one of its schedule from now.
+func (m *medicationService) ResumeMedication(medicationID uint, userID uint) (*models.MedicationResponse, *apiError.Error) {
+	medication, err := m.medicationRepo.GetMedicationDetail(medicationID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errMedicationNotFound
+		}
+		return nil, apiError.ErrInternalServerError
+	}
+	if medication.PausedAt == nil {
+		return nil, apiError.New("medication is not paused", http.StatusConflict)
+	}
 
-	medications, err := m.medicationRepo.GetAllMedications(userID)
+	now := time.Now()
+	medication.MedicationStopDate = medication.MedicationStopDate.Add(now.Sub(*medication.PausedAt))
+	medication.PausedAt = nil
+	nextDosageTime, ok := FirstDosageTime(medication, now)
+	for ok && nextDosageTime.Before(now) {
+		nextDosageTime, ok = NextDosageTime(medication, nextDosageTime)
+	}
+	medication.NextDosageTime = time.Time{}
+	if ok {
+		medication.NextDosageTime = nextDosageTime
+	}
+
+	err = m.medicationRepo.ResumeMedication(medication)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		log.Printf("error resuming medication %v: %v", medicationID, err)
+		return nil, apiError.ErrInternalServerError
 	}
+	return medication.MedicationToResponse(), nil
+}
 
+// moveToTimezone moves the medications to a new timezone. Doses are taken at the wall clock times of the timezone,
+// so the next dose is worked out again, the upcoming doses generated in the old timezone are replaced once it is saved.
+func moveToTimezone(medications []models.Medication, timezone string, now time.Time) {
+	for i := range medications {
+		medication := &medications[i]
+		medication.Timezone = timezone
+		// paused courses work out their next dose when they are resumed
+		if medication.PausedAt == nil && !medication.IsMedicationDone {
+			nextDosageTime, ok := FirstDosageTime(medication, now)
+			for ok && nextDosageTime.Before(now) {
+				nextDosageTime, ok = NextDosageTime(medication, nextDosageTime)
+			}
+			medication.NextDosageTime = time.Time{}
+			if ok {
+				medication.NextDosageTime = nextDosageTime
+			}
+		}
+	}
+}
+
+// GetAllMedications returns a page of the medications of the user matching the request
+func (m *medicationService) GetAllMedications(userID uint, request *models.MedicationListRequest) ([]models.MedicationResponse, *models.Pagination, *apiError.Error) {
+	filter := &models.MedicationFilter{
+		Name:        request.Name,
+		DependentID: request.DependentID,
+		Status:      request.Status,
+		Sort:        request.Sort,
+		Order:       request.Order,
+		// one more medication than requested tells whether there is a next page
+		Limit: request.PageLimit() + 1,
+	}
+	if filter.Order == "" && filter.Sort == "name" {
+		filter.Order = models.SortAscending
+	}
+	if request.Cursor != "" {
+		filter.After = &models.MedicationCursor{}
+		if err := models.DecodeCursor(request.Cursor, filter.After); err != nil {
+			return nil, nil, apiError.New("invalid cursor", http.StatusBadRequest)
+		}
+	}
+
+	medications, err := m.medicationRepo.GetAllMedications(userID, filter)
+	if err != nil {
+		return nil, nil, apiError.ErrInternalServerError
+	}
+
+	pagination := &models.Pagination{Limit: request.PageLimit()}
+	if len(medications) > pagination.Limit {
+		medications = medications[:pagination.Limit]
+		last := medications[len(medications)-1]
+		pagination.HasMore = true
+		pagination.NextCursor = models.EncodeCursor(models.MedicationCursor{ID: last.ID, Name: last.Name})
+	}
+
+	medicationResponses := make([]models.MedicationResponse, 0, len(medications))
 	for _, medication := range medications {
 		medicationResponses = append(medicationResponses, *medication.MedicationToResponse())
 	}
-	return medicationResponses, nil
+	return medicationResponses, pagination, nil
 }
 
-func (m *medicationService) UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint) *errors.Error {
+func (m *medicationService) UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint) *apiError.Error {
 	startDate, err := time.Parse(time.RFC3339, request.MedicationStartDate)
 	if err != nil {
-		return errors.New("wrong date format", http.StatusBadRequest)
+		return apiError.New("wrong date format", http.StatusBadRequest)
 	}
 	startTime, err := time.Parse(time.RFC3339, request.MedicationStartTime)
 	if err != nil {
-		return errors.New("wrong time format", http.StatusBadRequest)
+		return apiError.New("wrong time format", http.StatusBadRequest)
+	}
+	if err := validateSchedule(request.TimeInterval, request.Schedule); err != nil {
+		return err
+	}
+	if err := validateEscalationPolicy(request.EscalationPolicy, m.Config.MissedDoseGraceMinutes); err != nil {
+		return err
 	}
+	loc := models.LoadLocation(request.Timezone)
+	startDate, startTime = startDate.In(loc), startTime.In(loc)
+
 	medication := models.Medication{
 		Name:                   request.Name,
 		Dosage:                 request.Dosage,
@@ -114,27 +272,36 @@ func (m *medicationService) UpdateMedication(request *models.UpdateMedicationReq
 		MedicationIcon:         request.MedicationIcon,
 		MedicationStartDate:    startDate,
 		MedicationStartTime:    startTime,
+		Timezone:               request.Timezone,
 	}
 
-	nextTime := medication.MedicationStartTime.Add(time.Hour * time.Duration(medication.TimeInterval))
+	if request.Schedule != nil {
+		medication.Schedule = *request.Schedule
+	}
+	if request.EscalationPolicy != nil {
+		medication.EscalationPolicy = *request.EscalationPolicy
+	}
+	medication.PillCount = request.PillCount
+	medication.UnitsPerDose = request.UnitsPerDose
+	medication.RefillThresholdDays = request.RefillThresholdDays
 	medication.MedicationStopDate = medication.MedicationStartTime.AddDate(0, 0, medication.Duration)
-
-	medication.NextDosageTime = GetNextDosageTime(nextTime, medication.MedicationStartTime)
+	medication.NextDosageTime, _ = FirstDosageTime(&medication, time.Now())
 
 	//get medication where user and medication id is defined above then send it for updating
 	err = m.medicationRepo.UpdateMedication(&medication, medicationID, userID)
 	if err != nil {
-		return errors.ErrInternalServerError
+		return apiError.ErrInternalServerError
 	}
 	return nil
 }
 
-func (m *medicationService) GetNextMedications(userID uint) ([]models.MedicationResponse, *errors.Error) {
+// GetNextMedications returns the upcoming doses of the user, or of their dependent when dependentID is set
+func (m *medicationService) GetNextMedications(userID uint, dependentID *uint) ([]models.MedicationResponse, *apiError.Error) {
 	var nextMedicationResponses []models.MedicationResponse
 
-	medications, err := m.medicationRepo.GetNextMedications(userID)
+	medications, err := m.medicationRepo.GetNextMedications(userID, ownOrDependent(dependentID))
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		return nil, apiError.ErrInternalServerError
 	}
 
 	for _, medication := range medications {
@@ -144,77 +311,134 @@ func (m *medicationService) GetNextMedications(userID uint) ([]models.Medication
 
 }
 
-func (m *medicationService) CronUpdateMedicationForNextTime() error {
-	medications, err := m.medicationRepo.GetAllNextMedicationsToUpdate()
+// CronUpdateMedicationForNextTime generates the upcoming dose occurrences, then records every due occurrence
+// that has not been recorded yet in the medication history, however long ago it fell due.
+// It returns the number of occurrences recorded.
+func (m *medicationService) CronUpdateMedicationForNextTime() (int, error) {
+	now := time.Now()
+	err := m.scheduleDoseOccurrences(now)
 	if err != nil {
-		return fmt.Errorf("could not get next medications while running update next dosage cron job")
+		return 0, err
 	}
+	return m.recordDueDoseOccurrences(now)
+}
 
-	//create medication history for each medication
-	if medications != nil {
-		go m.CreateMedicationHistory(medications)
+func (m *medicationService) scheduleDoseOccurrences(now time.Time) error {
+	until := now.Add(DoseSchedulingHorizon)
+	medications, err := m.medicationRepo.GetMedicationsToSchedule(until)
+	if err != nil {
+		return fmt.Errorf("could not get medications to schedule while running update next dosage cron job")
 	}
 
-	for _, medication := range medications {
-		timeSumation := medication.NextDosageTime.Add(time.Hour * time.Duration(medication.TimeInterval))
-		nextDosageTime := GetNextDosageTime(timeSumation, medication.NextDosageTime)
-
-		if nextDosageTime.Unix() < medication.MedicationStopDate.Unix() {
-			err = m.medicationRepo.UpdateNextMedicationTime(&medication, nextDosageTime)
-			if err != nil {
-				return fmt.Errorf("could not update next medication time while running update next dosage cron job")
-			}
-		} else {
-			err = m.medicationRepo.UpdateMedicationDone(&medication)
-			if err != nil {
-				return fmt.Errorf("could not update is medication done while running update next dosage cron job")
-			}
+	for i := range medications {
+		medication := &medications[i]
+		occurrences := GenerateDoseOccurrences(medication, until)
+		err = m.medicationRepo.ScheduleDoseOccurrences(medication, occurrences)
+		if err != nil {
+			return fmt.Errorf("could not schedule dose occurrences while running update next dosage cron job")
 		}
 	}
 	return nil
 }
 
-func UpdateMedicationCronJob(medicationService MedicationService) {
-	// _, presentMinute, _ := time.Now().UTC().Clock()
-	// if presentMinute%15 != 0 {
-	// 	time.Sleep(time.Duration(presentMinute+(presentMinute%15)) * time.Minute)
-	// }
-	// waitTime := time.Duration(60-presentMinute)*time.Minute + time.Duration(60-presentSecond)*time.Second
-	s := gocron.NewScheduler(time.UTC)
-	s.Every(1).Minute().Do(func() {
-		err := medicationService.CronUpdateMedicationForNextTime()
+func (m *medicationService) recordDueDoseOccurrences(now time.Time) (int, error) {
+	recorded := 0
+	for {
+		occurrences, err := m.medicationRepo.RecordDueDoseOccurrences(now, doseOccurrenceBatchSize)
 		if err != nil {
-			log.Printf("cron job error: %v", err)
+			return recorded, fmt.Errorf("could not record due doses while running update next dosage cron job")
 		}
-	})
-	s.StartBlocking()
+
+		recorded += len(occurrences)
+		for _, occurrence := range occurrences {
+			medication := occurrence.Medication
+			nextDosageTime, ok := NextDosageTime(&medication, occurrence.ScheduledAt)
+
+			if ok {
+				err = m.medicationRepo.UpdateNextMedicationTime(&medication, nextDosageTime)
+				if err != nil {
+					return recorded, fmt.Errorf("could not update next medication time while running update next dosage cron job")
+				}
+			} else {
+				err = m.medicationRepo.UpdateMedicationDone(&medication)
+				if err != nil {
+					return recorded, fmt.Errorf("could not update is medication done while running update next dosage cron job")
+				}
+			}
+		}
+
+		if len(occurrences) < doseOccurrenceBatchSize {
+			return recorded, nil
+		}
+	}
 }
 
+// GetNextDosageTime returns t1 truncated to the minute when it falls on the same calendar day as t2,
+// otherwise the first dose of the day after t2 at 9:00. Days are taken in the location of t2,
+// so the 9:00 dose stays at 9:00 wall clock time across DST changes.
 func GetNextDosageTime(t1, t2 time.Time) time.Time {
-	if t1.Day()-t2.Day() <= 0 {
-		return time.Date(t1.Year(), t1.Month(), t1.Day(), t1.Hour(), t1.Minute(), 0, 0, time.UTC)
+	loc := t2.Location()
+	t1 = t1.In(loc)
+	y1, m1, d1 := t1.Date()
+	y2, m2, d2 := t2.Date()
+	if !time.Date(y1, m1, d1, 0, 0, 0, 0, loc).After(time.Date(y2, m2, d2, 0, 0, 0, 0, loc)) {
+		return t1.Truncate(time.Minute)
 	}
-	return time.Date(t2.Year(), t2.Month(), t2.Day()+1, 9, 0, 0, 0, time.UTC)
+	return time.Date(y2, m2, d2+1, 9, 0, 0, 0, loc)
 }
 
-func (m *medicationService) CreateMedicationHistory(medications []models.Medication) {
-	for _, medication := range medications {
-		medicationHistory := models.NewMedicationHistory(medication)
-		_, err := m.medicationHistoryRepo.CreateMedicationHistory(medicationHistory)
-		if err != nil {
-			log.Printf("error creating medication history for %v for %v : %v", medication.ID, medication.NextDosageTime, err)
+func validateSchedule(timeInterval int, schedule *models.MedicationSchedule) *apiError.Error {
+	scheduleType := models.IntervalSchedule
+	if schedule != nil && schedule.Type != "" {
+		scheduleType = schedule.Type
+	}
+	switch scheduleType {
+	case models.IntervalSchedule:
+		if timeInterval <= 0 {
+			return apiError.New("time_interval is required for interval schedules", http.StatusBadRequest)
+		}
+	case models.TimesOfDaySchedule:
+		if len(schedule.TimesOfDay) == 0 {
+			return apiError.New("times_of_day is required for times of day schedules", http.StatusBadRequest)
 		}
 	}
+	return nil
+}
+
+// validateEscalationPolicy refuses a caregiver alert that would only fall due once the dose is already marked as missed,
+// missedDoseGraceMinutes being the missed window of policies that do not set their own
+func validateEscalationPolicy(policy *models.EscalationPolicy, missedDoseGraceMinutes int) *apiError.Error {
+	if policy == nil || policy.CaregiverAfterMinutes == 0 {
+		return nil
+	}
+	missedAfterMinutes := missedDoseGraceMinutes
+	if policy.MissedAfterMinutes > 0 {
+		missedAfterMinutes = policy.MissedAfterMinutes
+	}
+	if policy.CaregiverAfterMinutes >= missedAfterMinutes {
+		return apiError.New(fmt.Sprintf("caregiver_after_minutes must be less than the %d minutes after which the dose is missed", missedAfterMinutes), http.StatusBadRequest)
+	}
+	return nil
 }
 
 func (m *medicationService) FindMedication(medicationName string, userId int) (*[]models.Medication, error) {
 	var medicationResponses []models.MedicationResponse
 	medications, err := m.medicationRepo.FindMedication(medicationName, userId)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		return nil, apiError.ErrInternalServerError
 	}
 	for _, medication := range *medications {
 		medicationResponses = append(medicationResponses, *medication.MedicationToResponse())
 	}
 	return medications, nil
 }
+
+// ownOrDependent filters the doses of a dependent when dependentID is set, and the user's own doses otherwise,
+// so that the reports of a user do not mix in their dependents
+func ownOrDependent(dependentID *uint) *uint {
+	if dependentID == nil {
+		own := uint(0)
+		return &own
+	}
+	return dependentID
+}
@@ -5,9 +5,9 @@ import (
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
-	"log"
 	"net/http"
 	"testing"
 	"time"
@@ -117,6 +117,24 @@ func Test_CreateMedicationService(t *testing.T) {
 				repository.EXPECT().CreateMedication(dbInput).Times(0).Return(dbOutput, dbError)
 			},
 		},
+		{
+			name: "caregiver alert after the dose is missed",
+			input: models.MedicationRequest{
+				Name:                   "paracetamol",
+				Dosage:                 2,
+				TimeInterval:           8,
+				MedicationStartDate:    "2013-10-21T13:28:06.419Z",
+				Duration:               7,
+				MedicationPrescribedBy: "Dr Tolu",
+				MedicationStartTime:    "2013-10-21T13:28:06.419Z",
+				PurposeOfMedication:    "malaria treatment",
+				EscalationPolicy:       &models.EscalationPolicy{CaregiverAfterMinutes: 60, CaregiverEmail: "caregiver@example.com", MissedAfterMinutes: 60},
+			},
+			createMedError: errors.New("caregiver_after_minutes must be less than the 60 minutes after which the dose is missed", http.StatusBadRequest),
+			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput *models.Medication, dbOutput *models.Medication, dbError error) {
+				repository.EXPECT().CreateMedication(gomock.Any()).Times(0)
+			},
+		},
 		{
 			name: "error creating medication due server error",
 			input: models.MedicationRequest{
@@ -262,7 +280,7 @@ func Test_GetAllMedicationsService(t *testing.T) {
 			},
 			getAllMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedications(dbInput, gomock.Any()).Times(1).Return(dbOutput, dbError)
 			},
 		},
 		{
@@ -273,7 +291,7 @@ func Test_GetAllMedicationsService(t *testing.T) {
 			getAllMedResponse: nil,
 			getAllMedError:    errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedications(dbInput, gomock.Any()).Times(1).Return(dbOutput, dbError)
 			},
 		},
 	}
@@ -282,19 +300,109 @@ func Test_GetAllMedicationsService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationRepository, tc.dbInput, tc.dbOutput, tc.dbError)
-			medicationResponse, err := testMedicationService.GetAllMedications(1)
+			medicationResponse, pagination, err := testMedicationService.GetAllMedications(1, &models.MedicationListRequest{})
 
 			require.Equal(t, tc.getAllMedResponse, medicationResponse)
 			require.Equal(t, tc.getAllMedError, err)
+			if err == nil {
+				require.Equal(t, &models.Pagination{Limit: models.DefaultPageLimit}, pagination)
+			}
 		})
 	}
 
 }
 
+func Test_GetAllMedicationsPagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repository := mocks.NewMockMedicationRepository(ctrl)
+	service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+	repository.EXPECT().GetAllMedications(uint(1), gomock.Any()).Times(1).
+		DoAndReturn(func(userID uint, filter *models.MedicationFilter) ([]models.Medication, error) {
+			require.Equal(t, 2, filter.Limit)
+			require.Equal(t, models.SortAscending, filter.Order)
+			require.Equal(t, &models.MedicationCursor{ID: 3, Name: "amoxicillin"}, filter.After)
+			require.Equal(t, "active", filter.Status)
+			return []models.Medication{
+				{Model: models.Model{ID: 5}, Name: "flagyl"},
+				{Model: models.Model{ID: 4}, Name: "paracetamol"},
+			}, nil
+		})
+
+	request := &models.MedicationListRequest{
+		PageRequest: models.PageRequest{Cursor: models.EncodeCursor(models.MedicationCursor{ID: 3, Name: "amoxicillin"}), Limit: 1},
+		Status:      "active",
+		Sort:        "name",
+	}
+	medications, pagination, err := service.GetAllMedications(1, request)
+	require.Nil(t, err)
+	require.Len(t, medications, 1)
+	require.True(t, pagination.HasMore)
+	require.Equal(t, models.EncodeCursor(models.MedicationCursor{ID: 5, Name: "flagyl"}), pagination.NextCursor)
+
+	_, _, err = service.GetAllMedications(1, &models.MedicationListRequest{PageRequest: models.PageRequest{Cursor: "%%"}})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+}
+
+func Test_CreateMedicationForDependent(t *testing.T) {
+	dependentID := uint(4)
+	request := func() *models.MedicationRequest {
+		return &models.MedicationRequest{
+			Name:                   "amoxicillin",
+			Dosage:                 1,
+			TimeInterval:           8,
+			MedicationStartDate:    "2013-10-21T13:28:06.419Z",
+			Duration:               7,
+			MedicationPrescribedBy: "Dr Tolu",
+			MedicationStartTime:    "2013-10-21T13:28:06.419Z",
+			PurposeOfMedication:    "ear infection",
+			UserID:                 1,
+			DependentID:            &dependentID,
+		}
+	}
+
+	t.Run("medication created for the dependent case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		dependentRepository := mocks.NewMockDependentRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), dependentRepository, testConfig)
+
+		dependentRepository.EXPECT().FindDependent(dependentID, uint(1)).Times(1).Return(&models.Dependent{Model: models.Model{ID: dependentID}, OwnerID: 1}, nil)
+		repository.EXPECT().CreateMedication(gomock.Any()).Times(1).
+			DoAndReturn(func(medication *models.Medication) (*models.Medication, error) {
+				require.Equal(t, &dependentID, medication.DependentID)
+				return medication, nil
+			})
+
+		medication, err := service.CreateMedication(request())
+		require.Nil(t, err)
+		require.Equal(t, &dependentID, medication.DependentID)
+	})
+
+	t.Run("dependent of another user case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		dependentRepository := mocks.NewMockDependentRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), dependentRepository, testConfig)
+
+		dependentRepository.EXPECT().FindDependent(dependentID, uint(1)).Times(1).
+			Return(nil, fmt.Errorf("could not find dependent: %w", gorm.ErrRecordNotFound))
+		repository.EXPECT().CreateMedication(gomock.Any()).Times(0)
+
+		_, err := service.CreateMedication(request())
+		require.Equal(t, errDependentNotFound, err)
+	})
+}
+
 func Test_GetNextMedicationService(t *testing.T) {
 	// arrange
 	startDate, _ := time.Parse(time.RFC3339, "2013-10-21T13:28:06.419Z")
 	startTime, _ := time.Parse(time.RFC3339, "2013-10-21T13:28:06.419Z")
+	// the user's own medications are listed without a dependent
+	own := uint(0)
 
 	medication := &models.Medication{
 		Name:                   "paracetamol",
@@ -356,7 +464,7 @@ func Test_GetNextMedicationService(t *testing.T) {
 			},
 			getNextMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetNextMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetNextMedications(dbInput, &own).Times(1).Return(dbOutput, dbError)
 			},
 		},
 		{
@@ -367,7 +475,7 @@ func Test_GetNextMedicationService(t *testing.T) {
 			getNextMedResponse: nil,
 			getNextMedError:    errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetNextMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetNextMedications(dbInput, &own).Times(1).Return(dbOutput, dbError)
 			},
 		},
 	}
@@ -376,7 +484,7 @@ func Test_GetNextMedicationService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationRepository, tc.dbInput, tc.dbOutput, tc.dbError)
-			medicationResponse, err := testMedicationService.GetNextMedications(1)
+			medicationResponse, err := testMedicationService.GetNextMedications(1, nil)
 
 			require.Equal(t, tc.getNextMedResponse, medicationResponse)
 			require.Equal(t, tc.getNextMedError, err)
@@ -386,54 +494,83 @@ func Test_GetNextMedicationService(t *testing.T) {
 
 }
 
+func Test_GetNextMedicationsOfDependent(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	dependentID := uint(5)
+	mockMedicationRepository.EXPECT().GetNextMedications(uint(1), &dependentID).Times(1).
+		Return([]models.Medication{{Model: models.Model{ID: 3}, Name: "amoxicillin", UserID: 1, DependentID: &dependentID}}, nil)
+
+	medications, err := testMedicationService.GetNextMedications(1, &dependentID)
+	require.Nil(t, err)
+	require.Len(t, medications, 1)
+	require.Equal(t, &dependentID, medications[0].DependentID)
+}
+
 func Test_CronUpdateMedicationForNextTime(t *testing.T) {
-	startDate := time.Now().UTC()
+	startDate := time.Now().UTC().Truncate(time.Minute)
 	stopDate := startDate.AddDate(0, 0, 7)
 	startTime := startDate
 
+	medication := models.Medication{
+		Model:                  models.Model{ID: 1, UpdatedAt: startDate.Unix()},
+		Name:                   "paracetamol",
+		Dosage:                 2,
+		TimeInterval:           8,
+		MedicationStartDate:    startDate,
+		Duration:               7,
+		MedicationPrescribedBy: "Dr Tolu",
+		MedicationStopDate:     stopDate,
+		MedicationStartTime:    startTime,
+		NextDosageTime:         startTime,
+		PurposeOfMedication:    "malaria treatment",
+		UserID:                 1,
+	}
+	lastDoseMedication := medication
+	lastDoseMedication.MedicationStopDate = startTime.Add(time.Hour)
+
+	nextDosageTime := GetNextDosageTime(startTime.Add(time.Hour*8), startTime)
+	occurrence := models.DoseOccurrence{
+		Model:        models.Model{ID: 1},
+		MedicationID: medication.ID,
+		Medication:   medication,
+		UserID:       medication.UserID,
+		ScheduledAt:  startTime,
+		Dosage:       medication.Dosage,
+	}
+	lastOccurrence := occurrence
+	lastOccurrence.Medication = lastDoseMedication
+
 	testCases := []struct {
 		name          string
-		dbInput       *models.Medication
-		dbOutput      []models.Medication
-		dbError       error
-		buildStubs    func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error)
+		buildStubs    func(repository *mocks.MockMedicationRepository)
 		checkResponse func(t *testing.T, cronJobError error)
 	}{
 		{
-			name: "updating medication's next time successful case",
-			dbInput: &models.Medication{
-				Name:                   "paracetamol",
-				Dosage:                 2,
-				TimeInterval:           8,
-				MedicationStartDate:    startDate,
-				Duration:               7,
-				MedicationPrescribedBy: "Dr Tolu",
-				MedicationStopDate:     stopDate,
-				MedicationStartTime:    startTime,
-				NextDosageTime:         startTime,
-				PurposeOfMedication:    "malaria treatment",
-				UserID:                 1,
+			name: "scheduling dose occurrences successful case",
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return([]models.Medication{medication}, nil)
+				repository.EXPECT().ScheduleDoseOccurrences(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(m *models.Medication, occurrences []models.DoseOccurrence) error {
+						require.NotEmpty(t, occurrences)
+						require.True(t, startTime.Equal(occurrences[0].ScheduledAt))
+						require.True(t, nextDosageTime.Equal(occurrences[1].ScheduledAt))
+						require.True(t, m.LastScheduledDoseTime.Equal(occurrences[len(occurrences)-1].ScheduledAt))
+						return nil
+					})
+				repository.EXPECT().RecordDueDoseOccurrences(gomock.Any(), doseOccurrenceBatchSize).Times(1).Return(nil, nil)
 			},
-			dbOutput: []models.Medication{
-				{
-					Name:                   "paracetamol",
-					Dosage:                 2,
-					TimeInterval:           8,
-					MedicationStartDate:    startDate,
-					Duration:               7,
-					MedicationPrescribedBy: "Dr Tolu",
-					MedicationStopDate:     stopDate,
-					MedicationStartTime:    startTime,
-					NextDosageTime:         startTime,
-					PurposeOfMedication:    "malaria treatment",
-					UserID:                 1,
-				},
+			checkResponse: func(t *testing.T, cronJobError error) {
+				require.Nil(t, cronJobError)
 			},
-			dbError: nil,
-			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
-				repository.EXPECT().UpdateNextMedicationTime(dbInput, timeInput).Times(1).Return(nil)
+		},
+		{
+			name: "updating medication's next time successful case",
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return(nil, nil)
+				repository.EXPECT().RecordDueDoseOccurrences(gomock.Any(), doseOccurrenceBatchSize).Times(1).Return([]models.DoseOccurrence{occurrence}, nil)
+				repository.EXPECT().UpdateNextMedicationTime(&medication, nextDosageTime).Times(1).Return(nil)
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
 				require.Nil(t, cronJobError)
@@ -441,105 +578,40 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 		},
 		{
 			name: "updating medication's is done successful case",
-			dbInput: &models.Medication{
-				Name:                   "paracetamol",
-				Dosage:                 2,
-				TimeInterval:           8,
-				MedicationStartDate:    startDate,
-				Duration:               7,
-				MedicationPrescribedBy: "Dr Tolu",
-				MedicationStopDate:     stopDate.AddDate(0, 0, -7),
-				MedicationStartTime:    startTime,
-				NextDosageTime:         startTime,
-				PurposeOfMedication:    "malaria treatment",
-				UserID:                 1,
-			},
-			dbOutput: []models.Medication{
-				{
-					Name:                   "paracetamol",
-					Dosage:                 2,
-					TimeInterval:           8,
-					MedicationStartDate:    startDate,
-					Duration:               7,
-					MedicationPrescribedBy: "Dr Tolu",
-					MedicationStopDate:     stopDate.AddDate(0, 0, -7),
-					MedicationStartTime:    startTime,
-					NextDosageTime:         startTime,
-					PurposeOfMedication:    "malaria treatment",
-					UserID:                 1,
-				},
-			},
-			dbError: nil,
-			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
-				repository.EXPECT().UpdateMedicationDone(dbInput).Times(1).Return(nil)
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return(nil, nil)
+				repository.EXPECT().RecordDueDoseOccurrences(gomock.Any(), doseOccurrenceBatchSize).Times(1).Return([]models.DoseOccurrence{lastOccurrence}, nil)
+				repository.EXPECT().UpdateMedicationDone(&lastDoseMedication).Times(1).Return(nil)
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
-				log.Println(cronJobError)
 				require.Nil(t, cronJobError)
 			},
 		},
 		{
-			name: "error getting next medications to update case",
-			dbInput: &models.Medication{
-				Name:                   "paracetamol",
-				Dosage:                 2,
-				TimeInterval:           8,
-				MedicationStartDate:    startDate,
-				Duration:               7,
-				MedicationPrescribedBy: "Dr Tolu",
-				MedicationStopDate:     stopDate,
-				MedicationStartTime:    startTime,
-				NextDosageTime:         startTime,
-				PurposeOfMedication:    "malaria treatment",
-				UserID:                 1,
-			},
-			dbOutput: nil,
-			dbError:  fmt.Errorf("could not get next medication: %v", gorm.ErrInvalidDB),
-			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
+			name: "error getting medications to schedule case",
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return(nil, fmt.Errorf("could not get medications to schedule: %v", gorm.ErrInvalidDB))
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
-				log.Println(cronJobError)
-				require.EqualError(t, cronJobError, fmt.Sprint("could not get next medications while running update next dosage cron job"))
+				require.EqualError(t, cronJobError, fmt.Sprint("could not get medications to schedule while running update next dosage cron job"))
 			},
 		},
 		{
-			name: "error updating medication's next time case",
-			dbInput: &models.Medication{
-				Name:                   "paracetamol",
-				Dosage:                 2,
-				TimeInterval:           8,
-				MedicationStartDate:    startDate,
-				Duration:               7,
-				MedicationPrescribedBy: "Dr Tolu",
-				MedicationStopDate:     stopDate,
-				MedicationStartTime:    startTime,
-				NextDosageTime:         startTime,
-				PurposeOfMedication:    "malaria treatment",
-				UserID:                 1,
+			name: "error recording due doses case",
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return(nil, nil)
+				repository.EXPECT().RecordDueDoseOccurrences(gomock.Any(), doseOccurrenceBatchSize).Times(1).Return(nil, fmt.Errorf("could not record due dose occurrences: %v", gorm.ErrInvalidDB))
 			},
-			dbOutput: []models.Medication{
-				{
-					Name:                   "paracetamol",
-					Dosage:                 2,
-					TimeInterval:           8,
-					MedicationStartDate:    startDate,
-					Duration:               7,
-					MedicationPrescribedBy: "Dr Tolu",
-					MedicationStopDate:     stopDate,
-					MedicationStartTime:    startTime,
-					NextDosageTime:         startTime,
-					PurposeOfMedication:    "malaria treatment",
-					UserID:                 1,
-				},
+			checkResponse: func(t *testing.T, cronJobError error) {
+				require.EqualError(t, cronJobError, fmt.Sprint("could not record due doses while running update next dosage cron job"))
 			},
-			dbError: nil,
-			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
-				repository.EXPECT().UpdateNextMedicationTime(dbInput, timeInput).Times(1).Return(fmt.Errorf("could not update medication: %v", gorm.ErrInvalidDB))
+		},
+		{
+			name: "error updating medication's next time case",
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return(nil, nil)
+				repository.EXPECT().RecordDueDoseOccurrences(gomock.Any(), doseOccurrenceBatchSize).Times(1).Return([]models.DoseOccurrence{occurrence}, nil)
+				repository.EXPECT().UpdateNextMedicationTime(&medication, nextDosageTime).Times(1).Return(fmt.Errorf("could not update medication: %v", gorm.ErrInvalidDB))
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
 				require.EqualError(t, cronJobError, fmt.Sprint("could not update next medication time while running update next dosage cron job"))
@@ -547,39 +619,10 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 		},
 		{
 			name: "error updating medication's is done fail case",
-			dbInput: &models.Medication{
-				Name:                   "paracetamol",
-				Dosage:                 2,
-				TimeInterval:           8,
-				MedicationStartDate:    startDate,
-				Duration:               7,
-				MedicationPrescribedBy: "Dr Tolu",
-				MedicationStopDate:     stopDate.AddDate(0, 0, -7),
-				MedicationStartTime:    startTime,
-				NextDosageTime:         startTime,
-				PurposeOfMedication:    "malaria treatment",
-				UserID:                 1,
-			},
-			dbOutput: []models.Medication{
-				{
-					Name:                   "paracetamol",
-					Dosage:                 2,
-					TimeInterval:           8,
-					MedicationStartDate:    startDate,
-					Duration:               7,
-					MedicationPrescribedBy: "Dr Tolu",
-					MedicationStopDate:     stopDate.AddDate(0, 0, -7),
-					MedicationStartTime:    startTime,
-					NextDosageTime:         startTime,
-					PurposeOfMedication:    "malaria treatment",
-					UserID:                 1,
-				},
-			},
-			dbError: nil,
-			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
-				repository.EXPECT().UpdateMedicationDone(dbInput).Times(1).Return(fmt.Errorf("could not update medication: %v", gorm.ErrInvalidDB))
+			buildStubs: func(repository *mocks.MockMedicationRepository) {
+				repository.EXPECT().GetMedicationsToSchedule(gomock.Any()).Times(1).Return(nil, nil)
+				repository.EXPECT().RecordDueDoseOccurrences(gomock.Any(), doseOccurrenceBatchSize).Times(1).Return([]models.DoseOccurrence{lastOccurrence}, nil)
+				repository.EXPECT().UpdateMedicationDone(&lastDoseMedication).Times(1).Return(fmt.Errorf("could not update medication: %v", gorm.ErrInvalidDB))
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
 				require.EqualError(t, cronJobError, fmt.Sprint("could not update is medication done while running update next dosage cron job"))
@@ -590,10 +633,8 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 	defer teardown()
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			timeSumation := tc.dbInput.NextDosageTime.Add(time.Hour * time.Duration(tc.dbInput.TimeInterval))
-			nextDosageTime := GetNextDosageTime(timeSumation, tc.dbInput.NextDosageTime)
-			tc.buildStubs(mockMedicationRepository, mockMedicationHistoryRepository, tc.dbInput, nextDosageTime, tc.dbOutput, tc.dbError)
-			err := testMedicationService.CronUpdateMedicationForNextTime()
+			tc.buildStubs(mockMedicationRepository)
+			_, err := testMedicationService.CronUpdateMedicationForNextTime()
 
 			tc.checkResponse(t, err)
 
@@ -678,6 +719,24 @@ func Test_UpdateMedicationService(t *testing.T) {
 				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID).Times(0).Return(dbError)
 			},
 		},
+		{
+			name: "caregiver alert after the grace period",
+			input: models.UpdateMedicationRequest{
+				Name:                   "paracetamol",
+				Dosage:                 2,
+				TimeInterval:           8,
+				MedicationStartDate:    "2013-10-21T13:28:06.419Z",
+				Duration:               7,
+				MedicationPrescribedBy: "Dr Tolu",
+				MedicationStartTime:    "2013-10-21T13:28:06.419Z",
+				PurposeOfMedication:    "malaria treatment",
+				EscalationPolicy:       &models.EscalationPolicy{CaregiverAfterMinutes: 180, CaregiverEmail: "caregiver@example.com"},
+			},
+			updateMedResponseError: errors.New("caregiver_after_minutes must be less than the 120 minutes after which the dose is missed", http.StatusBadRequest),
+			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput *models.Medication, medicationID uint, userID uint, dbError error) {
+				repository.EXPECT().UpdateMedication(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
 		{
 			name: "error updating medication due server error",
 			input: models.UpdateMedicationRequest{
@@ -720,3 +779,163 @@ func Test_UpdateMedicationService(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetNextDosageTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	lagos, err := time.LoadLocation("Africa/Lagos")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		t1       time.Time
+		t2       time.Time
+		expected time.Time
+	}{
+		{
+			name:     "next dose on the same day",
+			t1:       time.Date(2022, 8, 9, 20, 30, 45, 0, lagos),
+			t2:       time.Date(2022, 8, 9, 12, 30, 45, 0, lagos),
+			expected: time.Date(2022, 8, 9, 20, 30, 0, 0, lagos),
+		},
+		{
+			name:     "next dose moves to 9am of the following local day",
+			t1:       time.Date(2022, 8, 9, 23, 30, 0, 0, time.UTC),
+			t2:       time.Date(2022, 8, 9, 15, 30, 0, 0, lagos),
+			expected: time.Date(2022, 8, 10, 9, 0, 0, 0, lagos),
+		},
+		{
+			name:     "next dose across a month boundary",
+			t1:       time.Date(2022, 9, 1, 2, 0, 0, 0, lagos),
+			t2:       time.Date(2022, 8, 31, 18, 0, 0, 0, lagos),
+			expected: time.Date(2022, 9, 1, 9, 0, 0, 0, lagos),
+		},
+		{
+			name:     "9am dose keeps its wall clock time when DST starts",
+			t1:       time.Date(2022, 3, 12, 20, 0, 0, 0, newYork).Add(time.Hour * 8),
+			t2:       time.Date(2022, 3, 12, 20, 0, 0, 0, newYork),
+			expected: time.Date(2022, 3, 13, 9, 0, 0, 0, newYork),
+		},
+		{
+			name:     "interval is added in absolute hours when DST ends",
+			t1:       time.Date(2022, 11, 6, 0, 30, 0, 0, newYork).Add(time.Hour * 4),
+			t2:       time.Date(2022, 11, 6, 0, 30, 0, 0, newYork),
+			expected: time.Date(2022, 11, 6, 3, 30, 0, 0, newYork),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nextDosageTime := GetNextDosageTime(tc.t1, tc.t2)
+			require.True(t, tc.expected.Equal(nextDosageTime), "expected %v, got %v", tc.expected, nextDosageTime)
+			require.Equal(t, tc.expected.Location(), nextDosageTime.Location())
+		})
+	}
+}
+
+func Test_DeleteMedication(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dbError     error
+		expectedErr *errors.Error
+	}{
+		{name: "medication deleted case"},
+		{name: "medication not found case", dbError: fmt.Errorf("could not delete medication: %w", gorm.ErrRecordNotFound), expectedErr: errMedicationNotFound},
+		{name: "internal server error case", dbError: gorm.ErrInvalidDB, expectedErr: errors.ErrInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockMedicationRepository(ctrl)
+			service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+			repository.EXPECT().DeleteMedication(uint(2), uint(1)).Times(1).Return(tc.dbError)
+			require.Equal(t, tc.expectedErr, service.DeleteMedication(2, 1))
+		})
+	}
+}
+
+func Test_PauseAndResumeMedication(t *testing.T) {
+	startTime := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	pausedAt := time.Now().Add(-24 * time.Hour)
+	newMedication := func() *models.Medication {
+		return &models.Medication{
+			Model:               models.Model{ID: 2},
+			UserID:              1,
+			TimeInterval:        8,
+			MedicationStartTime: startTime,
+			MedicationStopDate:  startTime.AddDate(0, 0, 7),
+		}
+	}
+
+	t.Run("pause case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+		repository.EXPECT().GetMedicationDetail(uint(2), uint(1)).Times(1).Return(newMedication(), nil)
+		repository.EXPECT().PauseMedication(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+		medication, err := service.PauseMedication(2, 1)
+		require.Nil(t, err)
+		require.NotEmpty(t, medication.PausedAt)
+	})
+
+	t.Run("pause paused medication case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+		medication := newMedication()
+		medication.PausedAt = &pausedAt
+		repository.EXPECT().GetMedicationDetail(uint(2), uint(1)).Times(1).Return(medication, nil)
+		_, err := service.PauseMedication(2, 1)
+		require.Equal(t, http.StatusConflict, err.Status)
+	})
+
+	t.Run("resume case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+		medication := newMedication()
+		medication.PausedAt = &pausedAt
+		repository.EXPECT().GetMedicationDetail(uint(2), uint(1)).Times(1).Return(medication, nil)
+		repository.EXPECT().ResumeMedication(gomock.Any()).Times(1).
+			DoAndReturn(func(medication *models.Medication) error {
+				require.Nil(t, medication.PausedAt)
+				// the course is extended by the day it was paused
+				require.WithinDuration(t, startTime.AddDate(0, 0, 8), medication.MedicationStopDate, time.Minute)
+				require.False(t, medication.NextDosageTime.Before(time.Now().Add(-time.Minute)))
+				require.True(t, medication.NextDosageTime.Before(time.Now().Add(8*time.Hour)))
+				return nil
+			})
+		_, err := service.ResumeMedication(2, 1)
+		require.Nil(t, err)
+	})
+
+	t.Run("resume medication that is not paused case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+		repository.EXPECT().GetMedicationDetail(uint(2), uint(1)).Times(1).Return(newMedication(), nil)
+		_, err := service.ResumeMedication(2, 1)
+		require.Equal(t, http.StatusConflict, err.Status)
+	})
+
+	t.Run("resume unknown medication case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		repository := mocks.NewMockMedicationRepository(ctrl)
+		service := NewMedicationService(repository, mocks.NewMockMedicationHistoryRepository(ctrl), mocks.NewMockDependentRepository(ctrl), testConfig)
+
+		repository.EXPECT().GetMedicationDetail(uint(2), uint(1)).Times(1).Return(nil, fmt.Errorf("could not get medication: %w", gorm.ErrRecordNotFound))
+		_, err := service.ResumeMedication(2, 1)
+		require.Equal(t, errMedicationNotFound, err)
+	})
+}
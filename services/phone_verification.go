@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/phone_verification_mock.go -package=mocks github.com/decagonhq/meddle-api/services PhoneVerificationService
+
+const (
+	// phoneCodeValidity is how long a texted code can be entered
+	phoneCodeValidity = 10 * time.Minute
+	// phoneCodeMaxAttempts is how many codes can be entered for a texted code before a new one is needed
+	phoneCodeMaxAttempts = 5
+	// phoneCodeSendLimit is how many codes a user can have texted in phoneCodeSendWindow
+	phoneCodeSendLimit  = 5
+	phoneCodeSendWindow = time.Hour
+)
+
+var (
+	errPhoneAlreadyVerified = apiError.New("phone number already verified", http.StatusConflict)
+	errPhoneCodeExpired     = apiError.New("verification code expired, request a new one", http.StatusBadRequest)
+	errInvalidPhoneCode     = apiError.New("invalid verification code", http.StatusBadRequest)
+)
+
+// PhoneVerificationService texts users a code that proves their phone number is theirs
+type PhoneVerificationService interface {
+	SendPhoneVerification(user *models.User) (*models.PhoneVerificationResponse, *apiError.Error)
+	VerifyPhone(user *models.User, request *models.VerifyPhoneRequest) *apiError.Error
+	PurgeExpiredVerifications() (int, error)
+}
+
+type phoneVerificationService struct {
+	Config       *config.Config
+	phoneRepo    db.PhoneRepository
+	securityRepo db.SecurityRepository
+	sms          SMSSender
+}
+
+// NewPhoneVerificationService instantiates a PhoneVerificationService
+func NewPhoneVerificationService(phoneRepo db.PhoneRepository, securityRepo db.SecurityRepository, sms SMSSender, conf *config.Config) PhoneVerificationService {
+	return &phoneVerificationService{
+		Config:       conf,
+		phoneRepo:    phoneRepo,
+		securityRepo: securityRepo,
+		sms:          sms,
+	}
+}
+
+// generatePhoneCode returns a random 6 digit code
+func generatePhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashPhoneCode binds the code to the verification it was sent for
+func hashPhoneCode(userID uint, phoneNumber, code string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", userID, phoneNumber, code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// SendPhoneVerification texts the user a new code for their phone number, the code sent before stops working
+func (p *phoneVerificationService) SendPhoneVerification(user *models.User) (*models.PhoneVerificationResponse, *apiError.Error) {
+	if user.PhoneNumber == "" {
+		return nil, apiError.New("add a phone number to your profile first", http.StatusBadRequest)
+	}
+	if user.IsPhoneVerified() {
+		return nil, errPhoneAlreadyVerified
+	}
+
+	rateLimit, err := p.securityRepo.HitRateLimit(fmt.Sprintf("phone-code:%d", user.ID), phoneCodeSendWindow)
+	if err != nil {
+		log.Printf("error hitting phone code rate limit of user %v: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if rateLimit.Hits > phoneCodeSendLimit {
+		return nil, apiError.New("too many verification codes requested, try again later", http.StatusTooManyRequests)
+	}
+
+	code, err := generatePhoneCode()
+	if err != nil {
+		log.Printf("error generating phone code: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	verification := &models.PhoneVerification{
+		UserID:      user.ID,
+		PhoneNumber: user.PhoneNumber,
+		CodeHash:    hashPhoneCode(user.ID, user.PhoneNumber, code),
+		ExpiresAt:   time.Now().Add(phoneCodeValidity).Unix(),
+	}
+	if err := p.phoneRepo.CreatePhoneVerification(verification); err != nil {
+		log.Printf("error saving phone verification of user %v: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	message := fmt.Sprintf("Your Meddle verification code is %s. It expires in %d minutes.", code, int(phoneCodeValidity.Minutes()))
+	if err := p.sms.SendSMS(user.PhoneNumber, message); err != nil {
+		log.Printf("error texting phone code to user %v: %v", user.ID, err)
+		return nil, apiError.New("verification code could not be sent", http.StatusServiceUnavailable)
+	}
+	return verification.ToResponse(), nil
+}
+
+// VerifyPhone checks the code the user entered. Every code entered counts, wrong or not, so that a code
+// can only be guessed a few times.
+func (p *phoneVerificationService) VerifyPhone(user *models.User, request *models.VerifyPhoneRequest) *apiError.Error {
+	if user.IsPhoneVerified() {
+		return errPhoneAlreadyVerified
+	}
+	verification, err := p.phoneRepo.FindPhoneVerification(user.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("request a verification code first", http.StatusBadRequest)
+		}
+		log.Printf("error finding phone verification of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	if verification.ExpiresAt < time.Now().Unix() || verification.PhoneNumber != user.PhoneNumber {
+		return errPhoneCodeExpired
+	}
+
+	if err := p.phoneRepo.UsePhoneVerificationAttempt(verification.ID, phoneCodeMaxAttempts); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("too many wrong codes, request a new one", http.StatusTooManyRequests)
+		}
+		log.Printf("error using phone verification attempt of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	codeHash := hashPhoneCode(user.ID, verification.PhoneNumber, request.Code)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(verification.CodeHash)) != 1 {
+		return errInvalidPhoneCode
+	}
+
+	if err := p.phoneRepo.VerifyPhone(verification); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errPhoneCodeExpired
+		}
+		log.Printf("error verifying phone of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	event := &models.SecurityEvent{UserID: user.ID, Type: models.SecurityEventPhoneVerified}
+	if err := p.securityRepo.CreateSecurityEvent(event); err != nil {
+		log.Printf("error recording %s event of user %v: %v", event.Type, user.ID, err)
+	}
+	return nil
+}
+
+// PurgeExpiredVerifications deletes the verifications whose code can not be entered anymore
+func (p *phoneVerificationService) PurgeExpiredVerifications() (int, error) {
+	purged, err := p.phoneRepo.PurgePhoneVerifications(time.Now().Unix())
+	return int(purged), err
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type phoneMocks struct {
+	phoneRepo    *mocks.MockPhoneRepository
+	securityRepo *mocks.MockSecurityRepository
+	sms          *mocks.MockSMSSender
+}
+
+func newTestPhoneVerificationService(ctrl *gomock.Controller) (PhoneVerificationService, *phoneMocks) {
+	m := &phoneMocks{
+		phoneRepo:    mocks.NewMockPhoneRepository(ctrl),
+		securityRepo: mocks.NewMockSecurityRepository(ctrl),
+		sms:          mocks.NewMockSMSSender(ctrl),
+	}
+	return NewPhoneVerificationService(m.phoneRepo, m.securityRepo, m.sms, testConfig), m
+}
+
+func Test_SendPhoneVerification(t *testing.T) {
+	user := &models.User{Model: models.Model{ID: 4}, PhoneNumber: "+2348163608141"}
+	verifiedAt := time.Now()
+	verified := &models.User{Model: models.Model{ID: 4}, PhoneNumber: "+2348163608141", PhoneVerifiedAt: &verifiedAt}
+
+	testCases := []struct {
+		name        string
+		user        *models.User
+		buildStubs  func(m *phoneMocks)
+		expectedErr *apiError.Error
+	}{
+		{
+			name: "code sent case",
+			user: user,
+			buildStubs: func(m *phoneMocks) {
+				var sentHash string
+				m.securityRepo.EXPECT().HitRateLimit("phone-code:4", time.Hour).Times(1).
+					Return(&models.RateLimit{Hits: 1, WindowStart: time.Now()}, nil)
+				m.phoneRepo.EXPECT().CreatePhoneVerification(gomock.Any()).Times(1).
+					DoAndReturn(func(verification *models.PhoneVerification) error {
+						require.Equal(t, user.ID, verification.UserID)
+						require.Equal(t, user.PhoneNumber, verification.PhoneNumber)
+						require.Zero(t, verification.Attempts)
+						require.WithinDuration(t, time.Now().Add(10*time.Minute), time.Unix(verification.ExpiresAt, 0), time.Minute)
+						sentHash = verification.CodeHash
+						return nil
+					})
+				m.sms.EXPECT().SendSMS(user.PhoneNumber, gomock.Any()).Times(1).
+					DoAndReturn(func(phoneNumber, message string) error {
+						code := regexp.MustCompile(`\d{6}`).FindString(message)
+						require.Equal(t, sentHash, hashPhoneCode(user.ID, phoneNumber, code))
+						return nil
+					})
+			},
+		},
+		{
+			name: "already verified case",
+			user: verified,
+			buildStubs: func(m *phoneMocks) {
+				m.securityRepo.EXPECT().HitRateLimit(gomock.Any(), gomock.Any()).Times(0)
+				m.sms.EXPECT().SendSMS(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedErr: errPhoneAlreadyVerified,
+		},
+		{
+			name: "rate limited case",
+			user: user,
+			buildStubs: func(m *phoneMocks) {
+				m.securityRepo.EXPECT().HitRateLimit("phone-code:4", time.Hour).Times(1).
+					Return(&models.RateLimit{Hits: 6, WindowStart: time.Now()}, nil)
+				m.phoneRepo.EXPECT().CreatePhoneVerification(gomock.Any()).Times(0)
+				m.sms.EXPECT().SendSMS(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedErr: apiError.New("too many verification codes requested, try again later", http.StatusTooManyRequests),
+		},
+		{
+			name: "sms provider down case",
+			user: user,
+			buildStubs: func(m *phoneMocks) {
+				m.securityRepo.EXPECT().HitRateLimit("phone-code:4", time.Hour).Times(1).
+					Return(&models.RateLimit{Hits: 1, WindowStart: time.Now()}, nil)
+				m.phoneRepo.EXPECT().CreatePhoneVerification(gomock.Any()).Times(1).Return(nil)
+				m.sms.EXPECT().SendSMS(gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("gateway timeout"))
+			},
+			expectedErr: apiError.New("verification code could not be sent", http.StatusServiceUnavailable),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service, m := newTestPhoneVerificationService(ctrl)
+			tc.buildStubs(m)
+
+			verification, err := service.SendPhoneVerification(tc.user)
+			require.Equal(t, tc.expectedErr, err)
+			if tc.expectedErr == nil {
+				require.Equal(t, tc.user.PhoneNumber, verification.PhoneNumber)
+			}
+		})
+	}
+}
+
+func Test_VerifyPhone(t *testing.T) {
+	user := &models.User{Model: models.Model{ID: 4}, PhoneNumber: "+2348163608141"}
+	verification := &models.PhoneVerification{
+		Model:       models.Model{ID: 9},
+		UserID:      user.ID,
+		PhoneNumber: user.PhoneNumber,
+		CodeHash:    hashPhoneCode(user.ID, user.PhoneNumber, "123456"),
+		ExpiresAt:   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	expired := *verification
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	otherNumber := *verification
+	otherNumber.PhoneNumber = "+2348163608142"
+
+	testCases := []struct {
+		name        string
+		code        string
+		buildStubs  func(m *phoneMocks)
+		expectedErr *apiError.Error
+	}{
+		{
+			name: "phone verified case",
+			code: "123456",
+			buildStubs: func(m *phoneMocks) {
+				m.phoneRepo.EXPECT().FindPhoneVerification(user.ID).Times(1).Return(verification, nil)
+				m.phoneRepo.EXPECT().UsePhoneVerificationAttempt(uint(9), 5).Times(1).Return(nil)
+				m.phoneRepo.EXPECT().VerifyPhone(verification).Times(1).Return(nil)
+				m.securityRepo.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).
+					DoAndReturn(func(event *models.SecurityEvent) error {
+						require.Equal(t, models.SecurityEventPhoneVerified, event.Type)
+						return nil
+					})
+			},
+		},
+		{
+			name: "wrong code case",
+			code: "654321",
+			buildStubs: func(m *phoneMocks) {
+				m.phoneRepo.EXPECT().FindPhoneVerification(user.ID).Times(1).Return(verification, nil)
+				m.phoneRepo.EXPECT().UsePhoneVerificationAttempt(uint(9), 5).Times(1).Return(nil)
+				m.phoneRepo.EXPECT().VerifyPhone(gomock.Any()).Times(0)
+			},
+			expectedErr: errInvalidPhoneCode,
+		},
+		{
+			name: "too many attempts case",
+			code: "123456",
+			buildStubs: func(m *phoneMocks) {
+				m.phoneRepo.EXPECT().FindPhoneVerification(user.ID).Times(1).Return(verification, nil)
+				m.phoneRepo.EXPECT().UsePhoneVerificationAttempt(uint(9), 5).Times(1).Return(gorm.ErrRecordNotFound)
+				m.phoneRepo.EXPECT().VerifyPhone(gomock.Any()).Times(0)
+			},
+			expectedErr: apiError.New("too many wrong codes, request a new one", http.StatusTooManyRequests),
+		},
+		{
+			name: "expired code case",
+			code: "123456",
+			buildStubs: func(m *phoneMocks) {
+				m.phoneRepo.EXPECT().FindPhoneVerification(user.ID).Times(1).Return(&expired, nil)
+				m.phoneRepo.EXPECT().UsePhoneVerificationAttempt(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedErr: errPhoneCodeExpired,
+		},
+		{
+			name: "phone number changed case",
+			code: "123456",
+			buildStubs: func(m *phoneMocks) {
+				m.phoneRepo.EXPECT().FindPhoneVerification(user.ID).Times(1).Return(&otherNumber, nil)
+				m.phoneRepo.EXPECT().UsePhoneVerificationAttempt(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedErr: errPhoneCodeExpired,
+		},
+		{
+			name: "no code requested case",
+			code: "123456",
+			buildStubs: func(m *phoneMocks) {
+				m.phoneRepo.EXPECT().FindPhoneVerification(user.ID).Times(1).Return(nil, gorm.ErrRecordNotFound)
+			},
+			expectedErr: apiError.New("request a verification code first", http.StatusBadRequest),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service, m := newTestPhoneVerificationService(ctrl)
+			tc.buildStubs(m)
+
+			err := service.VerifyPhone(user, &models.VerifyPhoneRequest{Code: tc.code})
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_PurgeExpiredVerifications(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, m := newTestPhoneVerificationService(ctrl)
+	m.phoneRepo.EXPECT().PurgePhoneVerifications(gomock.Any()).Times(1).
+		DoAndReturn(func(before int64) (int64, error) {
+			require.InDelta(t, time.Now().Unix(), before, 5)
+			return 2, nil
+		})
+
+	purged, err := service.PurgeExpiredVerifications()
+	require.NoError(t, err)
+	require.Equal(t, 2, purged)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+)
+
+// UpdateUserProfile applies the non-empty fields of the request to the user's profile.
+// A new email address is only stored as pending and replaces the current one once it is verified,
+// a new phone number has to be verified again. The medications of the user move along to a new timezone.
+func (a *authService) UpdateUserProfile(user *models.User, request *models.UpdateUserRequest) (*models.ProfileResponse, *apiError.Error) {
+	if errs := models.ValidateStruct(request); len(errs) > 0 {
+		return nil, apiError.New(validationErrorMessage(errs), http.StatusBadRequest)
+	}
+
+	if request.Name != "" {
+		user.Name = request.Name
+	}
+	if request.PhoneNumber != "" && request.PhoneNumber != user.PhoneNumber {
+		if err := a.authRepo.IsPhoneExist(request.PhoneNumber); err != nil {
+			return nil, apiError.New("phone already exist", http.StatusBadRequest)
+		}
+		user.PhoneNumber = request.PhoneNumber
+		user.PhoneVerifiedAt = nil
+	}
+	if request.Timezone != "" {
+		user.Timezone = request.Timezone
+	}
+	if request.AvatarURL != "" {
+		user.AvatarURL = request.AvatarURL
+	}
+	if preferences := request.Preferences; preferences != nil {
+		// SMS reminders are only turned on for numbers known to be the user's, when the config asks so
+		enablingSMS := preferences.SMSNotifications != nil && *preferences.SMSNotifications && !user.Preferences.SMSNotifications
+		if enablingSMS && a.Config.RequireVerifiedPhoneForSMS && !user.IsPhoneVerified() {
+			return nil, apiError.New("verify your phone number before turning on sms reminders", http.StatusBadRequest)
+		}
+		if preferences.PushNotifications != nil {
+			user.Preferences.PushNotifications = *preferences.PushNotifications
+		}
+		if preferences.EmailNotifications != nil {
+			user.Preferences.EmailNotifications = *preferences.EmailNotifications
+		}
+		if preferences.SMSNotifications != nil {
+			user.Preferences.SMSNotifications = *preferences.SMSNotifications
+		}
+		if preferences.Language != nil {
+			user.Preferences.Language = *preferences.Language
+		}
+	}
+
+	emailChanged := request.Email != "" && request.Email != user.Email
+	if emailChanged {
+		if err := a.authRepo.IsEmailExist(request.Email); err != nil {
+			return nil, apiError.New("email already exist", http.StatusBadRequest)
+		}
+		user.PendingEmail = request.Email
+		user.VerificationSentAt = time.Now().Unix()
+	}
+
+	var timezoneChange *models.TimezoneChange
+	if request.Timezone != "" {
+		medications, err := a.medicationRepo.GetMedicationsOutsideTimezone(user.ID, user.Timezone)
+		if err != nil {
+			log.Printf("error getting medications of user %v to change timezone: %v", user.ID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		timezoneChange = &models.TimezoneChange{Medications: medications, From: time.Now()}
+		moveToTimezone(medications, user.Timezone, timezoneChange.From)
+	}
+
+	// the link is sent before the change is saved, so that a change is never saved without one. A link sent for
+	// a change that then fails to save does nothing, verifying only works for the pending email of the user.
+	if emailChanged {
+		if err := a.sendVerifyEmail(user.PendingEmail); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.authRepo.UpdateUser(user, timezoneChange); err != nil {
+		log.Printf("error updating user profile: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return user.ToProfileResponse(), nil
+}
+
+func validationErrorMessage(errs []error) string {
+	var sb strings.Builder
+	for _, err := range errs {
+		sb.WriteString(err.Error())
+	}
+	return strings.TrimSuffix(sb.String(), "; ")
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_UpdateUserProfileService(t *testing.T) {
+	newUser := func() *models.User {
+		return &models.User{
+			Model:         models.Model{ID: 1},
+			Name:          "name",
+			Email:         "email@gmail.com",
+			PhoneNumber:   "+2348163608141",
+			IsEmailActive: true,
+			Preferences:   models.UserPreferences{PushNotifications: true, EmailNotifications: true, Language: "en"},
+		}
+	}
+	off, on, french := false, true, "fr"
+
+	testCases := []struct {
+		name          string
+		verifiedPhone bool
+		request       models.UpdateUserRequest
+		buildStubs    func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer)
+		checkProfile  func(t *testing.T, profile *models.ProfileResponse)
+		expectedError *errors.Error
+	}{
+		{
+			name: "profile updated successfully",
+			request: models.UpdateUserRequest{
+				Name:        "  new name ",
+				Timezone:    "Europe/London",
+				Preferences: &models.UpdatePreferencesRequest{PushNotifications: &off, Language: &french},
+			},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				medicationRepo.EXPECT().GetMedicationsOutsideTimezone(uint(1), "Europe/London").Times(1).Return(nil, nil)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkProfile: func(t *testing.T, profile *models.ProfileResponse) {
+				require.Equal(t, "new name", profile.Name)
+				require.Equal(t, "Europe/London", profile.Timezone)
+				// preferences left out of the request are kept
+				require.Equal(t, models.UserPreferences{EmailNotifications: true, Language: "fr"}, profile.Preferences)
+			},
+		},
+		{
+			name:    "medications move along to the new timezone",
+			request: models.UpdateUserRequest{Timezone: "America/New_York"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				now := time.Now()
+				pausedAt := now.Add(-time.Hour)
+				schedule := models.MedicationSchedule{Type: models.TimesOfDaySchedule, TimesOfDay: []string{"09:00"}}
+				active := models.Medication{Model: models.Model{ID: 1}, UserID: 1, Timezone: "UTC", Schedule: schedule,
+					MedicationStartTime: now.AddDate(0, 0, -2), MedicationStopDate: now.AddDate(0, 0, 10), NextDosageTime: now.Add(time.Hour)}
+				paused := active
+				paused.ID, paused.PausedAt = 2, &pausedAt
+
+				medicationRepo.EXPECT().GetMedicationsOutsideTimezone(uint(1), "America/New_York").Times(1).
+					Return([]models.Medication{active, paused}, nil)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(user *models.User, timezoneChange *models.TimezoneChange) error {
+						require.Equal(t, "America/New_York", user.Timezone)
+						require.WithinDuration(t, now, timezoneChange.From, time.Minute)
+						require.Len(t, timezoneChange.Medications, 2)
+						for _, medication := range timezoneChange.Medications {
+							require.Equal(t, "America/New_York", medication.Timezone)
+						}
+						// paused courses work out their next dose when they are resumed
+						require.Equal(t, paused.NextDosageTime, timezoneChange.Medications[1].NextDosageTime)
+						next := timezoneChange.Medications[0].NextDosageTime.In(timezoneChange.Medications[0].Location())
+						require.True(t, next.After(now))
+						require.Equal(t, "09:00", next.Format("15:04"))
+						return nil
+					})
+			},
+		},
+		{
+			name:    "error getting medications to move to the new timezone",
+			request: models.UpdateUserRequest{Timezone: "America/New_York"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				medicationRepo.EXPECT().GetMedicationsOutsideTimezone(uint(1), "America/New_York").Times(1).Return(nil, gorm.ErrInvalidDB)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.ErrInternalServerError,
+		},
+		{
+			name:    "invalid timezone",
+			request: models.UpdateUserRequest{Timezone: "Mars/Olympus"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("Key: 'UpdateUserRequest.Timezone' Error:Field validation for 'Timezone' failed on the 'timezone' tag", http.StatusBadRequest),
+		},
+		{
+			name:    "phone number already in use",
+			request: models.UpdateUserRequest{PhoneNumber: "+2348163608142"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().IsPhoneExist("+2348163608142").Times(1).Return(gorm.ErrInvalidData)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("phone already exist", http.StatusBadRequest),
+		},
+		{
+			name:    "email change requires verification",
+			request: models.UpdateUserRequest{Email: "new@gmail.com"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().IsEmailExist("new@gmail.com").Times(1).Return(nil)
+				gomock.InOrder(
+					mailer.EXPECT().SendMail("new@gmail.com", gomock.Any(), gomock.Any(), "emailverification", gomock.Any()).Times(1).Return(nil),
+					repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).Return(nil),
+				)
+			},
+			checkProfile: func(t *testing.T, profile *models.ProfileResponse) {
+				require.Equal(t, "email@gmail.com", profile.Email)
+				require.Equal(t, "new@gmail.com", profile.PendingEmail)
+			},
+		},
+		{
+			name:    "email change not saved when the verification email fails",
+			request: models.UpdateUserRequest{Email: "new@gmail.com"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().IsEmailExist("new@gmail.com").Times(1).Return(nil)
+				mailer.EXPECT().SendMail("new@gmail.com", gomock.Any(), gomock.Any(), "emailverification", gomock.Any()).Times(1).Return(gorm.ErrInvalidData)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("Internal server error", http.StatusInternalServerError),
+		},
+		{
+			name:    "email another user is changing to",
+			request: models.UpdateUserRequest{Email: "new@gmail.com"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().IsEmailExist("new@gmail.com").Times(1).Return(gorm.ErrInvalidData)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+				mailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("email already exist", http.StatusBadRequest),
+		},
+		{
+			name:    "sms reminders need a verified phone number",
+			request: models.UpdateUserRequest{Preferences: &models.UpdatePreferencesRequest{SMSNotifications: &on}},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("verify your phone number before turning on sms reminders", http.StatusBadRequest),
+		},
+		{
+			name:          "sms reminders turned on",
+			verifiedPhone: true,
+			request:       models.UpdateUserRequest{Preferences: &models.UpdatePreferencesRequest{SMSNotifications: &on}},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+			},
+			checkProfile: func(t *testing.T, profile *models.ProfileResponse) {
+				require.True(t, profile.PhoneVerified)
+				require.True(t, profile.Preferences.SMSNotifications)
+				require.True(t, profile.Preferences.PushNotifications)
+			},
+		},
+		{
+			name:          "new phone number has to be verified again",
+			verifiedPhone: true,
+			request:       models.UpdateUserRequest{PhoneNumber: "+2348163608142"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().IsPhoneExist("+2348163608142").Times(1).Return(nil)
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(user *models.User, timezoneChange *models.TimezoneChange) error {
+						require.Nil(t, user.PhoneVerifiedAt)
+						return nil
+					})
+			},
+			checkProfile: func(t *testing.T, profile *models.ProfileResponse) {
+				require.Equal(t, "+2348163608142", profile.PhoneNumber)
+				require.False(t, profile.PhoneVerified)
+			},
+		},
+		{
+			name:    "database error",
+			request: models.UpdateUserRequest{Name: "new name"},
+			buildStubs: func(repository *mocks.MockAuthRepository, medicationRepo *mocks.MockMedicationRepository, mailer *mocks.MockMailer) {
+				repository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).Return(gorm.ErrInvalidDB)
+			},
+			expectedError: errors.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockAuthRepository(ctrl)
+			mailer := mocks.NewMockMailer(ctrl)
+			medicationRepo := mocks.NewMockMedicationRepository(ctrl)
+			authService := NewAuthService(repository, mocks.NewMockSecurityRepository(ctrl), medicationRepo, testConfig, mailer, mocks.NewMockPushNotifier(ctrl))
+			tc.buildStubs(repository, medicationRepo, mailer)
+
+			user := newUser()
+			if tc.verifiedPhone {
+				verifiedAt := time.Now()
+				user.PhoneVerifiedAt = &verifiedAt
+			}
+			profile, err := authService.UpdateUserProfile(user, &tc.request)
+			require.Equal(t, tc.expectedError, err)
+			if tc.checkProfile != nil {
+				tc.checkProfile(t, profile)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+)
+
+// pushSendAttempts is how many times a device is tried when its sends keep failing transiently
+const pushSendAttempts = 3
+
+// pushRetryBackoff is the wait before the first retry, it doubles after every attempt
+var pushRetryBackoff = 2 * time.Second
+
+// deliverPushNotification sends the payload through the transport, retrying the devices that failed transiently with
+// exponential backoff. Every attempt is recorded, and the devices whose token turned out invalid are pruned.
+// It returns the final outcome for every device.
+func (fcm *notificationService) deliverPushNotification(tokens []string, payload *models.PushPayload) []models.PushDelivery {
+	var outcomes []models.PushDelivery
+	var invalidTokens []string
+	pending := tokens
+	backoff := pushRetryBackoff
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		deliveries := fcm.transport.Send(pending, payload)
+		pending = nil
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			delivery.Attempt = attempt
+			delivery.Category = payload.Category
+			delivery.Title = payload.Title
+
+			switch {
+			case delivery.Status == models.PushUnavailable && attempt < pushSendAttempts:
+				pending = append(pending, delivery.Token)
+				continue
+			case delivery.Status == models.PushInvalidToken:
+				invalidTokens = append(invalidTokens, delivery.Token)
+			}
+			outcomes = append(outcomes, *delivery)
+		}
+
+		err := fcm.notificationRepo.CreatePushDeliveries(deliveries)
+		if err != nil {
+			log.Printf("error recording push deliveries: %v", err)
+		}
+
+		if len(pending) > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	if len(invalidTokens) > 0 {
+		err := fcm.notificationRepo.DeleteDeviceTokens(invalidTokens)
+		if err != nil {
+			log.Printf("error pruning invalid device tokens: %v", err)
+		}
+	}
+	return outcomes
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// pushTransportFunc adapts a function to the PushTransport interface
+type pushTransportFunc func(tokens []string, payload *models.PushPayload) []models.PushDelivery
+
+func (f pushTransportFunc) Send(tokens []string, payload *models.PushPayload) []models.PushDelivery {
+	return f(tokens, payload)
+}
+
+func Test_DeliverPushNotification(t *testing.T) {
+	pushRetryBackoff = 0
+	payload := &models.PushPayload{Title: "Time to take paracetamol", Category: models.NextMedicationCategory}
+
+	testCases := []struct {
+		name string
+		// outcomes holds the status returned for each token on every attempt
+		outcomes         map[string][]models.PushDeliveryStatus
+		expectedAttempts int
+		expected         map[string]models.PushDeliveryStatus
+		prunedTokens     []string
+	}{
+		{
+			name: "delivered, invalid and retried devices",
+			outcomes: map[string][]models.PushDeliveryStatus{
+				"phone":  {models.PushDelivered},
+				"old":    {models.PushInvalidToken},
+				"tablet": {models.PushUnavailable, models.PushDelivered},
+			},
+			expectedAttempts: 2,
+			expected: map[string]models.PushDeliveryStatus{
+				"phone":  models.PushDelivered,
+				"old":    models.PushInvalidToken,
+				"tablet": models.PushDelivered,
+			},
+			prunedTokens: []string{"old"},
+		},
+		{
+			name: "gives up after the last attempt",
+			outcomes: map[string][]models.PushDeliveryStatus{
+				"phone": {models.PushUnavailable, models.PushUnavailable, models.PushUnavailable},
+			},
+			expectedAttempts: pushSendAttempts,
+			expected: map[string]models.PushDeliveryStatus{
+				"phone": models.PushUnavailable,
+			},
+		},
+		{
+			name: "permanent failure is not retried",
+			outcomes: map[string][]models.PushDeliveryStatus{
+				"phone": {models.PushFailed},
+			},
+			expectedAttempts: 1,
+			expected: map[string]models.PushDeliveryStatus{
+				"phone": models.PushFailed,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			notificationRepo := mocks.NewMockNotificationRepository(ctrl)
+			var tokens []string
+			for token := range tc.outcomes {
+				tokens = append(tokens, token)
+			}
+			attempts := map[string]int{}
+			transport := pushTransportFunc(func(tokens []string, payload *models.PushPayload) []models.PushDelivery {
+				var deliveries []models.PushDelivery
+				for _, token := range tokens {
+					deliveries = append(deliveries, models.PushDelivery{Token: token, Status: tc.outcomes[token][attempts[token]]})
+					attempts[token]++
+				}
+				return deliveries
+			})
+			pushNotifier := &notificationService{Conf: testConfig, notificationRepo: notificationRepo, transport: transport}
+
+			notificationRepo.EXPECT().CreatePushDeliveries(gomock.Any()).Times(tc.expectedAttempts).Return(nil)
+			if tc.prunedTokens != nil {
+				notificationRepo.EXPECT().DeleteDeviceTokens(tc.prunedTokens).Times(1).Return(nil)
+			}
+
+			deliveries := pushNotifier.deliverPushNotification(tokens, payload)
+			require.Len(t, deliveries, len(tc.expected))
+			for _, delivery := range deliveries {
+				require.Equal(t, tc.expected[delivery.Token], delivery.Status)
+				require.Equal(t, attempts[delivery.Token], delivery.Attempt)
+				require.Equal(t, payload.Category, delivery.Category)
+			}
+		})
+	}
+}
+
+func Test_SendPushNotificationWithFakeTransport(t *testing.T) {
+	pushRetryBackoff = 0
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	notificationRepo := mocks.NewMockNotificationRepository(ctrl)
+	transport := NewFakeTransport("")
+	pushNotifier := NewPushNotifier(notificationRepo, mocks.NewMockAuthRepository(ctrl), testConfig, transport, mocks.NewMockSMSSender(ctrl))
+
+	notificationRepo.EXPECT().CreatePushDeliveries(gomock.Any()).Times(1).Return(nil)
+	notificationRepo.EXPECT().DeleteDeviceTokens([]string{"invalid-old-phone"}).Times(1).Return(nil)
+
+	payload := &models.PushPayload{Title: "Time to take paracetamol", Body: "paracetamol is due by 9:00AM"}
+	deliveries, err := pushNotifier.SendPushNotification([]string{"phone", "invalid-old-phone"}, payload)
+	require.Nil(t, err)
+	require.Len(t, deliveries, 2)
+
+	sent := transport.Sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "phone", sent[0].Token)
+	require.Equal(t, *payload, sent[0].Payload)
+}
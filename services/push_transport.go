@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/messaging"
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/models"
+	"google.golang.org/api/option"
+)
+
+const (
+	PushTransportFCM  = "fcm"
+	PushTransportFake = "fake"
+)
+
+// maxMulticastTokens is the number of devices FCM accepts in a single multicast message
+const maxMulticastTokens = 500
+
+// PushTransport delivers push notifications to devices
+type PushTransport interface {
+	// Send sends the payload to the given devices and reports the outcome for each of them, in order
+	Send(tokens []string, payload *models.PushPayload) []models.PushDelivery
+}
+
+// NewPushTransport returns the transport selected by the push_transport config, FCM by default
+func NewPushTransport(conf *config.Config) (PushTransport, error) {
+	switch conf.PushTransport {
+	case "", PushTransportFCM:
+		return NewFCMTransport(conf)
+	case PushTransportFake:
+		return NewFakeTransport(conf.FakePushFile), nil
+	default:
+		return nil, fmt.Errorf("unknown push transport %q", conf.PushTransport)
+	}
+}
+
+type fcmTransport struct {
+	client *messaging.Client
+}
+
+// NewFCMTransport instantiates a transport sending through Firebase Cloud Messaging
+func NewFCMTransport(conf *config.Config) (PushTransport, error) {
+	firebaseApp, err := firebase.NewApp(context.Background(), nil, option.WithCredentialsFile(conf.GoogleApplicationCredentials))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	client, err := firebaseApp.Messaging(context.Background())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &fcmTransport{client: client}, nil
+}
+
+// Send sends the payload to the devices through FCM multicast messages
+func (f *fcmTransport) Send(tokens []string, payload *models.PushPayload) []models.PushDelivery {
+	deliveries := make([]models.PushDelivery, 0, len(tokens))
+	for start := 0; start < len(tokens); start += maxMulticastTokens {
+		end := start + maxMulticastTokens
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		batch := tokens[start:end]
+
+		res, err := f.client.SendMulticast(context.Background(), newMulticastMessage(batch, payload))
+		if err != nil {
+			// the whole request failed, so every device shares the outcome
+			for _, token := range batch {
+				deliveries = append(deliveries, models.PushDelivery{Token: token, Status: fcmDeliveryStatus(err), Error: err.Error()})
+			}
+			continue
+		}
+		for i, r := range res.Responses {
+			delivery := models.PushDelivery{Token: batch[i], Status: fcmDeliveryStatus(r.Error), MessageID: r.MessageID}
+			if r.Error != nil {
+				delivery.Error = r.Error.Error()
+			}
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+// fcmDeliveryStatus classifies an FCM send error. Invalid argument errors are not treated as invalid
+// tokens, they are also returned for a malformed payload and would otherwise prune every device.
+func fcmDeliveryStatus(err error) models.PushDeliveryStatus {
+	switch {
+	case err == nil:
+		return models.PushDelivered
+	case messaging.IsRegistrationTokenNotRegistered(err), messaging.IsMismatchedCredential(err):
+		return models.PushInvalidToken
+	case messaging.IsServerUnavailable(err), messaging.IsInternal(err), messaging.IsMessageRateExceeded(err), messaging.IsUnknown(err):
+		return models.PushUnavailable
+	default:
+		return models.PushFailed
+	}
+}
+
+func newMulticastMessage(tokens []string, payload *models.PushPayload) *messaging.MulticastMessage {
+	return &messaging.MulticastMessage{
+		APNS: &messaging.APNSConfig{
+			Headers: map[string]string{
+				"apns-priority": "10",
+			},
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Category: string(payload.Category),
+					Alert: &messaging.ApsAlert{
+						Title: payload.Title,
+						Body:  payload.Body,
+					},
+					Sound:            "default",
+					ContentAvailable: true,
+				},
+			},
+			FCMOptions: nil,
+		},
+		Data: payload.Data,
+		Notification: &messaging.Notification{
+			Title:    payload.Title,
+			Body:     payload.Body,
+			ImageURL: "https://imgur.com/a/hmt6Mx2",
+		},
+
+		Tokens: tokens,
+	}
+}
+
+// FakeNotification is a notification delivered by the fake transport
+type FakeNotification struct {
+	Token   string             `json:"token"`
+	Payload models.PushPayload `json:"payload"`
+	SentAt  time.Time          `json:"sent_at"`
+}
+
+// FakeTransport keeps the notifications it is asked to send instead of sending them, for local development
+// and integration tests. Tokens starting with "invalid" are reported as invalid and those starting with
+// "unavailable" as transient failures, so that pruning and retries can be exercised too.
+type FakeTransport struct {
+	mu   sync.Mutex
+	sent []FakeNotification
+	// file, when set, gets every delivered notification appended as a JSON line
+	file string
+}
+
+// NewFakeTransport instantiates a fake transport, appending delivered notifications to file when it is not empty
+func NewFakeTransport(file string) *FakeTransport {
+	return &FakeTransport{file: file}
+}
+
+func (f *FakeTransport) Send(tokens []string, payload *models.PushPayload) []models.PushDelivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	deliveries := make([]models.PushDelivery, 0, len(tokens))
+	for _, token := range tokens {
+		switch {
+		case strings.HasPrefix(token, "invalid"):
+			deliveries = append(deliveries, models.PushDelivery{Token: token, Status: models.PushInvalidToken, Error: "fake invalid token"})
+		case strings.HasPrefix(token, "unavailable"):
+			deliveries = append(deliveries, models.PushDelivery{Token: token, Status: models.PushUnavailable, Error: "fake unavailable"})
+		default:
+			notification := FakeNotification{Token: token, Payload: *payload, SentAt: time.Now()}
+			f.sent = append(f.sent, notification)
+			f.appendToFile(notification)
+			deliveries = append(deliveries, models.PushDelivery{
+				Token:     token,
+				Status:    models.PushDelivered,
+				MessageID: fmt.Sprintf("fake-%d", len(f.sent)),
+			})
+		}
+	}
+	return deliveries
+}
+
+// Sent returns the notifications delivered so far
+func (f *FakeTransport) Sent() []FakeNotification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeNotification(nil), f.sent...)
+}
+
+func (f *FakeTransport) appendToFile(notification FakeNotification) {
+	if f.file == "" {
+		return
+	}
+	line, err := json.Marshal(notification)
+	if err != nil {
+		log.Printf("error encoding fake notification: %v", err)
+		return
+	}
+	file, err := os.OpenFile(f.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("error opening fake notification file: %v", err)
+		return
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		log.Printf("error writing fake notification: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"gorm.io/gorm"
+)
+
+// issueTokens starts a new session for the user on the client, and generates its access and refresh token pair
+func (a *authService) issueTokens(user *models.User, client models.ClientInfo) (*jwt.TokenPair, error) {
+	now := time.Now()
+	session := &models.Session{
+		UserID:     user.ID,
+		Device:     client.Device,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		LastUsedAt: now.Unix(),
+		ExpiresAt:  now.Add(jwt.RefreshTokenValidity).Unix(),
+	}
+	if err := a.authRepo.CreateSession(session); err != nil {
+		return nil, err
+	}
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", session.ID, a.Config.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	err = a.authRepo.CreateRefreshToken(newRefreshTokenRecord(user, tokenPair))
+	if err != nil {
+		return nil, err
+	}
+	return tokenPair, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Every refresh token can only be used once;
+// presenting one that was already rotated revokes its whole family, logging out whoever holds it.
+func (a *authService) RefreshToken(refreshToken string) (*models.TokenResponse, *apiError.Error) {
+	claims, err := jwt.ValidateAndGetClaims(refreshToken, a.Config.JWTSecret)
+	if err != nil {
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+	tokenType, _ := claims[jwt.TokenTypeClaim].(string)
+	tokenID, _ := claims["jti"].(string)
+	if tokenType != jwt.RefreshTokenType || tokenID == "" {
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+
+	storedToken, err := a.authRepo.FindRefreshToken(tokenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+		}
+		log.Printf("error finding refresh token: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if storedToken.RevokedAt != 0 {
+		return nil, a.revokeReusedRefreshToken(storedToken)
+	}
+
+	user, err := a.authRepo.FindUserByEmail(storedToken.Email)
+	if err != nil {
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+	if user.IsDisabled() {
+		return nil, apiError.ErrAccountDisabled
+	}
+	if storedToken.SessionID != 0 {
+		session, err := a.authRepo.FindSession(storedToken.SessionID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("error finding session: %v", err)
+			return nil, apiError.ErrInternalServerError
+		}
+		if session == nil || !session.IsActive(time.Now()) {
+			return nil, apiError.New("session expired, log in again", http.StatusUnauthorized)
+		}
+	}
+
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, storedToken.FamilyID, storedToken.SessionID, a.Config.JWTSecret)
+	if err != nil {
+		log.Printf("error generating token %s", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	err = a.authRepo.RotateRefreshToken(storedToken.TokenID, newRefreshTokenRecord(user, tokenPair))
+	if err != nil {
+		if errors.Is(err, db.ErrRefreshTokenReused) {
+			return nil, a.revokeReusedRefreshToken(storedToken)
+		}
+		log.Printf("error rotating refresh token: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if storedToken.SessionID != 0 {
+		if err := a.authRepo.ExtendSession(storedToken.SessionID, tokenPair.RefreshExpiresAt); err != nil {
+			log.Printf("error extending session %v: %v", storedToken.SessionID, err)
+		}
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+	}, nil
+}
+
+func (a *authService) revokeReusedRefreshToken(refreshToken *models.RefreshToken) *apiError.Error {
+	log.Printf("refresh token reuse detected for %s, revoking token family %s", refreshToken.Email, refreshToken.FamilyID)
+	if err := a.authRepo.RevokeRefreshTokenFamily(refreshToken.FamilyID); err != nil {
+		log.Printf("error revoking refresh token family: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	// the access tokens of the family go along with it
+	if refreshToken.SessionID != 0 {
+		err := a.authRepo.RevokeSession(refreshToken.UserID, refreshToken.SessionID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("error revoking session %v: %v", refreshToken.SessionID, err)
+			return apiError.ErrInternalServerError
+		}
+	}
+	return apiError.New("refresh token has already been used", http.StatusUnauthorized)
+}
+
+func newRefreshTokenRecord(user *models.User, tokenPair *jwt.TokenPair) *models.RefreshToken {
+	return &models.RefreshToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenID:   tokenPair.RefreshTokenID,
+		FamilyID:  tokenPair.FamilyID,
+		SessionID: tokenPair.SessionID,
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_RefreshTokenService(t *testing.T) {
+	user := &models.User{
+		Model: models.Model{ID: 1},
+		Name:  "name",
+		Email: "email@gmail.com",
+	}
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", 7, testConfig.JWTSecret)
+	require.NoError(t, err)
+	accessTokenOnly, err := jwt.GenerateTokenPair(user.Email, "", 7, testConfig.JWTSecret)
+	require.NoError(t, err)
+	session := &models.Session{Model: models.Model{ID: 7}, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	revokedSession := *session
+	revokedSession.RevokedAt = time.Now().Unix()
+
+	storedToken := models.RefreshToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenID:   tokenPair.RefreshTokenID,
+		FamilyID:  tokenPair.FamilyID,
+		SessionID: 7,
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	}
+	rotatedToken := storedToken
+	rotatedToken.RevokedAt = 1
+
+	testCases := []struct {
+		name          string
+		refreshToken  string
+		buildStubs    func(repository *mocks.MockAuthRepository)
+		expectedError *errors.Error
+	}{
+		{
+			name:         "refresh token rotated successfully",
+			refreshToken: tokenPair.RefreshToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindRefreshToken(storedToken.TokenID).Times(1).Return(&storedToken, nil)
+				repository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(session, nil)
+				repository.EXPECT().RotateRefreshToken(storedToken.TokenID, gomock.Any()).Times(1).
+					DoAndReturn(func(oldTokenID string, newToken *models.RefreshToken) error {
+						require.Equal(t, storedToken.FamilyID, newToken.FamilyID)
+						require.Equal(t, storedToken.SessionID, newToken.SessionID)
+						require.NotEqual(t, storedToken.TokenID, newToken.TokenID)
+						return nil
+					})
+				repository.EXPECT().ExtendSession(uint(7), gomock.Any()).Times(1).Return(nil)
+			},
+			expectedError: nil,
+		},
+		{
+			name:         "revoked session",
+			refreshToken: tokenPair.RefreshToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindRefreshToken(storedToken.TokenID).Times(1).Return(&storedToken, nil)
+				repository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(&revokedSession, nil)
+				repository.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("session expired, log in again", http.StatusUnauthorized),
+		},
+		{
+			name:         "access token presented as refresh token",
+			refreshToken: accessTokenOnly.AccessToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindRefreshToken(gomock.Any()).Times(0)
+			},
+			expectedError: errors.New("invalid refresh token", http.StatusUnauthorized),
+		},
+		{
+			name:         "unknown refresh token",
+			refreshToken: tokenPair.RefreshToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindRefreshToken(storedToken.TokenID).Times(1).Return(nil, gorm.ErrRecordNotFound)
+			},
+			expectedError: errors.New("invalid refresh token", http.StatusUnauthorized),
+		},
+		{
+			name:         "reused refresh token revokes the family",
+			refreshToken: tokenPair.RefreshToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindRefreshToken(storedToken.TokenID).Times(1).Return(&rotatedToken, nil)
+				repository.EXPECT().RevokeRefreshTokenFamily(storedToken.FamilyID).Times(1).Return(nil)
+				repository.EXPECT().RevokeSession(user.ID, uint(7)).Times(1).Return(nil)
+			},
+			expectedError: errors.New("refresh token has already been used", http.StatusUnauthorized),
+		},
+		{
+			name:         "concurrent rotation revokes the family",
+			refreshToken: tokenPair.RefreshToken,
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().FindRefreshToken(storedToken.TokenID).Times(1).Return(&storedToken, nil)
+				repository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+				repository.EXPECT().FindSession(uint(7)).Times(1).Return(session, nil)
+				repository.EXPECT().RotateRefreshToken(storedToken.TokenID, gomock.Any()).Times(1).Return(db.ErrRefreshTokenReused)
+				repository.EXPECT().RevokeRefreshTokenFamily(storedToken.FamilyID).Times(1).Return(nil)
+				repository.EXPECT().RevokeSession(user.ID, uint(7)).Times(1).Return(nil)
+			},
+			expectedError: errors.New("refresh token has already been used", http.StatusUnauthorized),
+		},
+	}
+
+	teardown := setup(t)
+	defer teardown()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockRepository)
+			tokens, err := testAuthService.RefreshToken(tc.refreshToken)
+			require.Equal(t, tc.expectedError, err)
+			if tc.expectedError == nil {
+				require.NotEmpty(t, tokens.AccessToken)
+				require.NotEqual(t, tc.refreshToken, tokens.RefreshToken)
+			}
+		})
+	}
+}
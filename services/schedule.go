@@ -0,0 +1,110 @@
+package services
+
+import (
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+)
+
+// FirstDosageTime returns the first dose of a newly created or edited medication.
+// The second return value is false when the medication has no scheduled dose at all,
+// which is always the case for as needed medications.
+func FirstDosageTime(medication *models.Medication, now time.Time) (time.Time, bool) {
+	startTime := medication.MedicationStartTime.In(medication.Location())
+	switch medication.ScheduleType() {
+	case models.AsNeededSchedule:
+		return time.Time{}, false
+	case models.TimesOfDaySchedule:
+		after := startTime.Add(-time.Nanosecond)
+		if now.After(after) {
+			after = now
+		}
+		return nextFixedDosageTime(medication, after)
+	default:
+		var firstDosageTime time.Time
+		if startTime.After(now) {
+			firstDosageTime = GetNextDosageTime(startTime, startTime)
+		} else {
+			firstDosageTime = GetNextDosageTime(startTime.Add(time.Hour*time.Duration(medication.TimeInterval)), startTime)
+		}
+		return skipToDoseDay(medication, firstDosageTime)
+	}
+}
+
+// NextDosageTime returns the dose that follows current. The second return value is false
+// once the course is over, that is when the next dose would not be before the stop date.
+func NextDosageTime(medication *models.Medication, current time.Time) (time.Time, bool) {
+	current = current.In(medication.Location())
+	switch medication.ScheduleType() {
+	case models.AsNeededSchedule:
+		return time.Time{}, false
+	case models.TimesOfDaySchedule:
+		return nextFixedDosageTime(medication, current)
+	default:
+		nextDosageTime := GetNextDosageTime(current.Add(time.Hour*time.Duration(medication.TimeInterval)), current)
+		return skipToDoseDay(medication, nextDosageTime)
+	}
+}
+
+// nextFixedDosageTime returns the first dose of a times of day schedule strictly after t
+func nextFixedDosageTime(medication *models.Medication, after time.Time) (time.Time, bool) {
+	day := after.In(medication.Location())
+	for !day.After(medication.MedicationStopDate) {
+		if medication.IsDoseDay(day) {
+			for _, doseTime := range medication.DoseTimesOn(day) {
+				if doseTime.After(after) {
+					return doseTime, doseTime.Before(medication.MedicationStopDate)
+				}
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+	}
+	return time.Time{}, false
+}
+
+// skipToDoseDay moves an interval dose that falls on a day without doses to 9:00 of the next dose day
+func skipToDoseDay(medication *models.Medication, dosageTime time.Time) (time.Time, bool) {
+	for !medication.IsDoseDay(dosageTime) {
+		if !dosageTime.Before(medication.MedicationStopDate) {
+			return dosageTime, false
+		}
+		dosageTime = time.Date(dosageTime.Year(), dosageTime.Month(), dosageTime.Day()+1, 9, 0, 0, 0, dosageTime.Location())
+	}
+	return dosageTime, dosageTime.Before(medication.MedicationStopDate)
+}
+
+// GenerateDoseOccurrences returns the doses of the medication due up to until that have not been generated yet,
+// and moves the medication's LastScheduledDoseTime and DosesScheduledUntil past them. Doses of a freshly created
+// or edited medication that were already due before it was saved are skipped.
+func GenerateDoseOccurrences(medication *models.Medication, until time.Time) []models.DoseOccurrence {
+	var nextDosageTime time.Time
+	var ok bool
+	if medication.LastScheduledDoseTime.IsZero() {
+		savedAt := time.Unix(medication.UpdatedAt, 0).Truncate(time.Minute)
+		nextDosageTime = medication.NextDosageTime
+		ok = !nextDosageTime.IsZero() && nextDosageTime.Before(medication.MedicationStopDate)
+		for ok && nextDosageTime.Before(savedAt) {
+			nextDosageTime, ok = NextDosageTime(medication, nextDosageTime)
+		}
+		if ok {
+			medication.NextDosageTime = nextDosageTime
+		}
+	} else {
+		nextDosageTime, ok = NextDosageTime(medication, medication.LastScheduledDoseTime)
+	}
+
+	var occurrences []models.DoseOccurrence
+	for ok && !nextDosageTime.After(until) {
+		occurrences = append(occurrences, models.NewDoseOccurrence(medication, nextDosageTime))
+		medication.LastScheduledDoseTime = nextDosageTime
+		nextDosageTime, ok = NextDosageTime(medication, nextDosageTime)
+	}
+
+	if ok {
+		medication.DosesScheduledUntil = until
+	} else {
+		// the whole course has been generated
+		medication.DosesScheduledUntil = medication.MedicationStopDate
+	}
+	return occurrences
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NextDosageTime(t *testing.T) {
+	lagos, err := time.LoadLocation("Africa/Lagos")
+	require.NoError(t, err)
+
+	// 2 January 2023 is a Monday
+	newMedication := func(schedule models.MedicationSchedule) *models.Medication {
+		return &models.Medication{
+			Dosage:              2,
+			TimeInterval:        8,
+			MedicationStartTime: time.Date(2023, 1, 2, 8, 0, 0, 0, lagos),
+			MedicationStopDate:  time.Date(2023, 1, 12, 8, 0, 0, 0, lagos),
+			Timezone:            "Africa/Lagos",
+			Schedule:            schedule,
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		medication *models.Medication
+		current    time.Time
+		expected   time.Time
+		ok         bool
+	}{
+		{
+			name:       "interval schedule",
+			medication: newMedication(models.MedicationSchedule{}),
+			current:    time.Date(2023, 1, 2, 8, 0, 0, 0, lagos),
+			expected:   time.Date(2023, 1, 2, 16, 0, 0, 0, lagos),
+			ok:         true,
+		},
+		{
+			name: "times of day schedule on the same day",
+			medication: newMedication(models.MedicationSchedule{
+				Type:       models.TimesOfDaySchedule,
+				TimesOfDay: []string{"20:00", "08:00"},
+			}),
+			current:  time.Date(2023, 1, 2, 8, 0, 0, 0, lagos),
+			expected: time.Date(2023, 1, 2, 20, 0, 0, 0, lagos),
+			ok:       true,
+		},
+		{
+			name: "times of day schedule on the next day",
+			medication: newMedication(models.MedicationSchedule{
+				Type:       models.TimesOfDaySchedule,
+				TimesOfDay: []string{"08:00", "20:00"},
+			}),
+			current:  time.Date(2023, 1, 2, 20, 0, 0, 0, lagos),
+			expected: time.Date(2023, 1, 3, 8, 0, 0, 0, lagos),
+			ok:       true,
+		},
+		{
+			name: "times of day schedule skips to the next weekday",
+			medication: newMedication(models.MedicationSchedule{
+				Type:       models.TimesOfDaySchedule,
+				TimesOfDay: []string{"08:00"},
+				Weekdays:   []time.Weekday{time.Monday, time.Friday},
+			}),
+			current:  time.Date(2023, 1, 2, 8, 0, 0, 0, lagos),
+			expected: time.Date(2023, 1, 6, 8, 0, 0, 0, lagos),
+			ok:       true,
+		},
+		{
+			name: "interval schedule every three days",
+			medication: newMedication(models.MedicationSchedule{
+				EveryNDays: 3,
+			}),
+			current:  time.Date(2023, 1, 2, 20, 0, 0, 0, lagos),
+			expected: time.Date(2023, 1, 5, 9, 0, 0, 0, lagos),
+			ok:       true,
+		},
+		{
+			name: "no dose after the stop date",
+			medication: newMedication(models.MedicationSchedule{
+				Type:       models.TimesOfDaySchedule,
+				TimesOfDay: []string{"09:00"},
+			}),
+			current: time.Date(2023, 1, 11, 9, 0, 0, 0, lagos),
+			ok:      false,
+		},
+		{
+			name: "as needed schedule",
+			medication: newMedication(models.MedicationSchedule{
+				Type: models.AsNeededSchedule,
+			}),
+			current: time.Date(2023, 1, 2, 8, 0, 0, 0, lagos),
+			ok:      false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nextDosageTime, ok := NextDosageTime(tc.medication, tc.current)
+			require.Equal(t, tc.ok, ok)
+			if tc.ok {
+				require.True(t, tc.expected.Equal(nextDosageTime), "expected %v, got %v", tc.expected, nextDosageTime)
+			}
+		})
+	}
+}
+
+func Test_DosageAt(t *testing.T) {
+	medication := &models.Medication{
+		Dosage:              4,
+		MedicationStartTime: time.Date(2023, 1, 2, 8, 0, 0, 0, time.UTC),
+		Timezone:            "UTC",
+		Schedule: models.MedicationSchedule{
+			TaperSteps: []models.TaperStep{{Days: 2, Dosage: 4}, {Days: 3, Dosage: 2}, {Days: 1, Dosage: 1}},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		at       time.Time
+		expected int
+	}{
+		{name: "first step", at: time.Date(2023, 1, 3, 20, 0, 0, 0, time.UTC), expected: 4},
+		{name: "second step", at: time.Date(2023, 1, 4, 8, 0, 0, 0, time.UTC), expected: 2},
+		{name: "last step", at: time.Date(2023, 1, 7, 8, 0, 0, 0, time.UTC), expected: 1},
+		{name: "after the last step", at: time.Date(2023, 1, 20, 8, 0, 0, 0, time.UTC), expected: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, medication.DosageAt(tc.at))
+		})
+	}
+}
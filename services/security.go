@@ -0,0 +1,58 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+)
+
+//go:generate mockgen -destination=../mocks/security_mock.go -package=mocks github.com/decagonhq/meddle-api/services SecurityService
+
+// SecurityService exposes the security events of accounts and looks after the shared rate limit counters
+type SecurityService interface {
+	GetSecurityEvents(userID uint) ([]models.SecurityEventResponse, *apiError.Error)
+	PurgeRateLimits() (int, error)
+}
+
+const (
+	securityEventsLimit = 50
+	// rateLimitRetention outlives the longest rate limit window
+	rateLimitRetention = 48 * time.Hour
+)
+
+type securityService struct {
+	Config       *config.Config
+	securityRepo db.SecurityRepository
+}
+
+// NewSecurityService instantiates a SecurityService
+func NewSecurityService(securityRepo db.SecurityRepository, conf *config.Config) SecurityService {
+	return &securityService{
+		Config:       conf,
+		securityRepo: securityRepo,
+	}
+}
+
+// GetSecurityEvents returns the latest security events of the user, most recent first
+func (s *securityService) GetSecurityEvents(userID uint) ([]models.SecurityEventResponse, *apiError.Error) {
+	events, err := s.securityRepo.GetSecurityEvents(userID, securityEventsLimit)
+	if err != nil {
+		log.Printf("error getting security events of user %v: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	responses := make([]models.SecurityEventResponse, 0, len(events))
+	for i := range events {
+		responses = append(responses, *events[i].SecurityEventToResponse())
+	}
+	return responses, nil
+}
+
+// PurgeRateLimits deletes the rate limit counters whose window is long over
+func (s *securityService) PurgeRateLimits() (int, error) {
+	purged, err := s.securityRepo.PurgeRateLimits(time.Now().Add(-rateLimitRetention))
+	return int(purged), err
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/session_mock.go -package=mocks github.com/decagonhq/meddle-api/services SessionService
+
+// SessionService lets users see the devices they are logged in on and log them out
+type SessionService interface {
+	GetSessions(user *models.User, currentSessionID uint) ([]models.SessionResponse, *apiError.Error)
+	RevokeSession(user *models.User, sessionID uint) *apiError.Error
+	RevokeAllSessions(user *models.User) *apiError.Error
+	PurgeRevokedTokens() (int, error)
+}
+
+type sessionService struct {
+	Config   *config.Config
+	authRepo db.AuthRepository
+}
+
+// NewSessionService instantiates a SessionService
+func NewSessionService(authRepo db.AuthRepository, conf *config.Config) SessionService {
+	return &sessionService{
+		Config:   conf,
+		authRepo: authRepo,
+	}
+}
+
+// GetSessions returns the active sessions of the user, marking the one the request was made with
+func (s *sessionService) GetSessions(user *models.User, currentSessionID uint) ([]models.SessionResponse, *apiError.Error) {
+	sessions, err := s.authRepo.GetActiveSessions(user.ID)
+	if err != nil {
+		log.Printf("error getting sessions of user %v: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	responses := make([]models.SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		responses = append(responses, *sessions[i].SessionToResponse(currentSessionID))
+	}
+	return responses, nil
+}
+
+// RevokeSession logs the user out of one of their sessions, its access and refresh tokens stop working right away
+func (s *sessionService) RevokeSession(user *models.User, sessionID uint) *apiError.Error {
+	if err := s.authRepo.RevokeSession(user.ID, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("session not found", http.StatusNotFound)
+		}
+		log.Printf("error revoking session %v of user %v: %v", sessionID, user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere, including the session the request was made with
+func (s *sessionService) RevokeAllSessions(user *models.User) *apiError.Error {
+	if err := s.authRepo.RevokeSessions(user.ID); err != nil {
+		log.Printf("error revoking sessions of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// PurgeRevokedTokens deletes the blacklist entries of tokens that expired since, they are refused anyway
+func (s *sessionService) PurgeRevokedTokens() (int, error) {
+	purged, err := s.authRepo.PurgeBlacklist(time.Now().Unix())
+	return int(purged), err
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_GetSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repository := mocks.NewMockAuthRepository(ctrl)
+	service := NewSessionService(repository, testConfig)
+
+	user := &models.User{Model: models.Model{ID: 1}}
+	repository.EXPECT().GetActiveSessions(user.ID).Times(1).Return([]models.Session{
+		{Model: models.Model{ID: 4}, Device: "Pixel 7"},
+		{Model: models.Model{ID: 2}, Device: "iPad"},
+	}, nil)
+
+	sessions, err := service.GetSessions(user, 2)
+	require.Nil(t, err)
+	require.Len(t, sessions, 2)
+	require.False(t, sessions[0].Current)
+	require.True(t, sessions[1].Current)
+}
+
+func Test_RevokeSession(t *testing.T) {
+	user := &models.User{Model: models.Model{ID: 1}}
+
+	testCases := []struct {
+		name        string
+		buildStubs  func(repository *mocks.MockAuthRepository)
+		expectedErr *apiError.Error
+	}{
+		{
+			name: "session revoked case",
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().RevokeSession(user.ID, uint(4)).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "session not found case",
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().RevokeSession(user.ID, uint(4)).Times(1).
+					Return(fmt.Errorf("could not revoke session: %w", gorm.ErrRecordNotFound))
+			},
+			expectedErr: apiError.New("session not found", http.StatusNotFound),
+		},
+		{
+			name: "internal server error case",
+			buildStubs: func(repository *mocks.MockAuthRepository) {
+				repository.EXPECT().RevokeSession(user.ID, uint(4)).Times(1).Return(gorm.ErrInvalidDB)
+			},
+			expectedErr: apiError.ErrInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repository := mocks.NewMockAuthRepository(ctrl)
+			tc.buildStubs(repository)
+
+			err := NewSessionService(repository, testConfig).RevokeSession(user, 4)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func Test_PurgeRevokedTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repository := mocks.NewMockAuthRepository(ctrl)
+	repository.EXPECT().PurgeBlacklist(gomock.Any()).Times(1).
+		DoAndReturn(func(before int64) (int64, error) {
+			require.InDelta(t, time.Now().Unix(), before, 5)
+			return 3, nil
+		})
+
+	purged, err := NewSessionService(repository, testConfig).PurgeRevokedTokens()
+	require.NoError(t, err)
+	require.Equal(t, 3, purged)
+}
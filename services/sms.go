@@ -0,0 +1,105 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+)
+
+//go:generate mockgen -destination=../mocks/sms_mock.go -package=mocks github.com/decagonhq/meddle-api/services SMSSender
+
+const (
+	SMSProviderHTTP    = "http"
+	SMSProviderConsole = "console"
+)
+
+// SMSSender sends text messages to phone numbers in E.164 format
+type SMSSender interface {
+	SendSMS(phoneNumber, message string) error
+}
+
+// NewSMSSender returns the sender selected by the sms_provider config, the console sender by default.
+// Production has to select a real provider, the console sender would drop every message.
+func NewSMSSender(conf *config.Config) (SMSSender, error) {
+	switch conf.SMSProvider {
+	case "", SMSProviderConsole:
+		if conf.Env == "prod" {
+			return nil, fmt.Errorf("the console sms provider can not be used in production, set an sms_provider")
+		}
+		return NewConsoleSMSSender(), nil
+	case SMSProviderHTTP:
+		return NewHTTPSMSSender(conf)
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", conf.SMSProvider)
+	}
+}
+
+// httpSMSSender posts every message as JSON to the endpoint of an SMS gateway
+type httpSMSSender struct {
+	url    string
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+// NewHTTPSMSSender instantiates a sender posting to the sms_provider_url
+func NewHTTPSMSSender(conf *config.Config) (SMSSender, error) {
+	if conf.SMSProviderURL == "" {
+		return nil, fmt.Errorf("the http sms provider needs an sms_provider_url")
+	}
+	return &httpSMSSender{
+		url:    conf.SMSProviderURL,
+		apiKey: conf.SMSProviderAPIKey,
+		from:   conf.SMSFrom,
+		client: &http.Client{Timeout: time.Second * 10},
+	}, nil
+}
+
+type smsMessage struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func (h *httpSMSSender) SendSMS(phoneNumber, message string) error {
+	body, err := json.Marshal(smsMessage{From: h.from, To: phoneNumber, Text: message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send sms: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("sms provider responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// ConsoleSMSSender drops text messages for local development, it only logs who they were for.
+// Messages carry verification codes, so their text is never logged.
+type ConsoleSMSSender struct{}
+
+// NewConsoleSMSSender instantiates a console sender
+func NewConsoleSMSSender() *ConsoleSMSSender {
+	return &ConsoleSMSSender{}
+}
+
+func (c *ConsoleSMSSender) SendSMS(phoneNumber, message string) error {
+	log.Printf("sms of %d characters to %s not sent, the console sms provider only logs them", len(message), phoneNumber)
+	return nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HTTPSMSSender(t *testing.T) {
+	var received smsMessage
+	status := http.StatusOK
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer provider.Close()
+
+	sender, err := NewSMSSender(&config.Config{SMSProvider: SMSProviderHTTP, SMSProviderURL: provider.URL, SMSProviderAPIKey: "key", SMSFrom: "Meddle"})
+	require.NoError(t, err)
+
+	require.NoError(t, sender.SendSMS("+2348163608141", "hello"))
+	require.Equal(t, smsMessage{From: "Meddle", To: "+2348163608141", Text: "hello"}, received)
+
+	status = http.StatusBadGateway
+	require.Error(t, sender.SendSMS("+2348163608141", "hello"))
+}
+
+func Test_NewSMSSender(t *testing.T) {
+	sender, err := NewSMSSender(&config.Config{})
+	require.NoError(t, err)
+	require.IsType(t, &ConsoleSMSSender{}, sender)
+	require.NoError(t, sender.SendSMS("+2348163608141", "hello"))
+
+	_, err = NewSMSSender(&config.Config{Env: "prod"})
+	require.Error(t, err)
+	_, err = NewSMSSender(&config.Config{Env: "prod", SMSProvider: SMSProviderConsole})
+	require.Error(t, err)
+	_, err = NewSMSSender(&config.Config{SMSProvider: SMSProviderHTTP})
+	require.Error(t, err)
+	_, err = NewSMSSender(&config.Config{SMSProvider: "pigeon"})
+	require.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCode(t *testing.T) {
+	// test vectors of RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	testCases := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "287082"},
+		{time: 1111111109, code: "081804"},
+		{time: 1234567890, code: "005924"},
+		{time: 20000000000, code: "353130"},
+	}
+	for _, tc := range testCases {
+		code, err := GenerateCode(secret, Step(time.Unix(tc.time, 0)))
+		require.NoError(t, err)
+		require.Equal(t, tc.code, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	code, err := GenerateCode(secret, Step(now))
+	require.NoError(t, err)
+	step, ok := Validate(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+
+	// a code typed in just after it rolled over is still accepted
+	_, ok = Validate(secret, code, now.Add(Period))
+	require.True(t, ok)
+
+	_, ok = Validate(secret, code, now.Add(3*Period))
+	require.False(t, ok)
+	_, ok = Validate(secret, "12345", now)
+	require.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("JBSWY3DPEHPK3PXP", "Meddle", "ada@example.com")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Meddle:ada@example.com?"))
+	require.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	require.Contains(t, uri, "issuer=Meddle")
+}
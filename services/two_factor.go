@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	apiError "github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/decagonhq/meddle-api/services/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	// twoFactorIssuer is the account name authenticator apps show above the codes
+	twoFactorIssuer = "Meddle"
+	// maxTwoFactorAttempts is how many wrong codes can be sent with a challenge before the login has to start over
+	maxTwoFactorAttempts = 3
+)
+
+var (
+	errTwoFactorEnabled    = apiError.New("two-factor authentication is already enabled", http.StatusConflict)
+	errTwoFactorNotEnabled = apiError.New("two-factor authentication is not enabled", http.StatusBadRequest)
+	errInvalidTwoFactor    = apiError.New("invalid two-factor code", http.StatusUnauthorized)
+	errInvalidChallenge    = apiError.New("invalid or expired challenge, log in again", http.StatusUnauthorized)
+)
+
+// recoveryCodeAlphabet leaves out characters that are easily mistaken for each other
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// generateRecoveryCode returns a random code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// hashRecoveryCode hashes a recovery code the way it is stored, ignoring case, dashes and spaces
+func hashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user. It only protects logins once a code of it is confirmed.
+func (a *authService) EnrollTwoFactor(user *models.User) (*models.TwoFactorEnrollResponse, *apiError.Error) {
+	if user.HasTwoFactor() {
+		return nil, errTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("error generating two-factor secret: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if err := a.securityRepo.SetTwoFactorSecret(user.ID, secret); err != nil {
+		log.Printf("error saving two-factor secret of user %v: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return &models.TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, twoFactorIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user sends a code of their enrolled secret,
+// and returns the recovery codes of the user
+func (a *authService) ConfirmTwoFactor(user *models.User, request *models.TwoFactorConfirmRequest) (*models.RecoveryCodesResponse, *apiError.Error) {
+	if user.HasTwoFactor() {
+		return nil, errTwoFactorEnabled
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, apiError.New("two-factor authentication was not set up", http.StatusBadRequest)
+	}
+	step, ok := totp.Validate(user.TwoFactorSecret, request.Code, time.Now())
+	if !ok {
+		return nil, apiError.New("invalid two-factor code", http.StatusBadRequest)
+	}
+
+	codes := make([]string, 0, models.RecoveryCodeCount)
+	hashes := make([]string, 0, models.RecoveryCodeCount)
+	for i := 0; i < models.RecoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			log.Printf("error generating recovery code: %v", err)
+			return nil, apiError.ErrInternalServerError
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	if err := a.securityRepo.EnableTwoFactor(user.ID, step, hashes); err != nil {
+		log.Printf("error enabling two-factor authentication of user %v: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	a.recordSecurityEvent(user, models.SecurityEventTwoFactorOn, models.ClientInfo{})
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor turns off two-factor authentication after checking the password or a recovery code of the user
+func (a *authService) DisableTwoFactor(user *models.User, request *models.TwoFactorDisableRequest) *apiError.Error {
+	if !user.HasTwoFactor() {
+		return errTwoFactorNotEnabled
+	}
+	if request.Password != "" {
+		if err := user.VerifyPassword(request.Password); err != nil {
+			return apiError.ErrInvalidPassword
+		}
+	} else if err := a.useRecoveryCode(user, request.RecoveryCode); err != nil {
+		return err
+	}
+
+	if err := a.securityRepo.DisableTwoFactor(user.ID); err != nil {
+		log.Printf("error disabling two-factor authentication of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	a.recordSecurityEvent(user, models.SecurityEventTwoFactorOff, models.ClientInfo{})
+	return nil
+}
+
+// LoginWithTwoFactor finishes the login started with a password, once the second factor is sent along with the challenge token
+func (a *authService) LoginWithTwoFactor(request *models.TwoFactorLoginRequest) (*models.LoginResponse, *apiError.Error) {
+	userID, err := jwt.ValidateTwoFactorChallengeToken(request.ChallengeToken, a.Config.JWTSecret)
+	if err != nil {
+		return nil, errInvalidChallenge
+	}
+	if err := a.authRepo.IsTokenInBlacklist(request.ChallengeToken); err != nil {
+		return nil, errInvalidChallenge
+	}
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidChallenge
+		}
+		log.Printf("error finding user %v: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if !user.HasTwoFactor() {
+		return nil, errInvalidChallenge
+	}
+	if err := checkSignIn(user, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// wrong codes count as wrong passwords, so that guessing them ends in a lockout
+	if request.Code != "" {
+		if err := a.useTwoFactorCode(user, request.Code); err != nil {
+			if err == errInvalidTwoFactor {
+				a.recordWrongTwoFactorCode(user, request)
+			}
+			return nil, err
+		}
+	} else if err := a.useRecoveryCode(user, request.RecoveryCode); err != nil {
+		if err.Status == http.StatusUnauthorized {
+			a.recordWrongTwoFactorCode(user, request)
+		}
+		return nil, err
+	}
+
+	if err := a.revokeTwoFactorChallenge(user, request.ChallengeToken); err != nil {
+		log.Printf("error blacklisting two-factor challenge: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	tokenPair, err := a.issueTokens(user, request.ClientInfo)
+	if err != nil {
+		log.Printf("error generating token %s", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	a.recordLogin(user, request.ClientInfo)
+
+	return user.LoginUserToDto(tokenPair.AccessToken, tokenPair.RefreshToken), nil
+}
+
+// recordWrongTwoFactorCode counts a wrong code as a failed login, and voids the challenge after maxTwoFactorAttempts of them
+func (a *authService) recordWrongTwoFactorCode(user *models.User, request *models.TwoFactorLoginRequest) {
+	a.recordFailedLogin(user, request.ClientInfo)
+
+	attempts, err := a.securityRepo.HitRateLimit(twoFactorChallengeKey(request.ChallengeToken), jwt.TwoFactorChallengeTokenValidity)
+	if err != nil {
+		// the challenge is voided rather than left open to guessing
+		log.Printf("error counting two-factor attempts of user %v: %v", user.ID, err)
+	} else if attempts.Hits < maxTwoFactorAttempts {
+		return
+	}
+	if err := a.revokeTwoFactorChallenge(user, request.ChallengeToken); err != nil {
+		log.Printf("error blacklisting two-factor challenge: %v", err)
+	}
+}
+
+func twoFactorChallengeKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "two-factor-challenge:" + hex.EncodeToString(sum[:])
+}
+
+// revokeTwoFactorChallenge stops the challenge from being used again
+func (a *authService) revokeTwoFactorChallenge(user *models.User, token string) error {
+	return a.authRepo.AddToBlackList(&models.BlackList{
+		Email:     user.Email,
+		Token:     token,
+		ExpiresAt: time.Now().Add(jwt.TwoFactorChallengeTokenValidity).Unix(),
+	})
+}
+
+// useTwoFactorCode checks a code of the authenticator of the user, every code can only be used once
+func (a *authService) useTwoFactorCode(user *models.User, code string) *apiError.Error {
+	step, ok := totp.Validate(user.TwoFactorSecret, code, time.Now())
+	if !ok || step <= user.TwoFactorLastStep {
+		return errInvalidTwoFactor
+	}
+	if err := a.securityRepo.UseTwoFactorStep(user.ID, step); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidTwoFactor
+		}
+		log.Printf("error using two-factor code of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+func (a *authService) useRecoveryCode(user *models.User, code string) *apiError.Error {
+	if err := a.securityRepo.UseRecoveryCode(user.ID, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("invalid recovery code", http.StatusUnauthorized)
+		}
+		log.Printf("error using recovery code of user %v: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// twoFactorChallenge is what a login of a user with two-factor authentication returns instead of tokens
+func (a *authService) twoFactorChallenge(user *models.User) (string, error) {
+	token, err := jwt.GenerateTwoFactorChallengeToken(user.ID, a.Config.JWTSecret)
+	if err != nil {
+		return "", fmt.Errorf("could not generate two-factor challenge: %v", err)
+	}
+	return token, nil
+}
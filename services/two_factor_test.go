@@ -0,0 +1,336 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/decagonhq/meddle-api/services/totp"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTwoFactorTestUser(t *testing.T) *models.User {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	enabledAt := time.Now().Add(-time.Hour)
+	user := newLoginTestUser(t)
+	user.TwoFactorSecret = secret
+	user.TwoFactorEnabledAt = &enabledAt
+	return user
+}
+
+func currentTwoFactorCode(t *testing.T, user *models.User) string {
+	code, err := totp.GenerateCode(user.TwoFactorSecret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	return code
+}
+
+func Test_HashRecoveryCode(t *testing.T) {
+	code, err := generateRecoveryCode()
+	require.NoError(t, err)
+	require.Len(t, code, 11)
+	require.Equal(t, hashRecoveryCode("abcde-fghjk"), hashRecoveryCode(" ABCDE fghjk"))
+	require.NotEqual(t, hashRecoveryCode("abcde-fghjk"), hashRecoveryCode("abcde-fghjm"))
+}
+
+func Test_LoginWithTwoFactorChallenge(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := newTwoFactorTestUser(t)
+	request := &models.LoginRequest{Email: user.Email, Password: "password"}
+
+	mockRepository.EXPECT().FindUserByEmail(user.Email).Times(1).Return(user, nil)
+	mockRepository.EXPECT().CreateRefreshToken(gomock.Any()).Times(0)
+	mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(0)
+
+	response, err := testAuthService.LoginUser(request)
+	require.Nil(t, err)
+	require.True(t, response.TwoFactorRequired)
+	require.Empty(t, response.AccessToken)
+	require.Empty(t, response.RefreshToken)
+
+	userID, errr := jwt.ValidateTwoFactorChallengeToken(response.ChallengeToken, testConfig.JWTSecret)
+	require.NoError(t, errr)
+	require.Equal(t, user.ID, userID)
+}
+
+func Test_LoginWithTwoFactor(t *testing.T) {
+	user := newTwoFactorTestUser(t)
+	challenge, err := jwt.GenerateTwoFactorChallengeToken(user.ID, testConfig.JWTSecret)
+	require.NoError(t, err)
+	tokenPair, err := jwt.GenerateTokenPair(user.Email, "", 0, testConfig.JWTSecret)
+	accessToken := tokenPair.AccessToken
+	require.NoError(t, err)
+	client := models.ClientInfo{IP: "10.0.0.1", UserAgent: "meddle-ios/2.0"}
+
+	testCases := []struct {
+		name        string
+		request     func() *models.TwoFactorLoginRequest
+		buildStubs  func()
+		expectedErr *errors.Error
+	}{
+		{
+			name: "code accepted case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: currentTwoFactorCode(t, user), ClientInfo: client}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(challenge).Times(1).Return(nil)
+				mockRepository.EXPECT().FindUserByID(user.ID).Times(1).Return(user, nil)
+				mockSecurityRepository.EXPECT().UseTwoFactorStep(user.ID, gomock.Any()).Times(1).Return(nil)
+				mockRepository.EXPECT().AddToBlackList(gomock.Any()).Times(1).
+					DoAndReturn(func(blacklist *models.BlackList) error {
+						require.Equal(t, challenge, blacklist.Token)
+						require.Greater(t, blacklist.ExpiresAt, time.Now().Unix())
+						return nil
+					})
+				mockRepository.EXPECT().CreateSession(gomock.Any()).Times(1).Return(nil)
+				mockRepository.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
+				mockSecurityRepository.EXPECT().HasLoggedInFrom(user.ID, client.UserAgent).Times(1).Return(true, nil)
+				mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "recovery code accepted case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: challenge, RecoveryCode: "ABCDE-FGHJK", ClientInfo: client}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(challenge).Times(1).Return(nil)
+				mockRepository.EXPECT().FindUserByID(user.ID).Times(1).Return(user, nil)
+				mockSecurityRepository.EXPECT().UseRecoveryCode(user.ID, hashRecoveryCode("abcdefghjk")).Times(1).Return(nil)
+				mockRepository.EXPECT().AddToBlackList(gomock.Any()).Times(1).Return(nil)
+				mockRepository.EXPECT().CreateSession(gomock.Any()).Times(1).Return(nil)
+				mockRepository.EXPECT().CreateRefreshToken(gomock.Any()).Times(1).Return(nil)
+				mockSecurityRepository.EXPECT().HasLoggedInFrom(user.ID, client.UserAgent).Times(1).Return(true, nil)
+				mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name: "replayed code case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: currentTwoFactorCode(t, user), ClientInfo: client}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(challenge).Times(1).Return(nil)
+				mockRepository.EXPECT().FindUserByID(user.ID).Times(1).Return(user, nil)
+				mockSecurityRepository.EXPECT().UseTwoFactorStep(user.ID, gomock.Any()).Times(1).
+					Return(fmt.Errorf("could not use two-factor code: %w", gorm.ErrRecordNotFound))
+				mockSecurityRepository.EXPECT().HitRateLimit(loginIPKey(client.IP), loginIPWindow).Times(1).Return(&models.RateLimit{}, nil)
+				mockSecurityRepository.EXPECT().RecordFailedLogin(user.ID, gomock.Any()).Times(1).Return(1, nil)
+				mockSecurityRepository.EXPECT().HitRateLimit(twoFactorChallengeKey(challenge), jwt.TwoFactorChallengeTokenValidity).Times(1).
+					Return(&models.RateLimit{Hits: 1}, nil)
+				mockRepository.EXPECT().CreateRefreshToken(gomock.Any()).Times(0)
+			},
+			expectedErr: errInvalidTwoFactor,
+		},
+		{
+			name: "wrong code case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: "000000", ClientInfo: client}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(challenge).Times(1).Return(nil)
+				mockRepository.EXPECT().FindUserByID(user.ID).Times(1).Return(user, nil)
+				mockSecurityRepository.EXPECT().UseTwoFactorStep(gomock.Any(), gomock.Any()).Times(0)
+				mockSecurityRepository.EXPECT().HitRateLimit(loginIPKey(client.IP), loginIPWindow).Times(1).Return(&models.RateLimit{}, nil)
+				mockSecurityRepository.EXPECT().RecordFailedLogin(user.ID, gomock.Any()).Times(1).Return(1, nil)
+				mockSecurityRepository.EXPECT().HitRateLimit(twoFactorChallengeKey(challenge), jwt.TwoFactorChallengeTokenValidity).Times(1).
+					Return(&models.RateLimit{Hits: 1}, nil)
+			},
+			expectedErr: errInvalidTwoFactor,
+		},
+		{
+			name: "challenge voided after too many wrong codes case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: challenge, RecoveryCode: "ABCDE-FGHJK", ClientInfo: client}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(challenge).Times(1).Return(nil)
+				mockRepository.EXPECT().FindUserByID(user.ID).Times(1).Return(user, nil)
+				mockSecurityRepository.EXPECT().UseRecoveryCode(user.ID, gomock.Any()).Times(1).Return(gorm.ErrRecordNotFound)
+				mockSecurityRepository.EXPECT().HitRateLimit(loginIPKey(client.IP), loginIPWindow).Times(1).Return(&models.RateLimit{}, nil)
+				mockSecurityRepository.EXPECT().RecordFailedLogin(user.ID, gomock.Any()).Times(1).Return(3, nil)
+				mockSecurityRepository.EXPECT().HitRateLimit(twoFactorChallengeKey(challenge), jwt.TwoFactorChallengeTokenValidity).Times(1).
+					Return(&models.RateLimit{Hits: maxTwoFactorAttempts}, nil)
+				mockRepository.EXPECT().AddToBlackList(gomock.Any()).Times(1).
+					DoAndReturn(func(blacklist *models.BlackList) error {
+						require.Equal(t, challenge, blacklist.Token)
+						return nil
+					})
+			},
+			expectedErr: errors.New("invalid recovery code", http.StatusUnauthorized),
+		},
+		{
+			name: "used challenge case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: challenge, Code: "000000"}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(challenge).Times(1).Return(errors.New("token expired", http.StatusUnauthorized))
+				mockRepository.EXPECT().FindUserByID(gomock.Any()).Times(0)
+			},
+			expectedErr: errInvalidChallenge,
+		},
+		{
+			name: "access token as challenge case",
+			request: func() *models.TwoFactorLoginRequest {
+				return &models.TwoFactorLoginRequest{ChallengeToken: accessToken, Code: "000000"}
+			},
+			buildStubs: func() {
+				mockRepository.EXPECT().IsTokenInBlacklist(gomock.Any()).Times(0)
+			},
+			expectedErr: errInvalidChallenge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs()
+
+			response, err := testAuthService.LoginWithTwoFactor(tc.request())
+			require.Equal(t, tc.expectedErr, err)
+			if tc.expectedErr == nil {
+				require.NotEmpty(t, response.AccessToken)
+				require.False(t, response.TwoFactorRequired)
+			}
+		})
+	}
+}
+
+func Test_TwoFactorGuessingEndsInLockout(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	// the repositories keep the failed logins of the user, like the database would
+	user := newTwoFactorTestUser(t)
+	mockRepository.EXPECT().FindUserByEmail(user.Email).AnyTimes().Return(user, nil)
+	mockRepository.EXPECT().FindUserByID(user.ID).AnyTimes().Return(user, nil)
+	mockRepository.EXPECT().IsTokenInBlacklist(gomock.Any()).AnyTimes().Return(nil)
+	mockRepository.EXPECT().AddToBlackList(gomock.Any()).AnyTimes().Return(nil)
+	mockSecurityRepository.EXPECT().HitRateLimit(gomock.Any(), gomock.Any()).AnyTimes().Return(&models.RateLimit{Hits: 1}, nil)
+	mockSecurityRepository.EXPECT().ResetFailedLogins(gomock.Any()).Times(0)
+	mockSecurityRepository.EXPECT().RecordFailedLogin(user.ID, gomock.Any()).AnyTimes().
+		DoAndReturn(func(userID uint, at time.Time) (int, error) {
+			user.FailedLoginCount++
+			return user.FailedLoginCount, nil
+		})
+	mockSecurityRepository.EXPECT().LockUser(user.ID, gomock.Any()).Times(1).
+		DoAndReturn(func(userID uint, until time.Time) error {
+			user.LockedUntil = &until
+			return nil
+		})
+	mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).Return(nil)
+	mockMailer.EXPECT().SendMail(user.Email, gomock.Any(), gomock.Any(), "accountunlock", gomock.Any()).Times(1).Return(nil)
+
+	// a code is guessed after every login with the right password, the delays between failures are left out
+	for i := 0; i < testConfig.LoginLockoutThreshold; i++ {
+		response, err := testAuthService.LoginUser(&models.LoginRequest{Email: user.Email, Password: "password"})
+		require.Nil(t, err)
+		_, err = testAuthService.LoginWithTwoFactor(&models.TwoFactorLoginRequest{ChallengeToken: response.ChallengeToken, Code: "000000"})
+		require.Equal(t, errInvalidTwoFactor, err)
+		user.LastFailedLoginAt = nil
+	}
+
+	_, err := testAuthService.LoginUser(&models.LoginRequest{Email: user.Email, Password: "password"})
+	require.Equal(t, http.StatusLocked, err.Status)
+}
+
+func Test_ConfirmTwoFactor(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := newLoginTestUser(t)
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	_, apiErr := testAuthService.ConfirmTwoFactor(user, &models.TwoFactorConfirmRequest{Code: "123456"})
+	require.Equal(t, http.StatusBadRequest, apiErr.Status)
+
+	user.TwoFactorSecret = secret
+	_, apiErr = testAuthService.ConfirmTwoFactor(user, &models.TwoFactorConfirmRequest{Code: "000000"})
+	require.Equal(t, http.StatusBadRequest, apiErr.Status)
+
+	mockSecurityRepository.EXPECT().EnableTwoFactor(user.ID, gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(userID uint, step int64, hashes []string) error {
+			require.Len(t, hashes, models.RecoveryCodeCount)
+			return nil
+		})
+	mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).
+		DoAndReturn(func(event *models.SecurityEvent) error {
+			require.Equal(t, models.SecurityEventTwoFactorOn, event.Type)
+			return nil
+		})
+	response, apiErr := testAuthService.ConfirmTwoFactor(user, &models.TwoFactorConfirmRequest{Code: currentTwoFactorCode(t, user)})
+	require.Nil(t, apiErr)
+	require.Len(t, response.RecoveryCodes, models.RecoveryCodeCount)
+}
+
+func Test_DisableTwoFactor(t *testing.T) {
+	user := newTwoFactorTestUser(t)
+
+	testCases := []struct {
+		name        string
+		user        *models.User
+		request     *models.TwoFactorDisableRequest
+		buildStubs  func()
+		expectedErr *errors.Error
+	}{
+		{
+			name:    "password case",
+			user:    user,
+			request: &models.TwoFactorDisableRequest{Password: "password"},
+			buildStubs: func() {
+				mockSecurityRepository.EXPECT().DisableTwoFactor(user.ID).Times(1).Return(nil)
+				mockSecurityRepository.EXPECT().CreateSecurityEvent(gomock.Any()).Times(1).Return(nil)
+			},
+		},
+		{
+			name:    "wrong password case",
+			user:    user,
+			request: &models.TwoFactorDisableRequest{Password: "wrongpassword"},
+			buildStubs: func() {
+				mockSecurityRepository.EXPECT().DisableTwoFactor(gomock.Any()).Times(0)
+			},
+			expectedErr: errors.ErrInvalidPassword,
+		},
+		{
+			name:    "used recovery code case",
+			user:    user,
+			request: &models.TwoFactorDisableRequest{RecoveryCode: "abcde-fghjk"},
+			buildStubs: func() {
+				mockSecurityRepository.EXPECT().UseRecoveryCode(user.ID, hashRecoveryCode("abcde-fghjk")).Times(1).
+					Return(fmt.Errorf("could not use recovery code: %w", gorm.ErrRecordNotFound))
+				mockSecurityRepository.EXPECT().DisableTwoFactor(gomock.Any()).Times(0)
+			},
+			expectedErr: errors.New("invalid recovery code", http.StatusUnauthorized),
+		},
+		{
+			name:        "not enabled case",
+			user:        newLoginTestUser(t),
+			request:     &models.TwoFactorDisableRequest{Password: "password"},
+			buildStubs:  func() {},
+			expectedErr: errTwoFactorNotEnabled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs()
+
+			err := testAuthService.DisableTwoFactor(tc.user, tc.request)
+			require.Equal(t, tc.expectedErr, err)
+		})
+	}
+}